@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// importResult 导入结果，与服务端 /bundles/import 的响应一致
+type importResult struct {
+	Items []struct {
+		Kind    string `json:"kind"`
+		Name    string `json:"name"`
+		Action  string `json:"action"`
+		Message string `json:"message"`
+	} `json:"items"`
+	Applied bool   `json:"applied"`
+	Summary string `json:"summary"`
+}
+
+func runExport(c *client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	flows := fs.String("flows", "", "要导出的任务流ID，逗号分隔")
+	format := fs.String("format", "yaml", "导出格式：yaml 或 json")
+	passphrase := fs.String("passphrase", "", "用于加密数据源密码的密钥，缺省时不导出密码")
+	output := fs.String("o", "", "输出文件，缺省输出到标准输出")
+	parseFlags(fs, args)
+
+	var ids []int
+	for _, v := range strings.Split(*flows, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("无效的任务流ID: %s", v)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errors.New("需要通过 -flows 指定要导出的任务流ID")
+	}
+
+	var resp struct {
+		Content string `json:"content"`
+	}
+	body := map[string]any{"flow_ids": ids, "format": *format, "passphrase": *passphrase}
+	if err := c.post("/bundles/export", body, &resp); err != nil {
+		return err
+	}
+	if *output == "" {
+		fmt.Print(resp.Content)
+		return nil
+	}
+	if err := os.WriteFile(*output, []byte(resp.Content), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已导出 %d 个任务流到 %s\n", len(ids), *output)
+	return nil
+}
+
+func runImport(c *client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只显示导入计划，不写入")
+	overwrite := fs.Bool("overwrite", false, "覆盖内容不同的同名任务和任务流")
+	passphrase := fs.String("passphrase", "", "导入包中密码已加密时的密钥")
+	files := parseFlags(fs, args)
+	if len(files) != 1 {
+		return errors.New("需要指定一个导入文件，- 表示从标准输入读取")
+	}
+
+	var content []byte
+	var err error
+	if files[0] == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(files[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	var result importResult
+	body := map[string]any{
+		"content":    string(content),
+		"passphrase": *passphrase,
+		"overwrite":  *overwrite,
+		"dry_run":    *dryRun,
+	}
+	if err := c.post("/bundles/import", body, &result); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "类型\t名称\t处理\t说明")
+	for _, item := range result.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Kind, item.Name, item.Action, item.Message)
+	}
+	w.Flush()
+	fmt.Println(result.Summary)
+
+	switch {
+	case result.Applied:
+		fmt.Println("导入完成")
+	case *dryRun:
+		fmt.Println("预演模式，未写入任何数据")
+	default:
+		return errors.New("存在冲突，未导入任何数据")
+	}
+	return nil
+}
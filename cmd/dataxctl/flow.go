@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// pollInterval 等待执行完成时查询状态的间隔
+const pollInterval = 3 * time.Second
+
+// startTimeout 发起执行后等待执行记录出现的最长时间
+const startTimeout = time.Minute
+
+func runFlow(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: list、run、kill、backfill、logs")
+	}
+	switch args[0] {
+	case "list":
+		return flowList(c, args[1:])
+	case "run":
+		return flowRun(c, args[1:])
+	case "kill":
+		return flowKill(c, args[1:])
+	case "backfill":
+		return flowBackfill(c, args[1:])
+	case "logs":
+		return flowLogs(c, args[1:])
+	}
+	return fmt.Errorf("未知的子命令: flow %s", args[0])
+}
+
+func flowList(c *client, args []string) error {
+	fs := flag.NewFlagSet("flow list", flag.ExitOnError)
+	q := fs.String("q", "", "名称关键字")
+	parseFlags(fs, args)
+
+	query := url.Values{"page_size": {"200"}}
+	if *q != "" {
+		query.Set("q", *q)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t名称\tCRON\t启用\t管理来源")
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var resp struct {
+			Flows      []models.TaskFlow `json:"flows"`
+			TotalPages int               `json:"total_pages"`
+		}
+		if err := c.get("/flows", query, &resp); err != nil {
+			return err
+		}
+		for _, f := range resp.Flows {
+			enabled := "否"
+			if f.Enabled {
+				enabled = "是"
+			}
+			managed := f.ManagedBy
+			if managed == "" {
+				managed = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", f.ID, f.Name, f.CronExpr, enabled, managed)
+		}
+		if page >= resp.TotalPages {
+			break
+		}
+	}
+	return w.Flush()
+}
+
+func flowRun(c *client, args []string) error {
+	fs := flag.NewFlagSet("flow run", flag.ExitOnError)
+	date := fs.String("date", "", "业务日期 YYYY-MM-DD，缺省为前一天")
+	wait := fs.Bool("wait", false, "等待执行完成，失败时退出码为 1")
+	id, err := idArg(parseFlags(fs, args), "任务流")
+	if err != nil {
+		return err
+	}
+	if err := checkDate(*date); err != nil {
+		return err
+	}
+	return startFlow(c, id, *date, *wait)
+}
+
+// startFlow 执行任务流，wait 为 true 时跟踪执行直到结束，执行未成功时返回错误
+func startFlow(c *client, flowID int, date string, wait bool) error {
+	before := 0
+	if wait {
+		var err error
+		if before, err = latestExecution(c, flowID); err != nil {
+			return err
+		}
+	}
+	if err := c.post(fmt.Sprintf("/flows/%d/runs", flowID), runBody(date), nil); err != nil {
+		return err
+	}
+	if !wait {
+		fmt.Printf("任务流 %d 已开始执行\n", flowID)
+		return nil
+	}
+
+	execID, err := waitExecution(c, flowID, before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("任务流 %d 已开始执行，执行ID %d\n", flowID, execID)
+	status, err := showExecution(c, execID, true, false)
+	if err != nil {
+		return err
+	}
+	if status != "success" {
+		return fmt.Errorf("任务流 %d 执行%s", flowID, statusText(status))
+	}
+	return nil
+}
+
+// latestExecution 返回任务流最近一次执行的ID，没有执行记录时为 0
+func latestExecution(c *client, flowID int) (int, error) {
+	var resp models.FlowLogListResponse
+	query := url.Values{"flow_id": {strconv.Itoa(flowID)}, "page_size": {"1"}}
+	if err := c.get("/flow-logs", query, &resp); err != nil {
+		return 0, err
+	}
+	if len(resp.Logs) == 0 {
+		return 0, nil
+	}
+	return resp.Logs[0].ID, nil
+}
+
+// waitExecution 等待发起的执行在服务端创建执行记录，返回新的执行ID
+func waitExecution(c *client, flowID, before int) (int, error) {
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		id, err := latestExecution(c, flowID)
+		if err != nil {
+			return 0, err
+		}
+		if id > before {
+			return id, nil
+		}
+		time.Sleep(time.Second)
+	}
+	return 0, fmt.Errorf("等待任务流 %d 的执行记录超时", flowID)
+}
+
+// showExecution 输出执行的步骤日志。follow 为 true 时持续跟踪直到执行结束；
+// 成功步骤的日志内容只在 verbose 时输出。返回执行的最终状态。
+func showExecution(c *client, execID int, follow, verbose bool) (string, error) {
+	printed := map[int]bool{}
+	for {
+		var detail models.FlowLogDetailResponse
+		if err := c.get(fmt.Sprintf("/flow-logs/%d", execID), nil, &detail); err != nil {
+			return "", err
+		}
+		for _, step := range detail.Steps {
+			if printed[step.ID] {
+				continue
+			}
+			printed[step.ID] = true
+			printStep(step, verbose || step.Status != "success")
+		}
+
+		exec := detail.Execution
+		if exec.Status != "running" {
+			fmt.Printf("执行 %d %s，开始 %s，结束 %s\n", exec.ID, statusText(exec.Status),
+				formatTime(&exec.StartTime), formatTime(exec.EndTime))
+			return exec.Status, nil
+		}
+		if !follow {
+			fmt.Printf("执行 %d 运行中，开始 %s\n", exec.ID, formatTime(&exec.StartTime))
+			return exec.Status, nil
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// printStep 输出步骤执行结果，withLog 为 true 时同时输出日志内容
+func printStep(step models.TaskExecutionLog, withLog bool) {
+	order := 0
+	if step.StepOrder != nil {
+		order = *step.StepOrder
+	}
+	fmt.Printf("[步骤 %d] %s  %s  %s\n", order, step.TaskName, statusText(step.Status), step.Duration)
+	if withLog && strings.TrimSpace(step.LogContent) != "" {
+		fmt.Println(strings.TrimRight(step.LogContent, "\n"))
+		fmt.Println()
+	}
+}
+
+// statusText 返回执行状态的中文说明
+func statusText(status string) string {
+	switch status {
+	case "success":
+		return "成功"
+	case "failed":
+		return "失败"
+	case "killed":
+		return "已终止"
+	case "running":
+		return "运行中"
+	case "skipped":
+		return "跳过"
+	}
+	return status
+}
+
+func flowKill(c *client, args []string) error {
+	fs := flag.NewFlagSet("flow kill", flag.ExitOnError)
+	id, err := idArg(parseFlags(fs, args), "任务流")
+	if err != nil {
+		return err
+	}
+	if err := c.post(fmt.Sprintf("/flows/%d/kill", id), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("已发送终止请求，任务流 %d\n", id)
+	return nil
+}
+
+// flowBackfill 按业务日期从 from 到 to 逐天执行任务流，每天等待上一天完成后再执行
+func flowBackfill(c *client, args []string) error {
+	fs := flag.NewFlagSet("flow backfill", flag.ExitOnError)
+	from := fs.String("from", "", "开始业务日期 YYYY-MM-DD（含）")
+	to := fs.String("to", "", "结束业务日期 YYYY-MM-DD（含）")
+	keepGoing := fs.Bool("keep-going", false, "某天失败后继续执行后续日期")
+	id, err := idArg(parseFlags(fs, args), "任务流")
+	if err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("补数需要同时指定 -from 和 -to")
+	}
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		return checkDate(*from)
+	}
+	end, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		return checkDate(*to)
+	}
+	if end.Before(start) {
+		return errors.New("结束日期不能早于开始日期")
+	}
+
+	var failed []string
+	days := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		days++
+		fmt.Printf("==> 业务日期 %s\n", date)
+		if err := startFlow(c, id, date, true); err != nil {
+			fmt.Fprintf(os.Stderr, "业务日期 %s 失败: %v\n", date, err)
+			failed = append(failed, date)
+			if !*keepGoing {
+				return fmt.Errorf("补数在业务日期 %s 停止，后续日期未执行", date)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("补数完成，共 %d 天，失败 %d 天: %s", days, len(failed), strings.Join(failed, ", "))
+	}
+	fmt.Printf("补数完成，共 %d 天\n", days)
+	return nil
+}
+
+func flowLogs(c *client, args []string) error {
+	fs := flag.NewFlagSet("flow logs", flag.ExitOnError)
+	execID := fs.Int("exec", 0, "执行ID，缺省为最近一次执行")
+	follow := fs.Bool("f", false, "持续跟踪直到执行结束")
+	id, err := idArg(parseFlags(fs, args), "任务流")
+	if err != nil {
+		return err
+	}
+	if *execID == 0 {
+		if *execID, err = latestExecution(c, id); err != nil {
+			return err
+		}
+		if *execID == 0 {
+			return fmt.Errorf("任务流 %d 没有执行记录", id)
+		}
+	}
+	_, err = showExecution(c, *execID, *follow, true)
+	return err
+}
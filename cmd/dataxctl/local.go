@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/robfig/cron/v3"
+
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
+	"com.duole/datax-web-go/internal/util"
+)
+
+// runLocal 离线渲染或执行单个任务：直接读取数据库中的任务或 DataX JSON 文件，
+// 不依赖 Web 服务，也不启动调度
+func runLocal(args []string) error {
+	if len(args) == 0 || (args[0] != "render" && args[0] != "run") {
+		return errors.New("缺少子命令: render、run")
+	}
+	execute := args[0] == "run"
+
+	fs := flag.NewFlagSet("local "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "服务端配置文件，用于读取数据库连接、datax_home 和 temp_dir")
+	taskID := fs.Int("task", 0, "从数据库加载的任务ID")
+	file := fs.String("file", "", "DataX JSON 配置文件，与 -task 二选一")
+	date := fs.String("date", "", "业务日期 YYYY-MM-DD，缺省为前一天")
+	if rest := parseFlags(fs, args[1:]); len(rest) > 0 {
+		return fmt.Errorf("多余的参数: %s", strings.Join(rest, " "))
+	}
+	if (*taskID > 0) == (*file != "") {
+		return errors.New("需要指定 -task 或 -file 之一")
+	}
+	if err := checkDate(*date); err != nil {
+		return err
+	}
+	executionDate := time.Now().AddDate(0, 0, -1)
+	if *date != "" {
+		executionDate, _ = time.ParseInLocation("2006-01-02", *date, time.Local)
+	}
+
+	cfg := util.LoadConfigFromYaml(*configPath)
+	if cfg == nil {
+		return fmt.Errorf("无法加载配置文件 %s", *configPath)
+	}
+	// 执行时需要解密任务配置引用的数据源密码，或从外部密码来源读取
+	keyring, err := cfg.Secrets.Keyring()
+	if err != nil {
+		return fmt.Errorf("主密钥配置错误: %v", err)
+	}
+	datax.SetKeyring(keyring)
+	providers, err := datax.SecretProvidersFromConfig(cfg.Secrets.ProviderConfig())
+	if err != nil {
+		return fmt.Errorf("外部密钥来源配置错误: %v", err)
+	}
+	datax.SetSecretProviders(providers)
+	var db *sql.DB
+	if *taskID > 0 {
+		var err error
+		if db, err = sql.Open("mysql", cfg.DSN()); err != nil {
+			return fmt.Errorf("无法连接数据库: %v", err)
+		}
+		defer db.Close()
+		if err := db.Ping(); err != nil {
+			return fmt.Errorf("数据库连接失败: %v", err)
+		}
+	}
+	// 只用于复用执行器，不加载也不启动调度
+	sched := services.NewScheduler(db, cron.New(cron.WithSeconds()), cfg.DataxHome, cfg.TempDir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = services.WithExecutionDate(ctx, executionDate)
+
+	var config, name string
+	if *taskID > 0 {
+		var err error
+		config, err = sched.RenderTaskConfig(ctx, *taskID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("任务 %d 不存在", *taskID)
+		}
+		if err != nil {
+			return fmt.Errorf("生成配置失败: %v", err)
+		}
+		name = fmt.Sprintf("local_%d", *taskID)
+	} else {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		config = util.ProcessDatePlaceholders(string(data), executionDate)
+		name = "local"
+	}
+	fmt.Fprintf(os.Stderr, "业务日期: %s\n", executionDate.Format("2006-01-02"))
+
+	// 预演路径检查，只报告不创建
+	pv := util.NewPathValidator()
+	pv.SetDryRun(true)
+	if err := pv.ValidateDataXConfigPaths(config); err != nil {
+		return err
+	}
+	for _, check := range pv.Checks() {
+		switch {
+		case check.Err != nil:
+			fmt.Fprintf(os.Stderr, "路径 %s: 检查失败: %v\n", check.Path, check.Err)
+		case check.Exists:
+			fmt.Fprintf(os.Stderr, "路径 %s: 已存在\n", check.Path)
+		default:
+			fmt.Fprintf(os.Stderr, "路径 %s: 不存在，执行时将创建\n", check.Path)
+		}
+	}
+
+	if !execute {
+		printJSON(config)
+		return nil
+	}
+
+	// 与调度执行一致：先校验并创建路径，再调用 DataX
+	if err := util.NewPathValidator().ValidateDataXConfigPaths(config); err != nil {
+		return fmt.Errorf("路径验证失败: %v", err)
+	}
+	if err := sched.ExecuteDataX(ctx, name, config, os.Stdout); err != nil {
+		return fmt.Errorf("DataX 执行失败: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, "DataX 执行成功")
+	return nil
+}
@@ -0,0 +1,177 @@
+// dataxctl 是 DataX Web 的命令行客户端，通过 /api/v1 接口管理任务流和任务，
+// 便于值班人员在终端或堡垒机的 cron 中操作。
+//
+// 服务地址和令牌通过 -server、-token 参数或 DATAX_SERVER、DATAX_TOKEN 环境变量指定，
+// 令牌在界面的“API 令牌”页面创建。
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `用法: dataxctl [-server URL] [-token TOKEN] <命令> [参数]
+
+任务流:
+  flow list [-q 关键字]                         列出任务流
+  flow run <ID> [-date YYYY-MM-DD] [-wait]      执行任务流，-wait 等待完成并按结果设置退出码
+  flow kill <ID>                                终止正在运行的任务流
+  flow backfill <ID> -from 日期 -to 日期 [-keep-going]
+                                                按业务日期逐天补数，默认遇到失败即停止
+  flow logs <ID> [-exec 执行ID] [-f]            查看任务流最近一次（或指定）执行的步骤日志，-f 持续跟踪
+
+任务:
+  task list [-q 关键字] [-flow 任务流ID]         列出任务
+  task run <ID> [-date YYYY-MM-DD] [-wait]      执行任务
+  task render <ID> [-date YYYY-MM-DD]           输出按业务日期替换占位符后的 DataX JSON
+  task logs <ID> [-n 条数]                      查看任务最近的执行日志
+
+离线调试（直接读取数据库或文件，无需 Web 服务和令牌）:
+  local render (-task ID | -file 文件) [-date YYYY-MM-DD] [-config config.yaml]
+                                                预演路径检查并输出最终的 DataX JSON
+  local run (-task ID | -file 文件) [-date YYYY-MM-DD] [-config config.yaml]
+                                                以与调度相同的方式执行 DataX，输出实时打印
+
+数据源凭据（直接读取数据库，无需 Web 服务和令牌）:
+  secrets rotate [-dry-run] [-config config.yaml]
+                                                用当前主密钥重新加密数据源密码，并将任务配置中的内联连接信息替换为引用
+  secrets bind [-dry-run] [-config config.yaml]
+                                                将任务配置中与数据源一致的内联连接信息替换为引用，不要求配置主密钥
+
+导入导出:
+  export -flows 1,2 [-format yaml|json] [-passphrase 密钥] [-o 文件]
+  import <文件> [-dry-run] [-overwrite] [-passphrase 密钥]
+
+全局参数:
+`
+
+func main() {
+	global := flag.NewFlagSet("dataxctl", flag.ExitOnError)
+	server := global.String("server", envOr("DATAX_SERVER", "http://localhost:8080"), "服务地址，默认读取 DATAX_SERVER")
+	token := global.String("token", os.Getenv("DATAX_TOKEN"), "API 令牌，默认读取 DATAX_TOKEN")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	// 离线命令直接读取数据库，不需要服务地址和令牌
+	if args[0] == "local" || args[0] == "secrets" {
+		run := runLocal
+		if args[0] == "secrets" {
+			run = runSecrets
+		}
+		if err := run(args[1:]); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	if *token == "" {
+		fatalf("未指定 API 令牌，请使用 -token 参数或设置 DATAX_TOKEN 环境变量")
+	}
+	c := newClient(*server, *token)
+
+	var err error
+	switch args[0] {
+	case "flow":
+		err = runFlow(c, args[1:])
+	case "task":
+		err = runTask(c, args[1:])
+	case "export":
+		err = runExport(c, args[1:])
+	case "import":
+		err = runImport(c, args[1:])
+	default:
+		global.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "dataxctl: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// parseFlags 解析参数，允许参数和位置参数交错（如 run 3 -wait），返回位置参数
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// idArg 解析唯一的 ID 位置参数
+func idArg(args []string, what string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("需要指定一个%sID", what)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("无效的%sID: %s", what, args[0])
+	}
+	return id, nil
+}
+
+// checkDate 校验业务日期格式
+func checkDate(s string) error {
+	if s == "" {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		return fmt.Errorf("无效的业务日期，格式应为 YYYY-MM-DD: %s", s)
+	}
+	return nil
+}
+
+// runBody 返回执行请求体，未指定业务日期时为 nil，由服务端使用默认日期
+func runBody(date string) any {
+	if date == "" {
+		return nil
+	}
+	return map[string]string{"execution_date": date}
+}
+
+// formatTime 格式化可为空的时间
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// printJSON 格式化输出 JSON，内容不是合法 JSON 时原样输出，便于排查
+func printJSON(s string) {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(s), "", "  "); err != nil {
+		fmt.Println(s)
+		return
+	}
+	fmt.Println(strings.TrimSpace(out.String()))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
+	"com.duole/datax-web-go/internal/util"
+)
+
+// runSecrets 数据源凭据维护。rotate 用于主密钥轮换：在配置中加入新主密钥并设为当前主密钥（旧主密钥保留），
+// 执行 rotate 后即可从配置中移除旧主密钥；bind 将旧任务配置中内联的连接信息替换为数据源引用
+func runSecrets(args []string) error {
+	if len(args) == 0 || (args[0] != "rotate" && args[0] != "bind") {
+		return errors.New("缺少子命令: rotate、bind")
+	}
+	rotate := args[0] == "rotate"
+
+	fs := flag.NewFlagSet("secrets "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "服务端配置文件，用于读取数据库连接和主密钥")
+	dryRun := fs.Bool("dry-run", false, "只统计需要处理的数量，不写入数据库")
+	if rest := parseFlags(fs, args[1:]); len(rest) > 0 {
+		return fmt.Errorf("多余的参数: %s", strings.Join(rest, " "))
+	}
+
+	cfg := util.LoadConfigFromYaml(*configPath)
+	if cfg == nil {
+		return fmt.Errorf("无法加载配置文件 %s", *configPath)
+	}
+	keyring, err := cfg.Secrets.Keyring()
+	if err != nil {
+		return fmt.Errorf("主密钥配置错误: %v", err)
+	}
+	if keyring == nil && rotate {
+		return errors.New("未配置主密钥，请在 secrets.master_keys 或 DATAX_MASTER_KEYS 中指定")
+	}
+
+	db, err := sql.Open("mysql", cfg.DSN())
+	if err != nil {
+		return fmt.Errorf("无法连接数据库: %v", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("数据库连接失败: %v", err)
+	}
+
+	verb := "已"
+	if *dryRun {
+		verb = "将"
+	}
+	if !rotate {
+		// 比对内联密码时需要解密数据源密码
+		datax.SetKeyring(keyring)
+		result, err := services.BindTaskDataSourceRefs(db, *dryRun)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s将 %d 个任务中的内联连接信息替换为引用（各生成一个新版本），清除 %d 个历史版本中的内联密码\n",
+			verb, result.Tasks, result.Versions)
+		return nil
+	}
+
+	result, err := services.RotateDataSourceSecrets(db, keyring, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "当前主密钥: %s\n", keyring.ActiveKey())
+	fmt.Printf("%s重新加密 %d 个数据源密码，%s将 %d 个任务中的内联连接信息替换为引用（各生成一个新版本），清除 %d 个历史版本中的内联密码\n",
+		verb, result.DataSources, verb, result.Tasks, result.Versions)
+	return nil
+}
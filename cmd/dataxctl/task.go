@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+func runTask(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: list、run、render、logs")
+	}
+	switch args[0] {
+	case "list":
+		return taskList(c, args[1:])
+	case "run":
+		return taskRun(c, args[1:])
+	case "render":
+		return taskRender(c, args[1:])
+	case "logs":
+		return taskLogs(c, args[1:])
+	}
+	return fmt.Errorf("未知的子命令: task %s", args[0])
+}
+
+func taskList(c *client, args []string) error {
+	fs := flag.NewFlagSet("task list", flag.ExitOnError)
+	q := fs.String("q", "", "名称关键字")
+	flowID := fs.Int("flow", 0, "只列出该任务流引用的任务")
+	parseFlags(fs, args)
+
+	query := url.Values{"page_size": {"200"}}
+	if *q != "" {
+		query.Set("q", *q)
+	}
+	if *flowID > 0 {
+		query.Set("flow_id", strconv.Itoa(*flowID))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t名称\t源\t目标\t增量列\t版本")
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var resp struct {
+			Tasks      []models.Task `json:"tasks"`
+			TotalPages int           `json:"total_pages"`
+		}
+		if err := c.get("/tasks", query, &resp); err != nil {
+			return err
+		}
+		for _, t := range resp.Tasks {
+			incr := t.IncrColumn
+			if incr == "" {
+				incr = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\n", t.ID, t.Name, t.Source, t.Target, incr, t.Version)
+		}
+		if page >= resp.TotalPages {
+			break
+		}
+	}
+	return w.Flush()
+}
+
+func taskRun(c *client, args []string) error {
+	fs := flag.NewFlagSet("task run", flag.ExitOnError)
+	date := fs.String("date", "", "业务日期 YYYY-MM-DD，缺省为前一天")
+	wait := fs.Bool("wait", false, "等待执行完成，失败时退出码为 1")
+	id, err := idArg(parseFlags(fs, args), "任务")
+	if err != nil {
+		return err
+	}
+	if err := checkDate(*date); err != nil {
+		return err
+	}
+
+	before := 0
+	if *wait {
+		last, err := latestTaskLog(c, id)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			before = last.ID
+		}
+	}
+	if err := c.post(fmt.Sprintf("/tasks/%d/runs", id), runBody(*date), nil); err != nil {
+		return err
+	}
+	fmt.Printf("任务 %d 已开始执行\n", id)
+	if !*wait {
+		return nil
+	}
+
+	// 任务日志在执行结束后写入，出现新日志即表示执行完成
+	for {
+		entry, err := latestTaskLog(c, id)
+		if err != nil {
+			return err
+		}
+		if entry != nil && entry.ID > before {
+			printTaskLog(*entry, entry.Status != "success")
+			if entry.Status != "success" {
+				return fmt.Errorf("任务 %d 执行%s", id, statusText(entry.Status))
+			}
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// latestTaskLog 返回任务最近一条执行日志，没有日志时为 nil
+func latestTaskLog(c *client, taskID int) (*models.TaskExecutionLog, error) {
+	var resp models.TaskLogListResponse
+	query := url.Values{"task_id": {strconv.Itoa(taskID)}, "page_size": {"1"}}
+	if err := c.get("/task-logs", query, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Logs) == 0 {
+		return nil, nil
+	}
+	return &resp.Logs[0], nil
+}
+
+// printTaskLog 输出一条任务执行日志，withLog 为 true 时同时输出日志内容
+func printTaskLog(entry models.TaskExecutionLog, withLog bool) {
+	fmt.Printf("[日志 %d] %s  %s  开始 %s  %s\n", entry.ID, entry.TaskName, statusText(entry.Status),
+		formatTime(&entry.StartTime), entry.Duration)
+	if withLog && strings.TrimSpace(entry.LogContent) != "" {
+		fmt.Println(strings.TrimRight(entry.LogContent, "\n"))
+		fmt.Println()
+	}
+}
+
+func taskRender(c *client, args []string) error {
+	fs := flag.NewFlagSet("task render", flag.ExitOnError)
+	date := fs.String("date", "", "业务日期 YYYY-MM-DD，缺省为前一天")
+	id, err := idArg(parseFlags(fs, args), "任务")
+	if err != nil {
+		return err
+	}
+	if err := checkDate(*date); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *date != "" {
+		query.Set("date", *date)
+	}
+	var resp struct {
+		JSONConfig string `json:"json_config"`
+	}
+	if err := c.get(fmt.Sprintf("/tasks/%d/render", id), query, &resp); err != nil {
+		return err
+	}
+	printJSON(resp.JSONConfig)
+	return nil
+}
+
+func taskLogs(c *client, args []string) error {
+	fs := flag.NewFlagSet("task logs", flag.ExitOnError)
+	n := fs.Int("n", 1, "显示最近的条数")
+	id, err := idArg(parseFlags(fs, args), "任务")
+	if err != nil {
+		return err
+	}
+	if *n < 1 {
+		*n = 1
+	}
+
+	var resp models.TaskLogListResponse
+	query := url.Values{"task_id": {strconv.Itoa(id)}, "page_size": {strconv.Itoa(*n)}}
+	if err := c.get("/task-logs", query, &resp); err != nil {
+		return err
+	}
+	if len(resp.Logs) == 0 {
+		return fmt.Errorf("任务 %d 没有执行日志", id)
+	}
+	// 列表按时间倒序返回，按时间正序输出使最近一条位于末尾
+	for i := len(resp.Logs) - 1; i >= 0; i-- {
+		printTaskLog(resp.Logs[i], true)
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 
 	"com.duole/datax-web-go/internal/controllers"
 	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
 	"com.duole/datax-web-go/internal/util"
 )
 
@@ -22,9 +23,7 @@ import (
 // 它设置合理的连接池大小并 ping 数据库以确保
 // 连接性。如果无法建立连接，程序将终止。
 func setupDatabase(cfg *util.Config) *sql.DB {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4&loc=Asia%%2FShanghai",
-		cfg.DBUser, cfg.DBPass, cfg.DBHost, cfg.DBPort, cfg.DBName)
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
 		log.Fatalf("无法连接数据库: %v", err)
 	}
@@ -43,14 +42,35 @@ func setupDatabase(cfg *util.Config) *sql.DB {
 // 用户、工具和监控的处理器。在必要时应用
 // 认证和授权的中间件。
 func setupRouter(ct *controllers.Controller) *gin.Engine {
-	r := gin.Default()
+	r, err := ct.NewEngine()
+	if err != nil {
+		log.Fatalf("trusted_proxies 配置错误: %v", err)
+	}
 	// 加载模板
 	r.LoadHTMLGlob("templates/**/*")
 	// 提供静态文件
 	r.Static("/static", "./static")
+	// 所有修改数据的请求都要校验 CSRF 令牌，静态文件之后注册，避免为静态资源创建会话
+	r.Use(ct.CSRF())
+	// 项目权限：要求当前用户在 :id 所指对象所属的项目中至少具有相应角色
+	viewTask := ct.MustProjectRole(controllers.ResTask, services.ProjectViewer)
+	runTask := ct.MustProjectRole(controllers.ResTask, services.ProjectOperator)
+	editTask := ct.MustProjectRole(controllers.ResTask, services.ProjectEditor)
+	viewFlow := ct.MustProjectRole(controllers.ResFlow, services.ProjectViewer)
+	runFlow := ct.MustProjectRole(controllers.ResFlow, services.ProjectOperator)
+	editFlow := ct.MustProjectRole(controllers.ResFlow, services.ProjectEditor)
+	viewDS := ct.MustProjectRole(controllers.ResDataSource, services.ProjectViewer)
+	editDS := ct.MustProjectRole(controllers.ResDataSource, services.ProjectEditor)
+	viewFlowLog := ct.MustProjectRole(controllers.ResFlowExecution, services.ProjectViewer)
+	viewTaskLog := ct.MustProjectRole(controllers.ResTaskLog, services.ProjectViewer)
+
 	// 认证路由
 	r.GET("/login", ct.ShowLogin)
 	r.POST("/login", ct.DoLogin)
+	r.GET("/login/2fa", ct.ShowTwoFactor)
+	r.POST("/login/2fa", ct.DoTwoFactor)
+	r.GET("/login/oidc", ct.OIDCLogin)
+	r.GET("/login/oidc/callback", ct.OIDCCallback)
 	r.GET("/logout", ct.Logout)
 	// 根路径重定向到任务
 	r.GET("/", ct.MustLogin(), func(c *gin.Context) {
@@ -59,30 +79,40 @@ func setupRouter(ct *controllers.Controller) *gin.Engine {
 	// 任务管理
 	r.GET("/tasks", ct.MustLogin(), ct.TaskList)
 	r.GET("/tasks/new", ct.MustLogin(), ct.TaskNewForm)
+	r.GET("/tasks/bulk", ct.MustLogin(), ct.TaskBulkForm)
 	r.POST("/tasks", ct.MustLogin(), ct.TaskCreate)
-	r.GET("/tasks/:id", ct.MustLogin(), ct.TaskManage)
-	r.POST("/tasks/:id", ct.MustLogin(), ct.TaskUpdateJson)
-	r.DELETE("/tasks/:id", ct.MustLogin(), ct.TaskDelete)
-	r.POST("/tasks/:id/run", ct.MustLogin(), ct.TaskRunNow)
+	r.GET("/tasks/:id", ct.MustLogin(), viewTask, ct.TaskManage)
+	r.POST("/tasks/:id", ct.MustLogin(), editTask, ct.TaskUpdateJson)
+	r.DELETE("/tasks/:id", ct.MustLogin(), editTask, ct.TaskDelete)
+	r.POST("/tasks/:id/run", ct.MustLogin(), runTask, ct.TaskRunNow)
+	r.POST("/tasks/:id/incremental", ct.MustLogin(), editTask, ct.TaskSetIncremental)
+	r.POST("/tasks/:id/watermark", ct.MustLogin(), editTask, ct.TaskResetWatermark)
+	r.POST("/tasks/:id/reconcile", ct.MustLogin(), editTask, ct.TaskSetReconcile)
+	r.GET("/tasks/:id/versions", ct.MustLogin(), viewTask, ct.TaskVersionList)
+	r.GET("/tasks/:id/versions/diff", ct.MustLogin(), viewTask, ct.TaskVersionDiff)
+	r.POST("/tasks/:id/versions/:version/rollback", ct.MustLogin(), editTask, ct.TaskVersionRollback)
 	// 任务流管理（带调度）
 	r.GET("/task-flows", ct.MustLogin(), ct.TaskFlowList)
 	r.GET("/task-flows/new", ct.MustLogin(), ct.TaskFlowNewForm)
 	r.POST("/task-flows", ct.MustLogin(), ct.TaskFlowCreate)
-	r.GET("/task-flows/:id", ct.MustLogin(), ct.TaskFlowProperties) // 直接到属性页
-	r.GET("/task-flows/:id/flow", ct.MustLogin(), ct.TaskFlowFlow)
-	r.POST("/task-flows/:id", ct.MustLogin(), ct.TaskFlowUpdate)
-	r.DELETE("/task-flows/:id", ct.MustLogin(), ct.TaskFlowDelete)
-	r.POST("/task-flows/:id/run", ct.MustLogin(), ct.TaskFlowRunNow)
-	r.POST("/task-flows/:id/toggle", ct.MustLogin(), ct.TaskFlowToggle)
-	r.POST("/task-flows/:id/kill", ct.MustLogin(), ct.TaskFlowKill)
-	r.POST("/task-flows/:id/steps", ct.MustLogin(), ct.TaskFlowAddStep)
-	r.DELETE("/task-flows/:id/steps/:step_id", ct.MustLogin(), ct.TaskFlowRemoveStep)
-	r.PUT("/task-flows/:id/steps/reorder", ct.MustLogin(), ct.TaskFlowReorderSteps)
+	r.POST("/task-flows/export", ct.MustLogin(), ct.TaskFlowExport)
+	r.GET("/task-flows/import", ct.MustLogin(), ct.TaskFlowImportForm)
+	r.POST("/task-flows/import", ct.MustLogin(), ct.TaskFlowImport)
+	r.GET("/task-flows/:id", ct.MustLogin(), viewFlow, ct.TaskFlowProperties) // 直接到属性页
+	r.GET("/task-flows/:id/flow", ct.MustLogin(), viewFlow, ct.TaskFlowFlow)
+	r.POST("/task-flows/:id", ct.MustLogin(), editFlow, ct.TaskFlowUpdate)
+	r.DELETE("/task-flows/:id", ct.MustLogin(), editFlow, ct.TaskFlowDelete)
+	r.POST("/task-flows/:id/run", ct.MustLogin(), runFlow, ct.TaskFlowRunNow)
+	r.POST("/task-flows/:id/toggle", ct.MustLogin(), editFlow, ct.TaskFlowToggle)
+	r.POST("/task-flows/:id/kill", ct.MustLogin(), runFlow, ct.TaskFlowKill)
+	r.POST("/task-flows/:id/steps", ct.MustLogin(), editFlow, ct.TaskFlowAddStep)
+	r.DELETE("/task-flows/:id/steps/:step_id", ct.MustLogin(), editFlow, ct.TaskFlowRemoveStep)
+	r.PUT("/task-flows/:id/steps/reorder", ct.MustLogin(), editFlow, ct.TaskFlowReorderSteps)
 	// 数据源管理
 	r.GET("/data-sources", ct.MustLogin(), ct.DSList)
 	r.POST("/data-sources", ct.MustLogin(), ct.DSCreate)
 	// 支持内联编辑的 JSON 获取：/data-sources/:id?format=json
-	r.GET("/data-sources/:id", ct.MustLogin(), func(c *gin.Context) {
+	r.GET("/data-sources/:id", ct.MustLogin(), viewDS, func(c *gin.Context) {
 		if c.Query("format") == "json" {
 			ct.DSGetOneJSON(c)
 			return
@@ -90,16 +120,38 @@ func setupRouter(ct *controllers.Controller) *gin.Engine {
 		// 默认重定向到列表页
 		c.Redirect(302, "/data-sources")
 	})
-	r.POST("/data-sources/:id", ct.MustLogin(), ct.DSUpdate)
-	r.DELETE("/data-sources/:id", ct.MustLogin(), ct.DSDelete)
+	r.POST("/data-sources/:id", ct.MustLogin(), editDS, ct.DSUpdate)
+	r.DELETE("/data-sources/:id", ct.MustLogin(), editDS, ct.DSDelete)
 	r.POST("/data-sources/test", ct.MustLogin(), ct.DSConnTest)
 	// 元数据 API
-	r.GET("/api/meta/mysql/:id/columns/:table", ct.MustLogin(), ct.MetaColumns)
+	r.GET("/api/meta/mysql/:id/columns/:table", ct.MustLogin(), viewDS, ct.MetaColumns)
 	// 用户管理（仅管理员）
 	r.GET("/admin/users", ct.MustLogin(), ct.MustAdmin(), ct.UserList)
 	r.GET("/admin/users/new", ct.MustLogin(), ct.MustAdmin(), ct.UserNewForm)
 	r.POST("/admin/users", ct.MustLogin(), ct.MustAdmin(), ct.UserCreate)
+	r.GET("/admin/users/:id/edit", ct.MustLogin(), ct.MustAdmin(), ct.UserEditForm)
+	r.POST("/admin/users/:id", ct.MustLogin(), ct.MustAdmin(), ct.UserUpdate)
+	r.DELETE("/admin/users/:id", ct.MustLogin(), ct.MustAdmin(), ct.UserDelete)
 	r.POST("/admin/users/:id/toggle", ct.MustLogin(), ct.MustAdmin(), ct.UserToggle)
+	r.POST("/admin/users/:id/reset-password", ct.MustLogin(), ct.MustAdmin(), ct.UserResetPassword)
+	r.POST("/admin/users/:id/reset-2fa", ct.MustLogin(), ct.MustAdmin(), ct.UserResetTwoFactor)
+	// 登录会话（仅管理员）
+	r.GET("/admin/sessions", ct.MustLogin(), ct.MustAdmin(), ct.SessionList)
+	r.POST("/admin/sessions/:id/revoke", ct.MustLogin(), ct.MustAdmin(), ct.SessionRevoke)
+	// 项目管理（仅管理员）
+	r.GET("/admin/projects", ct.MustLogin(), ct.MustAdmin(), ct.ProjectList)
+	r.POST("/admin/projects", ct.MustLogin(), ct.MustAdmin(), ct.ProjectCreate)
+	r.GET("/admin/projects/:id", ct.MustLogin(), ct.MustAdmin(), ct.ProjectMembers)
+	r.DELETE("/admin/projects/:id", ct.MustLogin(), ct.MustAdmin(), ct.ProjectDelete)
+	r.POST("/admin/projects/:id/members", ct.MustLogin(), ct.MustAdmin(), ct.ProjectSetMember)
+	r.DELETE("/admin/projects/:id/members/:user_id", ct.MustLogin(), ct.MustAdmin(), ct.ProjectRemoveMember)
+
+	// Git 同步（仅管理员）
+	r.GET("/admin/gitops", ct.MustLogin(), ct.MustAdmin(), ct.GitOpsPlan)
+	r.POST("/admin/gitops/sync", ct.MustLogin(), ct.MustAdmin(), ct.GitOpsSync)
+
+	r.GET("/admin/audit", ct.MustLogin(), ct.MustAdmin(), ct.AuditList)
+
 	// 工具：JSON 格式化页面
 	r.GET("/tools/json-format", ct.MustLogin(), func(c *gin.Context) {
 		c.HTML(http.StatusOK, "tools/json-format.tmpl", gin.H{})
@@ -107,14 +159,33 @@ func setupRouter(ct *controllers.Controller) *gin.Engine {
 	// 流程日志
 	r.GET("/flow-logs", ct.MustLogin(), ct.FlowLogList)
 	r.GET("/api/flow-logs", ct.MustLogin(), ct.GetFlowLogs)
-	r.GET("/api/flow-logs/:id", ct.MustLogin(), ct.GetFlowLogDetail)
+	r.GET("/api/flow-logs/:id", ct.MustLogin(), viewFlowLog, ct.GetFlowLogDetail)
 	// 任务日志
 	r.GET("/task-logs", ct.MustLogin(), ct.TaskLogList)
-	r.GET("/task-logs/:id", ct.MustLogin(), ct.TaskLogDetail)
+	r.GET("/task-logs/:id", ct.MustLogin(), viewTaskLog, ct.TaskLogDetail)
 	r.GET("/api/task-logs", ct.MustLogin(), ct.GetTaskLogs)
-	r.GET("/api/task-logs/:id", ct.MustLogin(), ct.GetTaskLogDetail)
+	r.GET("/api/task-logs/:id", ct.MustLogin(), viewTaskLog, ct.GetTaskLogDetail)
 	// DataX 预览
 	r.POST("/api/datax/preview", ct.MustLogin(), ct.DataXPreview)
+	// 批量生成任务
+	r.POST("/api/tasks/bulk/preview", ct.MustLogin(), ct.TaskBulkPreview)
+	r.POST("/api/tasks/bulk", ct.MustLogin(), ct.TaskBulkCreate)
+	// 修改密码
+	r.GET("/account/password", ct.MustLogin(), ct.PasswordForm)
+	r.POST("/account/password", ct.MustLogin(), ct.PasswordChange)
+	// 两步验证
+	r.GET("/account/2fa", ct.MustLogin(), ct.TwoFactorForm)
+	r.POST("/account/2fa", ct.MustLogin(), ct.TwoFactorEnable)
+	r.POST("/account/2fa/disable", ct.MustLogin(), ct.TwoFactorDisable)
+	r.POST("/account/2fa/recovery-codes", ct.MustLogin(), ct.TwoFactorRecoveryCodes)
+	// API 令牌
+	r.GET("/account/tokens", ct.MustLogin(), ct.TokenList)
+	r.POST("/account/tokens", ct.MustLogin(), ct.TokenCreate)
+	r.POST("/account/tokens/:id/revoke", ct.MustLogin(), ct.TokenRevoke)
+	// OpenAPI 文档（无需登录）
+	r.GET("/api/openapi.json", ct.OpenAPISpec)
+	// REST API v1：支持 Bearer 令牌或浏览器会话认证
+	ct.RegisterAPIRoutes(r.Group("/api/v1", ct.MustAPILogin()))
 	return r
 }
 
@@ -129,14 +200,62 @@ func main() {
 
 	// 从YAML文件加载配置
 	cfg := util.LoadConfigFromYaml(configPath)
+	// 数据源密码的主密钥，未配置时密码以明文保存
+	keyring, err := cfg.Secrets.Keyring()
+	if err != nil {
+		log.Fatalf("主密钥配置错误: %v", err)
+	}
+	if keyring == nil {
+		log.Printf("warning: secrets.master_keys is not configured, data source passwords are stored in plaintext")
+	}
+	datax.SetKeyring(keyring)
+	// 数据源的外部密码来源
+	providers, err := datax.SecretProvidersFromConfig(cfg.Secrets.ProviderConfig())
+	if err != nil {
+		log.Fatalf("外部密钥来源配置错误: %v", err)
+	}
+	datax.SetSecretProviders(providers)
 	// Connect to DB
 	db := setupDatabase(cfg)
 	// Set up session store using a secret key from config
 	store := sessions.NewCookieStore([]byte(cfg.SessionKey))
 	// Create services
-	auth := services.NewAuthService(db, store)
+	authenticators, err := services.NewAuthenticators(db, cfg)
+	if err != nil {
+		log.Fatalf("认证配置错误: %v", err)
+	}
+	auth := services.NewAuthService(db, store, authenticators...)
+	if cfg.OIDC.Issuer != "" {
+		provider, err := services.NewOIDCProvider(cfg.OIDC)
+		if err != nil {
+			log.Fatalf("单点登录配置错误: %v", err)
+		}
+		auth.SetOIDC(provider)
+	}
+	for _, role := range cfg.TwoFactor.RequiredRoles {
+		if role != "admin" && role != "user" {
+			log.Fatalf("两步验证配置错误: 无效的角色 %s", role)
+		}
+	}
+	auth.SetTwoFactorRoles(cfg.TwoFactor.RequiredRoles)
+	if err := cfg.PasswordPolicy.Validate(); err != nil {
+		log.Fatalf("密码策略配置错误: %v", err)
+	}
+	auth.SetLoginThrottle(services.NewLoginThrottle(db, cfg.Lockout))
 	c := cron.New(cron.WithSeconds())
 	sched := services.NewScheduler(db, c, cfg.DataxHome, cfg.TempDir)
+	shellRunner, err := services.NewShellRunner(cfg.ShellSteps)
+	if err != nil {
+		log.Fatalf("Shell 步骤配置错误: %v", err)
+	}
+	if !shellRunner.Sandboxed() && cfg.ShellSteps.AllowUnsandboxed {
+		log.Printf("warning: shell_steps.allow_unsandboxed is enabled, shell steps run as the service user")
+	}
+	sched.SetShellRunner(shellRunner)
+	// 在加载调度前从 Git 目录同步任务流，使调度使用同步后的定义
+	if cfg.GitOpsSyncOnStartup {
+		services.SyncGitOpsOnStartup(db, cfg.GitOpsDir, cfg.GitOpsAllowShell)
+	}
 	// Initialize scheduler (handles both task execution and task flow scheduling)
 	sched.LoadAndStart()
 	// Create controller
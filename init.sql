@@ -15,6 +15,15 @@ CREATE TABLE IF NOT EXISTS `users`
     `password`   VARCHAR(255)          NOT NULL COMMENT '密码，BCrypt加密存储',
     `role`       ENUM ('admin','user') NOT NULL DEFAULT 'user' COMMENT '用户角色：admin管理员，user普通用户',
     `disabled`   TINYINT(1)            NOT NULL DEFAULT 0 COMMENT '是否禁用：0启用，1禁用',
+    `auth_source` VARCHAR(20)          NOT NULL DEFAULT 'local' COMMENT '账户来源：local本地账户，ldap/oidc首次登录时自动开通的LDAP或单点登录账户',
+    `must_change_password` TINYINT(1)  NOT NULL DEFAULT 0 COMMENT '下次登录时是否必须修改密码：管理员重置密码后为1',
+    `password_changed_at`  TIMESTAMP   NULL     DEFAULT NULL COMMENT '最近修改密码时间',
+    `display_name` VARCHAR(100)        NOT NULL DEFAULT '' COMMENT '显示名称',
+    `email`        VARCHAR(255)        NOT NULL DEFAULT '' COMMENT '邮箱',
+    `deleted_at`   TIMESTAMP           NULL     DEFAULT NULL COMMENT '删除时间，非空表示已删除（软删除，保留用户名供审计追溯）',
+    `totp_secret`  VARCHAR(64)         NOT NULL DEFAULT '' COMMENT '两步验证（TOTP）密钥，Base32编码；totp_enabled为0时表示尚未确认',
+    `totp_enabled` TINYINT(1)          NOT NULL DEFAULT 0 COMMENT '是否已启用两步验证',
+    `totp_last_step` BIGINT            NOT NULL DEFAULT 0 COMMENT '最近一次使用的验证码周期序号，防止验证码重放',
     `created_by` INT                            DEFAULT NULL COMMENT '创建者用户ID',
     `updated_by` INT                            DEFAULT NULL COMMENT '更新者用户ID',
     `created_at` TIMESTAMP             NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
@@ -22,8 +31,106 @@ CREATE TABLE IF NOT EXISTS `users`
 ) ENGINE = InnoDB
   DEFAULT CHARSET = utf8mb4;
 
-INSERT INTO `users` (`username`, `password`, `role`)
-VALUES ('admin', '$2a$10$p/Yw3z/8VnHL7t84oRhg5upY2bY6sJxhS3OMeEvkLckR2Brkuzg/y', 'admin');
+-- 初始管理员 admin/admin，首次登录时必须修改密码
+INSERT INTO `users` (`username`, `password`, `role`, `must_change_password`)
+VALUES ('admin', '$2a$10$p/Yw3z/8VnHL7t84oRhg5upY2bY6sJxhS3OMeEvkLckR2Brkuzg/y', 'admin', 1);
+
+
+-- API 令牌表 - 存储用户的个人 API 令牌，仅保存 SHA-256 哈希
+DROP TABLE IF EXISTS `api_tokens`;
+CREATE TABLE `api_tokens`
+(
+    `id`           INT AUTO_INCREMENT PRIMARY KEY COMMENT '令牌ID，主键',
+    `user_id`      BIGINT UNSIGNED NOT NULL COMMENT '所属用户ID，关联users表',
+    `name`         VARCHAR(100)    NOT NULL COMMENT '令牌名称，便于识别用途',
+    `token_hash`   CHAR(64)        NOT NULL COMMENT '令牌的SHA-256哈希（十六进制），明文只在创建时显示一次',
+    `token_prefix` VARCHAR(16)     NOT NULL COMMENT '令牌前缀，用于在列表中识别令牌',
+    `expires_at`   TIMESTAMP       NULL DEFAULT NULL COMMENT '过期时间，NULL表示不过期',
+    `last_used_at` TIMESTAMP       NULL DEFAULT NULL COMMENT '最近使用时间',
+    `created_at`   TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    UNIQUE KEY `uk_token_hash` (`token_hash`),
+    KEY `idx_user` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
+-- 登录会话表 - 服务端保存的浏览器会话，Cookie 中只保存会话令牌，删除记录即强制下线
+DROP TABLE IF EXISTS `user_sessions`;
+CREATE TABLE `user_sessions`
+(
+    `id`           INT AUTO_INCREMENT PRIMARY KEY COMMENT '会话ID，主键',
+    `user_id`      BIGINT UNSIGNED NOT NULL COMMENT '所属用户ID，关联users表',
+    `token_hash`   CHAR(64)        NOT NULL COMMENT '会话令牌的SHA-256哈希（十六进制），明文只保存在Cookie中',
+    `ip`           VARCHAR(45)     NOT NULL DEFAULT '' COMMENT '登录时的客户端IP',
+    `user_agent`   VARCHAR(255)    NOT NULL DEFAULT '' COMMENT '登录时的浏览器标识',
+    `created_at`   TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '登录时间',
+    `last_seen_at` TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '最近活动时间，约每分钟更新一次',
+    `expires_at`   TIMESTAMP       NOT NULL COMMENT '过期时间',
+    UNIQUE KEY `uk_token_hash` (`token_hash`),
+    KEY `idx_user` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
+-- 两步验证恢复码表 - 丢失验证器设备时代替动态验证码登录，每个恢复码只能使用一次，仅保存 SHA-256 哈希
+DROP TABLE IF EXISTS `user_recovery_codes`;
+CREATE TABLE `user_recovery_codes`
+(
+    `id`         INT AUTO_INCREMENT PRIMARY KEY COMMENT '恢复码ID，主键',
+    `user_id`    BIGINT UNSIGNED NOT NULL COMMENT '所属用户ID，关联users表',
+    `code_hash`  CHAR(64)        NOT NULL COMMENT '恢复码的SHA-256哈希（十六进制），明文只在生成时显示一次',
+    `used_at`    TIMESTAMP       NULL DEFAULT NULL COMMENT '使用时间，NULL表示未使用',
+    `created_at` TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '生成时间',
+    KEY `idx_user` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
+-- 登录失败计数表 - 按账户和来源IP统计窗口期内的登录失败次数，达到上限后临时锁定
+DROP TABLE IF EXISTS `login_failures`;
+CREATE TABLE `login_failures`
+(
+    `scope`        VARCHAR(10)  NOT NULL COMMENT '计数维度：user按账户（小写用户名），ip按来源IP',
+    `login_key`    VARCHAR(255) NOT NULL COMMENT '用户名或IP',
+    `failures`     INT          NOT NULL DEFAULT 0 COMMENT '窗口期内的失败次数',
+    `window_start` TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '窗口期开始时间，即窗口内第一次失败的时间',
+    `locked_until` TIMESTAMP    NULL DEFAULT NULL COMMENT '锁定截止时间，NULL表示未锁定',
+    PRIMARY KEY (`scope`, `login_key`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
+-- 项目表 - 数据源、任务和任务流归属于项目，用户按项目授权
+-- 默认项目（ID为1）用于存放未指定项目的对象
+DROP TABLE IF EXISTS `projects`;
+CREATE TABLE `projects`
+(
+    `id`          INT AUTO_INCREMENT PRIMARY KEY COMMENT '项目ID，主键',
+    `name`        VARCHAR(100) NOT NULL UNIQUE COMMENT '项目名称，唯一',
+    `description` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '项目描述',
+    `created_by`  INT       DEFAULT NULL COMMENT '创建者用户ID',
+    `created_at`  TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `updated_at`  TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间'
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+INSERT INTO `projects` (`id`, `name`, `description`)
+VALUES (1, 'default', '默认项目');
+
+
+-- 项目成员表 - 用户在项目中的角色，管理员不需要授权即可访问所有项目
+DROP TABLE IF EXISTS `project_members`;
+CREATE TABLE `project_members`
+(
+    `project_id` INT                                   NOT NULL COMMENT '项目ID，关联projects表',
+    `user_id`    BIGINT UNSIGNED                       NOT NULL COMMENT '用户ID，关联users表',
+    `role`       ENUM ('viewer','operator','editor')   NOT NULL DEFAULT 'viewer' COMMENT '项目角色：viewer只读，operator可执行和终止，editor可编辑和删除',
+    `created_by` INT       DEFAULT NULL COMMENT '授权者用户ID',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '授权时间',
+    PRIMARY KEY (`project_id`, `user_id`),
+    KEY `idx_user` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
 
 
 -- 数据源表 - 存储各种类型的数据源连接信息
@@ -32,11 +139,13 @@ CREATE TABLE `data_sources`
 (
     `id`           INT AUTO_INCREMENT PRIMARY KEY COMMENT '数据源ID，主键',
     `name`         VARCHAR(100)                       NOT NULL COMMENT '数据源名称',
+    `project_id`   INT NOT NULL DEFAULT 1 COMMENT '所属项目ID，关联projects表',
     `type`         ENUM ('mysql','ofs','hdfs','cosn') NOT NULL COMMENT '数据源类型：mysql数据库，ofs对象存储，hdfs分布式文件系统，cosn腾讯云对象存储',
     -- MySQL fields
     `db_url`       VARCHAR(255) DEFAULT NULL COMMENT '数据库连接URL，仅MySQL类型使用',
     `db_user`      VARCHAR(50)  DEFAULT NULL COMMENT '数据库用户名，仅MySQL类型使用',
-    `db_password`  VARCHAR(100) DEFAULT NULL COMMENT '数据库密码，仅MySQL类型使用',
+    `db_password`  VARCHAR(512) DEFAULT NULL COMMENT '数据库密码，仅MySQL类型使用；配置主密钥后保存信封加密的密文',
+    `db_password_ref` VARCHAR(255) DEFAULT NULL COMMENT '外部密码来源，如 env:变量名、file:文件名、vault:路径#字段；设置后忽略 db_password，仅MySQL类型使用',
     `db_database`  VARCHAR(100) DEFAULT NULL COMMENT '数据库名称，仅MySQL类型使用',
     -- Unified Hadoop-compatible storage config
     `defaultfs`    VARCHAR(255) DEFAULT NULL COMMENT 'Hadoop默认文件系统地址，用于HDFS/OFS/COSN类型',
@@ -55,9 +164,15 @@ CREATE TABLE `tasks`
 (
     `id`          INT AUTO_INCREMENT PRIMARY KEY COMMENT '任务ID，主键',
     `name`        VARCHAR(100) NOT NULL COMMENT '任务名称',
+    `project_id`  INT          NOT NULL DEFAULT 1 COMMENT '所属项目ID，关联projects表',
     `source_id`   INT          NOT NULL COMMENT '源数据源ID，关联data_sources表',
     `target_id`   INT          NOT NULL COMMENT '目标数据源ID，关联data_sources表',
     `json_config` MEDIUMTEXT COMMENT 'DataX任务配置JSON，包含reader和writer配置',
+    `current_version` INT NOT NULL DEFAULT 0 COMMENT '当前配置版本号，关联task_versions表',
+    `incr_column` VARCHAR(100) DEFAULT NULL COMMENT '增量列（如updated_at或自增ID），为空表示全量同步',
+    `reconcile_enabled`   TINYINT(1) NOT NULL DEFAULT 0 COMMENT '是否在执行后对账：1对账，0不对账',
+    `reconcile_tolerance` INT        NOT NULL DEFAULT 0 COMMENT '对账允许的行数差异，超过则任务流失败',
+    `managed_by`  VARCHAR(32)  DEFAULT NULL COMMENT '管理来源：gitops表示由Git目录同步管理（界面只读），NULL表示在界面维护',
     `created_by`  INT      DEFAULT NULL COMMENT '创建者用户ID',
     `updated_by`  INT      DEFAULT NULL COMMENT '更新者用户ID',
     `created_at`  TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
@@ -66,13 +181,42 @@ CREATE TABLE `tasks`
   DEFAULT CHARSET = utf8mb4;
 
 
+-- 任务配置版本表 - 每次保存任务配置生成一个不可变版本
+DROP TABLE IF EXISTS `task_versions`;
+CREATE TABLE `task_versions`
+(
+    `id`          INT AUTO_INCREMENT PRIMARY KEY COMMENT '版本记录ID，主键',
+    `task_id`     INT          NOT NULL COMMENT '任务ID，关联tasks表',
+    `version`     INT          NOT NULL COMMENT '版本号，每个任务从1开始递增',
+    `json_config` MEDIUMTEXT   NOT NULL COMMENT '该版本的DataX任务配置JSON',
+    `comment`     VARCHAR(255) NOT NULL DEFAULT '' COMMENT '变更说明',
+    `created_by`  INT       DEFAULT NULL COMMENT '保存该版本的用户ID',
+    `created_at`  TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    UNIQUE KEY `uk_task_version` (`task_id`, `version`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
+-- 任务增量水位表 - 存储每个增量任务最近一次成功同步的高水位
+DROP TABLE IF EXISTS `task_watermarks`;
+CREATE TABLE `task_watermarks`
+(
+    `task_id`     INT          NOT NULL PRIMARY KEY COMMENT '任务ID，关联tasks表',
+    `incr_column` VARCHAR(100) NOT NULL COMMENT '水位对应的增量列',
+    `watermark`   VARCHAR(64)  NOT NULL COMMENT '最近一次成功同步的增量列最大值',
+    `updated_by`  INT       DEFAULT NULL COMMENT '手动修改水位的用户ID，NULL表示调度器自动推进',
+    `updated_at`  TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间'
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+
 -- 任务日志表 - 统一的执行日志存储
 -- 支持独立任务执行和任务流步骤执行两种上下文
 DROP TABLE IF EXISTS `task_logs`;
 CREATE TABLE `task_logs`
 (
     `id`                INT AUTO_INCREMENT PRIMARY KEY COMMENT '日志ID，主键',
-    `task_id`           INT                                                              NOT NULL COMMENT '任务ID，关联tasks表',
+    `task_id`           INT                                                                       DEFAULT NULL COMMENT '任务ID，关联tasks表；非DataX步骤为NULL',
     `flow_execution_id` INT                                                                       DEFAULT NULL COMMENT '任务流执行ID，如果为NULL则表示独立任务执行',
     `step_id`           INT                                                                       DEFAULT NULL COMMENT '任务流步骤ID，如果为NULL则表示独立任务执行',
     `step_order`        INT                                                                       DEFAULT NULL COMMENT '步骤顺序，用于任务流中的步骤排序',
@@ -81,6 +225,10 @@ CREATE TABLE `task_logs`
     `end_time`          TIMESTAMP                                           COMMENT '结束执行时间，NULL表示仍在运行',
     `status`            ENUM ('pending','running','success','failed','killed','skipped') NOT NULL DEFAULT 'pending' COMMENT '执行状态：pending等待，running运行中，success成功，failed失败，killed已终止，skipped跳过',
     `log`               MEDIUMTEXT                                   NOT NULL  COMMENT '执行日志内容',
+    `config_version`    INT                                                                       DEFAULT NULL COMMENT '执行时使用的任务配置版本号，非DataX步骤为NULL',
+    `reconcile_status`  ENUM ('none','matched','mismatched','error')                      NOT NULL DEFAULT 'none' COMMENT '对账状态：none未对账，matched一致，mismatched差异超出容忍度，error对账失败',
+    `source_rows`       BIGINT                                                                    DEFAULT NULL COMMENT '对账时源端行数',
+    `target_rows`       BIGINT                                                                    DEFAULT NULL COMMENT '对账时目标端（DataX写入）行数',
     `created_at`        TIMESTAMP                                                                 DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
     INDEX `idx_flow_execution` (`flow_execution_id`),
     INDEX `idx_step_id` (`step_id`),
@@ -96,9 +244,11 @@ CREATE TABLE `task_flows`
 (
     `id`          INT AUTO_INCREMENT PRIMARY KEY COMMENT '任务流ID，主键',
     `name`        VARCHAR(100) NOT NULL COMMENT '任务流名称',
+    `project_id`  INT          NOT NULL DEFAULT 1 COMMENT '所属项目ID，关联projects表',
     `description` TEXT COMMENT '任务流描述',
     `cron_expr`   VARCHAR(100) NOT NULL COMMENT 'Cron表达式，定义定时执行规则',
     `enabled`     TINYINT(1)   NOT NULL DEFAULT 1 COMMENT '是否启用：1启用，0禁用',
+    `managed_by`  VARCHAR(32)           DEFAULT NULL COMMENT '管理来源：gitops表示由Git目录同步管理（界面只读），NULL表示在界面维护',
     `created_by`  INT                   DEFAULT NULL COMMENT '创建者用户ID',
     `updated_by`  INT                   DEFAULT NULL COMMENT '更新者用户ID',
     `created_at`  TIMESTAMP             DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
@@ -106,13 +256,17 @@ CREATE TABLE `task_flows`
 ) ENGINE = InnoDB
   DEFAULT CHARSET = utf8mb4;
 
--- 任务流步骤表 - 定义任务流中任务的执行顺序
+-- 任务流步骤表 - 定义任务流中步骤的执行顺序
+-- datax步骤关联tasks表，其余类型的步骤在step_config中保存自身配置
 DROP TABLE IF EXISTS `task_flow_steps`;
 CREATE TABLE `task_flow_steps`
 (
     `id`              INT AUTO_INCREMENT PRIMARY KEY COMMENT '步骤ID，主键',
     `flow_id`         INT NOT NULL COMMENT '任务流ID，关联task_flows表',
-    `task_id`         INT NOT NULL COMMENT '任务ID，关联tasks表',
+    `step_type`       ENUM ('datax','check','sql','shell') NOT NULL DEFAULT 'datax' COMMENT '步骤类型：datax数据同步，check数据质量检查，sql执行SQL，shell执行Shell脚本',
+    `task_id`         INT      DEFAULT NULL COMMENT '任务ID，datax步骤关联tasks表',
+    `name`            VARCHAR(100) DEFAULT NULL COMMENT '步骤名称，非datax步骤使用',
+    `step_config`     TEXT COMMENT '步骤配置JSON，非datax步骤使用',
     `step_order`      INT NOT NULL COMMENT '步骤顺序，从1开始递增',
     `timeout_minutes` INT      DEFAULT NULL COMMENT '超时时间（分钟），NULL表示不限制',
     `created_by`      INT      DEFAULT NULL COMMENT '创建者用户ID',
@@ -135,4 +289,26 @@ CREATE TABLE `task_flow_executions`
     `end_time`       TIMESTAMP                                             COMMENT '结束执行时间，NULL表示仍在运行',
     `created_at`     TIMESTAMP                                             DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间'
 ) ENGINE = InnoDB
-  DEFAULT CHARSET = utf8mb4;
\ No newline at end of file
+  DEFAULT CHARSET = utf8mb4;
+
+-- 审计日志表 - 只追加，记录用户对数据源、任务、任务流和用户的变更及执行、终止、启停等操作
+DROP TABLE IF EXISTS `audit_logs`;
+CREATE TABLE `audit_logs`
+(
+    `id`          BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '审计记录ID，主键',
+    `actor_id`    INT          NOT NULL DEFAULT 0 COMMENT '操作人用户ID，0表示系统',
+    `actor`       VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '操作人用户名，用户删除或改名后仍保留',
+    `action`      VARCHAR(20)  NOT NULL COMMENT '操作：create新建，update更新，delete删除，run执行，kill终止，toggle启停',
+    `object_type` VARCHAR(20)  NOT NULL COMMENT '对象类型：data_source数据源，task任务，flow任务流，user用户',
+    `object_id`   INT          NOT NULL DEFAULT 0 COMMENT '对象ID，0表示未知',
+    `object_name` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '对象名称',
+    `changes`     MEDIUMTEXT COMMENT '变更内容JSON：字段 -> {before, after}，密码等敏感字段只记录是否变化',
+    `detail`      VARCHAR(255) NOT NULL DEFAULT '' COMMENT '补充说明，如执行日期、变更来源',
+    `ip`          VARCHAR(45)  NOT NULL DEFAULT '' COMMENT '客户端IP',
+    `user_agent`  VARCHAR(255) NOT NULL DEFAULT '' COMMENT '客户端User-Agent',
+    `created_at`  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',
+    KEY `idx_created_at` (`created_at`),
+    KEY `idx_object` (`object_type`, `object_id`),
+    KEY `idx_actor` (`actor`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"net/http"
+	"sync"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersion 为 /api/v1 文档的版本号，接口发生不兼容变化时递增
+const APIVersion = "1.0.0"
+
+var (
+	idResult  = openapi.Object(map[string]any{"id": 0})
+	qParam    = openapi.Param{Name: "q", Description: "名称关键字"}
+	projParam = openapi.Param{Name: "project_id", Type: "integer", Description: "所属项目ID"}
+	logQuery  = []openapi.Param{
+		{Name: "status", Description: "执行状态"},
+		{Name: "execution_type", Description: "执行类型：scheduled 或 manual"},
+		{Name: "date_from", Description: "开始日期（含），如 2024-01-01"},
+		{Name: "date_to", Description: "结束日期（含）"},
+	}
+)
+
+// withPage 在查询参数后追加分页参数
+func withPage(params ...openapi.Param) []openapi.Param {
+	return append(params, openapi.PageParams...)
+}
+
+// APIOperations 描述 /api/v1 下的全部路由及其请求、响应结构，用于生成 OpenAPI 文档。
+// 新增或修改 /api/v1 路由时必须同步修改此处，否则 api_spec_test.go 中的路由检查会失败。
+func APIOperations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: "GET", Path: "/api/v1/tokens", Tag: "tokens", Summary: "列出当前用户的 API 令牌",
+			Response: openapi.Object(map[string]any{"tokens": []models.APIToken{}})},
+		{Method: "POST", Path: "/api/v1/tokens", Tag: "tokens", Summary: "创建 API 令牌，明文只在本次响应中返回", Status: http.StatusCreated,
+			Request: apiTokenRequest{}, Response: openapi.Object(map[string]any{"token": ""})},
+		{Method: "DELETE", Path: "/api/v1/tokens/:id", Tag: "tokens", Summary: "撤销 API 令牌", Response: idResult},
+
+		{Method: "GET", Path: "/api/v1/projects", Tag: "projects", Summary: "列出当前用户可访问的项目及其角色",
+			Response: openapi.Object(map[string]any{"projects": []models.Project{}})},
+
+		{Method: "GET", Path: "/api/v1/audit-logs", Tag: "audit", Summary: "分页查询审计日志（仅管理员）",
+			Query: withPage(
+				openapi.Param{Name: "actor", Description: "操作人用户名"},
+				openapi.Param{Name: "action", Description: "操作：create、update、delete、run、kill、toggle、revoke"},
+				openapi.Param{Name: "object_type", Description: "对象类型：data_source、task、flow、user"},
+				openapi.Param{Name: "object_id", Type: "integer", Description: "对象ID"},
+				openapi.Param{Name: "q", Description: "对象名称或说明关键字"},
+				openapi.Param{Name: "date_from", Description: "开始日期（含），如 2024-01-01"},
+				openapi.Param{Name: "date_to", Description: "结束日期（含）"},
+			),
+			Response: openapi.Page("audit_logs", models.AuditLog{})},
+
+		{Method: "GET", Path: "/api/v1/data-sources", Tag: "data-sources", Summary: "分页列出可访问项目中的数据源",
+			Query:    withPage(openapi.Param{Name: "type", Description: "数据源类型：mysql、hdfs、ofs、cosn"}, projParam, qParam),
+			Response: openapi.Page("data_sources", models.DataSource{})},
+		{Method: "POST", Path: "/api/v1/data-sources", Tag: "data-sources", Summary: "创建数据源", Status: http.StatusCreated,
+			Request: apiDataSourceRequest{}, Response: models.DataSource{}},
+		{Method: "GET", Path: "/api/v1/data-sources/:id", Tag: "data-sources", Summary: "查询数据源（不含密码）", Response: models.DataSource{}},
+		{Method: "PUT", Path: "/api/v1/data-sources/:id", Tag: "data-sources", Summary: "更新数据源，未提供的字段保持不变",
+			Request: apiDataSourceRequest{}, Response: models.DataSource{}},
+		{Method: "DELETE", Path: "/api/v1/data-sources/:id", Tag: "data-sources", Summary: "删除未被任务引用的数据源", Response: idResult},
+
+		{Method: "GET", Path: "/api/v1/tasks", Tag: "tasks", Summary: "分页列出可访问项目中的任务（不含配置）",
+			Query: withPage(qParam, projParam,
+				openapi.Param{Name: "source_id", Type: "integer", Description: "源数据源ID"},
+				openapi.Param{Name: "target_id", Type: "integer", Description: "目标数据源ID"},
+				openapi.Param{Name: "flow_id", Type: "integer", Description: "所属任务流ID"}),
+			Response: openapi.Page("tasks", models.Task{})},
+		{Method: "POST", Path: "/api/v1/tasks", Tag: "tasks", Summary: "创建任务", Status: http.StatusCreated,
+			Request: apiTaskRequest{}, Response: models.Task{}},
+		{Method: "GET", Path: "/api/v1/tasks/:id", Tag: "tasks", Summary: "查询任务详情（含配置）", Response: models.Task{}},
+		{Method: "PUT", Path: "/api/v1/tasks/:id", Tag: "tasks", Summary: "更新任务配置、增量列和对账设置",
+			Request: apiTaskRequest{}, Response: models.Task{}},
+		{Method: "DELETE", Path: "/api/v1/tasks/:id", Tag: "tasks", Summary: "删除未被任务流引用的任务", Response: idResult},
+		{Method: "POST", Path: "/api/v1/tasks/:id/runs", Tag: "tasks", Summary: "异步执行任务，可指定业务日期", Status: http.StatusAccepted,
+			Request: apiRunRequest{}, Response: openapi.Object(map[string]any{"task_id": 0, "logs": ""})},
+		{Method: "GET", Path: "/api/v1/tasks/:id/render", Tag: "tasks", Summary: "按业务日期生成任务实际执行时的 DataX 配置",
+			Query:    []openapi.Param{{Name: "date", Description: "业务日期 YYYY-MM-DD，缺省为前一天"}},
+			Response: openapi.Object(map[string]any{"task_id": 0, "execution_date": "", "json_config": ""})},
+
+		{Method: "GET", Path: "/api/v1/flows", Tag: "flows", Summary: "分页列出可访问项目中的任务流",
+			Query:    withPage(qParam, projParam, openapi.Param{Name: "enabled", Type: "boolean", Description: "是否启用"}),
+			Response: openapi.Page("flows", models.TaskFlow{})},
+		{Method: "POST", Path: "/api/v1/flows", Tag: "flows", Summary: "创建任务流", Status: http.StatusCreated,
+			Request: apiFlowRequest{}, Response: apiFlowDetail{}},
+		{Method: "GET", Path: "/api/v1/flows/:id", Tag: "flows", Summary: "查询任务流详情（含步骤和运行状态）", Response: apiFlowDetail{}},
+		{Method: "PUT", Path: "/api/v1/flows/:id", Tag: "flows", Summary: "更新任务流描述、cron 和启用状态",
+			Request: apiFlowRequest{}, Response: apiFlowDetail{}},
+		{Method: "DELETE", Path: "/api/v1/flows/:id", Tag: "flows", Summary: "删除任务流及其步骤", Response: idResult},
+		{Method: "POST", Path: "/api/v1/flows/:id/runs", Tag: "flows", Summary: "异步执行任务流，可指定业务日期", Status: http.StatusAccepted,
+			Request: apiRunRequest{}, Response: openapi.Object(map[string]any{"flow_id": 0, "logs": ""})},
+		{Method: "POST", Path: "/api/v1/flows/:id/kill", Tag: "flows", Summary: "终止正在运行的任务流",
+			Response: openapi.Object(map[string]any{"flow_id": 0})},
+		{Method: "GET", Path: "/api/v1/flows/:id/steps", Tag: "steps", Summary: "列出任务流步骤",
+			Response: openapi.Object(map[string]any{"steps": []models.TaskFlowStep{}})},
+		{Method: "POST", Path: "/api/v1/flows/:id/steps", Tag: "steps", Summary: "在任务流末尾添加步骤", Status: http.StatusCreated,
+			Request: apiStepRequest{}, Response: openapi.Object(map[string]any{"id": int64(0), "step_order": 0})},
+		{Method: "PUT", Path: "/api/v1/flows/:id/steps/order", Tag: "steps", Summary: "按 step_ids 重排全部步骤",
+			Request:  openapi.Object(map[string]any{"step_ids": []int{}}),
+			Response: openapi.Object(map[string]any{"steps": []models.TaskFlowStep{}})},
+		{Method: "DELETE", Path: "/api/v1/flows/:id/steps/:step_id", Tag: "steps", Summary: "删除步骤", Response: idResult},
+
+		{Method: "POST", Path: "/api/v1/bundles/export", Tag: "bundles", Summary: "导出任务流及其引用的任务和数据源",
+			Request: apiExportRequest{}, Response: openapi.Object(map[string]any{"format": "", "content": ""})},
+		{Method: "POST", Path: "/api/v1/bundles/import", Tag: "bundles", Summary: "导入任务流导入包，dry_run 只返回导入计划",
+			Request: apiImportRequest{}, Response: apiImportResult{}},
+
+		{Method: "GET", Path: "/api/v1/flow-logs", Tag: "logs", Summary: "分页列出任务流执行记录",
+			Query: withPage(append([]openapi.Param{
+				{Name: "flow_id", Type: "integer", Description: "任务流ID"},
+				{Name: "flow_name", Description: "任务流名称关键字"},
+			}, logQuery...)...),
+			Response: models.FlowLogListResponse{}},
+		{Method: "GET", Path: "/api/v1/flow-logs/:id", Tag: "logs", Summary: "查询任务流执行详情及各步骤日志", Response: models.FlowLogDetailResponse{}},
+		{Method: "GET", Path: "/api/v1/task-logs", Tag: "logs", Summary: "分页列出任务执行日志",
+			Query: withPage(append([]openapi.Param{
+				{Name: "task_id", Type: "integer", Description: "任务ID"},
+				{Name: "flow_execution_id", Type: "integer", Description: "任务流执行记录ID"},
+				{Name: "task_name", Description: "任务或步骤名称关键字"},
+				{Name: "reconcile_status", Description: "对账状态"},
+			}, logQuery...)...),
+			Response: models.TaskLogListResponse{}},
+		{Method: "GET", Path: "/api/v1/task-logs/:id", Tag: "logs", Summary: "查询任务执行日志详情", Response: models.TaskExecutionLog{}},
+	}
+}
+
+var (
+	specOnce sync.Once
+	spec     map[string]any
+)
+
+// OpenAPISpec 返回 /api/v1 的 OpenAPI 3 文档，无需登录即可获取以便生成客户端
+func (ct *Controller) OpenAPISpec(c *gin.Context) {
+	specOnce.Do(func() {
+		spec = openapi.Build("DataX Web API", APIVersion, APIOperations())
+	})
+	c.JSON(http.StatusOK, spec)
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"testing"
+
+	"com.duole/datax-web-go/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// TestAPIRoutesMatchSpec 已注册的 /api/v1 路由必须与 OpenAPI 文档一致
+func TestAPIRoutesMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ct := NewController(nil, nil, nil, nil)
+	ct.RegisterAPIRoutes(r.Group("/api/v1", ct.MustAPILogin()))
+	if len(r.Routes()) == 0 {
+		t.Fatal("no /api/v1 routes registered")
+	}
+	if err := openapi.CheckRoutes(r.Routes(), "/api/v1", APIOperations()); err != nil {
+		t.Fatalf("API 文档与路由不一致: %v", err)
+	}
+}
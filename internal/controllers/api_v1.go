@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// /api/v1 的响应统一为 {"success": true, "data": ...}，
+// 错误统一为 {"success": false, "error": "..."} 并使用对应的 HTTP 状态码，与既有日志 API 一致。
+
+// RegisterAPIRoutes 在 /api/v1 路由组上注册 REST API，认证中间件由调用方挂在路由组上。
+// 注册的路由必须与 APIOperations 中的文档一致
+func (ct *Controller) RegisterAPIRoutes(v1 *gin.RouterGroup) {
+	viewTask := ct.MustProjectRole(ResTask, services.ProjectViewer)
+	runTask := ct.MustProjectRole(ResTask, services.ProjectOperator)
+	editTask := ct.MustProjectRole(ResTask, services.ProjectEditor)
+	viewFlow := ct.MustProjectRole(ResFlow, services.ProjectViewer)
+	runFlow := ct.MustProjectRole(ResFlow, services.ProjectOperator)
+	editFlow := ct.MustProjectRole(ResFlow, services.ProjectEditor)
+	viewDS := ct.MustProjectRole(ResDataSource, services.ProjectViewer)
+	editDS := ct.MustProjectRole(ResDataSource, services.ProjectEditor)
+	viewFlowLog := ct.MustProjectRole(ResFlowExecution, services.ProjectViewer)
+	viewTaskLog := ct.MustProjectRole(ResTaskLog, services.ProjectViewer)
+
+	v1.GET("/tokens", ct.APIListTokens)
+	v1.POST("/tokens", ct.APICreateToken)
+	v1.DELETE("/tokens/:id", ct.APIRevokeToken)
+	v1.GET("/projects", ct.APIListProjects)
+	v1.GET("/audit-logs", ct.APIListAuditLogs)
+	v1.GET("/data-sources", ct.APIListDataSources)
+	v1.POST("/data-sources", ct.APICreateDataSource)
+	v1.GET("/data-sources/:id", viewDS, ct.APIGetDataSource)
+	v1.PUT("/data-sources/:id", editDS, ct.APIUpdateDataSource)
+	v1.DELETE("/data-sources/:id", editDS, ct.APIDeleteDataSource)
+	v1.GET("/tasks", ct.APIListTasks)
+	v1.POST("/tasks", ct.APICreateTask)
+	v1.GET("/tasks/:id", viewTask, ct.APIGetTask)
+	v1.PUT("/tasks/:id", editTask, ct.APIUpdateTask)
+	v1.DELETE("/tasks/:id", editTask, ct.APIDeleteTask)
+	v1.POST("/tasks/:id/runs", runTask, ct.APIRunTask)
+	v1.GET("/tasks/:id/render", viewTask, ct.APIRenderTask)
+	v1.GET("/flows", ct.APIListFlows)
+	v1.POST("/flows", ct.APICreateFlow)
+	v1.GET("/flows/:id", viewFlow, ct.APIGetFlow)
+	v1.PUT("/flows/:id", editFlow, ct.APIUpdateFlow)
+	v1.DELETE("/flows/:id", editFlow, ct.APIDeleteFlow)
+	v1.POST("/flows/:id/runs", runFlow, ct.APIRunFlow)
+	v1.POST("/flows/:id/kill", runFlow, ct.APIKillFlow)
+	v1.GET("/flows/:id/steps", viewFlow, ct.APIListSteps)
+	v1.POST("/flows/:id/steps", editFlow, ct.APIAddStep)
+	v1.PUT("/flows/:id/steps/order", editFlow, ct.APIReorderSteps)
+	v1.DELETE("/flows/:id/steps/:step_id", editFlow, ct.APIRemoveStep)
+	v1.POST("/bundles/export", ct.APIExportBundle)
+	v1.POST("/bundles/import", ct.APIImportBundle)
+	v1.GET("/flow-logs", ct.GetFlowLogs)
+	v1.GET("/flow-logs/:id", viewFlowLog, ct.GetFlowLogDetail)
+	v1.GET("/task-logs", ct.GetTaskLogs)
+	v1.GET("/task-logs/:id", viewTaskLog, ct.GetTaskLogDetail)
+}
+
+// apiOK 返回成功响应
+func apiOK(c *gin.Context, status int, data any) {
+	c.JSON(status, gin.H{"success": true, "data": data})
+}
+
+// apiError 返回错误响应
+func apiError(c *gin.Context, status int, msg string) {
+	c.JSON(status, gin.H{"success": false, "error": msg})
+}
+
+// apiID 解析路径中的正整数 ID，无效时直接返回 400
+func apiID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		apiError(c, http.StatusBadRequest, "无效的ID: "+c.Param(name))
+		return 0, false
+	}
+	return id, true
+}
+
+// apiBind 解析 JSON 请求体，失败时直接返回 400
+func apiBind(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		apiError(c, http.StatusBadRequest, "请求体不是有效的 JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// apiPage 组装分页列表，key 为列表字段名（如 tasks、flows）
+func apiPage(key string, items any, total, page, pageSize int) gin.H {
+	return gin.H{
+		key:           items,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
+	}
+}
+
+// apiRunRequest 执行任务或任务流的可选请求体。execution_date 为业务日期（YYYY-MM-DD），
+// 日期占位符按该日期替换，用于补数；缺省时使用前一天。
+type apiRunRequest struct {
+	ExecutionDate string `json:"execution_date,omitempty"`
+}
+
+// parseExecutionDate 解析 YYYY-MM-DD 格式的业务日期
+func parseExecutionDate(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// apiRunContext 解析可选的执行请求体并返回执行上下文，失败时直接返回 400
+func apiRunContext(c *gin.Context) (context.Context, bool) {
+	ctx := context.Background()
+	if c.Request.ContentLength == 0 {
+		return ctx, true
+	}
+	var req apiRunRequest
+	if !apiBind(c, &req) {
+		return nil, false
+	}
+	if req.ExecutionDate == "" {
+		return ctx, true
+	}
+	date, err := parseExecutionDate(req.ExecutionDate)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "无效的业务日期，格式应为 YYYY-MM-DD: "+req.ExecutionDate)
+		return nil, false
+	}
+	return services.WithExecutionDate(ctx, date), true
+}
+
+// ========== API 令牌 ==========
+
+// apiTokenRequest 创建令牌的请求体，expires_in_days 为 0 表示不过期
+type apiTokenRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+// tokenExpiry 将有效天数转换为过期时间
+func tokenExpiry(days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	t := time.Now().AddDate(0, 0, days)
+	return &t
+}
+
+// APIListTokens 列出当前用户的令牌
+func (ct *Controller) APIListTokens(c *gin.Context) {
+	tokens, err := services.ListAPITokens(ct.db, ct.GetCurrentUserID(c))
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询令牌失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// APICreateToken 为当前用户创建令牌，明文只在本次响应中返回
+func (ct *Controller) APICreateToken(c *gin.Context) {
+	var req apiTokenRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	token, err := services.CreateAPIToken(ct.db, ct.GetCurrentUserID(c), req.Name, tokenExpiry(req.ExpiresInDays))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	apiOK(c, http.StatusCreated, gin.H{"token": token})
+}
+
+// APIRevokeToken 撤销当前用户的令牌
+func (ct *Controller) APIRevokeToken(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	if err := services.RevokeAPIToken(ct.db, ct.GetCurrentUserID(c), id); err != nil {
+		apiError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"id": id})
+}
+
+// TokenList 显示当前用户的 API 令牌管理页面
+func (ct *Controller) TokenList(c *gin.Context) {
+	tokens, err := services.ListAPITokens(ct.db, ct.GetCurrentUserID(c))
+	if err != nil {
+		c.String(500, "查询令牌失败: "+err.Error())
+		return
+	}
+	c.HTML(200, "user/tokens.tmpl", gin.H{"Tokens": tokens})
+}
+
+// TokenCreate 创建令牌并在页面中显示一次明文
+func (ct *Controller) TokenCreate(c *gin.Context) {
+	days, _ := strconv.Atoi(c.PostForm("expires_in_days"))
+	uid := ct.GetCurrentUserID(c)
+	token, err := services.CreateAPIToken(ct.db, uid, c.PostForm("name"), tokenExpiry(days))
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	tokens, err := services.ListAPITokens(ct.db, uid)
+	if err != nil {
+		c.String(500, "查询令牌失败: "+err.Error())
+		return
+	}
+	c.HTML(200, "user/tokens.tmpl", gin.H{"Tokens": tokens, "NewToken": token})
+}
+
+// TokenRevoke 撤销令牌
+func (ct *Controller) TokenRevoke(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := services.RevokeAPIToken(ct.db, ct.GetCurrentUserID(c), id); err != nil {
+		c.String(404, err.Error())
+		return
+	}
+	c.Redirect(302, "/account/tokens")
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"net/http"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// apiExportRequest 导出请求体，format 为 yaml（默认）或 json
+type apiExportRequest struct {
+	FlowIDs    []int  `json:"flow_ids"`
+	Format     string `json:"format"`
+	Passphrase string `json:"passphrase"`
+}
+
+// apiImportRequest 导入请求体，content 为 yaml 或 json 格式的导入包内容
+type apiImportRequest struct {
+	ProjectID  int    `json:"project_id,omitempty"`
+	Content    string `json:"content"`
+	Passphrase string `json:"passphrase"`
+	Overwrite  bool   `json:"overwrite"`
+	DryRun     bool   `json:"dry_run"`
+}
+
+// apiImportResult 导入结果，summary 为导入计划的统计说明
+type apiImportResult struct {
+	services.ImportResult
+	Summary string `json:"summary"`
+}
+
+// APIExportBundle 将任务流及其引用的任务和数据源导出为导入包，内容以字符串返回
+func (ct *Controller) APIExportBundle(c *gin.Context) {
+	var req apiExportRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Format == "" {
+		req.Format = "yaml"
+	}
+	if err := ct.checkExportFlows(c, req.FlowIDs); err != nil {
+		apiError(c, http.StatusForbidden, "导出失败: "+err.Error())
+		return
+	}
+	secretProjects, err := ct.exportSecretProjects(c)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "导出失败: "+err.Error())
+		return
+	}
+	bundle, err := services.ExportBundle(ct.db, req.FlowIDs, req.Passphrase, secretProjects)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "导出失败: "+err.Error())
+		return
+	}
+	data, err := services.MarshalBundle(bundle, req.Format)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "导出失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"format": req.Format, "content": string(data)})
+}
+
+// APIImportBundle 导入任务流导入包。dry_run 只返回导入计划；存在冲突时不会写入任何数据，
+// 此时 applied 为 false，items 中 action 为 conflict 的项说明原因。
+func (ct *Controller) APIImportBundle(c *gin.Context) {
+	var req apiImportRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if len(req.Content) > maxBundleSize {
+		apiError(c, http.StatusBadRequest, "导入内容过大")
+		return
+	}
+	bundle, err := services.ParseBundle([]byte(req.Content))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := services.ImportOptions{
+		Passphrase: req.Passphrase,
+		Overwrite:  req.Overwrite,
+		DryRun:     req.DryRun,
+		AllowShell: ct.currentRole(c) == "admin",
+	}
+	if err := ct.importProjectOptions(c, &opts, req.ProjectID); err != nil {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	result, err := services.ImportBundle(ct.db, bundle, opts, ct.GetCurrentUserID(c))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if result.Applied {
+		ct.rescheduleImported(result)
+		ct.auditImport(c, result, "导入")
+	}
+	apiOK(c, http.StatusOK, apiImportResult{ImportResult: *result, Summary: importSummary(result)})
+}
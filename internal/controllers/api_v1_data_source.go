@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
+	"github.com/gin-gonic/gin"
+)
+
+// apiDataSourceRequest 创建或更新数据源的请求体，更新时未提供的字段保持不变
+type apiDataSourceRequest struct {
+	Name         *string `json:"name"`
+	Type         string  `json:"type"`
+	DBURL        *string `json:"db_url"`
+	DBUser       *string `json:"db_user"`
+	DBPassword   *string `json:"db_password"`
+	PasswordRef  *string `json:"db_password_ref"` // 外部密码来源，空串表示改回使用 db_password
+	DBDatabase   *string `json:"db_database"`
+	DefaultFS    *string `json:"defaultfs"`
+	HadoopConfig *string `json:"hadoopconfig"`
+	ProjectID    int     `json:"project_id"` // 仅创建时有效，未指定时使用默认项目
+}
+
+// validDataSourceType 判断数据源类型是否受支持
+func validDataSourceType(typ string) bool {
+	switch datax.DataSourceType(typ) {
+	case datax.DataSourceMySQL, datax.DataSourceHDFS, datax.DataSourceOFS, datax.DataSourceCOSN:
+		return true
+	}
+	return false
+}
+
+// apply 将请求中的字段合并到数据源
+func (r *apiDataSourceRequest) apply(ds *models.DataSource) {
+	if r.Name != nil {
+		ds.Name = strings.TrimSpace(*r.Name)
+	}
+	set := func(dst **string, v *string) {
+		if v != nil {
+			s := strings.TrimSpace(*v)
+			*dst = &s
+		}
+	}
+	if ds.Type == DSTypeMySQL {
+		set(&ds.DBURL, r.DBURL)
+		set(&ds.DBUser, r.DBUser)
+		set(&ds.DBDatabase, r.DBDatabase)
+		set(&ds.DBPasswordRef, r.PasswordRef)
+		if r.DBPassword != nil {
+			// 密码不去除空白
+			pw := *r.DBPassword
+			ds.DBPassword = &pw
+		}
+	} else {
+		set(&ds.DefaultFS, r.DefaultFS)
+		set(&ds.HadoopConfig, r.HadoopConfig)
+	}
+}
+
+// loadAPIDataSource 查询单个数据源，withSecret 为 true 时包含密码（仅用于更新时保留原值）
+func (ct *Controller) loadAPIDataSource(id int, withSecret bool) (*models.DataSource, error) {
+	var ds models.DataSource
+	err := ct.db.QueryRow(`SELECT ds.id, ds.name, ds.project_id, p.name, ds.type, ds.db_url, ds.db_user, ds.db_password, ds.db_password_ref, ds.db_database, ds.defaultfs, ds.hadoopconfig,
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), ds.created_at, ds.updated_at
+		FROM data_sources ds
+		JOIN projects p ON ds.project_id = p.id
+		LEFT JOIN users uc ON ds.created_by = uc.id
+		LEFT JOIN users uu ON ds.updated_by = uu.id
+		WHERE ds.id=?`, id).
+		Scan(&ds.ID, &ds.Name, &ds.ProjectID, &ds.Project, &ds.Type, &ds.DBURL, &ds.DBUser, &ds.DBPassword, &ds.DBPasswordRef, &ds.DBDatabase, &ds.DefaultFS, &ds.HadoopConfig,
+			&ds.CreatedByName, &ds.UpdatedByName, &ds.CreatedAt, &ds.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if !withSecret {
+		ds.DBPassword = nil
+	}
+	return &ds, nil
+}
+
+// encryptAPIPassword 校验外部密码来源，并加密请求中提供的新密码，未提供时保留数据库中的原值；
+// 失败时写入错误响应并返回 false
+func encryptAPIPassword(c *gin.Context, ds *models.DataSource, req apiDataSourceRequest) bool {
+	if ds.DBPasswordRef != nil {
+		if err := datax.CheckPasswordRef(*ds.DBPasswordRef); err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+	if req.DBPassword == nil || ds.DBPassword == nil {
+		return true
+	}
+	sealed, err := datax.EncryptPassword(*ds.DBPassword)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "加密密码失败: "+err.Error())
+		return false
+	}
+	ds.DBPassword = &sealed
+	return true
+}
+
+// dataSourceNameTaken 判断名称是否已被其他数据源使用
+func (ct *Controller) dataSourceNameTaken(name string, excludeID int) bool {
+	var exists bool
+	ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM data_sources WHERE name=? AND id<>?)", name, excludeID).Scan(&exists)
+	return exists
+}
+
+// APIListDataSources 分页列出当前用户可访问项目中的数据源，支持按 type、project_id 和名称关键字 q 过滤，不返回密码
+func (ct *Controller) APIListDataSources(c *gin.Context) {
+	page, pageSize := pagination(c)
+	scope, args := projectScope(c, "ds.project_id")
+	where := "WHERE 1=1" + scope
+	if projectID := c.Query("project_id"); projectID != "" {
+		where += " AND ds.project_id = ?"
+		args = append(args, projectID)
+	}
+	if typ := c.Query("type"); typ != "" {
+		where += " AND ds.type = ?"
+		args = append(args, typ)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		where += " AND ds.name LIKE ?"
+		args = append(args, "%"+q+"%")
+	}
+
+	var total int
+	if err := ct.db.QueryRow("SELECT COUNT(*) FROM data_sources ds "+where, args...).Scan(&total); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+
+	rows, err := ct.db.Query(`SELECT ds.id, ds.name, ds.project_id, p.name, ds.type, ds.db_url, ds.db_user, ds.db_database, ds.defaultfs,
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), ds.created_at, ds.updated_at
+		FROM data_sources ds
+		JOIN projects p ON ds.project_id = p.id
+		LEFT JOIN users uc ON ds.created_by = uc.id
+		LEFT JOIN users uu ON ds.updated_by = uu.id
+		`+where+` ORDER BY ds.id DESC LIMIT ? OFFSET ?`, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	list := []models.DataSource{}
+	for rows.Next() {
+		var ds models.DataSource
+		if err := rows.Scan(&ds.ID, &ds.Name, &ds.ProjectID, &ds.Project, &ds.Type, &ds.DBURL, &ds.DBUser, &ds.DBDatabase, &ds.DefaultFS,
+			&ds.CreatedByName, &ds.UpdatedByName, &ds.CreatedAt, &ds.UpdatedAt); err != nil {
+			apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+			return
+		}
+		list = append(list, ds)
+	}
+	apiOK(c, http.StatusOK, apiPage("data_sources", list, total, page, pageSize))
+}
+
+// APIGetDataSource 返回单个数据源，不含密码
+func (ct *Controller) APIGetDataSource(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	ds, err := ct.loadAPIDataSource(id, false)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "数据源不存在")
+		return
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, ds)
+}
+
+// APICreateDataSource 创建数据源
+func (ct *Controller) APICreateDataSource(c *gin.Context) {
+	var req apiDataSourceRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if !validDataSourceType(req.Type) {
+		apiError(c, http.StatusBadRequest, "不支持的数据源类型: "+req.Type)
+		return
+	}
+	ds := models.DataSource{Type: req.Type}
+	req.apply(&ds)
+	if ds.Name == "" {
+		apiError(c, http.StatusBadRequest, "数据源名称不能为空")
+		return
+	}
+	if ct.dataSourceNameTaken(ds.Name, 0) {
+		apiError(c, http.StatusConflict, "数据源名称已存在: "+ds.Name)
+		return
+	}
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if !encryptAPIPassword(c, &ds, req) {
+		return
+	}
+
+	uid := ct.GetCurrentUserID(c)
+	result, err := ct.db.Exec(`INSERT INTO data_sources(name,project_id,type,db_url,db_user,db_password,db_password_ref,db_database,defaultfs,hadoopconfig,created_by,updated_by)
+		VALUES(?,?,?,?,?,?,NULLIF(?,''),?,?,?,?,?)`,
+		ds.Name, projectID, ds.Type, ds.DBURL, ds.DBUser, ds.DBPassword, ds.DBPasswordRef, ds.DBDatabase, ds.DefaultFS, ds.HadoopConfig, uid, uid)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "创建数据源失败: "+err.Error())
+		return
+	}
+	id, _ := result.LastInsertId()
+	ct.audit(c, services.AuditCreate, services.AuditDataSource, int(id), nil, ct.snapshot(services.AuditDataSource, int(id)))
+
+	created, err := ct.loadAPIDataSource(int(id), false)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusCreated, created)
+}
+
+// APIUpdateDataSource 更新数据源，未提供的字段（包括密码）保持不变，类型不可修改
+func (ct *Controller) APIUpdateDataSource(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var req apiDataSourceRequest
+	if !apiBind(c, &req) {
+		return
+	}
+
+	ds, err := ct.loadAPIDataSource(id, true)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "数据源不存在")
+		return
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+	if req.Type != "" && req.Type != ds.Type {
+		apiError(c, http.StatusBadRequest, "数据源类型不可修改")
+		return
+	}
+	req.apply(ds)
+	if ds.Name == "" {
+		apiError(c, http.StatusBadRequest, "数据源名称不能为空")
+		return
+	}
+	if ct.dataSourceNameTaken(ds.Name, id) {
+		apiError(c, http.StatusConflict, "数据源名称已存在: "+ds.Name)
+		return
+	}
+
+	if !encryptAPIPassword(c, ds, req) {
+		return
+	}
+
+	before := ct.snapshot(services.AuditDataSource, id)
+	_, err = ct.db.Exec(`UPDATE data_sources SET name=?,db_url=?,db_user=?,db_password=?,db_password_ref=NULLIF(?,''),db_database=?,defaultfs=?,hadoopconfig=?,updated_by=? WHERE id=?`,
+		ds.Name, ds.DBURL, ds.DBUser, ds.DBPassword, ds.DBPasswordRef, ds.DBDatabase, ds.DefaultFS, ds.HadoopConfig, ct.GetCurrentUserID(c), id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "更新数据源失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditDataSource, id, before, ct.snapshot(services.AuditDataSource, id))
+
+	updated, err := ct.loadAPIDataSource(id, false)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, updated)
+}
+
+// APIDeleteDataSource 删除未被任务引用的数据源
+func (ct *Controller) APIDeleteDataSource(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+
+	var refs int
+	if err := ct.db.QueryRow("SELECT COUNT(*) FROM tasks WHERE source_id=? OR target_id=?", id, id).Scan(&refs); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询数据源引用失败: "+err.Error())
+		return
+	}
+	if refs > 0 {
+		apiError(c, http.StatusConflict, "数据源仍被任务引用，无法删除")
+		return
+	}
+
+	before := ct.snapshot(services.AuditDataSource, id)
+	result, err := ct.db.Exec("DELETE FROM data_sources WHERE id=?", id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "删除数据源失败: "+err.Error())
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apiError(c, http.StatusNotFound, "数据源不存在")
+		return
+	}
+	ct.audit(c, services.AuditDelete, services.AuditDataSource, id, before, nil)
+	apiOK(c, http.StatusOK, gin.H{"id": id})
+}
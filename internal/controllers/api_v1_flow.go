@@ -0,0 +1,591 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// apiFlowRequest 创建或更新任务流的请求体，更新时未提供的字段保持不变，名称不可修改
+type apiFlowRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Cron        *string `json:"cron"`
+	Enabled     *bool   `json:"enabled"`
+	ProjectID   int     `json:"project_id"` // 仅创建时有效，未指定时使用默认项目
+}
+
+// apiFlowDetail 任务流详情，包含步骤和运行状态
+type apiFlowDetail struct {
+	models.TaskFlow
+	Running bool                  `json:"running"`
+	Steps   []models.TaskFlowStep `json:"steps"`
+}
+
+// apiStepRequest 添加步骤的请求体，字段含义与界面的添加步骤表单一致
+type apiStepRequest struct {
+	Type           string          `json:"type"`
+	TaskID         int             `json:"task_id"`
+	Name           string          `json:"name"`
+	DataSourceID   int             `json:"data_source_id"`
+	TimeoutMinutes *int            `json:"timeout_minutes"`
+	SQL            string          `json:"sql"`
+	Script         string          `json:"script"`
+	Assertions     json.RawMessage `json:"assertions"`
+}
+
+// flowSteps 查询任务流的全部步骤
+func (ct *Controller) flowSteps(flowID int) ([]models.TaskFlowStep, error) {
+	rows, err := ct.db.Query(`
+		SELECT s.id, s.step_order, s.step_type, s.timeout_minutes,
+		       COALESCE(t.name, s.name, '') as task_name, COALESCE(s.task_id, 0) as task_id,
+		       COALESCE(s.step_config, '')
+		FROM task_flow_steps s
+		LEFT JOIN tasks t ON s.task_id = t.id
+		WHERE s.flow_id = ? AND (s.step_type <> 'datax' OR t.id IS NOT NULL)
+		ORDER BY s.step_order`, flowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []models.TaskFlowStep{}
+	for rows.Next() {
+		var s models.TaskFlowStep
+		if err := rows.Scan(&s.ID, &s.StepOrder, &s.StepType, &s.TimeoutMinutes, &s.TaskName, &s.TaskID, &s.Config); err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+	return steps, rows.Err()
+}
+
+// respondFlow 返回任务流详情
+func (ct *Controller) respondFlow(c *gin.Context, status, id int) {
+	var d apiFlowDetail
+	err := ct.db.QueryRow(`SELECT tf.id, tf.name, tf.project_id, p.name, tf.description, tf.cron_expr, tf.enabled, COALESCE(tf.managed_by,''),
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), tf.created_at, tf.updated_at
+		FROM task_flows tf
+		JOIN projects p ON tf.project_id = p.id
+		LEFT JOIN users uc ON tf.created_by = uc.id
+		LEFT JOIN users uu ON tf.updated_by = uu.id
+		WHERE tf.id=?`, id).
+		Scan(&d.ID, &d.Name, &d.ProjectID, &d.Project, &d.Description, &d.CronExpr, &d.Enabled, &d.ManagedBy,
+			&d.CreatedByName, &d.UpdatedByName, &d.CreatedAt, &d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "任务流不存在")
+		return
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+		return
+	}
+	if d.Steps, err = ct.flowSteps(id); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流步骤失败: "+err.Error())
+		return
+	}
+	d.Running = ct.sched.IsTaskFlowRunning(id)
+	apiOK(c, status, d)
+}
+
+// editableFlow 校验任务流存在且未被 Git 同步管理，不满足时直接返回错误
+func (ct *Controller) editableFlow(c *gin.Context, id int) bool {
+	var managed string
+	err := ct.db.QueryRow("SELECT COALESCE(managed_by,'') FROM task_flows WHERE id=?", id).Scan(&managed)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "任务流不存在")
+		return false
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+		return false
+	}
+	if managed != "" {
+		apiError(c, http.StatusForbidden, msgFlowManaged)
+		return false
+	}
+	return true
+}
+
+// APIListFlows 分页列出当前用户可访问项目中的任务流，支持名称关键字 q、project_id 和 enabled=true|false 过滤
+func (ct *Controller) APIListFlows(c *gin.Context) {
+	page, pageSize := pagination(c)
+	scope, args := projectScope(c, "tf.project_id")
+	where := "WHERE 1=1" + scope
+	if projectID, _ := strconv.Atoi(c.Query("project_id")); projectID > 0 {
+		where += " AND tf.project_id = ?"
+		args = append(args, projectID)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		where += " AND tf.name LIKE ?"
+		args = append(args, "%"+q+"%")
+	}
+	if v := c.Query("enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "enabled 只能为 true 或 false")
+			return
+		}
+		where += " AND tf.enabled = ?"
+		args = append(args, enabled)
+	}
+
+	var total int
+	if err := ct.db.QueryRow("SELECT COUNT(*) FROM task_flows tf "+where, args...).Scan(&total); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+		return
+	}
+
+	rows, err := ct.db.Query(`SELECT tf.id, tf.name, tf.project_id, p.name, tf.description, tf.cron_expr, tf.enabled, COALESCE(tf.managed_by,''),
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), tf.created_at, tf.updated_at
+		FROM task_flows tf
+		JOIN projects p ON tf.project_id = p.id
+		LEFT JOIN users uc ON tf.created_by = uc.id
+		LEFT JOIN users uu ON tf.updated_by = uu.id
+		`+where+` ORDER BY tf.id DESC LIMIT ? OFFSET ?`, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	flows := []models.TaskFlow{}
+	for rows.Next() {
+		var f models.TaskFlow
+		if err := rows.Scan(&f.ID, &f.Name, &f.ProjectID, &f.Project, &f.Description, &f.CronExpr, &f.Enabled, &f.ManagedBy,
+			&f.CreatedByName, &f.UpdatedByName, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+			return
+		}
+		flows = append(flows, f)
+	}
+	apiOK(c, http.StatusOK, apiPage("flows", flows, total, page, pageSize))
+}
+
+// APIGetFlow 返回任务流详情，包含步骤和是否正在运行
+func (ct *Controller) APIGetFlow(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	ct.respondFlow(c, http.StatusOK, id)
+}
+
+// APICreateFlow 创建任务流并加入调度，enabled 缺省为启用
+func (ct *Controller) APICreateFlow(c *gin.Context) {
+	var req apiFlowRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	var name, description, cronExpr string
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		description = strings.TrimSpace(*req.Description)
+	}
+	if req.Cron != nil {
+		cronExpr = strings.TrimSpace(*req.Cron)
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+	if name == "" {
+		apiError(c, http.StatusBadRequest, "任务流名称不能为空")
+		return
+	}
+	if err := services.ValidateCronExpression(cronExpr); err != nil {
+		apiError(c, http.StatusBadRequest, "cron表达式无效: "+err.Error())
+		return
+	}
+	var exists bool
+	ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM task_flows WHERE name=?)", name).Scan(&exists)
+	if exists {
+		apiError(c, http.StatusConflict, "任务流名称已存在: "+name)
+		return
+	}
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	uid := ct.GetCurrentUserID(c)
+	result, err := ct.db.Exec(`INSERT INTO task_flows(name, project_id, description, cron_expr, enabled, created_by, updated_by)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`, name, projectID, description, cronExpr, enabled, uid, uid)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "创建任务流失败: "+err.Error())
+		return
+	}
+	id64, _ := result.LastInsertId()
+	id := int(id64)
+	ct.audit(c, services.AuditCreate, services.AuditFlow, id, nil, ct.snapshot(services.AuditFlow, id))
+
+	if err := ct.sched.ReloadTaskFlow(id); err != nil {
+		log.Printf("scheduler: failed to add new task flow %d: %v", id, err)
+	}
+	ct.respondFlow(c, http.StatusCreated, id)
+}
+
+// APIUpdateFlow 更新任务流描述、cron 和启用状态，并重新加载调度
+func (ct *Controller) APIUpdateFlow(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var req apiFlowRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if !ct.editableFlow(c, id) {
+		return
+	}
+	if req.Name != nil {
+		apiError(c, http.StatusBadRequest, "任务流名称不支持修改")
+		return
+	}
+
+	sets := []string{"updated_by=?"}
+	args := []any{ct.GetCurrentUserID(c)}
+	if req.Description != nil {
+		sets = append(sets, "description=?")
+		args = append(args, strings.TrimSpace(*req.Description))
+	}
+	if req.Cron != nil {
+		cronExpr := strings.TrimSpace(*req.Cron)
+		if err := services.ValidateCronExpression(cronExpr); err != nil {
+			apiError(c, http.StatusBadRequest, "cron表达式无效: "+err.Error())
+			return
+		}
+		sets = append(sets, "cron_expr=?")
+		args = append(args, cronExpr)
+	}
+	if req.Enabled != nil {
+		sets = append(sets, "enabled=?")
+		args = append(args, *req.Enabled)
+	}
+
+	before := ct.snapshot(services.AuditFlow, id)
+	if _, err := ct.db.Exec("UPDATE task_flows SET "+strings.Join(sets, ", ")+" WHERE id=?", append(args, id)...); err != nil {
+		apiError(c, http.StatusInternalServerError, "更新任务流失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, id, before, ct.snapshot(services.AuditFlow, id))
+	if err := ct.sched.ReloadTaskFlow(id); err != nil {
+		log.Printf("scheduler: failed to reload task flow %d: %v", id, err)
+	}
+	ct.respondFlow(c, http.StatusOK, id)
+}
+
+// APIDeleteFlow 从调度中移除并永久删除任务流及其步骤
+func (ct *Controller) APIDeleteFlow(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	if !ct.editableFlow(c, id) {
+		return
+	}
+
+	before := ct.snapshot(services.AuditFlow, id)
+	if err := ct.sched.RemoveTaskFlowFromCron(id); err != nil {
+		log.Printf("scheduler: failed to remove task flow %d from cron: %v", id, err)
+	}
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM task_flow_steps WHERE flow_id=?", id); err != nil {
+		apiError(c, http.StatusInternalServerError, "删除任务流步骤失败: "+err.Error())
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM task_flows WHERE id=?", id); err != nil {
+		apiError(c, http.StatusInternalServerError, "删除任务流失败: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "提交事务失败")
+		return
+	}
+	ct.audit(c, services.AuditDelete, services.AuditFlow, id, before, nil)
+	apiOK(c, http.StatusOK, gin.H{"id": id})
+}
+
+// APIRunFlow 异步执行任务流，执行结果通过 /api/v1/flow-logs 查询
+func (ct *Controller) APIRunFlow(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var exists bool
+	if err := ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM task_flows WHERE id=?)", id).Scan(&exists); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流失败: "+err.Error())
+		return
+	}
+	if !exists {
+		apiError(c, http.StatusNotFound, "任务流不存在")
+		return
+	}
+	if ct.sched.IsTaskFlowRunning(id) {
+		apiError(c, http.StatusConflict, "任务流正在运行中，请稍后再试")
+		return
+	}
+	ctx, ok := apiRunContext(c)
+	if !ok {
+		return
+	}
+	ct.auditAction(c, services.AuditRun, services.AuditFlow, id, runDetail(ctx))
+
+	go func() {
+		if err := ct.sched.RunTaskFlow(ctx, id); err != nil {
+			log.Printf("api: task flow %d execution failed: %v", id, err)
+		}
+	}()
+	apiOK(c, http.StatusAccepted, gin.H{"flow_id": id, "logs": fmt.Sprintf("/api/v1/flow-logs?flow_id=%d", id)})
+}
+
+// APIKillFlow 终止正在运行的任务流
+func (ct *Controller) APIKillFlow(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	if err := ct.sched.KillTaskFlow(id); err != nil {
+		apiError(c, http.StatusConflict, "无法终止: "+err.Error())
+		return
+	}
+	ct.auditAction(c, services.AuditKill, services.AuditFlow, id, "")
+	apiOK(c, http.StatusOK, gin.H{"flow_id": id})
+}
+
+// APIListSteps 列出任务流的步骤
+func (ct *Controller) APIListSteps(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var exists bool
+	ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM task_flows WHERE id=?)", id).Scan(&exists)
+	if !exists {
+		apiError(c, http.StatusNotFound, "任务流不存在")
+		return
+	}
+	steps, err := ct.flowSteps(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流步骤失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"steps": steps})
+}
+
+// APIAddStep 在任务流末尾添加步骤，支持 datax、check、sql 和 shell（仅管理员）
+func (ct *Controller) APIAddStep(c *gin.Context) {
+	flowID, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var req apiStepRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if !ct.editableFlow(c, flowID) {
+		return
+	}
+	if req.Type == "" {
+		req.Type = services.StepTypeDataX
+	}
+
+	var taskID, stepName, stepConfig any
+	if req.Type == services.StepTypeDataX {
+		// project_id 由 MustProjectRole 中间件设置
+		if err := ct.checkSameProject("tasks", req.TaskID, c.GetInt("project_id")); err == sql.ErrNoRows {
+			apiError(c, http.StatusBadRequest, "任务不存在")
+			return
+		} else if err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		taskID = req.TaskID
+	} else {
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			apiError(c, http.StatusBadRequest, "步骤名称不能为空")
+			return
+		}
+		if err := ct.checkDataSourcesUsable(c, c.GetInt("project_id"), req.DataSourceID); err != nil {
+			apiError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		var config string
+		var err error
+		switch req.Type {
+		case services.StepTypeCheck:
+			config, err = services.NewCheckConfig(req.DataSourceID, string(req.Assertions))
+		case services.StepTypeSQL:
+			config, err = services.NewSQLStepConfig(req.DataSourceID, req.SQL)
+		case services.StepTypeShell:
+			// Shell 脚本在服务器上执行，仅允许管理员添加
+			if ct.currentRole(c) != "admin" {
+				apiError(c, http.StatusForbidden, "仅管理员可以添加 Shell 步骤")
+				return
+			}
+			config, err = services.NewShellStepConfig(req.Script)
+		default:
+			apiError(c, http.StatusBadRequest, "不支持的步骤类型: "+req.Type)
+			return
+		}
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		stepName, stepConfig = name, config
+	}
+
+	var timeout *int
+	if req.TimeoutMinutes != nil && *req.TimeoutMinutes > 0 {
+		timeout = req.TimeoutMinutes
+	}
+
+	var maxOrder int
+	ct.db.QueryRow("SELECT COALESCE(MAX(step_order), 0) FROM task_flow_steps WHERE flow_id=?", flowID).Scan(&maxOrder)
+
+	uid := ct.GetCurrentUserID(c)
+	before := ct.snapshot(services.AuditFlow, flowID)
+	result, err := ct.db.Exec(`INSERT INTO task_flow_steps (flow_id, step_type, task_id, name, step_config, step_order, timeout_minutes, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, flowID, req.Type, taskID, stepName, stepConfig, maxOrder+1, timeout, uid, uid)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "添加步骤失败: "+err.Error())
+		return
+	}
+	stepID, _ := result.LastInsertId()
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
+	apiOK(c, http.StatusCreated, gin.H{"id": stepID, "step_order": maxOrder + 1})
+}
+
+// APIRemoveStep 删除步骤并压缩后续步骤的顺序
+func (ct *Controller) APIRemoveStep(c *gin.Context) {
+	flowID, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	stepID, ok := apiID(c, "step_id")
+	if !ok {
+		return
+	}
+	if !ct.editableFlow(c, flowID) {
+		return
+	}
+	before := ct.snapshot(services.AuditFlow, flowID)
+
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+
+	var order int
+	if err := tx.QueryRow("SELECT step_order FROM task_flow_steps WHERE id=? AND flow_id=?", stepID, flowID).Scan(&order); err != nil {
+		apiError(c, http.StatusNotFound, "步骤不存在")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM task_flow_steps WHERE id=? AND flow_id=?", stepID, flowID); err != nil {
+		apiError(c, http.StatusInternalServerError, "删除步骤失败: "+err.Error())
+		return
+	}
+	if _, err := tx.Exec("UPDATE task_flow_steps SET step_order = step_order - 1 WHERE flow_id = ? AND step_order > ?", flowID, order); err != nil {
+		apiError(c, http.StatusInternalServerError, "重新排序失败: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "提交事务失败")
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
+	apiOK(c, http.StatusOK, gin.H{"id": stepID})
+}
+
+// APIReorderSteps 按 step_ids 的顺序重排任务流的步骤，step_ids 必须恰好包含该任务流的全部步骤
+func (ct *Controller) APIReorderSteps(c *gin.Context) {
+	flowID, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		StepIDs []int `json:"step_ids"`
+	}
+	if !apiBind(c, &req) {
+		return
+	}
+	if !ct.editableFlow(c, flowID) {
+		return
+	}
+	before := ct.snapshot(services.AuditFlow, flowID)
+
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM task_flow_steps WHERE flow_id=?", flowID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流步骤失败: "+err.Error())
+		return
+	}
+	current := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			apiError(c, http.StatusInternalServerError, "查询任务流步骤失败: "+err.Error())
+			return
+		}
+		current[id] = true
+	}
+	rows.Close()
+
+	seen := make(map[int]bool)
+	for _, id := range req.StepIDs {
+		if !current[id] || seen[id] {
+			apiError(c, http.StatusBadRequest, fmt.Sprintf("步骤 %d 不属于该任务流或重复", id))
+			return
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(current) {
+		apiError(c, http.StatusBadRequest, "step_ids 必须包含该任务流的全部步骤")
+		return
+	}
+
+	// 先移到临时顺序，避免唯一键冲突
+	if _, err := tx.Exec("UPDATE task_flow_steps SET step_order = step_order + 10000 WHERE flow_id = ?", flowID); err != nil {
+		apiError(c, http.StatusInternalServerError, "设置临时顺序失败: "+err.Error())
+		return
+	}
+	for i, id := range req.StepIDs {
+		if _, err := tx.Exec("UPDATE task_flow_steps SET step_order=? WHERE id=? AND flow_id=?", i+1, id, flowID); err != nil {
+			apiError(c, http.StatusInternalServerError, "更新步骤顺序失败: "+err.Error())
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "提交事务失败")
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
+
+	steps, err := ct.flowSteps(flowID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流步骤失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"steps": steps})
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+
+	"com.duole/datax-web-go/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// APIListProjects 列出当前用户可访问的项目及其在项目中的角色，管理员返回全部项目
+func (ct *Controller) APIListProjects(c *gin.Context) {
+	projects, err := ct.accessibleProjects(c)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询项目失败: "+err.Error())
+		return
+	}
+	if projects == nil {
+		projects = []models.Project{}
+	}
+	apiOK(c, http.StatusOK, gin.H{"projects": projects})
+}
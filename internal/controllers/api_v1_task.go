@@ -0,0 +1,514 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
+	"github.com/gin-gonic/gin"
+)
+
+// apiTaskRequest 创建或更新任务的请求体。
+// json_config 可以是 DataX JSON 对象或其字符串形式；config 为与界面生成器相同的 ConfigRequest，两者二选一。
+// 更新时未提供的字段保持不变。
+type apiTaskRequest struct {
+	Name               *string              `json:"name"`
+	SourceID           int                  `json:"source_id"`
+	TargetID           int                  `json:"target_id"`
+	JSONConfig         json.RawMessage      `json:"json_config"`
+	Config             *datax.ConfigRequest `json:"config"`
+	Comment            string               `json:"comment"`
+	IncrColumn         *string              `json:"incr_column"`
+	ReconcileEnabled   *bool                `json:"reconcile_enabled"`
+	ReconcileTolerance *int                 `json:"reconcile_tolerance"`
+	FlowID             int                  `json:"flow_id"`    // 仅创建时有效，追加为该任务流的最后一个步骤
+	ProjectID          int                  `json:"project_id"` // 仅创建时有效，未指定时使用默认项目
+}
+
+// jobConfig 返回请求中的 DataX 配置（已格式化），未提供配置时返回空字符串。
+// 由 config 生成时，引用的数据源必须可以在任务所属的项目 projectID 中使用。
+func (ct *Controller) jobConfig(c *gin.Context, req *apiTaskRequest, projectID int) (string, error) {
+	if req.Config != nil {
+		if len(req.JSONConfig) > 0 {
+			return "", errors.New("json_config 和 config 只能提供一个")
+		}
+		if err := ct.checkDataSourcesUsable(c, projectID, req.Config.DataSourceIDs()...); err != nil {
+			return "", err
+		}
+		return datax.NewService(ct.db).BuildJSON(*req.Config)
+	}
+	if len(req.JSONConfig) == 0 || string(req.JSONConfig) == "null" {
+		return "", nil
+	}
+
+	raw := []byte(req.JSONConfig)
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		raw = []byte(s)
+	}
+	var job map[string]any
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return "", errors.New("json_config 不是有效的 JSON 对象")
+	}
+	pretty, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(pretty), nil
+}
+
+// loadAPITask 查询任务详情，包含配置和所属任务流
+func (ct *Controller) loadAPITask(c *gin.Context, id int) (*models.Task, error) {
+	var t models.Task
+	err := ct.db.QueryRow(`SELECT t.id, t.name, t.project_id, p.name, t.source_id, t.target_id, COALESCE(t.json_config,''), t.current_version,
+		       COALESCE(t.incr_column,''), t.reconcile_enabled, t.reconcile_tolerance, COALESCE(t.managed_by,''),
+		       COALESCE(s.name,''), COALESCE(g.name,''),
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), t.created_at, t.updated_at
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		LEFT JOIN data_sources s ON t.source_id = s.id
+		LEFT JOIN data_sources g ON t.target_id = g.id
+		LEFT JOIN users uc ON t.created_by = uc.id
+		LEFT JOIN users uu ON t.updated_by = uu.id
+		WHERE t.id=?`, id).
+		Scan(&t.ID, &t.Name, &t.ProjectID, &t.Project, &t.SourceID, &t.TargetID, &t.JsonConfig, &t.Version,
+			&t.IncrColumn, &t.ReconcileEnabled, &t.ReconcileTolerance, &t.ManagedBy,
+			&t.Source, &t.Target, &t.CreatedByName, &t.UpdatedByName, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := ct.taskFlowMemberships(c, id)
+	if err != nil {
+		return nil, err
+	}
+	t.Flows = memberships[id]
+	return &t, nil
+}
+
+// respondTask 返回任务详情
+func (ct *Controller) respondTask(c *gin.Context, status, id int) {
+	t, err := ct.loadAPITask(c, id)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "任务不存在")
+		return
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+		return
+	}
+	apiOK(c, status, t)
+}
+
+// APIListTasks 分页列出当前用户可访问项目中的任务（不含配置），支持名称关键字 q、project_id、source_id、target_id 和 flow_id 过滤
+func (ct *Controller) APIListTasks(c *gin.Context) {
+	page, pageSize := pagination(c)
+	scope, args := projectScope(c, "t.project_id")
+	where := "WHERE 1=1" + scope
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		where += " AND t.name LIKE ?"
+		args = append(args, "%"+q+"%")
+	}
+	for _, col := range []string{"project_id", "source_id", "target_id"} {
+		if v, _ := strconv.Atoi(c.Query(col)); v > 0 {
+			where += " AND t." + col + " = ?"
+			args = append(args, v)
+		}
+	}
+	if flowID, _ := strconv.Atoi(c.Query("flow_id")); flowID > 0 {
+		where += " AND EXISTS(SELECT 1 FROM task_flow_steps tfs WHERE tfs.task_id = t.id AND tfs.flow_id = ?)"
+		args = append(args, flowID)
+	}
+
+	var total int
+	if err := ct.db.QueryRow("SELECT COUNT(*) FROM tasks t "+where, args...).Scan(&total); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+		return
+	}
+
+	rows, err := ct.db.Query(`SELECT t.id, t.name, t.project_id, p.name, t.source_id, t.target_id, t.current_version,
+		       COALESCE(t.incr_column,''), t.reconcile_enabled, t.reconcile_tolerance, COALESCE(t.managed_by,''),
+		       COALESCE(s.name,''), COALESCE(g.name,''),
+		       COALESCE(uc.username, '系统'), COALESCE(uu.username, '系统'), t.created_at, t.updated_at
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		LEFT JOIN data_sources s ON t.source_id = s.id
+		LEFT JOIN data_sources g ON t.target_id = g.id
+		LEFT JOIN users uc ON t.created_by = uc.id
+		LEFT JOIN users uu ON t.updated_by = uu.id
+		`+where+` ORDER BY t.id DESC LIMIT ? OFFSET ?`, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	tasks := []models.Task{}
+	for rows.Next() {
+		var t models.Task
+		if err := rows.Scan(&t.ID, &t.Name, &t.ProjectID, &t.Project, &t.SourceID, &t.TargetID, &t.Version,
+			&t.IncrColumn, &t.ReconcileEnabled, &t.ReconcileTolerance, &t.ManagedBy,
+			&t.Source, &t.Target, &t.CreatedByName, &t.UpdatedByName, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+			return
+		}
+		tasks = append(tasks, t)
+	}
+
+	memberships, err := ct.taskFlowMemberships(c, 0)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流引用失败: "+err.Error())
+		return
+	}
+	for i := range tasks {
+		tasks[i].Flows = memberships[tasks[i].ID]
+	}
+	apiOK(c, http.StatusOK, apiPage("tasks", tasks, total, page, pageSize))
+}
+
+// APIGetTask 返回任务详情，包含 DataX 配置
+func (ct *Controller) APIGetTask(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	ct.respondTask(c, http.StatusOK, id)
+}
+
+// APICreateTask 创建任务并生成初始配置版本，可选追加到任务流
+func (ct *Controller) APICreateTask(c *gin.Context) {
+	var req apiTaskRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	name := ""
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if name == "" {
+		apiError(c, http.StatusBadRequest, "任务名称不能为空")
+		return
+	}
+	if req.SourceID <= 0 || req.TargetID <= 0 {
+		apiError(c, http.StatusBadRequest, "source_id 和 target_id 不能为空")
+		return
+	}
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := ct.checkDataSourcesUsable(c, projectID, req.SourceID, req.TargetID); err != nil {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	config, err := ct.jobConfig(c, &req, projectID)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if config == "" {
+		apiError(c, http.StatusBadRequest, "缺少 json_config 或 config")
+		return
+	}
+	incrColumn := ""
+	if req.IncrColumn != nil {
+		incrColumn = strings.TrimSpace(*req.IncrColumn)
+	}
+	if err := services.ValidateIncrColumn(incrColumn); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	reconcileEnabled := req.ReconcileEnabled != nil && *req.ReconcileEnabled
+	tolerance := 0
+	if req.ReconcileTolerance != nil {
+		if *req.ReconcileTolerance < 0 {
+			apiError(c, http.StatusBadRequest, "对账容忍度必须为非负整数")
+			return
+		}
+		tolerance = *req.ReconcileTolerance
+	}
+	if req.FlowID > 0 {
+		if ct.managedBy("task_flows", req.FlowID) != "" {
+			apiError(c, http.StatusForbidden, msgFlowManaged)
+			return
+		}
+		if err := ct.checkSameProject("task_flows", req.FlowID, projectID); err == sql.ErrNoRows {
+			apiError(c, http.StatusBadRequest, "任务流不存在")
+			return
+		} else if err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	userID := ct.GetCurrentUserID(c)
+	flowBefore := ct.snapshot(services.AuditFlow, req.FlowID)
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO tasks(name, project_id, source_id, target_id, json_config, incr_column, reconcile_enabled, reconcile_tolerance, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)`,
+		name, projectID, req.SourceID, req.TargetID, config, incrColumn, reconcileEnabled, tolerance, userID, userID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "创建任务失败: "+err.Error())
+		return
+	}
+	id64, _ := result.LastInsertId()
+	taskID := int(id64)
+
+	comment := strings.TrimSpace(req.Comment)
+	if comment == "" {
+		comment = "创建任务"
+	}
+	if _, err := services.SaveTaskConfig(tx, taskID, config, comment, userID); err != nil {
+		apiError(c, saveConfigStatus(err), err.Error())
+		return
+	}
+
+	if req.FlowID > 0 {
+		var maxOrder int
+		if err := tx.QueryRow("SELECT COALESCE(MAX(step_order), 0) FROM task_flow_steps WHERE flow_id=?", req.FlowID).Scan(&maxOrder); err != nil {
+			apiError(c, http.StatusInternalServerError, "获取步骤顺序失败")
+			return
+		}
+		if _, err := tx.Exec(`INSERT INTO task_flow_steps (flow_id, task_id, step_order, created_by, updated_by)
+			VALUES (?, ?, ?, ?, ?)`, req.FlowID, taskID, maxOrder+1, userID, userID); err != nil {
+			apiError(c, http.StatusInternalServerError, "添加任务到流程失败: "+err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "提交事务失败")
+		return
+	}
+	ct.audit(c, services.AuditCreate, services.AuditTask, taskID, nil, ct.snapshot(services.AuditTask, taskID))
+	if flowBefore != nil {
+		ct.audit(c, services.AuditUpdate, services.AuditFlow, req.FlowID, flowBefore, ct.snapshot(services.AuditFlow, req.FlowID))
+	}
+	ct.respondTask(c, http.StatusCreated, taskID)
+}
+
+// APIUpdateTask 更新任务配置、增量列和对账设置。配置变化时生成新版本，增量列变化时清除旧水位。
+func (ct *Controller) APIUpdateTask(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var req apiTaskRequest
+	if !apiBind(c, &req) {
+		return
+	}
+
+	var currentConfig, currentIncr, managed string
+	err := ct.db.QueryRow("SELECT COALESCE(json_config,''), COALESCE(incr_column,''), COALESCE(managed_by,'') FROM tasks WHERE id=?", id).
+		Scan(&currentConfig, &currentIncr, &managed)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "任务不存在")
+		return
+	} else if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+		return
+	}
+	if managed != "" {
+		apiError(c, http.StatusForbidden, msgTaskManaged)
+		return
+	}
+	if req.Name != nil || req.SourceID > 0 || req.TargetID > 0 || req.FlowID > 0 {
+		apiError(c, http.StatusBadRequest, "name、source_id、target_id 和 flow_id 不支持修改")
+		return
+	}
+
+	// project_id 由 MustProjectRole 中间件设置
+	config, err := ct.jobConfig(c, &req, c.GetInt("project_id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len([]rune(req.Comment)) > 255 {
+		apiError(c, http.StatusBadRequest, "变更说明不能超过255个字符")
+		return
+	}
+	if req.ReconcileTolerance != nil && *req.ReconcileTolerance < 0 {
+		apiError(c, http.StatusBadRequest, "对账容忍度必须为非负整数")
+		return
+	}
+	var incrColumn string
+	if req.IncrColumn != nil {
+		incrColumn = strings.TrimSpace(*req.IncrColumn)
+		if err := services.ValidateIncrColumn(incrColumn); err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	userID := ct.GetCurrentUserID(c)
+	before := ct.snapshot(services.AuditTask, id)
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+
+	if config != "" && services.NormalizeJSON(config) != services.NormalizeJSON(currentConfig) {
+		if _, err := services.SaveTaskConfig(tx, id, config, strings.TrimSpace(req.Comment), userID); err != nil {
+			apiError(c, saveConfigStatus(err), "更新任务失败: "+err.Error())
+			return
+		}
+	}
+	if req.IncrColumn != nil {
+		if _, err := tx.Exec("UPDATE tasks SET incr_column=NULLIF(?, ''), updated_by=? WHERE id=?", incrColumn, userID, id); err != nil {
+			apiError(c, http.StatusInternalServerError, "更新增量配置失败")
+			return
+		}
+	}
+	if req.ReconcileEnabled != nil {
+		if _, err := tx.Exec("UPDATE tasks SET reconcile_enabled=?, updated_by=? WHERE id=?", *req.ReconcileEnabled, userID, id); err != nil {
+			apiError(c, http.StatusInternalServerError, "更新对账配置失败")
+			return
+		}
+	}
+	if req.ReconcileTolerance != nil {
+		if _, err := tx.Exec("UPDATE tasks SET reconcile_tolerance=?, updated_by=? WHERE id=?", *req.ReconcileTolerance, userID, id); err != nil {
+			apiError(c, http.StatusInternalServerError, "更新对账配置失败")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "提交事务失败")
+		return
+	}
+
+	if req.IncrColumn != nil && incrColumn != currentIncr {
+		if err := services.ResetTaskWatermark(ct.db, id, "", userID); err != nil {
+			apiError(c, http.StatusInternalServerError, "清除增量水位失败")
+			return
+		}
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditTask, id, before, ct.snapshot(services.AuditTask, id))
+	ct.respondTask(c, http.StatusOK, id)
+}
+
+// APIDeleteTask 删除未被任何任务流引用的任务，连同其配置版本和增量水位
+func (ct *Controller) APIDeleteTask(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	if ct.managedBy("tasks", id) != "" {
+		apiError(c, http.StatusForbidden, msgTaskManaged)
+		return
+	}
+
+	memberships, err := ct.taskFlowMemberships(c, id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务流引用失败")
+		return
+	}
+	if flows := memberships[id]; len(flows) > 0 {
+		names := make([]string, 0, len(flows))
+		for _, f := range flows {
+			names = append(names, f.Name)
+		}
+		apiError(c, http.StatusConflict, "任务仍被以下任务流引用，请先从任务流中移除: "+strings.Join(names, "、"))
+		return
+	}
+
+	before := ct.snapshot(services.AuditTask, id)
+	tx, err := ct.db.Begin()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "删除任务失败: "+err.Error())
+		return
+	}
+	defer tx.Rollback()
+	deleted, err := services.DeleteTask(tx, id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "删除任务失败: "+err.Error())
+		return
+	}
+	if !deleted {
+		apiError(c, http.StatusNotFound, "任务不存在")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apiError(c, http.StatusInternalServerError, "删除任务失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditDelete, services.AuditTask, id, before, nil)
+	apiOK(c, http.StatusOK, gin.H{"id": id})
+}
+
+// APIRunTask 异步执行任务，执行结果通过 /api/v1/task-logs 查询
+func (ct *Controller) APIRunTask(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	var exists bool
+	if err := ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id=?)", id).Scan(&exists); err != nil {
+		apiError(c, http.StatusInternalServerError, "查询任务失败: "+err.Error())
+		return
+	}
+	if !exists {
+		apiError(c, http.StatusNotFound, "任务不存在")
+		return
+	}
+	if ct.sched.IsTaskRunning(id) {
+		apiError(c, http.StatusConflict, "任务正在运行中，请稍后再试")
+		return
+	}
+	ctx, ok := apiRunContext(c)
+	if !ok {
+		return
+	}
+	ct.auditAction(c, services.AuditRun, services.AuditTask, id, runDetail(ctx))
+
+	go func() {
+		if _, err := ct.sched.RunTask(ctx, id); err != nil {
+			log.Printf("api: task %d execution failed: %v", id, err)
+		}
+	}()
+	apiOK(c, http.StatusAccepted, gin.H{"task_id": id, "logs": "/api/v1/task-logs?task_id=" + strconv.Itoa(id)})
+}
+
+// APIRenderTask 返回任务按业务日期（date 参数，缺省为前一天）替换占位符后的 DataX 配置，
+// 增量任务同时注入当前水位对应的同步区间，与实际执行时使用的配置一致
+func (ct *Controller) APIRenderTask(c *gin.Context) {
+	id, ok := apiID(c, "id")
+	if !ok {
+		return
+	}
+	date := time.Now().AddDate(0, 0, -1)
+	if v := c.Query("date"); v != "" {
+		d, err := parseExecutionDate(v)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "无效的业务日期，格式应为 YYYY-MM-DD: "+v)
+			return
+		}
+		date = d
+	}
+
+	config, err := ct.sched.RenderTaskConfig(services.WithExecutionDate(context.Background(), date), id)
+	if err == sql.ErrNoRows {
+		apiError(c, http.StatusNotFound, "任务不存在")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "生成配置失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, gin.H{"task_id": id, "execution_date": date.Format("2006-01-02"), "json_config": config})
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// snapshot 返回对象的当前状态，用于记录审计变更
+func (ct *Controller) snapshot(objectType string, id int) map[string]any {
+	return services.AuditSnapshot(ct.db, objectType, id)
+}
+
+// audit 记录当前用户对对象的变更。before 为 nil 表示新建，after 为 nil 表示删除。
+// 审计写入失败只记录日志，不影响已完成的操作。
+func (ct *Controller) audit(c *gin.Context, action, objectType string, id int, before, after map[string]any) {
+	ct.recordAudit(c, services.AuditEntry{
+		Action:     action,
+		ObjectType: objectType,
+		ObjectID:   id,
+		ObjectName: auditName(after, before),
+		Changes:    services.AuditDiff(before, after),
+	})
+}
+
+// auditAction 记录执行、终止等不改变对象定义的操作，detail 为补充说明
+func (ct *Controller) auditAction(c *gin.Context, action, objectType string, id int, detail string) {
+	ct.recordAudit(c, services.AuditEntry{
+		Action:     action,
+		ObjectType: objectType,
+		ObjectID:   id,
+		ObjectName: auditName(ct.snapshot(objectType, id)),
+		Detail:     detail,
+	})
+}
+
+// runDetail 返回执行操作的审计说明，指定了业务日期时记录该日期
+func runDetail(ctx context.Context) string {
+	if date := services.ExecutionDateFrom(ctx); !date.IsZero() {
+		return "业务日期 " + date.Format("2006-01-02")
+	}
+	return ""
+}
+
+// auditImport 记录导入或 Git 同步实际写入的对象，source 说明变更来源
+func (ct *Controller) auditImport(c *gin.Context, result *services.ImportResult, source string) {
+	if result == nil || !result.Applied {
+		return
+	}
+	for _, item := range result.Items {
+		switch item.Action {
+		case services.AuditCreate, services.AuditUpdate, services.AuditDelete:
+			ct.recordAudit(c, services.AuditEntry{
+				Action:     item.Action,
+				ObjectType: item.Kind,
+				ObjectName: item.Name,
+				Detail:     source,
+			})
+		}
+	}
+}
+
+// recordAudit 补充操作人和客户端信息后写入审计记录
+func (ct *Controller) recordAudit(c *gin.Context, e services.AuditEntry) {
+	e.ActorID = ct.GetCurrentUserID(c)
+	e.Actor = c.GetString("user")
+	e.IP = c.ClientIP()
+	e.UserAgent = c.Request.UserAgent()
+	if err := services.RecordAudit(ct.db, e); err != nil {
+		log.Printf("audit: failed to record %s %s %d by %s: %v", e.Action, e.ObjectType, e.ObjectID, e.Actor, err)
+	}
+}
+
+// auditName 从快照中取对象名称，依次尝试各快照
+func auditName(snapshots ...map[string]any) string {
+	for _, s := range snapshots {
+		for _, key := range []string{"name", "username"} {
+			if name, ok := s[key].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// auditFilter 从查询参数解析审计记录的过滤条件
+func auditFilter(c *gin.Context) services.AuditFilter {
+	page, pageSize := pagination(c)
+	objectID, _ := strconv.Atoi(c.Query("object_id"))
+	return services.AuditFilter{
+		Actor:      strings.TrimSpace(c.Query("actor")),
+		Action:     c.Query("action"),
+		ObjectType: c.Query("object_type"),
+		ObjectID:   objectID,
+		Keyword:    strings.TrimSpace(c.Query("q")),
+		DateFrom:   c.Query("date_from"),
+		DateTo:     c.Query("date_to"),
+		Page:       page,
+		PageSize:   pageSize,
+	}
+}
+
+// AuditList 显示审计日志页面（仅管理员），支持按操作人、操作、对象和日期筛选
+func (ct *Controller) AuditList(c *gin.Context) {
+	filter := auditFilter(c)
+	logs, total, err := services.ListAuditLogs(ct.db, filter)
+	if err != nil {
+		c.String(500, "查询审计日志失败: "+err.Error())
+		return
+	}
+	totalPages := (total + filter.PageSize - 1) / filter.PageSize
+	page := gin.H{
+		"Logs":       logs,
+		"Filter":     filter,
+		"Total":      total,
+		"Page":       filter.Page,
+		"TotalPages": totalPages,
+	}
+	if filter.Page > 1 {
+		page["PrevURL"] = auditPageURL(c, filter.Page-1)
+	}
+	if filter.Page < totalPages {
+		page["NextURL"] = auditPageURL(c, filter.Page+1)
+	}
+	c.HTML(200, "audit/list.tmpl", page)
+}
+
+// auditPageURL 返回保留当前筛选条件的翻页链接
+func auditPageURL(c *gin.Context, page int) string {
+	query := c.Request.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return "/admin/audit?" + query.Encode()
+}
+
+// APIListAuditLogs 分页查询审计日志（仅管理员）
+func (ct *Controller) APIListAuditLogs(c *gin.Context) {
+	if ct.currentRole(c) != "admin" {
+		apiError(c, http.StatusForbidden, "仅管理员可以查看审计日志")
+		return
+	}
+	filter := auditFilter(c)
+	logs, total, err := services.ListAuditLogs(ct.db, filter)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "查询审计日志失败: "+err.Error())
+		return
+	}
+	apiOK(c, http.StatusOK, apiPage("audit_logs", logs, total, filter.Page, filter.PageSize))
+}
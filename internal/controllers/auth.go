@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 
 	"com.duole/datax-web-go/internal/services"
 	"github.com/gin-gonic/gin"
@@ -19,20 +22,41 @@ func NewAuthController(auth *services.AuthService) *AuthController {
 	}
 }
 
-// 中间件确保用户已登录。如果未登录，重定向到登录页面。
+// 中间件确保用户已登录。如果未登录，重定向到登录页面；
+// 密码被管理员重置后，修改密码前只能访问修改密码页面；
+// 角色要求两步验证但尚未启用时，只能访问两步验证绑定页面。
 func (ac *AuthController) MustLogin() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user, _ := ac.auth.CurrentUser(c.Request)
-		if user == "" {
+		u := ac.auth.Session(c.Request)
+		if u == nil {
 			c.Redirect(http.StatusFound, "/login")
 			c.Abort()
 			return
 		}
-		c.Set("user", user)
+		if u.MustChangePassword && c.FullPath() != passwordPath {
+			c.Redirect(http.StatusFound, passwordPath)
+			c.Abort()
+			return
+		}
+		if u.MustEnrollTwoFactor && c.FullPath() != twoFactorPath && c.FullPath() != passwordPath {
+			c.Redirect(http.StatusFound, twoFactorPath)
+			c.Abort()
+			return
+		}
+		c.Set("user", u.Username)
+		c.Set("user_id", u.UserID)
+		c.Set("session_id", u.SessionID)
+		c.Set("role", u.Role)
 		c.Next()
 	}
 }
 
+// passwordPath 修改密码页面
+const passwordPath = "/account/password"
+
+// twoFactorPath 两步验证设置页面
+const twoFactorPath = "/account/2fa"
+
 // 中间件确保用户具有管理员角色。非管理员用户
 // 被禁止访问包装的路由。
 func (ac *AuthController) MustAdmin() gin.HandlerFunc {
@@ -47,22 +71,144 @@ func (ac *AuthController) MustAdmin() gin.HandlerFunc {
 	}
 }
 
+// MustAPILogin 保护 /api/v1 路由：优先使用 Authorization: Bearer 令牌认证，
+// 未携带令牌时回退到浏览器会话。认证失败返回 JSON 错误而不是重定向。
+func (ac *AuthController) MustAPILogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Authorization 头格式应为 Bearer <令牌>"})
+				return
+			}
+			userID, user, role, err := ac.auth.AuthenticateToken(strings.TrimSpace(token))
+			if err == services.ErrTokenPasswordChange || err == services.ErrTokenTwoFactorEnroll {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": err.Error()})
+				return
+			}
+			c.Set("user", user)
+			c.Set("user_id", userID)
+			c.Set("role", role)
+			c.Next()
+			return
+		}
+
+		u := ac.auth.Session(c.Request)
+		if u == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "error": "未登录或缺少 API 令牌"})
+			return
+		}
+		if u.MustChangePassword {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "请先修改密码"})
+			return
+		}
+		if u.MustEnrollTwoFactor {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "请先启用两步验证"})
+			return
+		}
+		c.Set("user", u.Username)
+		c.Set("user_id", u.UserID)
+		c.Set("role", u.Role)
+		c.Next()
+	}
+}
+
 // ShowLogin 渲染登录页面
 func (ac *AuthController) ShowLogin(c *gin.Context) {
-	c.HTML(200, "login.tmpl", gin.H{})
+	c.HTML(200, "login.tmpl", gin.H{"OIDC": ac.auth.OIDCEnabled()})
 }
 
 // DoLogin 处理登录表单提交
 func (ac *AuthController) DoLogin(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
-	if _, err := ac.auth.Login(c.Writer, c.Request, username, password); err != nil {
-		c.HTML(401, "login.tmpl", gin.H{"Error": "用户名或密码错误"})
+	var locked *services.LoginLockedError
+	if _, err := ac.auth.Login(c.Writer, withClientIP(c), username, password); err == services.ErrTwoFactorRequired {
+		c.Redirect(http.StatusFound, "/login/2fa")
+		return
+	} else if errors.As(err, &locked) {
+		c.HTML(http.StatusTooManyRequests, "login.tmpl", gin.H{"Error": locked.Error(), "OIDC": ac.auth.OIDCEnabled()})
+		return
+	} else if err != nil {
+		c.HTML(401, "login.tmpl", gin.H{"Error": "用户名或密码错误", "OIDC": ac.auth.OIDCEnabled()})
 		return
 	}
 	c.Redirect(302, "/tasks")
 }
 
+// ShowTwoFactor 渲染登录时输入两步验证码的页面
+func (ac *AuthController) ShowTwoFactor(c *gin.Context) {
+	if !ac.auth.TwoFactorPending(c.Request) {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	c.HTML(http.StatusOK, "login_2fa.tmpl", gin.H{})
+}
+
+// DoTwoFactor 校验登录时输入的两步验证码或恢复码
+func (ac *AuthController) DoTwoFactor(c *gin.Context) {
+	err := ac.auth.CompleteTwoFactor(c.Writer, withClientIP(c), c.PostForm("code"))
+	var locked *services.LoginLockedError
+	switch {
+	case err == nil:
+		c.Redirect(http.StatusFound, "/tasks")
+	case err == services.ErrInvalidTwoFactorCode:
+		c.HTML(http.StatusUnauthorized, "login_2fa.tmpl", gin.H{"Error": "验证码错误，请重试"})
+	case errors.As(err, &locked):
+		c.HTML(http.StatusTooManyRequests, "login.tmpl", gin.H{"Error": locked.Error(), "OIDC": ac.auth.OIDCEnabled()})
+	default:
+		c.HTML(http.StatusUnauthorized, "login.tmpl", gin.H{"Error": "验证已超时或失败次数过多，请重新登录", "OIDC": ac.auth.OIDCEnabled()})
+	}
+}
+
+// OIDCLogin 跳转到身份提供方进行单点登录
+func (ac *AuthController) OIDCLogin(c *gin.Context) {
+	if !ac.auth.OIDCEnabled() {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	url, err := ac.auth.BeginOIDC(c.Writer, c.Request)
+	if err != nil {
+		log.Printf("auth: failed to start oidc login: %v", err)
+		c.HTML(http.StatusBadGateway, "login.tmpl", gin.H{"Error": "无法连接单点登录服务，请稍后重试", "OIDC": true})
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+// OIDCCallback 处理身份提供方的回调，校验通过后登录
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	if !ac.auth.OIDCEnabled() {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		msg := "单点登录失败: " + errCode
+		if desc := c.Query("error_description"); desc != "" {
+			msg += "（" + desc + "）"
+		}
+		c.HTML(http.StatusUnauthorized, "login.tmpl", gin.H{"Error": msg, "OIDC": true})
+		return
+	}
+	if _, err := ac.auth.FinishOIDC(c.Writer, withClientIP(c), c.Query("state"), c.Query("code")); err == services.ErrTwoFactorRequired {
+		c.Redirect(http.StatusFound, "/login/2fa")
+		return
+	} else if err != nil {
+		c.HTML(http.StatusUnauthorized, "login.tmpl", gin.H{"Error": "单点登录失败: " + err.Error(), "OIDC": true})
+		return
+	}
+	c.Redirect(http.StatusFound, "/tasks")
+}
+
+// withClientIP 返回携带客户端 IP 的请求，登录时记录在会话中
+func withClientIP(c *gin.Context) *http.Request {
+	return c.Request.WithContext(services.WithClientIP(c.Request.Context(), c.ClientIP()))
+}
+
 // Logout 处理登出
 func (ac *AuthController) Logout(c *gin.Context) {
 	ac.auth.Logout(c.Writer, c.Request)
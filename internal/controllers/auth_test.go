@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// rejectAll 拒绝所有登录的认证器
+type rejectAll struct{}
+
+func (rejectAll) Name() string { return services.AuthSourceLocal }
+func (rejectAll) Authenticate(string, string) (*services.Identity, error) {
+	return nil, services.ErrInvalidCredentials
+}
+
+func TestLoginLockoutIgnoresForgedForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		headers []string
+		wantKey string
+	}{
+		{
+			name:    "no trusted proxies",
+			remote:  "198.51.100.7:40000",
+			headers: []string{"10.0.0.1", "10.0.0.2", "203.0.113.9", "1.1.1.1, 2.2.2.2"},
+			wantKey: "198.51.100.7",
+		},
+		{
+			// 经可信代理转发时取最右侧的非代理地址，客户端自行添加的前缀无效
+			name:    "behind trusted proxy",
+			trusted: []string{"192.0.2.0/24"},
+			remote:  "192.0.2.10:40000",
+			headers: []string{"10.0.0.1, 198.51.100.7", "10.0.0.2, 198.51.100.7", "198.51.100.7", "1.1.1.1,198.51.100.7"},
+			wantKey: "198.51.100.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := &fakeLoginFailures{limit: 3, counts: map[string]int{}}
+			db := openFakeLoginFailures(t, failures)
+			auth := services.NewAuthService(db, sessions.NewCookieStore([]byte("test")), rejectAll{})
+			auth.SetLoginThrottle(services.NewLoginThrottle(db, util.LoginLockoutConfig{
+				MaxFailures: 100, IPMaxFailures: 3, WindowMinutes: 15, LockoutMinutes: 15,
+			}))
+			ct := NewController(db, auth, &util.Config{TrustedProxies: tt.trusted}, nil)
+			gin.SetMode(gin.TestMode)
+			r, err := ct.NewEngine()
+			if err != nil {
+				t.Fatalf("NewEngine: %v", err)
+			}
+			r.SetHTMLTemplate(template.Must(template.New("login.tmpl").Parse("{{.Error}}")))
+			r.POST("/login", ct.DoLogin)
+
+			// 每次更换用户名并伪造不同的 X-Forwarded-For，失败仍计入同一个来源 IP
+			var codes []int
+			for i, xff := range tt.headers {
+				form := url.Values{"username": {fmt.Sprintf("guess%d", i)}, "password": {"wrong"}}
+				req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("X-Forwarded-For", xff)
+				req.RemoteAddr = tt.remote
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				codes = append(codes, w.Code)
+			}
+
+			if got := failures.keys(); len(got) != 1 || got[0] != tt.wantKey {
+				t.Fatalf("failures counted for IPs %v, want only %s", got, tt.wantKey)
+			}
+			want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+			if fmt.Sprint(codes) != fmt.Sprint(want) {
+				t.Fatalf("status codes = %v, want %v", codes, want)
+			}
+		})
+	}
+}
+
+// fakeLoginFailures 内存中的 login_failures 表，只统计来源 IP 维度的失败次数。
+// 驱动按语句操作的表识别语句，不依赖语句的具体写法
+type fakeLoginFailures struct {
+	mu     sync.Mutex
+	limit  int
+	counts map[string]int
+}
+
+func (f *fakeLoginFailures) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.counts {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+var (
+	loginFailuresOnce sync.Once
+	loginFailuresMu   sync.Mutex
+	loginFailuresDBs  = map[string]*fakeLoginFailures{}
+)
+
+func openFakeLoginFailures(t *testing.T, f *fakeLoginFailures) *sql.DB {
+	t.Helper()
+	loginFailuresOnce.Do(func() { sql.Register("fakeloginfailures", loginFailuresDriver{}) })
+	loginFailuresMu.Lock()
+	loginFailuresDBs[t.Name()] = f
+	loginFailuresMu.Unlock()
+	db, err := sql.Open("fakeloginfailures", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type loginFailuresDriver struct{}
+
+func (loginFailuresDriver) Open(name string) (driver.Conn, error) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	f, ok := loginFailuresDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %s", name)
+	}
+	return &loginFailuresConn{f: f}, nil
+}
+
+type loginFailuresConn struct{ f *fakeLoginFailures }
+
+func (c *loginFailuresConn) Prepare(query string) (driver.Stmt, error) {
+	return &loginFailuresStmt{f: c.f, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *loginFailuresConn) Close() error { return nil }
+func (c *loginFailuresConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("fake db: transactions unsupported")
+}
+
+type loginFailuresStmt struct {
+	f     *fakeLoginFailures
+	query string
+}
+
+func (s *loginFailuresStmt) Close() error  { return nil }
+func (s *loginFailuresStmt) NumInput() int { return -1 }
+
+// Exec 记录写入 login_failures 的失败，参数依次为维度和键
+func (s *loginFailuresStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO login_failures"):
+		if args[0] == "ip" {
+			s.f.mu.Lock()
+			s.f.counts[args[1].(string)]++
+			s.f.mu.Unlock()
+		}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "DELETE FROM login_failures"):
+		return driver.RowsAffected(0), nil
+	}
+	return nil, fmt.Errorf("fake db: unsupported exec %q", s.query)
+}
+
+// Query 回答锁定检查：来源 IP 的失败次数达到上限时返回剩余的锁定秒数，参数依次为账户维度、账户、IP 维度和 IP
+func (s *loginFailuresStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.Contains(s.query, "FROM login_failures") || len(args) != 4 {
+		return nil, fmt.Errorf("fake db: unsupported query %q", s.query)
+	}
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	var remaining driver.Value
+	if s.f.counts[args[3].(string)] >= s.f.limit {
+		remaining = int64(900)
+	}
+	return &singleRow{value: remaining}, nil
+}
+
+type singleRow struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *singleRow) Columns() []string { return []string{"remaining"} }
+func (r *singleRow) Close() error      { return nil }
+func (r *singleRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
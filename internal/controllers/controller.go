@@ -3,9 +3,11 @@ package controllers
 import (
 	"database/sql"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"net/http"
 
 	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
 	"com.duole/datax-web-go/internal/util"
 )
 
@@ -35,6 +37,16 @@ func NewController(db *sql.DB, auth *services.AuthService, cfg *util.Config, sch
 	}
 }
 
+// NewEngine 创建 gin 引擎。只有来自 trusted_proxies 的请求才按 X-Forwarded-For 取客户端 IP，
+// 未配置时不信任任何代理，避免伪造请求头绕过按 IP 的登录锁定或篡改审计日志中的 IP
+func (ct *Controller) NewEngine() (*gin.Engine, error) {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(ct.cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // 委托给专门的控制器
 func (ct *Controller) MustLogin() gin.HandlerFunc {
 	return ct.authController.MustLogin()
@@ -44,6 +56,14 @@ func (ct *Controller) MustAdmin() gin.HandlerFunc {
 	return ct.authController.MustAdmin()
 }
 
+func (ct *Controller) MustAPILogin() gin.HandlerFunc {
+	return ct.authController.MustAPILogin()
+}
+
+func (ct *Controller) CSRF() gin.HandlerFunc {
+	return ct.authController.CSRF()
+}
+
 func (ct *Controller) ShowLogin(c *gin.Context) {
 	ct.authController.ShowLogin(c)
 }
@@ -52,11 +72,45 @@ func (ct *Controller) DoLogin(c *gin.Context) {
 	ct.authController.DoLogin(c)
 }
 
+func (ct *Controller) ShowTwoFactor(c *gin.Context) {
+	ct.authController.ShowTwoFactor(c)
+}
+
+func (ct *Controller) DoTwoFactor(c *gin.Context) {
+	ct.authController.DoTwoFactor(c)
+}
+
+func (ct *Controller) OIDCLogin(c *gin.Context) {
+	ct.authController.OIDCLogin(c)
+}
+
+func (ct *Controller) OIDCCallback(c *gin.Context) {
+	ct.authController.OIDCCallback(c)
+}
+
 func (ct *Controller) Logout(c *gin.Context) {
 	ct.authController.Logout(c)
 }
 
+// DataXPreview 预览新建任务的配置，引用的数据源必须可以在新任务所属的项目（请求中的 project_id）中使用
 func (ct *Controller) DataXPreview(c *gin.Context) {
+	var req struct {
+		datax.ConfigRequest
+		ProjectID int `json:"project_id"`
+	}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请求体无效"})
+		return
+	}
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if err := ct.checkDataSourcesUsable(c, projectID, req.DataSourceIDs()...); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
 	ct.dataxController.DataXConfPreview(c)
 }
 
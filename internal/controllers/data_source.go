@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
 	"database/sql"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -19,6 +21,7 @@ type DSFields struct {
 	DBURL        string
 	DBUser       string
 	DBPassword   string
+	PasswordRef  string // 外部密码来源，设置后不使用 DBPassword
 	DBDatabase   string
 	DefaultFS    string
 	HadoopConfig string
@@ -32,6 +35,7 @@ func (ct *Controller) getDSFields(c *gin.Context, dsType string) DSFields {
 		fields.DBURL = strings.TrimSpace(c.PostForm("db_url"))
 		fields.DBUser = strings.TrimSpace(c.PostForm("db_user"))
 		fields.DBPassword = c.PostForm("db_password")
+		fields.PasswordRef = strings.TrimSpace(c.PostForm("db_password_ref"))
 		fields.DBDatabase = strings.TrimSpace(c.PostForm("db_database"))
 	} else {
 		fields.DefaultFS = strings.TrimSpace(c.PostForm("defaultfs"))
@@ -41,37 +45,49 @@ func (ct *Controller) getDSFields(c *gin.Context, dsType string) DSFields {
 	return fields
 }
 
-// DSList 显示所有配置的数据源
+// DSList 显示当前用户可访问项目中的数据源
 func (ct *Controller) DSList(c *gin.Context) {
+	scope, args := projectScope(c, "ds.project_id")
 	query := `
-		SELECT ds.id, ds.name, ds.type, 
+		SELECT ds.id, ds.name, ds.type, ds.project_id, p.name,
 		       COALESCE(uc.username, '系统') as created_by_name,
 		       COALESCE(uu.username, '系统') as updated_by_name,
 		       ds.created_at
 		FROM data_sources ds
+		JOIN projects p ON ds.project_id = p.id
 		LEFT JOIN users uc ON ds.created_by = uc.id
 		LEFT JOIN users uu ON ds.updated_by = uu.id
+		WHERE 1=1` + scope + `
 		ORDER BY ds.id DESC
 	`
-	rows, _ := ct.db.Query(query)
+	rows, err := ct.db.Query(query, args...)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取数据源失败: %v", err))
+		return
+	}
 	defer rows.Close()
 
 	var list []models.DataSource
 	for rows.Next() {
 		var d models.DataSource
-		rows.Scan(&d.ID, &d.Name, &d.Type, &d.CreatedByName, &d.UpdatedByName, &d.CreatedAt)
+		rows.Scan(&d.ID, &d.Name, &d.Type, &d.ProjectID, &d.Project, &d.CreatedByName, &d.UpdatedByName, &d.CreatedAt)
 		list = append(list, d)
 	}
-	c.HTML(200, "data_source/list.tmpl", gin.H{"DataSources": list})
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+	c.HTML(200, "data_source/list.tmpl", gin.H{"DataSources": list, "Projects": projects})
 }
 
 // DSGetOneJSON 返回单个数据源作为 JSON 用于内联编辑器
 func (ct *Controller) DSGetOneJSON(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var ds models.DataSource
-	query := `SELECT id,name,type,db_url,db_user,db_database,defaultfs,hadoopconfig FROM data_sources WHERE id=?`
+	query := `SELECT id,name,project_id,type,db_url,db_user,db_password_ref,db_database,defaultfs,hadoopconfig FROM data_sources WHERE id=?`
 	err := ct.db.QueryRow(query, id).
-		Scan(&ds.ID, &ds.Name, &ds.Type, &ds.DBURL, &ds.DBUser, &ds.DBDatabase, &ds.DefaultFS, &ds.HadoopConfig)
+		Scan(&ds.ID, &ds.Name, &ds.ProjectID, &ds.Type, &ds.DBURL, &ds.DBUser, &ds.DBPasswordRef, &ds.DBDatabase, &ds.DefaultFS, &ds.HadoopConfig)
 
 	if err != nil {
 		c.JSON(404, gin.H{"error": "数据源不存在"})
@@ -88,19 +104,37 @@ func (ct *Controller) DSCreate(c *gin.Context) {
 	uid := ct.GetCurrentUserID(c)
 	fields := ct.getDSFields(c, typ)
 
-	var err error
+	requested, _ := strconv.Atoi(c.PostForm("project_id"))
+	projectID, err := ct.checkCreateProject(c, requested)
+	if err != nil {
+		c.String(403, err.Error())
+		return
+	}
+
+	var result sql.Result
 	if typ == DSTypeMySQL {
-		query := `INSERT INTO data_sources(name,type,db_url,db_user,db_password,db_database,created_by,updated_by) VALUES(?,?,?,?,?,?,?,?)`
-		_, err = ct.db.Exec(query, name, typ, fields.DBURL, fields.DBUser, fields.DBPassword, fields.DBDatabase, uid, uid)
+		if err := datax.CheckPasswordRef(fields.PasswordRef); err != nil {
+			c.String(400, err.Error())
+			return
+		}
+		var password string
+		if password, err = datax.EncryptPassword(fields.DBPassword); err != nil {
+			c.String(500, "加密密码失败: "+err.Error())
+			return
+		}
+		query := `INSERT INTO data_sources(name,project_id,type,db_url,db_user,db_password,db_password_ref,db_database,created_by,updated_by) VALUES(?,?,?,?,?,?,NULLIF(?,''),?,?,?)`
+		result, err = ct.db.Exec(query, name, projectID, typ, fields.DBURL, fields.DBUser, password, fields.PasswordRef, fields.DBDatabase, uid, uid)
 	} else {
-		query := `INSERT INTO data_sources(name,type,defaultfs,hadoopconfig,created_by,updated_by) VALUES(?,?,?,?,?,?)`
-		_, err = ct.db.Exec(query, name, typ, fields.DefaultFS, fields.HadoopConfig, uid, uid)
+		query := `INSERT INTO data_sources(name,project_id,type,defaultfs,hadoopconfig,created_by,updated_by) VALUES(?,?,?,?,?,?,?)`
+		result, err = ct.db.Exec(query, name, projectID, typ, fields.DefaultFS, fields.HadoopConfig, uid, uid)
 	}
 
 	if err != nil {
 		c.String(500, "创建数据源失败: "+err.Error())
 		return
 	}
+	id, _ := result.LastInsertId()
+	ct.audit(c, services.AuditCreate, services.AuditDataSource, int(id), nil, ct.snapshot(services.AuditDataSource, int(id)))
 
 	c.Redirect(302, "/data-sources")
 }
@@ -112,14 +146,27 @@ func (ct *Controller) DSUpdate(c *gin.Context) {
 	name := strings.TrimSpace(c.PostForm("name"))
 	uid := ct.GetCurrentUserID(c)
 	fields := ct.getDSFields(c, typ)
+	before := ct.snapshot(services.AuditDataSource, id)
 
 	if typ == DSTypeMySQL {
-		query := `UPDATE data_sources SET name=?,db_url=?,db_user=?,db_password=?,db_database=?,updated_by=? WHERE id=?`
-		ct.db.Exec(query, name, fields.DBURL, fields.DBUser, fields.DBPassword, fields.DBDatabase, uid, id)
+		if err := datax.CheckPasswordRef(fields.PasswordRef); err != nil {
+			c.String(400, err.Error())
+			return
+		}
+		password, err := datax.EncryptPassword(fields.DBPassword)
+		if err != nil {
+			c.String(500, "加密密码失败: "+err.Error())
+			return
+		}
+		query := `UPDATE data_sources SET name=?,db_url=?,db_user=?,db_password=?,db_password_ref=NULLIF(?,''),db_database=?,updated_by=? WHERE id=?`
+		ct.db.Exec(query, name, fields.DBURL, fields.DBUser, password, fields.PasswordRef, fields.DBDatabase, uid, id)
 	} else {
 		query := `UPDATE data_sources SET name=?,defaultfs=?,hadoopconfig=?,updated_by=? WHERE id=?`
 		ct.db.Exec(query, name, fields.DefaultFS, fields.HadoopConfig, uid, id)
 	}
+	if before != nil {
+		ct.audit(c, services.AuditUpdate, services.AuditDataSource, id, before, ct.snapshot(services.AuditDataSource, id))
+	}
 
 	c.Redirect(302, "/data-sources")
 }
@@ -127,6 +174,7 @@ func (ct *Controller) DSUpdate(c *gin.Context) {
 // DSDelete 删除数据源
 func (ct *Controller) DSDelete(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	before := ct.snapshot(services.AuditDataSource, id)
 	query := "DELETE FROM data_sources WHERE id=?"
 	result, err := ct.db.Exec(query, id)
 	if err != nil {
@@ -139,6 +187,7 @@ func (ct *Controller) DSDelete(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "数据源不存在"})
 		return
 	}
+	ct.audit(c, services.AuditDelete, services.AuditDataSource, id, before, nil)
 
 	c.JSON(200, gin.H{"message": "删除成功", "redirect": "/data-sources"})
 }
@@ -149,7 +198,9 @@ type ConnTestRequest struct {
 	DBURL      string `json:"db_url"`
 	DBUser     string `json:"db_user"`
 	DBPassword string `json:"db_password"`
-	DBDatabase string `json:"db_database"`
+	// PasswordRef 新建时填写的外部密码来源，只能在保存后测试，避免读取密钥后发往任意地址
+	PasswordRef string `json:"db_password_ref"`
+	DBDatabase  string `json:"db_database"`
 }
 
 // DSConnTest 测试数据源连接
@@ -162,16 +213,31 @@ func (ct *Controller) DSConnTest(c *gin.Context) {
 
 	var url, user, pass, dbname string
 
-	// 尝试从ID获取数据源信息（用于编辑时的测试）
+	// 尝试从ID获取数据源信息（用于编辑时的测试），只有项目编辑者可以使用已保存的密码
 	if request.ID != "" {
 		if id, err := strconv.Atoi(request.ID); err == nil {
-			query := `SELECT db_url,db_user,db_password,db_database FROM data_sources WHERE id=? AND type=?`
-			ct.db.QueryRow(query, id, DSTypeMySQL).Scan(&url, &user, &pass, &dbname)
+			var projectID int
+			var passRef string
+			query := `SELECT project_id,db_url,db_user,COALESCE(db_password,''),COALESCE(db_password_ref,''),db_database FROM data_sources WHERE id=? AND type=?`
+			if ct.db.QueryRow(query, id, DSTypeMySQL).Scan(&projectID, &url, &user, &pass, &passRef, &dbname) == nil {
+				if !ct.requireProjectRole(c, projectID, services.ProjectEditor) {
+					return
+				}
+				var err error
+				if pass, err = datax.ResolvePassword(pass, passRef); err != nil {
+					c.JSON(200, gin.H{"success": false, "error": "获取密码失败: " + err.Error()})
+					return
+				}
+			}
 		}
 	}
 
 	// 如果从数据库没有获取到数据，则从请求数据获取（用于新建时的测试）
 	if url == "" {
+		if strings.TrimSpace(request.PasswordRef) != "" {
+			c.JSON(200, gin.H{"success": false, "error": "使用外部密码来源时请先保存数据源再测试连接"})
+			return
+		}
 		url = strings.TrimSpace(request.DBURL)
 		user = strings.TrimSpace(request.DBUser)
 		pass = request.DBPassword
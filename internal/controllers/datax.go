@@ -6,6 +6,7 @@ import (
 
 	"com.duole/datax-web-go/internal/services/datax"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // DataXController 处理 DataX 相关的 HTTP 请求
@@ -22,7 +23,7 @@ func NewDataXController(db *sql.DB) *DataXController {
 
 func (ct *DataXController) DataXConfPreview(c *gin.Context) {
 	var req datax.ConfigRequest
-	if err := c.BindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "请求体无效",
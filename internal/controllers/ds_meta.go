@@ -5,20 +5,21 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"strconv"
+
+	"com.duole/datax-web-go/internal/services/datax"
 )
 
 // MetaColumns 列出 MySQL 数据源表的列。
 func (ct *Controller) MetaColumns(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	table := c.Param("table")
-	var url, user, pass, dbname string
-	err := ct.db.QueryRow(`SELECT db_url,db_user,db_password,db_database FROM data_sources WHERE id=? AND type='mysql'`, id).
-		Scan(&url, &user, &pass, &dbname)
+	conn, err := datax.GetMySQLConnection(ct.db, id)
 	if err != nil {
 		c.JSON(400, gin.H{"error": "仅支持 MySQL 元数据或配置缺失"})
 		return
 	}
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true", user, pass, url, dbname)
+	dbname := conn.DB
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true", conn.User, conn.Pass, conn.Host, dbname)
 	dbc, openErr := sql.Open("mysql", dsn)
 	if openErr != nil {
 		c.JSON(500, gin.H{"error": "连接源库失败"})
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GitOpsPlan 显示 Git 目录与数据库之间的同步计划（不写入数据）
+func (ct *Controller) GitOpsPlan(c *gin.Context) {
+	ct.renderGitOps(c, true)
+}
+
+// GitOpsSync 管理员手动触发 Git 目录同步；存在冲突时不写入任何数据
+func (ct *Controller) GitOpsSync(c *gin.Context) {
+	ct.renderGitOps(c, false)
+}
+
+func (ct *Controller) renderGitOps(c *gin.Context, dryRun bool) {
+	page := gin.H{"Dir": ct.cfg.GitOpsDir, "DryRun": dryRun}
+	if ct.cfg.GitOpsDir == "" {
+		c.HTML(200, "gitops/sync.tmpl", page)
+		return
+	}
+
+	result, err := services.SyncGitOps(ct.db, ct.cfg.GitOpsDir, dryRun, ct.cfg.GitOpsAllowShell, ct.GetCurrentUserID(c))
+	if err != nil {
+		page["Error"] = err.Error()
+		c.HTML(200, "gitops/sync.tmpl", page)
+		return
+	}
+	if result.Applied {
+		ct.rescheduleImported(result)
+		ct.auditImport(c, result, "Git 同步")
+	}
+
+	page["Result"] = result
+	page["Summary"] = importSummary(result)
+	c.HTML(200, "gitops/sync.tmpl", page)
+}
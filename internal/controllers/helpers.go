@@ -1,14 +1,20 @@
 package controllers
 
 import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
 	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
 	"github.com/gin-gonic/gin"
-	"log"
 )
 
-// GetDataSourcesByType 按类型检索数据源
-func (ct *Controller) GetDataSourcesByType(srcType string) ([]models.DataSource, error) {
-	rows, err := ct.db.Query("SELECT id,name FROM data_sources WHERE type=?", srcType)
+// GetDataSourcesByType 按类型检索当前用户可访问项目中的数据源
+func (ct *Controller) GetDataSourcesByType(c *gin.Context, srcType string) ([]models.DataSource, error) {
+	scope, args := projectScope(c, "project_id")
+	rows, err := ct.db.Query("SELECT id,name FROM data_sources WHERE type=?"+scope, append([]any{srcType}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -26,10 +32,59 @@ func (ct *Controller) GetDataSourcesByType(srcType string) ([]models.DataSource,
 	return sources, nil
 }
 
-// GetCurrentUserID 从请求中获取当前用户 ID
+// GetCurrentUserID 从请求中获取当前用户 ID，API 令牌认证时直接使用令牌所属用户
 func (ct *Controller) GetCurrentUserID(c *gin.Context) int {
+	if id := c.GetInt("user_id"); id > 0 {
+		return id
+	}
 	user, _ := ct.auth.CurrentUser(c.Request)
 	var uid int
 	ct.db.QueryRow("SELECT id FROM users WHERE username=?", user).Scan(&uid)
 	return uid
 }
+
+// currentRole 返回当前用户角色，API 令牌认证时使用令牌所属用户的角色
+func (ct *Controller) currentRole(c *gin.Context) string {
+	if role := c.GetString("role"); role != "" {
+		return role
+	}
+	_, role := ct.auth.CurrentUser(c.Request)
+	return role
+}
+
+// saveConfigStatus 返回保存任务配置失败时的状态码，引用了无权使用的数据源属于请求错误
+func saveConfigStatus(err error) int {
+	if errors.Is(err, datax.ErrRefOutOfScope) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// pagination 解析 page 和 page_size 查询参数，page_size 限制在 1-200 之间
+func pagination(c *gin.Context) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 200 {
+		pageSize = 200
+	}
+	return page, pageSize
+}
+
+// 由 Git 同步管理的对象在界面中只读，修改需在仓库中完成
+const (
+	msgTaskManaged = "该任务由 Git 目录同步管理，请修改仓库中的定义后同步"
+	msgFlowManaged = "该任务流由 Git 目录同步管理，请修改仓库中的定义后同步"
+)
+
+// managedBy 返回任务或任务流的管理来源，空字符串表示可在界面中编辑
+func (ct *Controller) managedBy(table string, id int) string {
+	var managed string
+	ct.db.QueryRow("SELECT COALESCE(managed_by,'') FROM "+table+" WHERE id=?", id).Scan(&managed)
+	return managed
+}
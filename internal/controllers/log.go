@@ -24,25 +24,41 @@ func NewLogController(db *sql.DB) *LogController {
 // GetTaskLogs 获取任务执行日志列表（支持独立任务和任务流步骤）
 func (lc *LogController) GetTaskLogs(c *gin.Context) {
 	// 获取查询参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := pagination(c)
 	status := c.Query("status")
 	taskName := c.Query("task_name")
 	executionType := c.Query("execution_type") // scheduled, manual
+	reconcileStatus := c.Query("reconcile_status")
 	dateFrom := c.Query("date_from")
 	dateTo := c.Query("date_to")
 
-	// 构建查询条件
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	// 构建查询条件，只返回当前用户可访问项目中的日志：任务流步骤归属任务流所在项目，独立任务归属任务所在项目
+	scope, args := projectScope(c, `COALESCE((SELECT f.project_id FROM task_flow_executions e
+		JOIN task_flows f ON e.flow_id = f.id WHERE e.id = tl.flow_execution_id), t.project_id)`)
+	whereClause := "WHERE 1=1" + scope
 
 	if status != "" {
 		whereClause += " AND tl.status = ?"
 		args = append(args, status)
 	}
 
+	if taskID, _ := strconv.Atoi(c.Query("task_id")); taskID > 0 {
+		whereClause += " AND tl.task_id = ?"
+		args = append(args, taskID)
+	}
+
+	if executionID, _ := strconv.Atoi(c.Query("flow_execution_id")); executionID > 0 {
+		whereClause += " AND tl.flow_execution_id = ?"
+		args = append(args, executionID)
+	}
+
+	if reconcileStatus != "" {
+		whereClause += " AND tl.reconcile_status = ?"
+		args = append(args, reconcileStatus)
+	}
+
 	if taskName != "" {
-		whereClause += " AND t.name LIKE ?"
+		whereClause += " AND COALESCE(t.name, tfs.name) LIKE ?"
 		args = append(args, "%"+taskName+"%")
 	}
 
@@ -66,6 +82,7 @@ func (lc *LogController) GetTaskLogs(c *gin.Context) {
 		SELECT COUNT(*) 
 		FROM task_logs tl
 		LEFT JOIN tasks t ON tl.task_id = t.id
+		LEFT JOIN task_flow_steps tfs ON tl.step_id = tfs.id
 		` + whereClause
 
 	var total int
@@ -84,11 +101,13 @@ func (lc *LogController) GetTaskLogs(c *gin.Context) {
 
 	// 查询任务执行日志列表
 	query := `
-		SELECT tl.id, tl.task_id, t.name as task_name, 
+		SELECT tl.id, COALESCE(tl.task_id, 0), COALESCE(t.name, tfs.name, '') as task_name, 
 		       tl.flow_execution_id, tl.step_id, tl.step_order,
-		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at
+		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at,
+		       tl.reconcile_status, tl.source_rows, tl.target_rows, tl.config_version
 		FROM task_logs tl
 		LEFT JOIN tasks t ON tl.task_id = t.id
+		LEFT JOIN task_flow_steps tfs ON tl.step_id = tfs.id
 		` + whereClause + `
 		ORDER BY tl.start_time DESC
 		LIMIT ? OFFSET ?
@@ -109,11 +128,12 @@ func (lc *LogController) GetTaskLogs(c *gin.Context) {
 	for rows.Next() {
 		var log models.TaskExecutionLog
 		var endTime sql.NullTime
-		var flowExecutionID, stepID, stepOrder sql.NullInt64
+		var flowExecutionID, stepID, stepOrder, sourceRows, targetRows, configVersion sql.NullInt64
 
 		err := rows.Scan(&log.ID, &log.TaskID, &log.TaskName,
 			&flowExecutionID, &stepID, &stepOrder, &log.Status, &log.ExecutionType,
-			&log.StartTime, &endTime, &log.LogContent, &log.CreatedAt)
+			&log.StartTime, &endTime, &log.LogContent, &log.CreatedAt,
+			&log.ReconcileStatus, &sourceRows, &targetRows, &configVersion)
 		if err != nil {
 			continue
 		}
@@ -132,6 +152,15 @@ func (lc *LogController) GetTaskLogs(c *gin.Context) {
 		if stepOrder.Valid {
 			log.StepOrder = &[]int{int(stepOrder.Int64)}[0]
 		}
+		if sourceRows.Valid {
+			log.SourceRows = &sourceRows.Int64
+		}
+		if targetRows.Valid {
+			log.TargetRows = &targetRows.Int64
+		}
+		if configVersion.Valid {
+			log.ConfigVersion = &[]int{int(configVersion.Int64)}[0]
+		}
 
 		logs = append(logs, log)
 	}
@@ -163,22 +192,25 @@ func (lc *LogController) GetTaskLogDetail(c *gin.Context) {
 
 	// 查询任务执行详情
 	query := `
-		SELECT tl.id, tl.task_id, t.name as task_name, 
+		SELECT tl.id, COALESCE(tl.task_id, 0), COALESCE(t.name, tfs.name, '') as task_name, 
 		       tl.flow_execution_id, tl.step_id, tl.step_order,
-		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at
+		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at,
+		       tl.reconcile_status, tl.source_rows, tl.target_rows, tl.config_version
 		FROM task_logs tl
 		LEFT JOIN tasks t ON tl.task_id = t.id
+		LEFT JOIN task_flow_steps tfs ON tl.step_id = tfs.id
 		WHERE tl.id = ?
 	`
 
 	var log models.TaskExecutionLog
 	var endTime sql.NullTime
-	var flowExecutionID, stepID, stepOrder sql.NullInt64
+	var flowExecutionID, stepID, stepOrder, sourceRows, targetRows, configVersion sql.NullInt64
 
 	err = lc.db.QueryRow(query, logID).Scan(
 		&log.ID, &log.TaskID, &log.TaskName,
 		&flowExecutionID, &stepID, &stepOrder, &log.Status, &log.ExecutionType,
-		&log.StartTime, &endTime, &log.LogContent, &log.CreatedAt)
+		&log.StartTime, &endTime, &log.LogContent, &log.CreatedAt,
+		&log.ReconcileStatus, &sourceRows, &targetRows, &configVersion)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -211,6 +243,18 @@ func (lc *LogController) GetTaskLogDetail(c *gin.Context) {
 		log.StepOrder = &[]int{int(stepOrder.Int64)}[0]
 	}
 
+	if sourceRows.Valid {
+		log.SourceRows = &sourceRows.Int64
+	}
+
+	if targetRows.Valid {
+		log.TargetRows = &targetRows.Int64
+	}
+
+	if configVersion.Valid {
+		log.ConfigVersion = &[]int{int(configVersion.Int64)}[0]
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    log,
@@ -220,23 +264,27 @@ func (lc *LogController) GetTaskLogDetail(c *gin.Context) {
 // GetFlowLogs 获取任务流执行日志列表
 func (lc *LogController) GetFlowLogs(c *gin.Context) {
 	// 获取查询参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := pagination(c)
 	status := c.Query("status")
 	flowName := c.Query("flow_name")
 	executionType := c.Query("execution_type") // scheduled, manual
 	dateFrom := c.Query("date_from")
 	dateTo := c.Query("date_to")
 
-	// 构建查询条件
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
+	// 构建查询条件，只返回当前用户可访问项目中的任务流日志
+	scope, args := projectScope(c, "tf.project_id")
+	whereClause := "WHERE 1=1" + scope
 
 	if status != "" {
 		whereClause += " AND tfe.status = ?"
 		args = append(args, status)
 	}
 
+	if flowID, _ := strconv.Atoi(c.Query("flow_id")); flowID > 0 {
+		whereClause += " AND tfe.flow_id = ?"
+		args = append(args, flowID)
+	}
+
 	if flowName != "" {
 		whereClause += " AND tf.name LIKE ?"
 		args = append(args, "%"+flowName+"%")
@@ -381,11 +429,13 @@ func (lc *LogController) GetFlowLogDetail(c *gin.Context) {
 
 	// 查询步骤日志（从统一的task_logs表查询）
 	stepsQuery := `
-		SELECT tl.id, tl.task_id, t.name as task_name, 
+		SELECT tl.id, COALESCE(tl.task_id, 0), COALESCE(t.name, tfs.name, '') as task_name, 
 		       tl.flow_execution_id, tl.step_id, tl.step_order,
-		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at
+		       tl.status, tl.execution_type, tl.start_time, tl.end_time, tl.log, tl.created_at,
+		       tl.reconcile_status, tl.source_rows, tl.target_rows, tl.config_version
 		FROM task_logs tl
 		LEFT JOIN tasks t ON tl.task_id = t.id
+		LEFT JOIN task_flow_steps tfs ON tl.step_id = tfs.id
 		WHERE tl.flow_execution_id = ?
 		ORDER BY tl.step_order
 	`
@@ -404,11 +454,12 @@ func (lc *LogController) GetFlowLogDetail(c *gin.Context) {
 	for rows.Next() {
 		var step models.TaskExecutionLog
 		var endTime sql.NullTime
-		var flowExecutionID, stepID, stepOrder sql.NullInt64
+		var flowExecutionID, stepID, stepOrder, sourceRows, targetRows, configVersion sql.NullInt64
 
 		err := rows.Scan(&step.ID, &step.TaskID, &step.TaskName,
 			&flowExecutionID, &stepID, &stepOrder, &step.Status, &step.ExecutionType,
-			&step.StartTime, &endTime, &step.LogContent, &step.CreatedAt)
+			&step.StartTime, &endTime, &step.LogContent, &step.CreatedAt,
+			&step.ReconcileStatus, &sourceRows, &targetRows, &configVersion)
 		if err != nil {
 			continue
 		}
@@ -430,6 +481,17 @@ func (lc *LogController) GetFlowLogDetail(c *gin.Context) {
 			step.StepOrder = &[]int{int(stepOrder.Int64)}[0]
 		}
 
+		if sourceRows.Valid {
+			step.SourceRows = &sourceRows.Int64
+		}
+
+		if targetRows.Valid {
+			step.TargetRows = &targetRows.Int64
+		}
+		if configVersion.Valid {
+			step.ConfigVersion = &[]int{int(configVersion.Int64)}[0]
+		}
+
 		steps = append(steps, step)
 	}
 
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// passwordPage 返回修改密码页面的数据
+func (ct *Controller) passwordPage(c *gin.Context) gin.H {
+	var source string
+	var mustChange bool
+	ct.db.QueryRow("SELECT auth_source, must_change_password FROM users WHERE id=?", ct.GetCurrentUserID(c)).
+		Scan(&source, &mustChange)
+	return gin.H{
+		"MustChange": mustChange,
+		"External":   source != "" && source != services.AuthSourceLocal,
+		"Policy":     ct.cfg.PasswordPolicy,
+	}
+}
+
+// PasswordForm 显示当前用户的修改密码页面
+func (ct *Controller) PasswordForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "user/password.tmpl", ct.passwordPage(c))
+}
+
+// PasswordChange 修改当前用户的密码。修改后该用户的其他会话失效，当前会话保持登录
+func (ct *Controller) PasswordChange(c *gin.Context) {
+	page := ct.passwordPage(c)
+	fail := func(status int, msg string) {
+		page["Error"] = msg
+		c.HTML(status, "user/password.tmpl", page)
+	}
+
+	uid := ct.GetCurrentUserID(c)
+	current := c.PostForm("current_password")
+	password := c.PostForm("new_password")
+	if password != c.PostForm("confirm_password") {
+		fail(http.StatusBadRequest, "两次输入的新密码不一致")
+		return
+	}
+	if err := services.VerifyPassword(ct.db, uid, current); err == services.ErrNotLocalAccount {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		fail(http.StatusBadRequest, "当前密码错误")
+		return
+	}
+	if password == current {
+		fail(http.StatusBadRequest, "新密码不能与当前密码相同")
+		return
+	}
+	if err := services.CheckPasswordPolicy(ct.cfg.PasswordPolicy, c.GetString("user"), password); err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before := ct.snapshot(services.AuditUser, uid)
+	if err := services.SetPassword(ct.db, uid, password, false, uid); err != nil {
+		fail(http.StatusInternalServerError, "修改密码失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, uid, before, ct.snapshot(services.AuditUser, uid))
+	if err := ct.auth.RenewSession(c.Writer, c.Request, uid); err != nil {
+		// 当前会话已随其他会话一起撤销，需要重新登录
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+
+	page = ct.passwordPage(c)
+	page["Success"] = true
+	c.HTML(http.StatusOK, "user/password.tmpl", page)
+}
+
+// UserResetPassword 管理员为本地账户设置临时密码，用户下次登录后必须先修改密码，
+// 该用户已登录的会话立即失效
+func (ct *Controller) UserResetPassword(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var username string
+	if err := ct.db.QueryRow("SELECT username FROM users WHERE id=? AND deleted_at IS NULL", id).Scan(&username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "用户不存在"})
+		return
+	}
+	password := c.PostForm("password")
+	if err := services.CheckPasswordPolicy(ct.cfg.PasswordPolicy, username, password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	before := ct.snapshot(services.AuditUser, id)
+	if err := services.SetPassword(ct.db, id, password, true, ct.GetCurrentUserID(c)); err == services.ErrNotLocalAccount {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "重置密码失败"})
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, id, before, ct.snapshot(services.AuditUser, id))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码已重置，用户下次登录时需修改密码"})
+}
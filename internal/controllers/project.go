@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// 由 :id 路由参数查找所属项目的资源类型
+const (
+	ResDataSource    = "data_sources"
+	ResTask          = "tasks"
+	ResFlow          = "task_flows"
+	ResFlowExecution = "flow_executions"
+	ResTaskLog       = "task_logs"
+)
+
+// projectQueries 按资源ID查询所属项目。任务流步骤的日志归属任务流所在项目，独立任务的日志归属任务所在项目
+var projectQueries = map[string]string{
+	ResDataSource:    "SELECT project_id FROM data_sources WHERE id=?",
+	ResTask:          "SELECT project_id FROM tasks WHERE id=?",
+	ResFlow:          "SELECT project_id FROM task_flows WHERE id=?",
+	ResFlowExecution: "SELECT tf.project_id FROM task_flow_executions e JOIN task_flows tf ON e.flow_id = tf.id WHERE e.id=?",
+	ResTaskLog: `SELECT COALESCE(tf.project_id, t.project_id) FROM task_logs tl
+		LEFT JOIN task_flow_executions e ON tl.flow_execution_id = e.id
+		LEFT JOIN task_flows tf ON e.flow_id = tf.id
+		LEFT JOIN tasks t ON tl.task_id = t.id
+		WHERE tl.id=?`,
+}
+
+const msgProjectForbidden = "没有权限：需要该项目的%s角色"
+
+// MustProjectRole 中间件要求当前用户在 :id 所指对象所属的项目中至少具有 role 角色，管理员不受限制。
+// 对象不存在时放行，由处理器返回 404。通过后在上下文中设置 project_id 和 project_role。
+func (ct *Controller) MustProjectRole(resource, role string) gin.HandlerFunc {
+	query, ok := projectQueries[resource]
+	if !ok {
+		panic("unknown project resource: " + resource)
+	}
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		var projectID sql.NullInt64
+		err = ct.db.QueryRow(query, id).Scan(&projectID)
+		if err == sql.ErrNoRows {
+			c.Next()
+			return
+		}
+		if err != nil {
+			log.Printf("project: failed to look up project of %s %d: %v", resource, id, err)
+			denyProject(c, http.StatusInternalServerError, "查询所属项目失败")
+			return
+		}
+		if !ct.requireProjectRole(c, int(projectID.Int64), role) {
+			return
+		}
+		c.Set("project_id", int(projectID.Int64))
+		c.Next()
+	}
+}
+
+// projectRole 返回当前用户在项目中的角色，管理员视为所有项目的编辑者
+func (ct *Controller) projectRole(c *gin.Context, projectID int) string {
+	if ct.currentRole(c) == "admin" {
+		return services.ProjectEditor
+	}
+	role, err := services.ProjectRole(ct.db, ct.GetCurrentUserID(c), projectID)
+	if err != nil {
+		log.Printf("project: failed to look up role in project %d: %v", projectID, err)
+	}
+	return role
+}
+
+// requireProjectRole 检查当前用户在项目中至少具有 role 角色，否则返回 403 并中止请求
+func (ct *Controller) requireProjectRole(c *gin.Context, projectID int, role string) bool {
+	current := ct.projectRole(c, projectID)
+	if !services.ProjectRoleAtLeast(current, role) {
+		denyProject(c, http.StatusForbidden, fmt.Sprintf(msgProjectForbidden, services.ProjectRoleName(role)))
+		return false
+	}
+	c.Set("project_role", current)
+	return true
+}
+
+// denyProject 按请求类型返回错误：API 和脚本请求返回 JSON，页面请求返回文本
+func denyProject(c *gin.Context, status int, msg string) {
+	switch {
+	case strings.HasPrefix(c.Request.URL.Path, "/api/"):
+		c.AbortWithStatusJSON(status, gin.H{"success": false, "error": msg})
+	case c.Request.Method == http.MethodGet:
+		c.String(status, msg)
+		c.Abort()
+	default:
+		c.AbortWithStatusJSON(status, gin.H{"success": false, "error": msg})
+	}
+}
+
+// projectScope 返回把 column 限制在当前用户所属项目内的查询条件（以 AND 开头）及参数，管理员不受限制。
+// 依赖登录中间件在上下文中设置的 user 和 role。
+func projectScope(c *gin.Context, column string) (string, []any) {
+	if c.GetString("role") == "admin" {
+		return "", nil
+	}
+	return " AND " + column + ` IN (SELECT pm.project_id FROM project_members pm
+		JOIN users u ON pm.user_id = u.id WHERE u.username = ?)`, []any{c.GetString("user")}
+}
+
+// accessibleProjects 返回当前用户可访问的项目，管理员返回全部项目并视为编辑者
+func (ct *Controller) accessibleProjects(c *gin.Context) ([]models.Project, error) {
+	if ct.currentRole(c) != "admin" {
+		return services.UserProjects(ct.db, ct.GetCurrentUserID(c))
+	}
+	projects, err := services.ListProjects(ct.db)
+	for i := range projects {
+		projects[i].Role = services.ProjectEditor
+	}
+	return projects, err
+}
+
+// editableProjects 返回当前用户具有编辑者角色的项目，用于新建对象时选择项目
+func (ct *Controller) editableProjects(c *gin.Context) ([]models.Project, error) {
+	projects, err := ct.accessibleProjects(c)
+	if err != nil {
+		return nil, err
+	}
+	var editable []models.Project
+	for _, p := range projects {
+		if p.Role == services.ProjectEditor {
+			editable = append(editable, p)
+		}
+	}
+	return editable, nil
+}
+
+// checkCreateProject 校验新建对象的目标项目：未指定时使用默认项目，当前用户必须是该项目的编辑者
+func (ct *Controller) checkCreateProject(c *gin.Context, projectID int) (int, error) {
+	if projectID <= 0 {
+		projectID = services.DefaultProjectID
+	}
+	var exists bool
+	if err := ct.db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE id=?)", projectID).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("项目 %d 不存在", projectID)
+	}
+	if !services.ProjectRoleAtLeast(ct.projectRole(c, projectID), services.ProjectEditor) {
+		return 0, errors.New("没有在该项目中新建对象的权限")
+	}
+	return projectID, nil
+}
+
+// checkDataSourcesUsable 校验任务或任务流步骤可以使用引用的数据源：数据源与对象属于同一项目 projectID，
+// 或当前用户是数据源所在项目的编辑者。只读成员不能借此把其他项目的连接凭据带入自己的任务或导出包。
+// 未指定的ID（0）由调用方校验
+func (ct *Controller) checkDataSourcesUsable(c *gin.Context, projectID int, ids ...int) error {
+	for _, id := range ids {
+		if id <= 0 {
+			continue
+		}
+		var dsProject int
+		err := ct.db.QueryRow("SELECT project_id FROM data_sources WHERE id=?", id).Scan(&dsProject)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("数据源 %d 不存在", id)
+		}
+		if err != nil {
+			return err
+		}
+		if dsProject != projectID && !services.ProjectRoleAtLeast(ct.projectRole(c, dsProject), services.ProjectEditor) {
+			return fmt.Errorf("没有使用数据源 %d 的权限：只能使用同一项目中的数据源，或需要数据源所在项目的编辑者角色", id)
+		}
+	}
+	return nil
+}
+
+// checkSameProject 校验对象与任务流属于同一项目，任务流只能编排本项目的任务
+func (ct *Controller) checkSameProject(table string, id, projectID int) error {
+	var other int
+	err := ct.db.QueryRow("SELECT project_id FROM "+table+" WHERE id=?", id).Scan(&other)
+	if err != nil {
+		return err
+	}
+	if other != projectID {
+		return errors.New("只能使用同一项目中的对象")
+	}
+	return nil
+}
+
+// ========== 项目管理（仅管理员） ==========
+
+// ProjectList 显示所有项目
+func (ct *Controller) ProjectList(c *gin.Context) {
+	projects, err := services.ListProjects(ct.db)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目列表失败: %v", err))
+		return
+	}
+	c.HTML(200, "project/list.tmpl", gin.H{"Projects": projects, "Error": c.Query("error")})
+}
+
+// ProjectCreate 创建项目
+func (ct *Controller) ProjectCreate(c *gin.Context) {
+	id, err := services.CreateProject(ct.db, c.PostForm("name"), c.PostForm("description"), ct.GetCurrentUserID(c))
+	if err != nil {
+		c.Redirect(302, "/admin/projects?error="+url.QueryEscape(err.Error()))
+		return
+	}
+	c.Redirect(302, fmt.Sprintf("/admin/projects/%d", id))
+}
+
+// ProjectDelete 删除空项目
+func (ct *Controller) ProjectDelete(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := services.DeleteProject(ct.db, id); err != nil {
+		c.JSON(400, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "message": "项目已删除"})
+}
+
+// ProjectMembers 显示项目成员和授权表单
+func (ct *Controller) ProjectMembers(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var project models.Project
+	err := ct.db.QueryRow("SELECT id, name, description, created_at FROM projects WHERE id=?", id).
+		Scan(&project.ID, &project.Name, &project.Description, &project.CreatedAt)
+	if err != nil {
+		c.String(404, "项目不存在")
+		return
+	}
+	members, err := services.ListProjectMembers(ct.db, id)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目成员失败: %v", err))
+		return
+	}
+
+	// 可授权的用户：未被授权且未删除的普通用户，管理员无需授权
+	rows, err := ct.db.Query(`SELECT id, username FROM users
+		WHERE role <> 'admin' AND deleted_at IS NULL AND id NOT IN (SELECT user_id FROM project_members WHERE project_id=?)
+		ORDER BY username`, id)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取用户列表失败: %v", err))
+		return
+	}
+	defer rows.Close()
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username); err == nil {
+			users = append(users, u)
+		}
+	}
+
+	c.HTML(200, "project/members.tmpl", gin.H{
+		"Project": project,
+		"Members": members,
+		"Users":   users,
+		"Error":   c.Query("error"),
+	})
+}
+
+// ProjectSetMember 授予或修改用户在项目中的角色
+func (ct *Controller) ProjectSetMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.PostForm("user_id"))
+	target := fmt.Sprintf("/admin/projects/%d", id)
+	if userID <= 0 {
+		c.Redirect(302, target+"?error="+url.QueryEscape("请选择用户"))
+		return
+	}
+	if err := services.SetProjectMember(ct.db, id, userID, c.PostForm("role"), ct.GetCurrentUserID(c)); err != nil {
+		c.Redirect(302, target+"?error="+url.QueryEscape(err.Error()))
+		return
+	}
+	c.Redirect(302, target)
+}
+
+// ProjectRemoveMember 取消用户在项目中的授权
+func (ct *Controller) ProjectRemoveMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.Param("user_id"))
+	if err := services.RemoveProjectMember(ct.db, id, userID); err != nil {
+		c.JSON(500, gin.H{"success": false, "error": "取消授权失败"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "message": "已取消授权"})
+}
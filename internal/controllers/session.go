@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionList 显示全部有效的登录会话
+func (ct *Controller) SessionList(c *gin.Context) {
+	sessions, err := services.ListActiveSessions(ct.db)
+	if err != nil {
+		c.String(http.StatusInternalServerError, fmt.Sprintf("获取会话列表失败: %v", err))
+		return
+	}
+	c.HTML(http.StatusOK, "user/sessions.tmpl", gin.H{"Sessions": sessions, "Current": c.GetInt("session_id")})
+}
+
+// SessionRevoke 强制下线指定会话，该会话的下一个请求即需要重新登录
+func (ct *Controller) SessionRevoke(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, err := services.RevokeSession(ct.db, id)
+	if err == services.ErrSessionNotFound {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, fmt.Sprintf("强制下线失败: %v", err))
+		return
+	}
+	ct.auditAction(c, services.AuditRevoke, services.AuditUser, userID, fmt.Sprintf("强制下线会话 #%d", id))
+	c.Redirect(http.StatusFound, "/admin/sessions")
+}
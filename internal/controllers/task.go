@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -9,59 +10,111 @@ import (
 	"strings"
 )
 
-// TaskList 显示所有任务
+// TaskList 显示当前用户可访问项目中的任务及其所属的全部任务流
 func (ct *Controller) TaskList(c *gin.Context) {
-	rows, _ := ct.db.Query(`
-		SELECT t.id, t.name, tf.name, tf.id, 
+	scope, args := projectScope(c, "t.project_id")
+	rows, err := ct.db.Query(`
+		SELECT t.id, t.name, t.project_id, p.name, COALESCE(t.managed_by, ''),
 		       COALESCE(uc.username, '系统') as created_by_name,
 		       COALESCE(uu.username, '系统') as updated_by_name,
 		       t.created_at, t.updated_at
 		FROM tasks t 
-		LEFT JOIN task_flow_steps tfs ON t.id=tfs.task_id 
-		LEFT JOIN task_flows tf ON tfs.flow_id=tf.id
+		JOIN projects p ON t.project_id = p.id
 		LEFT JOIN users uc ON t.created_by = uc.id
 		LEFT JOIN users uu ON t.updated_by = uu.id
+		WHERE 1=1`+scope+`
 		ORDER BY t.id DESC
-	`)
+	`, args...)
+	if err != nil {
+		c.String(500, "查询任务失败: "+err.Error())
+		return
+	}
 	defer rows.Close()
 	var tasks []models.Task
 	for rows.Next() {
 		var r models.Task
-		rows.Scan(&r.ID, &r.Name, &r.FlowName, &r.FlowID, &r.CreatedByName, &r.UpdatedByName, &r.CreatedAt, &r.UpdatedAt)
+		rows.Scan(&r.ID, &r.Name, &r.ProjectID, &r.Project, &r.ManagedBy, &r.CreatedByName, &r.UpdatedByName, &r.CreatedAt, &r.UpdatedAt)
 		tasks = append(tasks, r)
 	}
+
+	memberships, err := ct.taskFlowMemberships(c, 0)
+	if err != nil {
+		c.String(500, "查询任务流引用失败: "+err.Error())
+		return
+	}
+	for i := range tasks {
+		tasks[i].Flows = memberships[tasks[i].ID]
+	}
+
 	c.HTML(200, "task/list.tmpl", gin.H{"Tasks": tasks})
 }
 
+// taskFlowMemberships 按任务ID返回引用该任务的任务流，taskID 为 0 时返回当前用户可访问项目中的所有任务
+func (ct *Controller) taskFlowMemberships(c *gin.Context, taskID int) (map[int][]models.TaskFlowSelection, error) {
+	scope, args := projectScope(c, "tf.project_id")
+	query := `
+		SELECT DISTINCT tfs.task_id, tf.id, tf.name
+		FROM task_flow_steps tfs
+		JOIN task_flows tf ON tfs.flow_id = tf.id
+		WHERE tfs.task_id IS NOT NULL` + scope
+	if taskID > 0 {
+		query += " AND tfs.task_id = ?"
+		args = append(args, taskID)
+	}
+	rows, err := ct.db.Query(query+" ORDER BY tf.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int][]models.TaskFlowSelection)
+	for rows.Next() {
+		var id int
+		var f models.TaskFlowSelection
+		if err := rows.Scan(&id, &f.ID, &f.Name); err != nil {
+			return nil, err
+		}
+		result[id] = append(result[id], f)
+	}
+	return result, rows.Err()
+}
+
 // TaskNewForm 显示创建新任务的表单
 func (ct *Controller) TaskNewForm(c *gin.Context) {
 	// 获取各种类型的数据源
-	mysql, err := ct.GetDataSourcesByType("mysql")
+	mysql, err := ct.GetDataSourcesByType(c, "mysql")
 	if err != nil {
 		c.String(500, fmt.Sprintf("获取MySQL数据源失败: %v", err))
 		return
 	}
 
-	ofs, err := ct.GetDataSourcesByType("ofs")
+	ofs, err := ct.GetDataSourcesByType(c, "ofs")
 	if err != nil {
 		c.String(500, fmt.Sprintf("获取OFS数据源失败: %v", err))
 		return
 	}
 
-	hdfs, err := ct.GetDataSourcesByType("hdfs")
+	hdfs, err := ct.GetDataSourcesByType(c, "hdfs")
 	if err != nil {
 		c.String(500, fmt.Sprintf("获取HDFS数据源失败: %v", err))
 		return
 	}
 
-	cosn, err := ct.GetDataSourcesByType("cosn")
+	cosn, err := ct.GetDataSourcesByType(c, "cosn")
 	if err != nil {
 		c.String(500, fmt.Sprintf("获取COSN数据源失败: %v", err))
 		return
 	}
 
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+
 	// 只获取未禁用的任务流
-	rows, err := ct.db.Query("SELECT id, name FROM task_flows WHERE enabled = 1 ORDER BY name")
+	scope, args := projectScope(c, "project_id")
+	rows, err := ct.db.Query("SELECT id, name, project_id FROM task_flows WHERE enabled = 1"+scope+" ORDER BY name", args...)
 	if err != nil {
 		c.String(500, fmt.Sprintf("获取任务流失败: %v", err))
 		return
@@ -71,7 +124,7 @@ func (ct *Controller) TaskNewForm(c *gin.Context) {
 	var taskFlows []models.TaskFlowSelection
 	for rows.Next() {
 		var tf models.TaskFlowSelection
-		if err := rows.Scan(&tf.ID, &tf.Name); err != nil {
+		if err := rows.Scan(&tf.ID, &tf.Name, &tf.ProjectID); err != nil {
 			c.String(500, fmt.Sprintf("扫描任务流数据失败: %v", err))
 			return
 		}
@@ -84,6 +137,7 @@ func (ct *Controller) TaskNewForm(c *gin.Context) {
 		"HDFS":      hdfs,
 		"COSN":      cosn,
 		"TaskFlows": taskFlows,
+		"Projects":  projects,
 	})
 }
 
@@ -116,11 +170,36 @@ func (ct *Controller) TaskCreate(c *gin.Context) {
 		return
 	}
 
-	flowID, err := strconv.Atoi(c.PostForm("flow_id"))
-	if err != nil || flowID <= 0 {
-		c.String(400, "无效的任务流ID")
+	// 任务流可选，任务可以独立存在并在之后被多个任务流引用
+	var flowID int
+	if v := strings.TrimSpace(c.PostForm("flow_id")); v != "" {
+		flowID, err = strconv.Atoi(v)
+		if err != nil || flowID < 0 {
+			c.String(400, "无效的任务流ID")
+			return
+		}
+		if flowID > 0 && ct.managedBy("task_flows", flowID) != "" {
+			c.String(403, msgFlowManaged)
+			return
+		}
+	}
+
+	requested, _ := strconv.Atoi(c.PostForm("project_id"))
+	projectID, err := ct.checkCreateProject(c, requested)
+	if err != nil {
+		c.String(403, err.Error())
+		return
+	}
+	if err := ct.checkDataSourcesUsable(c, projectID, srcID, tgtID); err != nil {
+		c.String(403, err.Error())
 		return
 	}
+	if flowID > 0 {
+		if err := ct.checkSameProject("task_flows", flowID, projectID); err != nil {
+			c.String(400, "任务流: "+err.Error())
+			return
+		}
+	}
 
 	// 验证JSON格式
 	var job map[string]any
@@ -140,6 +219,7 @@ func (ct *Controller) TaskCreate(c *gin.Context) {
 	userID := ct.GetCurrentUserID(c)
 
 	// 开始事务
+	flowBefore := ct.snapshot(services.AuditFlow, flowID)
 	tx, err := ct.db.Begin()
 	if err != nil {
 		c.String(500, "数据库事务开始失败")
@@ -148,8 +228,8 @@ func (ct *Controller) TaskCreate(c *gin.Context) {
 	defer tx.Rollback()
 
 	// 创建任务
-	result, err := tx.Exec(`INSERT INTO tasks(name, source_id, target_id, json_config, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?)`, name, srcID, tgtID, string(pretty), userID, userID)
+	result, err := tx.Exec(`INSERT INTO tasks(name, project_id, source_id, target_id, json_config, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, name, projectID, srcID, tgtID, string(pretty), userID, userID)
 	if err != nil {
 		c.String(500, "创建任务失败")
 		return
@@ -161,20 +241,28 @@ func (ct *Controller) TaskCreate(c *gin.Context) {
 		return
 	}
 
-	// 添加到任务流 - 获取下一个步骤顺序
-	var maxOrder int
-	err = tx.QueryRow("SELECT COALESCE(MAX(step_order), 0) FROM task_flow_steps WHERE flow_id=?", flowID).Scan(&maxOrder)
-	if err != nil {
-		c.String(500, "获取步骤顺序失败")
+	// 创建初始配置版本
+	if _, err := services.SaveTaskConfig(tx, int(taskID), string(pretty), "创建任务", userID); err != nil {
+		c.String(saveConfigStatus(err), err.Error())
 		return
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO task_flow_steps (flow_id, task_id, step_order)
-		VALUES (?, ?, ?)`, flowID, taskID, maxOrder+1)
-	if err != nil {
-		c.String(500, "添加任务到流程失败")
-		return
+	// 选择了任务流时追加为该任务流的最后一个步骤
+	if flowID > 0 {
+		var maxOrder int
+		err = tx.QueryRow("SELECT COALESCE(MAX(step_order), 0) FROM task_flow_steps WHERE flow_id=?", flowID).Scan(&maxOrder)
+		if err != nil {
+			c.String(500, "获取步骤顺序失败")
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO task_flow_steps (flow_id, task_id, step_order, created_by, updated_by)
+			VALUES (?, ?, ?, ?, ?)`, flowID, taskID, maxOrder+1, userID, userID)
+		if err != nil {
+			c.String(500, "添加任务到流程失败")
+			return
+		}
 	}
 
 	// 提交事务
@@ -182,6 +270,10 @@ func (ct *Controller) TaskCreate(c *gin.Context) {
 		c.String(500, "提交事务失败")
 		return
 	}
+	ct.audit(c, services.AuditCreate, services.AuditTask, int(taskID), nil, ct.snapshot(services.AuditTask, int(taskID)))
+	if flowBefore != nil {
+		ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, flowBefore, ct.snapshot(services.AuditFlow, flowID))
+	}
 
 	c.Redirect(302, "/tasks")
 }
@@ -191,25 +283,133 @@ func (ct *Controller) TaskManage(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
 	var task models.Task
-	err := ct.db.QueryRow(`SELECT t.id, t.name, t.source_id, t.target_id, COALESCE(t.json_config,''), t.created_at, t.updated_at,
+	err := ct.db.QueryRow(`SELECT t.id, t.name, t.source_id, t.target_id, COALESCE(t.json_config,''), t.current_version, COALESCE(t.incr_column,''), t.reconcile_enabled, t.reconcile_tolerance, COALESCE(t.managed_by,''), t.created_at, t.updated_at,
         (SELECT name FROM data_sources WHERE id=t.source_id),
         (SELECT name FROM data_sources WHERE id=t.target_id) FROM tasks t WHERE t.id=?`, id).
-		Scan(&task.ID, &task.Name, &task.SourceID, &task.TargetID, &task.JsonConfig, &task.CreatedAt, &task.UpdatedAt, &task.Source, &task.Target)
+		Scan(&task.ID, &task.Name, &task.SourceID, &task.TargetID, &task.JsonConfig, &task.Version, &task.IncrColumn, &task.ReconcileEnabled, &task.ReconcileTolerance, &task.ManagedBy, &task.CreatedAt, &task.UpdatedAt, &task.Source, &task.Target)
 
 	if err != nil {
 		c.String(404, "任务不存在")
 		return
 	}
 
+	watermark, err := services.GetTaskWatermark(ct.db, id)
+	if err != nil {
+		c.String(500, "查询增量水位失败: "+err.Error())
+		return
+	}
+
+	memberships, err := ct.taskFlowMemberships(c, id)
+	if err != nil {
+		c.String(500, "查询任务流引用失败: "+err.Error())
+		return
+	}
+	task.Flows = memberships[id]
+
 	c.HTML(200, "task/manage.tmpl", gin.H{
-		"Task": task,
+		"Task":      task,
+		"Watermark": watermark,
 	})
 }
 
-// TaskUpdateJson 处理任务 JSON 配置更新
+// TaskSetIncremental 设置或关闭任务的增量同步列
+// 增量列变化时会清除旧水位，下次执行从头同步
+func (ct *Controller) TaskSetIncremental(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	column := strings.TrimSpace(c.PostForm("incr_column"))
+
+	if ct.managedBy("tasks", id) != "" {
+		c.String(403, msgTaskManaged)
+		return
+	}
+
+	if err := services.ValidateIncrColumn(column); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+
+	var current string
+	if err := ct.db.QueryRow("SELECT COALESCE(incr_column,'') FROM tasks WHERE id=?", id).Scan(&current); err != nil {
+		c.String(404, "任务不存在")
+		return
+	}
+
+	before := ct.snapshot(services.AuditTask, id)
+	userID := ct.GetCurrentUserID(c)
+	_, err := ct.db.Exec("UPDATE tasks SET incr_column=NULLIF(?, ''), updated_by=? WHERE id=?", column, userID, id)
+	if err != nil {
+		c.String(500, "更新增量配置失败")
+		return
+	}
+
+	if current != column {
+		if err := services.ResetTaskWatermark(ct.db, id, "", userID); err != nil {
+			c.String(500, "清除增量水位失败")
+			return
+		}
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditTask, id, before, ct.snapshot(services.AuditTask, id))
+
+	c.Redirect(302, fmt.Sprintf("/tasks/%d", id))
+}
+
+// TaskSetReconcile 设置任务执行后的行数对账
+func (ct *Controller) TaskSetReconcile(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	enabled := c.PostForm("reconcile_enabled") == "1"
+	if ct.managedBy("tasks", id) != "" {
+		c.String(403, msgTaskManaged)
+		return
+	}
+
+	tolerance := 0
+	if v := strings.TrimSpace(c.PostForm("reconcile_tolerance")); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil || t < 0 {
+			c.String(400, "对账容忍度必须为非负整数")
+			return
+		}
+		tolerance = t
+	}
+
+	before := ct.snapshot(services.AuditTask, id)
+	userID := ct.GetCurrentUserID(c)
+	_, err := ct.db.Exec("UPDATE tasks SET reconcile_enabled=?, reconcile_tolerance=?, updated_by=? WHERE id=?",
+		enabled, tolerance, userID, id)
+	if err != nil {
+		c.String(500, "更新对账配置失败")
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditTask, id, before, ct.snapshot(services.AuditTask, id))
+
+	c.Redirect(302, fmt.Sprintf("/tasks/%d", id))
+}
+
+// TaskResetWatermark 手动修改或清除任务的增量水位
+func (ct *Controller) TaskResetWatermark(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	value := strings.TrimSpace(c.PostForm("watermark"))
+
+	before := ct.snapshot(services.AuditTask, id)
+	if err := services.ResetTaskWatermark(ct.db, id, value, ct.GetCurrentUserID(c)); err != nil {
+		c.String(400, "更新增量水位失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditTask, id, before, ct.snapshot(services.AuditTask, id))
+
+	c.Redirect(302, fmt.Sprintf("/tasks/%d", id))
+}
+
+// TaskUpdateJson 处理任务 JSON 配置更新，每次保存生成一个新的配置版本
 func (ct *Controller) TaskUpdateJson(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	jsonConfig := strings.TrimSpace(c.PostForm("datax_json"))
+	comment := strings.TrimSpace(c.PostForm("comment"))
+
+	if ct.managedBy("tasks", id) != "" {
+		c.String(403, msgTaskManaged)
+		return
+	}
 
 	// 验证JSON格式
 	var jsonData interface{}
@@ -217,16 +417,42 @@ func (ct *Controller) TaskUpdateJson(c *gin.Context) {
 		c.String(400, "JSON格式不正确")
 		return
 	}
+	if len([]rune(comment)) > 255 {
+		c.String(400, "变更说明不能超过255个字符")
+		return
+	}
 
 	// 获取当前用户ID
 	userID := ct.GetCurrentUserID(c)
+	before := ct.snapshot(services.AuditTask, id)
 
-	// 更新任务JSON配置
-	_, err := ct.db.Exec(`UPDATE tasks SET json_config=?, updated_by=? WHERE id=?`, jsonConfig, userID, id)
+	tx, err := ct.db.Begin()
 	if err != nil {
-		c.String(500, "更新任务失败")
+		c.String(500, "数据库事务开始失败")
+		return
+	}
+	defer tx.Rollback()
+
+	// 配置未变化时不生成新版本
+	var current string
+	if err := tx.QueryRow("SELECT COALESCE(json_config,'') FROM tasks WHERE id=?", id).Scan(&current); err != nil {
+		c.String(404, "任务不存在")
+		return
+	}
+	if current == jsonConfig {
+		c.Redirect(302, fmt.Sprintf("/tasks/%d", id))
+		return
+	}
+
+	if _, err := services.SaveTaskConfig(tx, id, jsonConfig, comment, userID); err != nil {
+		c.String(saveConfigStatus(err), "更新任务失败: "+err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(500, "提交事务失败")
 		return
 	}
+	ct.audit(c, services.AuditUpdate, services.AuditTask, id, before, ct.snapshot(services.AuditTask, id))
 
 	c.Redirect(302, fmt.Sprintf("/tasks/%d", id))
 }
@@ -234,6 +460,7 @@ func (ct *Controller) TaskUpdateJson(c *gin.Context) {
 // TaskRunNow 手动触发任务执行（异步）
 func (ct *Controller) TaskRunNow(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	ct.auditAction(c, services.AuditRun, services.AuditTask, id, "")
 
 	// 异步执行任务
 	go func() {
@@ -247,46 +474,57 @@ func (ct *Controller) TaskRunNow(c *gin.Context) {
 	c.Redirect(302, "/task-logs")
 }
 
-// TaskDelete 永久删除任务
+// TaskDelete 永久删除未被任何任务流引用的任务，连同其配置版本和增量水位
 func (ct *Controller) TaskDelete(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil || id <= 0 {
 		c.JSON(400, gin.H{"error": "无效的任务ID"})
 		return
 	}
+	if ct.managedBy("tasks", id) != "" {
+		c.JSON(403, gin.H{"error": msgTaskManaged})
+		return
+	}
 
-	// 开始事务
-	tx, err := ct.db.Begin()
+	// 仍被任务流引用的任务不允许删除
+	memberships, err := ct.taskFlowMemberships(c, id)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "数据库事务开始失败"})
+		c.JSON(500, gin.H{"error": "查询任务流引用失败"})
+		return
+	}
+	if flows := memberships[id]; len(flows) > 0 {
+		names := make([]string, 0, len(flows))
+		for _, f := range flows {
+			names = append(names, f.Name)
+		}
+		c.JSON(409, gin.H{
+			"error": "任务仍被以下任务流引用，请先从任务流中移除: " + strings.Join(names, "、"),
+			"flows": flows,
+		})
 		return
 	}
-	defer tx.Rollback()
 
-	// 删除相关记录
-	_, err = tx.Exec("DELETE FROM task_flow_steps WHERE task_id=?", id)
+	before := ct.snapshot(services.AuditTask, id)
+	tx, err := ct.db.Begin()
 	if err != nil {
-		c.JSON(500, gin.H{"error": "删除任务流步骤失败"})
+		c.JSON(500, gin.H{"error": "删除任务失败"})
 		return
 	}
-
-	result, err := tx.Exec("DELETE FROM tasks WHERE id=?", id)
+	defer tx.Rollback()
+	deleted, err := services.DeleteTask(tx, id)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "删除任务失败"})
 		return
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil || rowsAffected == 0 {
+	if !deleted {
 		c.JSON(404, gin.H{"error": "任务不存在"})
 		return
 	}
-
-	// 提交事务
-	if err = tx.Commit(); err != nil {
-		c.JSON(500, gin.H{"error": "提交事务失败"})
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "删除任务失败"})
 		return
 	}
+	ct.audit(c, services.AuditDelete, services.AuditTask, id, before, nil)
 
 	c.JSON(200, gin.H{"message": "删除成功", "redirect": "/tasks"})
 }
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"com.duole/datax-web-go/internal/services"
+	"com.duole/datax-web-go/internal/services/datax"
+	"github.com/gin-gonic/gin"
+)
+
+// TaskBulkForm 显示按库批量生成任务的向导页面
+func (ct *Controller) TaskBulkForm(c *gin.Context) {
+	mysql, err := ct.GetDataSourcesByType(c, "mysql")
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取MySQL数据源失败: %v", err))
+		return
+	}
+
+	var fsSources []gin.H
+	for _, typ := range []string{"ofs", "hdfs", "cosn"} {
+		list, err := ct.GetDataSourcesByType(c, typ)
+		if err != nil {
+			c.String(500, fmt.Sprintf("获取%s数据源失败: %v", typ, err))
+			return
+		}
+		for _, ds := range list {
+			fsSources = append(fsSources, gin.H{"ID": ds.ID, "Name": ds.Name, "Type": typ})
+		}
+	}
+
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+
+	c.HTML(200, "task/bulk.tmpl", gin.H{
+		"MySQL":    mysql,
+		"FS":       fsSources,
+		"Projects": projects,
+	})
+}
+
+// TaskBulkPreview 返回批量生成的任务计划，不写入数据库
+func (ct *Controller) TaskBulkPreview(c *gin.Context) {
+	var req datax.BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请求体无效"})
+		return
+	}
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if err := ct.checkDataSourcesUsable(c, projectID, req.SourceID, req.TargetID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	plans, err := ct.dataxController.dataxService.GenerateBulk(req)
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	existing := ct.existingTaskNames()
+	result := make([]gin.H, 0, len(plans))
+	for _, p := range plans {
+		result = append(result, gin.H{
+			"table":   p.Table,
+			"name":    p.Name,
+			"columns": p.Columns,
+			"json":    p.Job,
+			"error":   p.Error,
+			"exists":  existing[p.Name],
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "tasks": result})
+}
+
+// TaskBulkCreate 为匹配的每张表创建任务，并按需创建包含全部任务的新任务流
+// 名称已存在或生成失败的表会被跳过并在响应中列出
+func (ct *Controller) TaskBulkCreate(c *gin.Context) {
+	var req datax.BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请求体无效"})
+		return
+	}
+
+	projectID, err := ct.checkCreateProject(c, req.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if err := ct.checkDataSourcesUsable(c, projectID, req.SourceID, req.TargetID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	if req.Flow != nil {
+		if err := services.ValidateCronExpression(req.Flow.Cron); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+	}
+
+	plans, err := ct.dataxController.dataxService.GenerateBulk(req)
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	userID := ct.GetCurrentUserID(c)
+	existing := ct.existingTaskNames()
+
+	tx, err := ct.db.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"success": false, "error": "数据库事务开始失败"})
+		return
+	}
+	defer tx.Rollback()
+
+	var flowID int64
+	if req.Flow != nil {
+		result, err := tx.Exec(`INSERT INTO task_flows(name, project_id, description, cron_expr, enabled, created_by, updated_by)
+			VALUES(?, ?, ?, ?, 1, ?, ?)`, req.Flow.Name, projectID, req.Flow.Description, req.Flow.Cron, userID, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"success": false, "error": "创建任务流失败: " + err.Error()})
+			return
+		}
+		flowID, _ = result.LastInsertId()
+	}
+
+	var created []gin.H
+	var skipped []gin.H
+	var createdIDs []int
+	stepOrder := 0
+	for _, p := range plans {
+		if p.Error != "" {
+			skipped = append(skipped, gin.H{"table": p.Table, "reason": p.Error})
+			continue
+		}
+		if existing[p.Name] {
+			skipped = append(skipped, gin.H{"table": p.Table, "reason": "任务名称已存在"})
+			continue
+		}
+
+		pretty, err := ct.dataxController.dataxService.FormatJSON(p.Job)
+		if err != nil {
+			skipped = append(skipped, gin.H{"table": p.Table, "reason": "JSON格式化失败"})
+			continue
+		}
+
+		result, err := tx.Exec(`INSERT INTO tasks(name, project_id, source_id, target_id, json_config, created_by, updated_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, p.Name, projectID, p.SourceID, p.TargetID, pretty, userID, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"success": false, "error": fmt.Sprintf("创建任务 %s 失败: %v", p.Name, err)})
+			return
+		}
+		taskID, _ := result.LastInsertId()
+		if _, err := services.SaveTaskConfig(tx, int(taskID), pretty, "批量生成", userID); err != nil {
+			c.JSON(500, gin.H{"success": false, "error": fmt.Sprintf("创建任务 %s 失败: %v", p.Name, err)})
+			return
+		}
+
+		if flowID > 0 {
+			stepOrder++
+			_, err = tx.Exec(`INSERT INTO task_flow_steps (flow_id, task_id, step_order, created_by, updated_by)
+				VALUES (?, ?, ?, ?, ?)`, flowID, taskID, stepOrder, userID, userID)
+			if err != nil {
+				c.JSON(500, gin.H{"success": false, "error": "添加任务到流程失败: " + err.Error()})
+				return
+			}
+		}
+
+		existing[p.Name] = true
+		created = append(created, gin.H{"id": taskID, "name": p.Name, "table": p.Table})
+		createdIDs = append(createdIDs, int(taskID))
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"success": false, "error": "提交事务失败"})
+		return
+	}
+
+	for _, id := range createdIDs {
+		ct.audit(c, services.AuditCreate, services.AuditTask, id, nil, ct.snapshot(services.AuditTask, id))
+	}
+	redirect := "/tasks"
+	if flowID > 0 {
+		ct.audit(c, services.AuditCreate, services.AuditFlow, int(flowID), nil, ct.snapshot(services.AuditFlow, int(flowID)))
+		if err := ct.sched.ReloadTaskFlow(int(flowID)); err != nil {
+			log.Printf("scheduler: failed to add new task flow %d: %v", flowID, err)
+		}
+		redirect = fmt.Sprintf("/task-flows/%d/flow", flowID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"created":  created,
+		"skipped":  skipped,
+		"flow_id":  flowID,
+		"redirect": redirect,
+	})
+}
+
+// existingTaskNames 返回已存在的任务名称集合
+func (ct *Controller) existingTaskNames() map[string]bool {
+	names := make(map[string]bool)
+	rows, err := ct.db.Query("SELECT name FROM tasks")
+	if err != nil {
+		return names
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// bulkErrorStatus 将批量生成的错误映射为 HTTP 状态码
+func bulkErrorStatus(err error) int {
+	if ve, ok := datax.IsValidationError(err); ok {
+		return ve.StatusCode
+	}
+	return http.StatusBadRequest
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services"
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -12,24 +13,31 @@ import (
 
 // ========== 任务流处理器 ==========
 
-// TaskFlowList 显示所有任务流，包含运行、切换、编辑和删除操作
+// TaskFlowList 显示当前用户可访问项目中的任务流，包含运行、切换、编辑和删除操作
 func (ct *Controller) TaskFlowList(c *gin.Context) {
-	rows, _ := ct.db.Query(`
-		SELECT tf.id, tf.name, tf.description, tf.cron_expr, tf.enabled,
+	scope, args := projectScope(c, "tf.project_id")
+	rows, err := ct.db.Query(`
+		SELECT tf.id, tf.name, tf.project_id, p.name, tf.description, tf.cron_expr, tf.enabled, COALESCE(tf.managed_by, ''),
 		       COALESCE(uc.username, '系统') as created_by_name,
 		       COALESCE(uu.username, '系统') as updated_by_name,
 		       tf.created_at
 		FROM task_flows tf
+		JOIN projects p ON tf.project_id = p.id
 		LEFT JOIN users uc ON tf.created_by = uc.id
 		LEFT JOIN users uu ON tf.updated_by = uu.id
+		WHERE 1=1`+scope+`
 		ORDER BY tf.id DESC
-	`)
+	`, args...)
+	if err != nil {
+		c.String(500, "查询任务流失败: "+err.Error())
+		return
+	}
 	defer rows.Close()
 
 	var flows []models.TaskFlow
 	for rows.Next() {
 		var r models.TaskFlow
-		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.CronExpr, &r.Enabled, &r.CreatedByName, &r.UpdatedByName, &r.CreatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.ProjectID, &r.Project, &r.Description, &r.CronExpr, &r.Enabled, &r.ManagedBy, &r.CreatedByName, &r.UpdatedByName, &r.CreatedAt); err != nil {
 			c.String(500, "扫描任务流数据失败: %v", err)
 			return
 		}
@@ -40,7 +48,12 @@ func (ct *Controller) TaskFlowList(c *gin.Context) {
 
 // TaskFlowNewForm 显示创建新任务流的表单
 func (ct *Controller) TaskFlowNewForm(c *gin.Context) {
-	c.HTML(200, "taskflow/form.tmpl", gin.H{"IsEdit": false})
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+	c.HTML(200, "taskflow/form.tmpl", gin.H{"IsEdit": false, "Projects": projects})
 }
 
 // TaskFlowCreate 处理新任务流的创建
@@ -49,12 +62,19 @@ func (ct *Controller) TaskFlowCreate(c *gin.Context) {
 	description := strings.TrimSpace(c.PostForm("description"))
 	cronExpr := strings.TrimSpace(c.PostForm("cron"))
 
+	requested, _ := strconv.Atoi(c.PostForm("project_id"))
+	projectID, err := ct.checkCreateProject(c, requested)
+	if err != nil {
+		c.String(403, err.Error())
+		return
+	}
+
 	// 创建人
 	uid := ct.GetCurrentUserID(c)
 
 	// 入库
-	result, err := ct.db.Exec(`INSERT INTO task_flows(name, description, cron_expr, enabled, created_by, updated_by)
-		VALUES(?, ?, ?, 1, ?, ?)`, name, description, cronExpr, uid, uid)
+	result, err := ct.db.Exec(`INSERT INTO task_flows(name, project_id, description, cron_expr, enabled, created_by, updated_by)
+		VALUES(?, ?, ?, ?, 1, ?, ?)`, name, projectID, description, cronExpr, uid, uid)
 	if err != nil {
 		c.String(500, "创建任务流失败: "+err.Error())
 		return
@@ -66,6 +86,7 @@ func (ct *Controller) TaskFlowCreate(c *gin.Context) {
 		c.String(500, "获取任务流ID失败: "+err.Error())
 		return
 	}
+	ct.audit(c, services.AuditCreate, services.AuditFlow, int(flowID), nil, ct.snapshot(services.AuditFlow, int(flowID)))
 
 	// 将新任务流加入调度器
 	if err := ct.sched.ReloadTaskFlow(int(flowID)); err != nil {
@@ -80,16 +101,16 @@ func (ct *Controller) TaskFlowCreate(c *gin.Context) {
 func (ct *Controller) TaskFlowProperties(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	// 获取任务流详情
-	var name, description, cronExpr string
-	err := ct.db.QueryRow("SELECT name, description, cron_expr FROM task_flows WHERE id=?", id).
-		Scan(&name, &description, &cronExpr)
+	var name, description, cronExpr, managedBy string
+	err := ct.db.QueryRow("SELECT name, description, cron_expr, COALESCE(managed_by,'') FROM task_flows WHERE id=?", id).
+		Scan(&name, &description, &cronExpr, &managedBy)
 	if err != nil {
 		c.String(404, "任务流不存在")
 		return
 	}
 
 	c.HTML(200, "taskflow/form.tmpl", gin.H{
-		"FlowID": id, "Name": name, "Description": description, "Cron": cronExpr, "IsEdit": true,
+		"FlowID": id, "Name": name, "Description": description, "Cron": cronExpr, "IsEdit": true, "ManagedBy": managedBy,
 	})
 }
 
@@ -97,8 +118,8 @@ func (ct *Controller) TaskFlowProperties(c *gin.Context) {
 func (ct *Controller) TaskFlowFlow(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	// 获取任务流详情
-	var name string
-	err := ct.db.QueryRow("SELECT name FROM task_flows WHERE id=?", id).Scan(&name)
+	var name, managedBy string
+	err := ct.db.QueryRow("SELECT name, COALESCE(managed_by,'') FROM task_flows WHERE id=?", id).Scan(&name, &managedBy)
 	if err != nil {
 		c.String(404, "任务流不存在")
 		return
@@ -106,29 +127,24 @@ func (ct *Controller) TaskFlowFlow(c *gin.Context) {
 
 	// 获取任务流步骤
 	stepRows, _ := ct.db.Query(`
-		SELECT s.id, s.step_order, s.timeout_minutes, 
-		       t.name as task_name, t.id as task_id
+		SELECT s.id, s.step_order, s.step_type, s.timeout_minutes, 
+		       COALESCE(t.name, s.name, '') as task_name, COALESCE(s.task_id, 0) as task_id,
+		       COALESCE(s.step_config, '')
 		FROM task_flow_steps s
-		JOIN tasks t ON s.task_id = t.id
-		WHERE s.flow_id = ?
+		LEFT JOIN tasks t ON s.task_id = t.id
+		WHERE s.flow_id = ? AND (s.step_type <> 'datax' OR t.id IS NOT NULL)
 		ORDER BY s.step_order`, id)
 	defer stepRows.Close()
 
 	var steps []models.TaskFlowStep
 	for stepRows.Next() {
 		var s models.TaskFlowStep
-		stepRows.Scan(&s.ID, &s.StepOrder, &s.TimeoutMinutes, &s.TaskName, &s.TaskID)
+		stepRows.Scan(&s.ID, &s.StepOrder, &s.StepType, &s.TimeoutMinutes, &s.TaskName, &s.TaskID, &s.Config)
 		steps = append(steps, s)
 	}
 
-	// 获取可用于添加步骤的任务（仅限未在任何流程中的任务）
-	taskRows, _ := ct.db.Query(`
-		SELECT t.id, t.name 
-		FROM tasks t 
-		LEFT JOIN task_flow_steps tfs ON t.id = tfs.task_id 
-		WHERE tfs.task_id IS NULL 
-		ORDER BY t.name
-	`)
+	// 获取可用于添加步骤的任务，任务可被同一项目的多个任务流复用
+	taskRows, _ := ct.db.Query(`SELECT id, name FROM tasks WHERE project_id = (SELECT project_id FROM task_flows WHERE id=?) ORDER BY name`, id)
 	defer taskRows.Close()
 	var availableTasks []models.TaskFlowSelection
 	for taskRows.Next() {
@@ -137,8 +153,18 @@ func (ct *Controller) TaskFlowFlow(c *gin.Context) {
 		availableTasks = append(availableTasks, t)
 	}
 
+	// 获取可用于检查和 SQL 步骤的 MySQL 数据源
+	mysqlSources, err := ct.GetDataSourcesByType(c, "mysql")
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取MySQL数据源失败: %v", err))
+		return
+	}
+
+	_, role := ct.auth.CurrentUser(c.Request)
+
 	c.HTML(200, "taskflow/flow.tmpl", gin.H{
 		"FlowID": id, "Name": name, "Steps": steps, "AvailableTasks": availableTasks,
+		"MySQLSources": mysqlSources, "IsAdmin": role == "admin", "ManagedBy": managedBy,
 	})
 }
 
@@ -164,6 +190,8 @@ func (ct *Controller) TaskFlowRunNow(c *gin.Context) {
 		return
 	}
 
+	ct.auditAction(c, services.AuditRun, services.AuditFlow, id, "")
+
 	// 异步执行任务流
 	go func() {
 		if err := ct.sched.RunTaskFlow(context.Background(), id); err != nil {
@@ -182,7 +210,15 @@ func (ct *Controller) TaskFlowRunNow(c *gin.Context) {
 // TaskFlowToggle 切换任务流的启用状态
 func (ct *Controller) TaskFlowToggle(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if ct.managedBy("task_flows", id) != "" {
+		c.String(403, msgFlowManaged)
+		return
+	}
+	before := ct.snapshot(services.AuditFlow, id)
 	ct.db.Exec("UPDATE task_flows SET enabled=1-enabled WHERE id=?", id)
+	if before != nil {
+		ct.audit(c, services.AuditToggle, services.AuditFlow, id, before, ct.snapshot(services.AuditFlow, id))
+	}
 
 	// 在调度器中重新加载任务流以应用启用/禁用更改
 	if err := ct.sched.ReloadTaskFlow(id); err != nil {
@@ -199,6 +235,7 @@ func (ct *Controller) TaskFlowKill(c *gin.Context) {
 		c.String(400, fmt.Sprintf("无法终止: %v", err))
 		return
 	}
+	ct.auditAction(c, services.AuditKill, services.AuditFlow, id, "")
 	c.Redirect(302, fmt.Sprintf("/task-flows/%d", id))
 }
 
@@ -208,6 +245,11 @@ func (ct *Controller) TaskFlowUpdate(c *gin.Context) {
 	description := strings.TrimSpace(c.PostForm("description"))
 	cronExpr := strings.TrimSpace(c.PostForm("cron"))
 
+	if ct.managedBy("task_flows", id) != "" {
+		c.String(403, msgFlowManaged)
+		return
+	}
+
 	// 获取当前用户ID
 	uid := ct.GetCurrentUserID(c)
 
@@ -220,12 +262,14 @@ func (ct *Controller) TaskFlowUpdate(c *gin.Context) {
 	}
 
 	// 更新数据库
+	before := ct.snapshot(services.AuditFlow, id)
 	_, err = ct.db.Exec(`UPDATE task_flows SET description=?, cron_expr=?, updated_by=? WHERE id=?`,
 		description, cronExpr, uid, id)
 	if err != nil {
 		c.String(500, "更新失败: "+err.Error())
 		return
 	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, id, before, ct.snapshot(services.AuditFlow, id))
 
 	// 只有当cron表达式发生变化时才重新加载任务流
 	if currentCronExpr != cronExpr {
@@ -244,6 +288,12 @@ func (ct *Controller) TaskFlowUpdate(c *gin.Context) {
 // TaskFlowDelete 永久删除任务流及其步骤
 func (ct *Controller) TaskFlowDelete(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if ct.managedBy("task_flows", id) != "" {
+		c.JSON(403, gin.H{"error": msgFlowManaged})
+		return
+	}
+
+	before := ct.snapshot(services.AuditFlow, id)
 
 	// 先从cron调度中移除任务流
 	if err := ct.sched.RemoveTaskFlowFromCron(id); err != nil {
@@ -270,15 +320,73 @@ func (ct *Controller) TaskFlowDelete(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "任务流不存在"})
 		return
 	}
+	ct.audit(c, services.AuditDelete, services.AuditFlow, id, before, nil)
 
 	c.JSON(200, gin.H{"message": "删除成功", "redirect": "/task-flows"})
 }
 
-// TaskFlowAddStep 向流程添加任务
+// TaskFlowAddStep 向流程添加步骤，支持 DataX 任务、数据质量检查、SQL 和 Shell 步骤
 func (ct *Controller) TaskFlowAddStep(c *gin.Context) {
 	flowID, _ := strconv.Atoi(c.Param("id"))
-	taskID, _ := strconv.Atoi(c.PostForm("task_id"))
+	stepType := c.DefaultPostForm("step_type", services.StepTypeDataX)
 	timeoutStr := strings.TrimSpace(c.PostForm("timeout_minutes"))
+	if ct.managedBy("task_flows", flowID) != "" {
+		c.String(403, msgFlowManaged)
+		return
+	}
+
+	// DataX 步骤关联任务，其余步骤保存名称和配置
+	var taskID, stepName, stepConfig any
+	if stepType == services.StepTypeDataX {
+		id, err := strconv.Atoi(c.PostForm("task_id"))
+		if err != nil || id <= 0 {
+			c.String(400, "请选择任务")
+			return
+		}
+		// project_id 由 MustProjectRole 中间件设置
+		if err := ct.checkSameProject("tasks", id, c.GetInt("project_id")); err != nil {
+			c.String(400, "任务: "+err.Error())
+			return
+		}
+		taskID = id
+	} else {
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			c.String(400, "步骤名称不能为空")
+			return
+		}
+		dsID, _ := strconv.Atoi(c.PostForm("data_source_id"))
+		if dsID > 0 {
+			if err := ct.checkDataSourcesUsable(c, c.GetInt("project_id"), dsID); err != nil {
+				c.String(403, err.Error())
+				return
+			}
+		}
+
+		var config string
+		var err error
+		switch stepType {
+		case services.StepTypeCheck:
+			config, err = services.NewCheckConfig(dsID, c.PostForm("assertions"))
+		case services.StepTypeSQL:
+			config, err = services.NewSQLStepConfig(dsID, c.PostForm("sql"))
+		case services.StepTypeShell:
+			// Shell 脚本在服务器上执行，仅允许管理员添加
+			if _, role := ct.auth.CurrentUser(c.Request); role != "admin" {
+				c.String(403, "仅管理员可以添加 Shell 步骤")
+				return
+			}
+			config, err = services.NewShellStepConfig(c.PostForm("script"))
+		default:
+			c.String(400, "不支持的步骤类型")
+			return
+		}
+		if err != nil {
+			c.String(400, err.Error())
+			return
+		}
+		stepName, stepConfig = name, config
+	}
 
 	// Get next step order
 	var maxOrder int
@@ -296,7 +404,14 @@ func (ct *Controller) TaskFlowAddStep(c *gin.Context) {
 	uid := ct.GetCurrentUserID(c)
 
 	// 插入新步骤
-	ct.db.Exec("INSERT INTO task_flow_steps (flow_id, task_id, step_order, timeout_minutes, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?)", flowID, taskID, maxOrder+1, timeout, uid, uid)
+	before := ct.snapshot(services.AuditFlow, flowID)
+	_, err := ct.db.Exec(`INSERT INTO task_flow_steps (flow_id, step_type, task_id, name, step_config, step_order, timeout_minutes, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, flowID, stepType, taskID, stepName, stepConfig, maxOrder+1, timeout, uid, uid)
+	if err != nil {
+		c.String(500, "添加步骤失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
 
 	c.Redirect(302, fmt.Sprintf("/task-flows/%d/flow", flowID))
 }
@@ -305,6 +420,12 @@ func (ct *Controller) TaskFlowAddStep(c *gin.Context) {
 func (ct *Controller) TaskFlowRemoveStep(c *gin.Context) {
 	flowID, _ := strconv.Atoi(c.Param("id"))
 	stepID, _ := strconv.Atoi(c.Param("step_id"))
+	if ct.managedBy("task_flows", flowID) != "" {
+		c.String(403, msgFlowManaged)
+		return
+	}
+
+	before := ct.snapshot(services.AuditFlow, flowID)
 
 	// 开始事务
 	tx, err := ct.db.Begin()
@@ -342,6 +463,7 @@ func (ct *Controller) TaskFlowRemoveStep(c *gin.Context) {
 		c.String(500, fmt.Sprintf("提交事务失败: %v", err))
 		return
 	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
 
 	c.JSON(200, gin.H{"message": "步骤删除成功"})
 }
@@ -350,6 +472,10 @@ func (ct *Controller) TaskFlowRemoveStep(c *gin.Context) {
 func (ct *Controller) TaskFlowReorderSteps(c *gin.Context) {
 	flowID, _ := strconv.Atoi(c.Param("id"))
 	stepOrders := c.PostFormArray("step_order")
+	if ct.managedBy("task_flows", flowID) != "" {
+		c.String(403, msgFlowManaged)
+		return
+	}
 
 	if len(stepOrders) == 0 {
 		c.String(400, "没有提供步骤顺序")
@@ -368,6 +494,8 @@ func (ct *Controller) TaskFlowReorderSteps(c *gin.Context) {
 		return
 	}
 
+	before := ct.snapshot(services.AuditFlow, flowID)
+
 	// 开始事务
 	tx, err := ct.db.Begin()
 	if err != nil {
@@ -416,5 +544,6 @@ func (ct *Controller) TaskFlowReorderSteps(c *gin.Context) {
 		c.String(500, fmt.Sprintf("提交事务失败: %v", err))
 		return
 	}
+	ct.audit(c, services.AuditUpdate, services.AuditFlow, flowID, before, ct.snapshot(services.AuditFlow, flowID))
 	c.JSON(200, gin.H{"message": "步骤顺序更新成功"})
 }
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBundleSize 导入包的大小上限
+const maxBundleSize = 10 << 20
+
+// TaskFlowExport 将选中的任务流及其引用的任务和数据源导出为 yaml/json 导入包
+func (ct *Controller) TaskFlowExport(c *gin.Context) {
+	var ids []int
+	for _, v := range c.PostFormArray("flow_ids") {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.String(400, "无效的任务流ID: "+v)
+			return
+		}
+		ids = append(ids, id)
+	}
+	format := c.DefaultPostForm("format", "yaml")
+	passphrase := c.PostForm("passphrase")
+	if err := ct.checkExportFlows(c, ids); err != nil {
+		c.String(403, "导出失败: "+err.Error())
+		return
+	}
+
+	secretProjects, err := ct.exportSecretProjects(c)
+	if err != nil {
+		c.String(500, "导出失败: "+err.Error())
+		return
+	}
+	bundle, err := services.ExportBundle(ct.db, ids, passphrase, secretProjects)
+	if err != nil {
+		c.String(400, "导出失败: "+err.Error())
+		return
+	}
+	data, err := services.MarshalBundle(bundle, format)
+	if err != nil {
+		c.String(400, "导出失败: "+err.Error())
+		return
+	}
+
+	contentType := "application/x-yaml"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	filename := fmt.Sprintf("datax-flows-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(200, contentType, data)
+}
+
+// checkExportFlows 导入包包含数据源凭据，导出要求当前用户是每个任务流所属项目的编辑者
+func (ct *Controller) checkExportFlows(c *gin.Context, ids []int) error {
+	for _, id := range ids {
+		var projectID int
+		if err := ct.db.QueryRow("SELECT project_id FROM task_flows WHERE id=?", id).Scan(&projectID); err != nil {
+			return fmt.Errorf("任务流 %d 不存在", id)
+		}
+		if !services.ProjectRoleAtLeast(ct.projectRole(c, projectID), services.ProjectEditor) {
+			return fmt.Errorf("没有导出任务流 %d 的权限", id)
+		}
+	}
+	return nil
+}
+
+// exportSecretProjects 返回当前用户可以导出数据源密钥的项目，即具有编辑者角色的项目；管理员不限制（nil）。
+// 任务可能使用其他项目中的数据源，导出时不能借此解密当前用户不是编辑者的项目中的密码
+func (ct *Controller) exportSecretProjects(c *gin.Context) (map[int]bool, error) {
+	if ct.currentRole(c) == "admin" {
+		return nil, nil
+	}
+	projects, err := services.UserProjects(ct.db, ct.GetCurrentUserID(c))
+	if err != nil {
+		return nil, err
+	}
+	editable := map[int]bool{}
+	for _, p := range projects {
+		if p.Role == services.ProjectEditor {
+			editable[p.ID] = true
+		}
+	}
+	return editable, nil
+}
+
+// importProjectOptions 设置导入的目标项目，非管理员只能复用自己可访问项目中的已有数据源
+func (ct *Controller) importProjectOptions(c *gin.Context, opts *services.ImportOptions, requested int) error {
+	projectID, err := ct.checkCreateProject(c, requested)
+	if err != nil {
+		return err
+	}
+	opts.ProjectID = projectID
+	if ct.currentRole(c) == "admin" {
+		return nil
+	}
+	projects, err := services.UserProjects(ct.db, ct.GetCurrentUserID(c))
+	if err != nil {
+		return err
+	}
+	opts.DataSourceProjects = map[int]bool{}
+	for _, p := range projects {
+		opts.DataSourceProjects[p.ID] = true
+	}
+	return nil
+}
+
+// TaskFlowImportForm 显示导入页面
+func (ct *Controller) TaskFlowImportForm(c *gin.Context) {
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+	c.HTML(200, "taskflow/import.tmpl", gin.H{"DryRun": true, "Projects": projects, "ProjectID": 0})
+}
+
+// TaskFlowImport 导入任务流导入包。预演模式只返回导入计划；
+// 存在冲突时不会写入任何数据。
+func (ct *Controller) TaskFlowImport(c *gin.Context) {
+	content := c.PostForm("bundle")
+	if file, err := c.FormFile("bundle_file"); err == nil {
+		if file.Size > maxBundleSize {
+			c.String(400, "导入文件过大")
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.String(400, "读取导入文件失败: "+err.Error())
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxBundleSize))
+		f.Close()
+		if err != nil {
+			c.String(400, "读取导入文件失败: "+err.Error())
+			return
+		}
+		content = string(data)
+	}
+
+	opts := services.ImportOptions{
+		Passphrase: c.PostForm("passphrase"),
+		Overwrite:  c.PostForm("overwrite") == "1",
+		DryRun:     c.PostForm("dry_run") == "1",
+		AllowShell: ct.currentRole(c) == "admin",
+	}
+	requested, _ := strconv.Atoi(c.PostForm("project_id"))
+	projects, err := ct.editableProjects(c)
+	if err != nil {
+		c.String(500, fmt.Sprintf("获取项目失败: %v", err))
+		return
+	}
+	// 回显表单，便于预演后直接确认导入
+	page := gin.H{"Bundle": content, "Overwrite": opts.Overwrite, "DryRun": opts.DryRun,
+		"Projects": projects, "ProjectID": requested}
+
+	if err := ct.importProjectOptions(c, &opts, requested); err != nil {
+		page["Error"] = err.Error()
+		c.HTML(403, "taskflow/import.tmpl", page)
+		return
+	}
+
+	bundle, err := services.ParseBundle([]byte(content))
+	if err != nil {
+		page["Error"] = err.Error()
+		c.HTML(400, "taskflow/import.tmpl", page)
+		return
+	}
+
+	result, err := services.ImportBundle(ct.db, bundle, opts, ct.GetCurrentUserID(c))
+	if err != nil {
+		page["Error"] = err.Error()
+		c.HTML(400, "taskflow/import.tmpl", page)
+		return
+	}
+
+	if result.Applied {
+		ct.rescheduleImported(result)
+		ct.auditImport(c, result, "导入")
+		// 导入完成后不再回显内容，避免重复提交
+		page["Bundle"] = ""
+	}
+
+	page["Result"] = result
+	page["Summary"] = importSummary(result)
+	c.HTML(200, "taskflow/import.tmpl", page)
+}
+
+// rescheduleImported 导入或同步完成后重新加载新建、更新的任务流，并移除已删除任务流的调度
+func (ct *Controller) rescheduleImported(result *services.ImportResult) {
+	for _, id := range result.FlowIDs {
+		if err := ct.sched.ReloadTaskFlow(id); err != nil {
+			log.Printf("scheduler: failed to reload imported task flow %d: %v", id, err)
+		}
+	}
+	for _, id := range result.RemovedFlowIDs {
+		if err := ct.sched.RemoveTaskFlowFromCron(id); err != nil {
+			log.Printf("scheduler: failed to remove task flow %d from cron: %v", id, err)
+		}
+	}
+}
+
+// importSummary 生成导入计划的统计说明
+func importSummary(r *services.ImportResult) string {
+	labels := []struct{ action, label string }{
+		{services.ImportCreate, "新建"},
+		{services.ImportUpdate, "更新"},
+		{services.ImportReuse, "复用"},
+		{services.ImportUnchanged, "无变化"},
+		{services.ImportDelete, "删除"},
+		{services.ImportConflict, "冲突"},
+	}
+	var parts []string
+	for _, l := range labels {
+		if n := r.Count(l.action); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", l.label, n))
+		}
+	}
+	return strings.Join(parts, "，")
+}
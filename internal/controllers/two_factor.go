@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"com.duole/datax-web-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// twoFactorPage 返回两步验证设置页面的数据，未启用时生成用于绑定的二维码
+func (ct *Controller) twoFactorPage(c *gin.Context) gin.H {
+	uid := ct.GetCurrentUserID(c)
+	page := gin.H{"Required": ct.auth.TwoFactorRequired(ct.currentRole(c))}
+	enabled, remaining, err := services.TwoFactorStatus(ct.db, uid)
+	if err != nil {
+		page["Error"] = "读取两步验证状态失败: " + err.Error()
+		return page
+	}
+	page["Enabled"] = enabled
+	page["Remaining"] = remaining
+	if !enabled {
+		enrollment, err := services.BeginTwoFactorEnrollment(ct.db, uid, ct.cfg.TwoFactor.Issuer)
+		if err != nil {
+			page["Error"] = "生成两步验证密钥失败: " + err.Error()
+			return page
+		}
+		page["Secret"] = enrollment.Secret
+		// 二维码为 data URI，需显式标记为可信地址才能用于 img src
+		page["QRCode"] = template.URL(enrollment.QRCode)
+	}
+	return page
+}
+
+// TwoFactorForm 显示当前用户的两步验证设置页面
+func (ct *Controller) TwoFactorForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "user/two_factor.tmpl", ct.twoFactorPage(c))
+}
+
+// TwoFactorEnable 校验验证器应用生成的验证码后启用两步验证，并显示恢复码
+func (ct *Controller) TwoFactorEnable(c *gin.Context) {
+	uid := ct.GetCurrentUserID(c)
+	before := ct.snapshot(services.AuditUser, uid)
+	codes, err := services.ConfirmTwoFactor(ct.db, uid, c.PostForm("code"))
+	if err != nil {
+		page := ct.twoFactorPage(c)
+		page["Error"] = err.Error()
+		c.HTML(http.StatusBadRequest, "user/two_factor.tmpl", page)
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, uid, before, ct.snapshot(services.AuditUser, uid))
+
+	page := ct.twoFactorPage(c)
+	page["RecoveryCodes"] = codes
+	c.HTML(http.StatusOK, "user/two_factor.tmpl", page)
+}
+
+// TwoFactorDisable 校验验证码后关闭两步验证，角色要求两步验证时不能关闭
+func (ct *Controller) TwoFactorDisable(c *gin.Context) {
+	uid := ct.GetCurrentUserID(c)
+	fail := func(status int, msg string) {
+		page := ct.twoFactorPage(c)
+		page["Error"] = msg
+		c.HTML(status, "user/two_factor.tmpl", page)
+	}
+	if ct.auth.TwoFactorRequired(ct.currentRole(c)) {
+		fail(http.StatusBadRequest, "当前角色要求启用两步验证，不能关闭")
+		return
+	}
+	if err := services.VerifyTwoFactor(ct.db, uid, c.PostForm("code")); err != nil {
+		fail(http.StatusBadRequest, services.ErrInvalidTwoFactorCode.Error())
+		return
+	}
+
+	before := ct.snapshot(services.AuditUser, uid)
+	if err := services.DisableTwoFactor(ct.db, uid); err != nil {
+		fail(http.StatusInternalServerError, "关闭两步验证失败: "+err.Error())
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, uid, before, ct.snapshot(services.AuditUser, uid))
+	c.Redirect(http.StatusFound, twoFactorPath)
+}
+
+// TwoFactorRecoveryCodes 校验验证码后重新生成恢复码，原有恢复码作废
+func (ct *Controller) TwoFactorRecoveryCodes(c *gin.Context) {
+	uid := ct.GetCurrentUserID(c)
+	fail := func(status int, msg string) {
+		page := ct.twoFactorPage(c)
+		page["Error"] = msg
+		c.HTML(status, "user/two_factor.tmpl", page)
+	}
+	if err := services.VerifyTwoFactor(ct.db, uid, c.PostForm("code")); err != nil {
+		fail(http.StatusBadRequest, services.ErrInvalidTwoFactorCode.Error())
+		return
+	}
+	codes, err := services.RegenerateRecoveryCodes(ct.db, uid)
+	if err != nil {
+		fail(http.StatusInternalServerError, "生成恢复码失败: "+err.Error())
+		return
+	}
+
+	page := ct.twoFactorPage(c)
+	page["RecoveryCodes"] = codes
+	c.HTML(http.StatusOK, "user/two_factor.tmpl", page)
+}
+
+// UserResetTwoFactor 管理员为丢失验证器设备的用户关闭两步验证，该用户已登录的会话立即失效。
+// 角色要求两步验证时，用户下次登录后需重新绑定
+func (ct *Controller) UserResetTwoFactor(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if _, err := ct.loadUser(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "用户不存在"})
+		return
+	}
+
+	before := ct.snapshot(services.AuditUser, id)
+	if err := services.DisableTwoFactor(ct.db, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "重置两步验证失败"})
+		return
+	}
+	if err := services.RevokeUserSessions(ct.db, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "撤销会话失败"})
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, id, before, ct.snapshot(services.AuditUser, id))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "两步验证已重置，该用户已登录的会话已失效"})
+}
@@ -1,31 +1,35 @@
 package controllers
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"com.duole/datax-web-go/internal/models"
 	"com.duole/datax-web-go/internal/services"
 	"github.com/gin-gonic/gin"
-	"strconv"
-	"strings"
 )
 
-// UserList 显示所有用户
+// UserList 显示所有未删除的用户
 func (ct *Controller) UserList(c *gin.Context) {
 	rows, _ := ct.db.Query(`
 		SELECT 
-			u.id, u.username, u.role, u.disabled,
+			u.id, u.username, u.display_name, u.email, u.role, u.disabled, u.auth_source, u.totp_enabled,
 		    COALESCE(uc.username, '系统') as created_by_name,
 		    COALESCE(uu.username, '系统') as updated_by_name,
 		    u.created_at
 		FROM users u
 		LEFT JOIN users uc ON u.created_by = uc.id
 		LEFT JOIN users uu ON u.updated_by = uu.id
+		WHERE u.deleted_at IS NULL
 		ORDER BY u.id DESC
 	`)
 	defer rows.Close()
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		rows.Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.CreatedByName, &u.UpdatedByName, &u.CreatedAt)
+		rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.Email, &u.Role, &u.Disabled, &u.AuthSource, &u.TwoFactor, &u.CreatedByName, &u.UpdatedByName, &u.CreatedAt)
 		users = append(users, u)
 	}
 	c.HTML(200, "user/list.tmpl", gin.H{"Users": users})
@@ -33,21 +37,147 @@ func (ct *Controller) UserList(c *gin.Context) {
 
 // UserNewForm 显示创建新用户的表单
 func (ct *Controller) UserNewForm(c *gin.Context) {
-	c.HTML(200, "user/form.tmpl", gin.H{})
+	c.HTML(200, "user/form.tmpl", gin.H{"Form": models.User{Role: "user"}})
+}
+
+// userInput 从表单读取可编辑的用户字段
+func userInput(c *gin.Context) services.UserInput {
+	return services.UserInput{
+		Role:        c.PostForm("role"),
+		DisplayName: strings.TrimSpace(c.PostForm("display_name")),
+		Email:       strings.TrimSpace(c.PostForm("email")),
+		Disabled:    c.PostForm("disabled") == "1",
+	}
 }
 
-// UserCreate 创建新用户
+// UserCreate 创建新用户。未填写初始密码时自动生成并仅显示一次，
+// 新用户首次登录后必须修改密码
 func (ct *Controller) UserCreate(c *gin.Context) {
 	username := strings.TrimSpace(c.PostForm("username"))
-	role := c.PostForm("role")
 	password := c.PostForm("password")
+	in := userInput(c)
+	form := models.User{Username: username, Role: in.Role, DisplayName: in.DisplayName, Email: in.Email, Disabled: in.Disabled}
+	fail := func(status int, msg string) {
+		c.HTML(status, "user/form.tmpl", gin.H{"Form": form, "Error": msg})
+	}
+
+	if err := services.ValidateUsername(username); err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := in.Validate(); err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = services.GeneratePassword(ct.cfg.PasswordPolicy); err != nil {
+			fail(http.StatusInternalServerError, "生成随机密码失败")
+			return
+		}
+	} else if err := services.CheckPasswordPolicy(ct.cfg.PasswordPolicy, username, password); err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := services.CheckUsernameAvailable(ct.db, username); err != nil {
+		fail(http.StatusConflict, err.Error())
+		return
+	}
+	hashed, err := services.HashPassword(password)
+	if err != nil {
+		fail(http.StatusInternalServerError, "创建用户失败")
+		return
+	}
 
 	// 获取当前用户ID
 	createdBy := ct.GetCurrentUserID(c)
-	hashed, _ := services.HashPassword(password)
-	ct.db.Exec(`INSERT INTO users(username, password, role, disabled, created_by, updated_by) 
-		VALUES (?, ?, ?, 0, ?, ?)`, username, hashed, role, createdBy, createdBy)
+	result, err := ct.db.Exec(`INSERT INTO users(username, password, role, disabled, display_name, email,
+		must_change_password, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)`,
+		username, hashed, in.Role, in.Disabled, in.DisplayName, in.Email, createdBy, createdBy)
+	if err != nil {
+		// 并发创建同名用户时由唯一索引兜底
+		if services.CheckUsernameAvailable(ct.db, username) != nil {
+			fail(http.StatusConflict, fmt.Sprintf("用户名 %s 已存在", username))
+			return
+		}
+		fail(http.StatusInternalServerError, "创建用户失败: "+err.Error())
+		return
+	}
+	id64, _ := result.LastInsertId()
+	id := int(id64)
+	ct.audit(c, services.AuditCreate, services.AuditUser, id, nil, ct.snapshot(services.AuditUser, id))
+
+	if generated {
+		c.HTML(http.StatusOK, "user/form.tmpl", gin.H{"Created": username, "Password": password})
+		return
+	}
+	c.Redirect(302, "/admin/users")
+}
+
+// loadUser 读取未删除的用户
+func (ct *Controller) loadUser(id int) (models.User, error) {
+	var u models.User
+	err := ct.db.QueryRow(`SELECT id, username, display_name, email, role, disabled, auth_source
+		FROM users WHERE id=? AND deleted_at IS NULL`, id).
+		Scan(&u.ID, &u.Username, &u.DisplayName, &u.Email, &u.Role, &u.Disabled, &u.AuthSource)
+	return u, err
+}
 
+// userEditPage 返回编辑用户页面的数据，包括删除时可接收任务和任务流的用户
+func (ct *Controller) userEditPage(c *gin.Context, u models.User) gin.H {
+	var candidates []models.User
+	rows, err := ct.db.Query(`SELECT id, username FROM users
+		WHERE deleted_at IS NULL AND disabled=0 AND id<>? ORDER BY username`, u.ID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var cand models.User
+			if err := rows.Scan(&cand.ID, &cand.Username); err == nil {
+				candidates = append(candidates, cand)
+			}
+		}
+	}
+	return gin.H{
+		"User":         u,
+		"Form":         u,
+		"Self":         u.ID == ct.GetCurrentUserID(c),
+		"TransferTo":   candidates,
+		"ExternalRole": u.AuthSource != "" && u.AuthSource != services.AuthSourceLocal,
+	}
+}
+
+// UserEditForm 显示编辑用户的表单
+func (ct *Controller) UserEditForm(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	u, err := ct.loadUser(id)
+	if err != nil {
+		c.String(http.StatusNotFound, "用户不存在")
+		return
+	}
+	c.HTML(http.StatusOK, "user/form.tmpl", ct.userEditPage(c, u))
+}
+
+// UserUpdate 修改用户的角色、状态、显示名称和邮箱，用户名不可修改
+func (ct *Controller) UserUpdate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	u, err := ct.loadUser(id)
+	if err != nil {
+		c.String(http.StatusNotFound, "用户不存在")
+		return
+	}
+	in := userInput(c)
+
+	before := ct.snapshot(services.AuditUser, id)
+	if err := services.UpdateUser(ct.db, id, in, ct.GetCurrentUserID(c)); err != nil {
+		page := ct.userEditPage(c, u)
+		page["Form"] = models.User{ID: u.ID, Username: u.Username, AuthSource: u.AuthSource,
+			Role: in.Role, DisplayName: in.DisplayName, Email: in.Email, Disabled: in.Disabled}
+		page["Error"] = err.Error()
+		c.HTML(http.StatusBadRequest, "user/form.tmpl", page)
+		return
+	}
+	ct.audit(c, services.AuditUpdate, services.AuditUser, id, before, ct.snapshot(services.AuditUser, id))
 	c.Redirect(302, "/admin/users")
 }
 
@@ -57,11 +187,51 @@ func (ct *Controller) UserToggle(c *gin.Context) {
 
 	// 获取当前用户ID
 	updatedBy := ct.GetCurrentUserID(c)
-	_, err := ct.db.Exec("UPDATE users SET disabled=1-disabled, updated_by=? WHERE id=?", updatedBy, id)
-	if err != nil {
+	before := ct.snapshot(services.AuditUser, id)
+	if err := services.ToggleUser(ct.db, id, updatedBy); err == services.ErrLastAdmin {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": err.Error()})
+		return
+	} else if err == services.ErrUserNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(500, gin.H{"success": false, "error": "更新用户状态失败"})
 		return
 	}
+	ct.audit(c, services.AuditToggle, services.AuditUser, id, before, ct.snapshot(services.AuditUser, id))
 
 	c.JSON(200, gin.H{"success": true, "message": "用户状态更新成功"})
 }
+
+// UserDelete 软删除用户，其创建的任务和任务流转交给 transfer_to 指定的用户。
+// 不能删除当前登录的用户
+func (ct *Controller) UserDelete(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	transferTo, err := strconv.Atoi(c.Query("transfer_to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请选择接收任务和任务流的用户"})
+		return
+	}
+	currentID := ct.GetCurrentUserID(c)
+	if id == currentID {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "不能删除当前登录的用户"})
+		return
+	}
+	var receiver string
+	ct.db.QueryRow("SELECT username FROM users WHERE id=?", transferTo).Scan(&receiver)
+
+	before := ct.snapshot(services.AuditUser, id)
+	if err := services.DeleteUser(ct.db, id, transferTo, currentID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	ct.recordAudit(c, services.AuditEntry{
+		Action:     services.AuditDelete,
+		ObjectType: services.AuditUser,
+		ObjectID:   id,
+		ObjectName: auditName(before),
+		Changes:    services.AuditDiff(before, ct.snapshot(services.AuditUser, id)),
+		Detail:     "任务和任务流转交给 " + receiver,
+	})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "用户已删除"})
+}
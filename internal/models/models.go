@@ -10,10 +10,13 @@ import (
 type DataSource struct {
 	ID            int       `json:"id"`
 	Name          string    `json:"name"`
+	ProjectID     int       `json:"project_id"`
+	Project       string    `json:"project,omitempty"`
 	Type          string    `json:"type"`
 	DBURL         *string   `json:"db_url,omitempty"`
 	DBUser        *string   `json:"db_user,omitempty"`
 	DBPassword    *string   `json:"db_password,omitempty"`
+	DBPasswordRef *string   `json:"db_password_ref,omitempty"`
 	DBDatabase    *string   `json:"db_database,omitempty"`
 	DefaultFS     *string   `json:"defaultfs,omitempty"`
 	HadoopConfig  *string   `json:"hadoopconfig,omitempty"`
@@ -25,25 +28,79 @@ type DataSource struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// ========== API 令牌模型 ==========
+
+// APIToken 表示用户的个人 API 令牌，明文只在创建时返回
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserSession 表示服务端保存的登录会话
+type UserSession struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
 // ========== 任务模型 ==========
 
 // Task 表示任务记录
 type Task struct {
 	ID         int    `json:"id"`
 	Name       string `json:"name"`
+	ProjectID  int    `json:"project_id"`
+	Project    string `json:"project,omitempty"`
 	SourceID   int    `json:"source_id"`
 	TargetID   int    `json:"target_id"`
 	JsonConfig string `json:"json_config"`
+	Version    int    `json:"current_version"`
+	IncrColumn string `json:"incr_column,omitempty"`
+	// 执行后对账配置
+	ReconcileEnabled   bool `json:"reconcile_enabled"`
+	ReconcileTolerance int  `json:"reconcile_tolerance"`
+	// 非空时表示由外部来源（如 Git 同步）管理，界面中只读
+	ManagedBy string `json:"managed_by,omitempty"`
 	// Additional fields for display
-	Source        string    `json:"source,omitempty"`
-	Target        string    `json:"target,omitempty"`
-	FlowName      string    `json:"flow_name,omitempty"`
-	FlowID        int       `json:"flow_id,omitempty"`
+	Source        string              `json:"source,omitempty"`
+	Target        string              `json:"target,omitempty"`
+	Flows         []TaskFlowSelection `json:"flows,omitempty"` // 引用该任务的任务流
+	CreatedBy     *int                `json:"created_by,omitempty"`
+	UpdatedBy     *int                `json:"updated_by,omitempty"`
+	CreatedByName *string             `json:"created_by_name,omitempty"`
+	UpdatedByName *string             `json:"updated_by_name,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// TaskVersion 表示任务配置的一个不可变版本
+type TaskVersion struct {
+	ID            int       `json:"id"`
+	TaskID        int       `json:"task_id"`
+	Version       int       `json:"version"`
+	JsonConfig    string    `json:"json_config"`
+	Comment       string    `json:"comment"`
 	CreatedBy     *int      `json:"created_by,omitempty"`
-	UpdatedBy     *int      `json:"updated_by,omitempty"`
 	CreatedByName *string   `json:"created_by_name,omitempty"`
-	UpdatedByName *string   `json:"updated_by_name,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TaskWatermark 表示增量任务的高水位
+type TaskWatermark struct {
+	TaskID        int       `json:"task_id"`
+	IncrColumn    string    `json:"incr_column"`
+	Watermark     string    `json:"watermark"`
+	UpdatedByName *string   `json:"updated_by_name,omitempty"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
@@ -57,8 +114,9 @@ type LogItem struct {
 
 // TaskFlowSelection 表示用于选择的任务流（简化版本）
 type TaskFlowSelection struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	ProjectID int    `json:"project_id,omitempty"`
 }
 
 // ========== User Models ==========
@@ -69,6 +127,10 @@ type User struct {
 	Username      string    `json:"username"`
 	Role          string    `json:"role"`
 	Disabled      bool      `json:"disabled"`
+	AuthSource    string    `json:"auth_source"` // local、ldap 或 oidc
+	DisplayName   string    `json:"display_name"`
+	Email         string    `json:"email"`
+	TwoFactor     bool      `json:"two_factor"` // 是否已启用两步验证
 	CreatedBy     *int      `json:"created_by,omitempty"`
 	UpdatedBy     *int      `json:"updated_by,omitempty"`
 	CreatedByName *string   `json:"created_by_name,omitempty"`
@@ -77,15 +139,62 @@ type User struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// ========== 项目模型 ==========
+
+// Project 表示项目，Role 为当前用户在项目中的角色
+type Project struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Role        string    `json:"role,omitempty"`
+	Members     int       `json:"members"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ProjectMember 表示用户在项目中的角色
+type ProjectMember struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ========== 审计日志模型 ==========
+
+// AuditLog 表示一条审计记录
+type AuditLog struct {
+	ID         int64                  `json:"id"`
+	ActorID    int                    `json:"actor_id"`
+	Actor      string                 `json:"actor"`
+	Action     string                 `json:"action"`
+	ObjectType string                 `json:"object_type"`
+	ObjectID   int                    `json:"object_id"`
+	ObjectName string                 `json:"object_name"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	Detail     string                 `json:"detail,omitempty"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"user_agent"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// AuditChange 表示一个字段变更前后的值，新建时只有 After，删除时只有 Before
+type AuditChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
 // ========== TaskFlow Models ==========
 
 // TaskFlow 表示包含所有详情的任务流
 type TaskFlow struct {
 	ID            int       `json:"id"`
 	Name          string    `json:"name"`
+	ProjectID     int       `json:"project_id"`
+	Project       string    `json:"project,omitempty"`
 	Description   string    `json:"description"`
 	CronExpr      string    `json:"cron_expr"`
 	Enabled       bool      `json:"enabled"`
+	ManagedBy     string    `json:"managed_by,omitempty"` // 非空时表示由外部来源管理，界面中只读
 	CreatedBy     *int      `json:"created_by,omitempty"`
 	UpdatedBy     *int      `json:"updated_by,omitempty"`
 	CreatedByName *string   `json:"created_by_name,omitempty"`
@@ -98,9 +207,11 @@ type TaskFlow struct {
 type TaskFlowStep struct {
 	ID             int    `json:"id"`
 	StepOrder      int    `json:"step_order"`
+	StepType       string `json:"step_type"` // datax, check, sql, shell
 	TimeoutMinutes *int   `json:"timeout_minutes,omitempty"`
-	TaskName       string `json:"task_name"`
-	TaskID         int    `json:"task_id"`
+	TaskName       string `json:"task_name"`         // datax步骤为任务名称，其余为步骤名称
+	TaskID         int    `json:"task_id,omitempty"` // 仅datax步骤有效
+	Config         string `json:"step_config,omitempty"`
 }
 
 // ========== Log Models ==========
@@ -133,6 +244,10 @@ type TaskExecutionLog struct {
 	Duration        string     `json:"duration,omitempty"`
 	LogContent      string     `json:"log_content"`
 	ErrorMessage    string     `json:"error_message,omitempty"`
+	ConfigVersion   *int       `json:"config_version,omitempty"`
+	ReconcileStatus string     `json:"reconcile_status"` // none, matched, mismatched, error
+	SourceRows      *int64     `json:"source_rows,omitempty"`
+	TargetRows      *int64     `json:"target_rows,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 }
 
@@ -0,0 +1,366 @@
+// Package openapi 根据 API 处理器的路由描述生成 OpenAPI 3 文档，
+// 请求和响应结构通过反射 Go 类型的 json 标签得到，保证文档与代码一致。
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Schema 为 OpenAPI Schema 对象，可直接作为 Operation 的 Request 或 Response 使用
+type Schema map[string]any
+
+// Param 查询参数描述
+type Param struct {
+	Name        string
+	Type        string // string, integer, boolean
+	Description string
+}
+
+// Operation 描述一个 API 路由。Request 和 Response 为示例值（如 models.Task{}）或 Schema，
+// Response 描述响应信封中 data 字段的内容。
+type Operation struct {
+	Method   string
+	Path     string // gin 风格路径，如 /api/v1/tasks/:id
+	Tag      string
+	Summary  string
+	Query    []Param
+	Request  any
+	Response any
+	Status   int // 成功状态码，缺省为 200
+	Public   bool
+}
+
+// PageParams 分页查询参数
+var PageParams = []Param{
+	{Name: "page", Type: "integer", Description: "页码，从 1 开始"},
+	{Name: "page_size", Type: "integer", Description: "每页条数，默认 20，最大 200"},
+}
+
+// Page 返回分页列表的 Schema，key 为列表字段名
+func Page(key string, item any) Schema {
+	return Schema{"type": "object", "properties": map[string]any{
+		key:           Schema{"type": "array", "items": item},
+		"total":       Schema{"type": "integer"},
+		"page":        Schema{"type": "integer"},
+		"page_size":   Schema{"type": "integer"},
+		"total_pages": Schema{"type": "integer"},
+	}}
+}
+
+// Object 返回具有给定属性的对象 Schema，属性值为示例值或 Schema
+func Object(props map[string]any) Schema {
+	return Schema{"type": "object", "properties": props}
+}
+
+// ginParam 匹配 gin 路径参数
+var ginParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// generator 在生成过程中收集引用的命名结构体
+type generator struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+// Build 生成 OpenAPI 3 文档
+func Build(title, version string, ops []Operation) map[string]any {
+	g := &generator{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+	g.schemas["Error"] = Schema{
+		"type":     "object",
+		"required": []string{"success", "error"},
+		"properties": map[string]any{
+			"success": Schema{"type": "boolean", "enum": []bool{false}},
+			"error":   Schema{"type": "string"},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, op := range ops {
+		path := ginParam.ReplaceAllString(op.Path, "{$1}")
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerToken": Schema{"type": "http", "scheme": "bearer", "description": "个人 API 令牌"},
+			},
+		},
+		"security": []map[string][]string{{"bearerToken": {}}},
+	}
+}
+
+// operation 生成单个操作对象
+func (g *generator) operation(op Operation) map[string]any {
+	status := op.Status
+	if status == 0 {
+		status = 200
+	}
+
+	var params []any
+	for _, m := range ginParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": Schema{"type": "integer"},
+		})
+	}
+	for _, q := range op.Query {
+		typ := q.Type
+		if typ == "" {
+			typ = "string"
+		}
+		params = append(params, map[string]any{
+			"name": q.Name, "in": "query", "description": q.Description, "schema": Schema{"type": typ},
+		})
+	}
+
+	data := any(Schema{})
+	if op.Response != nil {
+		data = g.schema(op.Response)
+	}
+	errorResponse := map[string]any{
+		"description": "错误",
+		"content":     map[string]any{"application/json": map[string]any{"schema": Schema{"$ref": "#/components/schemas/Error"}}},
+	}
+	result := map[string]any{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+		"responses": map[string]any{
+			fmt.Sprint(status): map[string]any{
+				"description": "成功",
+				"content": map[string]any{"application/json": map[string]any{"schema": Schema{
+					"type":     "object",
+					"required": []string{"success", "data"},
+					"properties": map[string]any{
+						"success": Schema{"type": "boolean", "enum": []bool{true}},
+						"data":    data,
+					},
+				}}},
+			},
+			"default": errorResponse,
+		},
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+	if op.Request != nil {
+		result["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(op.Request)}},
+		}
+	}
+	if op.Public {
+		result["security"] = []any{}
+	}
+	return result
+}
+
+// operationID 由方法和路径生成操作ID，如 GET /api/v1/tasks/:id -> getTasksId
+func operationID(op Operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.FieldsFunc(strings.TrimPrefix(op.Path, "/api/v1"), func(r rune) bool {
+		return r == '/' || r == ':' || r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(upperFirst(part))
+	}
+	return b.String()
+}
+
+// schema 将示例值或 Schema 转换为 Schema。Schema 中 properties 的属性值以及
+// items、additionalProperties 也可以是示例值，其余键按字面输出。
+func (g *generator) schema(v any) any {
+	s, ok := v.(Schema)
+	if !ok {
+		return g.typeSchema(reflect.TypeOf(v))
+	}
+	out := Schema{}
+	for k, val := range s {
+		switch k {
+		case "properties":
+			props := map[string]any{}
+			for name, p := range val.(map[string]any) {
+				props[name] = g.schema(p)
+			}
+			out[k] = props
+		case "items", "additionalProperties":
+			out[k] = g.schema(val)
+		default:
+			out[k] = val
+		}
+	}
+	return out
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// typeSchema 反射 Go 类型生成 Schema，命名结构体放入 components 并返回引用
+func (g *generator) typeSchema(t reflect.Type) any {
+	if t == nil {
+		return Schema{}
+	}
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	s := g.baseSchema(t)
+	if nullable {
+		if _, isRef := s["$ref"]; isRef {
+			return Schema{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+	}
+	return s
+}
+
+func (g *generator) baseSchema(t reflect.Type) Schema {
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return Schema{"description": "任意 JSON"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Interface:
+		return Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := g.componentName(t)
+		return Schema{"$ref": "#/components/schemas/" + name}
+	}
+	return Schema{}
+}
+
+// componentName 返回命名结构体在 components 中的名称，首次遇到时生成其 Schema。
+// 未导出的 api 前缀请求类型去掉前缀，如 apiTaskRequest -> TaskRequest。
+func (g *generator) componentName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := upperFirst(strings.TrimPrefix(t.Name(), "api"))
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = upperFirst(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	g.names[t] = name
+	g.schemas[name] = Schema{} // 占位，支持递归类型
+	g.schemas[name] = g.structSchema(t)
+	return name
+}
+
+// structSchema 按 json 标签生成对象 Schema，匿名嵌入的结构体字段会展开
+func (g *generator) structSchema(t reflect.Type) Schema {
+	props := map[string]any{}
+	var required []string
+	g.collectFields(t, props, &required)
+	s := Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *generator) collectFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.collectFields(f.Type, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// CheckRoutes 比较已注册的 gin 路由与文档中的操作，返回两者不一致之处。
+// 只检查以 prefix 开头的路由。
+func CheckRoutes(routes gin.RoutesInfo, prefix string, ops []Operation) error {
+	registered := map[string]bool{}
+	for _, r := range routes {
+		if strings.HasPrefix(r.Path, prefix) {
+			registered[r.Method+" "+r.Path] = true
+		}
+	}
+	documented := map[string]bool{}
+	for _, op := range ops {
+		documented[strings.ToUpper(op.Method)+" "+op.Path] = true
+	}
+
+	var problems []string
+	for k := range registered {
+		if !documented[k] {
+			problems = append(problems, "路由未写入 API 文档: "+k)
+		}
+	}
+	for k := range documented {
+		if !registered[k] {
+			problems = append(problems, "API 文档中的路由未注册: "+k)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// apiTokenPrefix 令牌明文前缀，便于在日志和密钥扫描中识别
+const apiTokenPrefix = "dxw_"
+
+var (
+	// ErrInvalidAPIToken 令牌不存在、已过期或所属用户已禁用
+	ErrInvalidAPIToken = errors.New("无效或已过期的 API 令牌")
+	// ErrTokenPasswordChange 令牌所属用户的密码已被管理员重置，修改密码前令牌不可用
+	ErrTokenPasswordChange = errors.New("令牌所属账户需要先在页面登录并修改密码")
+	// ErrTokenTwoFactorEnroll 令牌所属用户的角色要求两步验证但尚未启用，启用前令牌不可用
+	ErrTokenTwoFactorEnroll = errors.New("令牌所属账户需要先在页面登录并启用两步验证")
+)
+
+// hashAPIToken 返回令牌明文的 SHA-256 十六进制哈希，数据库中只保存该哈希
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 为用户生成新的 API 令牌并返回明文，明文不会被保存，只能在创建时获取一次。
+// expiresAt 为 nil 表示不过期。
+func CreateAPIToken(db *sql.DB, userID int, name string, expiresAt *time.Time) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("令牌名称不能为空")
+	}
+	if len([]rune(name)) > 100 {
+		return "", errors.New("令牌名称不能超过100个字符")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成令牌失败: %v", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(buf)
+
+	_, err := db.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, userID, name, hashAPIToken(token), token[:len(apiTokenPrefix)+8], expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("保存令牌失败: %v", err)
+	}
+	return token, nil
+}
+
+// ListAPITokens 返回用户的全部令牌（不含明文和哈希）
+func ListAPITokens(db *sql.DB, userID int) ([]models.APIToken, error) {
+	rows, err := db.Query(`SELECT id, user_id, name, token_prefix, expires_at, last_used_at, created_at
+		FROM api_tokens WHERE user_id=? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var t models.APIToken
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &expiresAt, &lastUsedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken 删除用户自己的令牌，撤销后立即失效
+func RevokeAPIToken(db *sql.DB, userID, tokenID int) error {
+	result, err := db.Exec("DELETE FROM api_tokens WHERE id=? AND user_id=?", tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("撤销令牌失败: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("令牌不存在")
+	}
+	return nil
+}
+
+// RevokeUserAPITokens 撤销用户的全部 API 令牌，用于管理员重置密码
+func RevokeUserAPITokens(db execer, userID int) error {
+	_, err := db.Exec("DELETE FROM api_tokens WHERE user_id=?", userID)
+	return err
+}
+
+// AuthenticateToken 校验 API 令牌，返回令牌所属的用户。
+// 令牌过期或用户被禁用时返回 ErrInvalidAPIToken；与会话一样，用户必须修改密码或启用两步验证时
+// 分别返回 ErrTokenPasswordChange 和 ErrTokenTwoFactorEnroll。
+func (a *AuthService) AuthenticateToken(token string) (userID int, username, role string, err error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return 0, "", "", ErrInvalidAPIToken
+	}
+
+	var tokenID int
+	var disabled, mustChange, twoFactor bool
+	var expiresAt sql.NullTime
+	err = a.db.QueryRow(`SELECT t.id, u.id, u.username, u.role, u.disabled, u.must_change_password, u.totp_enabled, t.expires_at
+		FROM api_tokens t JOIN users u ON t.user_id = u.id
+		WHERE t.token_hash=?`, hashAPIToken(token)).
+		Scan(&tokenID, &userID, &username, &role, &disabled, &mustChange, &twoFactor, &expiresAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("auth: failed to look up api token: %v", err)
+		}
+		return 0, "", "", ErrInvalidAPIToken
+	}
+	if disabled || (expiresAt.Valid && time.Now().After(expiresAt.Time)) {
+		return 0, "", "", ErrInvalidAPIToken
+	}
+	if mustChange {
+		return 0, "", "", ErrTokenPasswordChange
+	}
+	if !twoFactor && a.TwoFactorRequired(role) {
+		return 0, "", "", ErrTokenTwoFactorEnroll
+	}
+
+	if _, err := a.db.Exec("UPDATE api_tokens SET last_used_at=NOW() WHERE id=?", tokenID); err != nil {
+		log.Printf("auth: failed to update api token %d last_used_at: %v", tokenID, err)
+	}
+	return userID, username, role, nil
+}
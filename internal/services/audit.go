@@ -0,0 +1,301 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// 审计操作
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditRun    = "run"
+	AuditKill   = "kill"
+	AuditToggle = "toggle"
+	AuditRevoke = "revoke"
+)
+
+// 审计对象类型，与导入结果中的 Kind 一致
+const (
+	AuditDataSource = "data_source"
+	AuditTask       = "task"
+	AuditFlow       = "flow"
+	AuditUser       = "user"
+)
+
+// auditTables 对象类型对应的数据表
+var auditTables = map[string]string{
+	AuditDataSource: "data_sources",
+	AuditTask:       "tasks",
+	AuditFlow:       "task_flows",
+	AuditUser:       "users",
+}
+
+// auditIgnored 快照中忽略的字段，这些字段每次修改都会变化或已单独记录
+var auditIgnored = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"created_by": true,
+	"updated_by": true,
+	// 每次两步验证登录都会变化
+	"totp_last_step": true,
+}
+
+// auditSecrets 敏感字段，审计记录中只体现是否变化，不保存值
+var auditSecrets = map[string]bool{
+	"password":    true,
+	"db_password": true,
+	"totp_secret": true,
+}
+
+const auditRedacted = "******"
+
+// AuditEntry 待写入的审计记录
+type AuditEntry struct {
+	ActorID    int
+	Actor      string
+	Action     string
+	ObjectType string
+	ObjectID   int
+	ObjectName string
+	Changes    map[string]models.AuditChange
+	Detail     string
+	IP         string
+	UserAgent  string
+}
+
+// AuditSnapshot 读取对象当前的全部字段，用于对比操作前后的变化；任务包含增量水位，任务流包含步骤列表。
+// 对象不存在或查询失败时返回 nil。
+func AuditSnapshot(db *sql.DB, objectType string, id int) map[string]any {
+	table, ok := auditTables[objectType]
+	if !ok || id <= 0 {
+		return nil
+	}
+	rows, err := db.Query("SELECT * FROM "+table+" WHERE id=?", id)
+	if err != nil {
+		log.Printf("audit: failed to snapshot %s %d: %v", objectType, id, err)
+		return nil
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		log.Printf("audit: failed to snapshot %s %d: %v", objectType, id, err)
+		return nil
+	}
+
+	snapshot := make(map[string]any, len(columns))
+	for i, col := range columns {
+		if auditIgnored[col] {
+			continue
+		}
+		if values[i].Valid {
+			snapshot[col] = values[i].String
+		} else {
+			snapshot[col] = nil
+		}
+	}
+	rows.Close()
+
+	switch objectType {
+	case AuditTask:
+		var watermark sql.NullString
+		if err := db.QueryRow("SELECT watermark FROM task_watermarks WHERE task_id=?", id).Scan(&watermark); err == nil {
+			snapshot["watermark"] = watermark.String
+		}
+	case AuditFlow:
+		snapshot["steps"] = auditFlowSteps(db, id)
+	}
+	return snapshot
+}
+
+// auditFlowSteps 以可读文本返回任务流的步骤，便于对比步骤的增删和重排
+func auditFlowSteps(db *sql.DB, flowID int) []string {
+	rows, err := db.Query(`SELECT s.step_order, s.step_type, COALESCE(t.name, s.name, ''), COALESCE(s.step_config, '')
+		FROM task_flow_steps s LEFT JOIN tasks t ON s.task_id = t.id
+		WHERE s.flow_id=? ORDER BY s.step_order`, flowID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	steps := []string{}
+	for rows.Next() {
+		var order int
+		var typ, name, config string
+		if rows.Scan(&order, &typ, &name, &config) != nil {
+			continue
+		}
+		step := fmt.Sprintf("%d. [%s] %s", order, typ, name)
+		if config != "" {
+			step += " " + config
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// AuditDiff 对比操作前后的快照，返回发生变化的字段。before 为 nil 表示新建，after 为 nil 表示删除。
+// 敏感字段的值以掩码代替。
+func AuditDiff(before, after map[string]any) map[string]models.AuditChange {
+	changes := map[string]models.AuditChange{}
+	for key, old := range before {
+		cur, ok := after[key]
+		if ok && auditEqual(old, cur) {
+			continue
+		}
+		change := models.AuditChange{Before: auditValue(key, old)}
+		if ok {
+			change.After = auditValue(key, cur)
+		}
+		changes[key] = change
+	}
+	for key, cur := range after {
+		if _, ok := before[key]; ok {
+			continue
+		}
+		changes[key] = models.AuditChange{After: auditValue(key, cur)}
+	}
+	return changes
+}
+
+// auditEqual 比较两个快照值，快照值只包含字符串、nil 和字符串列表
+func auditEqual(a, b any) bool {
+	if as, ok := a.([]string); ok {
+		bs, ok := b.([]string)
+		return ok && strings.Join(as, "\n") == strings.Join(bs, "\n")
+	}
+	return a == b
+}
+
+// auditValue 返回写入审计记录的字段值，敏感字段非空时以掩码代替，任务配置中的内联密码同样以掩码代替
+func auditValue(key string, v any) any {
+	if auditSecrets[key] && v != nil && v != "" {
+		return auditRedacted
+	}
+	if config, ok := v.(string); ok && key == "json_config" {
+		return RedactConfigPasswords(config)
+	}
+	return v
+}
+
+// RecordAudit 写入一条审计记录。审计表只追加，不提供修改和删除
+func RecordAudit(db *sql.DB, e AuditEntry) error {
+	var changes any
+	if len(e.Changes) > 0 {
+		data, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		changes = string(data)
+	}
+	_, err := db.Exec(`INSERT INTO audit_logs (actor_id, actor, action, object_type, object_id, object_name, changes, detail, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ActorID, e.Actor, e.Action, e.ObjectType, e.ObjectID, truncate(e.ObjectName, 255), changes,
+		truncate(e.Detail, 255), truncate(e.IP, 45), truncate(e.UserAgent, 255))
+	return err
+}
+
+// truncate 按字符截断字符串，避免超出列长度
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// AuditFilter 审计记录查询条件，空值表示不限制
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	ObjectType string
+	ObjectID   int
+	Keyword    string // 匹配对象名称或补充说明
+	DateFrom   string
+	DateTo     string
+	Page       int
+	PageSize   int
+}
+
+// ListAuditLogs 按条件分页查询审计记录，按时间倒序
+func ListAuditLogs(db *sql.DB, f AuditFilter) ([]models.AuditLog, int, error) {
+	where := "WHERE 1=1"
+	var args []any
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{
+		{"actor", f.Actor},
+		{"action", f.Action},
+		{"object_type", f.ObjectType},
+	} {
+		if cond.value != "" {
+			where += " AND " + cond.column + " = ?"
+			args = append(args, cond.value)
+		}
+	}
+	if f.ObjectID > 0 {
+		where += " AND object_id = ?"
+		args = append(args, f.ObjectID)
+	}
+	if f.Keyword != "" {
+		where += " AND (object_name LIKE ? OR detail LIKE ?)"
+		args = append(args, "%"+f.Keyword+"%", "%"+f.Keyword+"%")
+	}
+	if f.DateFrom != "" {
+		where += " AND created_at >= ?"
+		args = append(args, f.DateFrom)
+	}
+	if f.DateTo != "" {
+		where += " AND created_at < DATE_ADD(?, INTERVAL 1 DAY)"
+		args = append(args, f.DateTo)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_logs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`SELECT id, actor_id, actor, action, object_type, object_id, object_name,
+		       COALESCE(changes, ''), detail, ip, user_agent, created_at
+		FROM audit_logs `+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	logs := []models.AuditLog{}
+	for rows.Next() {
+		var l models.AuditLog
+		var changes string
+		if err := rows.Scan(&l.ID, &l.ActorID, &l.Actor, &l.Action, &l.ObjectType, &l.ObjectID, &l.ObjectName,
+			&changes, &l.Detail, &l.IP, &l.UserAgent, &l.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &l.Changes); err != nil {
+				log.Printf("audit: invalid changes in record %d: %v", l.ID, err)
+			}
+		}
+		logs = append(logs, l)
+	}
+	return logs, total, rows.Err()
+}
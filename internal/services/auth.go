@@ -7,70 +7,381 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"time"
 )
 
 // AuthService 封装用户认证、会话处理和授权逻辑。
-// 它使用 gorilla/sessions cookie 存储来在请求之间持久化
-// 已认证用户信息。数据库中的所有密码必须存储为 bcrypt 哈希。
-// 在成功认证期间，会话会使用已登录用户和角色进行更新。
+// 登录会话保存在数据库中，gorilla/sessions cookie 只保存会话令牌，
+// 因此会话可以随时撤销。数据库中的所有密码必须存储为 bcrypt 哈希。
 type AuthService struct {
-	db    *sql.DB
-	store *sessions.CookieStore
+	db             *sql.DB
+	store          *sessions.CookieStore
+	authenticators []Authenticator
+	oidc           *OIDCProvider
+	// 必须启用两步验证的角色
+	twoFactorRoles []string
+	// 登录失败锁定，为 nil 时不限制
+	throttle *LoginThrottle
 }
 
 // NewAuthService 使用给定的数据库句柄和 cookie 存储创建新的 AuthService。
 // 在将其传递给此构造函数之前，应该使用安全选项配置存储。
-func NewAuthService(db *sql.DB, store *sessions.CookieStore) *AuthService {
+// 登录时按顺序尝试 authenticators，未指定时只使用本地账户。
+func NewAuthService(db *sql.DB, store *sessions.CookieStore, authenticators ...Authenticator) *AuthService {
 	// 为内部使用配置会话选项
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 days for internal use
 		HttpOnly: true,
 	}
-	return &AuthService{db: db, store: store}
+	if len(authenticators) == 0 {
+		authenticators = []Authenticator{NewLocalAuthenticator(db)}
+	}
+	return &AuthService{db: db, store: store, authenticators: authenticators}
 }
 
 // Login 尝试认证给定的用户名和密码。如果成功，
-// 用户和角色将存储在 HTTP 会话中。它返回
-// 已认证的角色或失败时的错误。调用者负责
-// 通过 sess.Save() 持久化会话。
+// 为用户创建服务端会话并返回已认证的角色，失败时返回错误。
+// 用户已启用两步验证时返回 ErrTwoFactorRequired，此时会话尚未认证，
+// 需调用 CompleteTwoFactor 校验验证码后才完成登录。
+// 账户或来源 IP 因失败次数过多被锁定时返回 *LoginLockedError，不再校验密码。
 func (a *AuthService) Login(w http.ResponseWriter, r *http.Request, username, password string) (string, error) {
-	var hash, role string
-	var disabled bool
-	err := a.db.QueryRow("SELECT password, role, disabled FROM users WHERE username=?", username).Scan(&hash, &role, &disabled)
+	ip := clientIP(r)
+	if err := a.throttle.Check(username, ip); err != nil {
+		return "", err
+	}
+	identity, err := a.authenticate(username, password)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		a.throttle.Fail(username, ip)
+		return "", err
+	}
+	role, err := a.startSession(w, r, identity)
+	if err == nil {
+		a.throttle.Succeed(username)
 	}
+	return role, err
+}
 
-	// 检查账户是否被禁用
-	if disabled {
-		return "", errors.New("account is disabled")
+// SetLoginThrottle 启用登录失败锁定
+func (a *AuthService) SetLoginThrottle(t *LoginThrottle) {
+	a.throttle = t
+}
+
+// startSession 开通或同步账户后，为用户创建服务端会话。用户已启用两步验证时只记录待验证状态，
+// 返回 ErrTwoFactorRequired，输入验证码通过 CompleteTwoFactor 后才创建会话
+func (a *AuthService) startSession(w http.ResponseWriter, r *http.Request, identity *Identity) (string, error) {
+	userID, role, err := a.provision(identity)
+	if err != nil {
+		return "", err
+	}
+	var totpEnabled bool
+	if err := a.db.QueryRow("SELECT totp_enabled FROM users WHERE id=?", userID).Scan(&totpEnabled); err != nil {
+		log.Printf("auth: failed to load two-factor status of user %d: %v", userID, err)
+		return "", errors.New("session error")
 	}
+	if totpEnabled {
+		if err := a.beginTwoFactor(w, r, userID, identity.Username); err != nil {
+			return "", err
+		}
+		return role, ErrTwoFactorRequired
+	}
+	if err := a.issueSession(w, r, userID); err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// twoFactorTTL 密码校验通过后输入两步验证码的期限
+const twoFactorTTL = 5 * time.Minute
+
+// twoFactorMaxAttempts 每次登录允许输错两步验证码的次数，超过后需重新输入密码
+const twoFactorMaxAttempts = 5
+
+// SetTwoFactorRoles 设置必须启用两步验证的角色
+func (a *AuthService) SetTwoFactorRoles(roles []string) {
+	a.twoFactorRoles = roles
+}
 
-	// 比较 bcrypt 哈希密码
-	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
-		return "", errors.New("invalid credentials")
+// TwoFactorRequired 判断角色是否必须启用两步验证
+func (a *AuthService) TwoFactorRequired(role string) bool {
+	for _, r := range a.twoFactorRoles {
+		if r == role {
+			return true
+		}
 	}
+	return false
+}
 
-	// 创建会话
+// beginTwoFactor 在 cookie 中记录密码校验已通过、等待两步验证的用户，此时尚未创建会话。
+// 浏览器中原有的会话随之删除
+func (a *AuthService) beginTwoFactor(w http.ResponseWriter, r *http.Request, userID int, username string) error {
 	sess, err := a.store.Get(r, "sess")
 	if err != nil {
 		log.Printf("Error getting session: %v", err)
-		return "", errors.New("session error")
+		return errors.New("session error")
+	}
+	if old, ok := sess.Values["sid"].(string); ok {
+		if err := deleteSession(a.db, old); err != nil {
+			log.Printf("auth: failed to delete previous session: %v", err)
+		}
+		delete(sess.Values, "sid")
+	}
+	sess.Values["mfa_user"] = userID
+	sess.Values["mfa_login"] = username
+	sess.Values["mfa_started"] = time.Now().Unix()
+	sess.Values["mfa_attempts"] = 0
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return errors.New("session error")
+	}
+	return nil
+}
+
+// pendingTwoFactor 返回等待两步验证的用户 ID，没有或已超时时返回 0
+func pendingTwoFactor(sess *sessions.Session) int {
+	userID, _ := sess.Values["mfa_user"].(int)
+	started, _ := sess.Values["mfa_started"].(int64)
+	if userID == 0 || time.Since(time.Unix(started, 0)) > twoFactorTTL {
+		return 0
+	}
+	return userID
+}
+
+// TwoFactorPending 判断当前浏览器是否有等待输入两步验证码的登录
+func (a *AuthService) TwoFactorPending(r *http.Request) bool {
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		return false
+	}
+	return pendingTwoFactor(sess) != 0
+}
+
+// CompleteTwoFactor 校验待验证登录的动态验证码或恢复码，通过后创建会话。
+// 超时或输错次数过多时清除待验证状态，需要重新输入密码。输错验证码同样计入账户的登录失败次数
+func (a *AuthService) CompleteTwoFactor(w http.ResponseWriter, r *http.Request, code string) error {
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return errors.New("session error")
+	}
+	userID := pendingTwoFactor(sess)
+	if userID == 0 {
+		return ErrInvalidCredentials
+	}
+	username, _ := sess.Values["mfa_login"].(string)
+	ip := clientIP(r)
+	if err := a.throttle.Check(username, ip); err != nil {
+		clearTwoFactor(sess)
+		if saveErr := sess.Save(r, w); saveErr != nil {
+			log.Printf("Error saving session: %v", saveErr)
+		}
+		return err
+	}
+
+	if err := VerifyTwoFactor(a.db, userID, code); err != nil {
+		if err != ErrInvalidTwoFactorCode {
+			log.Printf("auth: two-factor verification for user %d failed: %v", userID, err)
+		}
+		a.throttle.Fail(username, ip)
+		attempts, _ := sess.Values["mfa_attempts"].(int)
+		sess.Values["mfa_attempts"] = attempts + 1
+		if attempts+1 >= twoFactorMaxAttempts {
+			clearTwoFactor(sess)
+			err = ErrInvalidCredentials
+		} else {
+			err = ErrInvalidTwoFactorCode
+		}
+		if saveErr := sess.Save(r, w); saveErr != nil {
+			log.Printf("Error saving session: %v", saveErr)
+		}
+		return err
+	}
+
+	clearTwoFactor(sess)
+	a.throttle.Succeed(username)
+	return a.issueSession(w, r, userID)
+}
+
+// clearTwoFactor 清除待验证登录状态
+func clearTwoFactor(sess *sessions.Session) {
+	for _, key := range []string{"mfa_user", "mfa_login", "mfa_started", "mfa_attempts"} {
+		delete(sess.Values, key)
 	}
+}
 
-	sess.Values["user"] = username
-	sess.Values["role"] = role
+// issueSession 创建服务端会话并把令牌写入 cookie。每次登录都使用新令牌，
+// 浏览器中原有的会话随之删除，避免会话固定攻击
+func (a *AuthService) issueSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return errors.New("session error")
+	}
+	if old, ok := sess.Values["sid"].(string); ok {
+		if err := deleteSession(a.db, old); err != nil {
+			log.Printf("auth: failed to delete previous session: %v", err)
+		}
+	}
 
+	token, err := createSession(a.db, userID, clientIP(r), r.UserAgent())
+	if err != nil {
+		log.Printf("auth: failed to create session for user %d: %v", userID, err)
+		return errors.New("session error")
+	}
+	sess.Values["sid"] = token
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return errors.New("session error")
+	}
+	return nil
+}
+
+// SetOIDC 启用 OpenID Connect 单点登录
+func (a *AuthService) SetOIDC(p *OIDCProvider) {
+	a.oidc = p
+}
+
+// OIDCEnabled 判断是否启用了单点登录
+func (a *AuthService) OIDCEnabled() bool {
+	return a.oidc != nil
+}
+
+// oidcRequestTTL 跳转到身份提供方后完成登录的期限
+const oidcRequestTTL = 10 * time.Minute
+
+// BeginOIDC 生成跳转到身份提供方的授权地址，并把 state、nonce 和 PKCE 校验码保存在会话中
+func (a *AuthService) BeginOIDC(w http.ResponseWriter, r *http.Request) (string, error) {
+	if a.oidc == nil {
+		return "", errors.New("未启用单点登录")
+	}
+	url, req, err := a.oidc.AuthCodeURL(r.Context())
+	if err != nil {
+		return "", err
+	}
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return "", errors.New("session error")
+	}
+	sess.Values["oidc_state"] = req.State
+	sess.Values["oidc_nonce"] = req.Nonce
+	sess.Values["oidc_verifier"] = req.Verifier
+	sess.Values["oidc_started"] = time.Now().Unix()
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return "", errors.New("session error")
+	}
+	return url, nil
+}
+
+// FinishOIDC 处理身份提供方的回调：取出并清除会话中的登录参数，校验 ID 令牌后开通或同步账户并登录
+func (a *AuthService) FinishOIDC(w http.ResponseWriter, r *http.Request, state, code string) (string, error) {
+	if a.oidc == nil {
+		return "", errors.New("未启用单点登录")
+	}
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return "", errors.New("session error")
+	}
+	var req *OIDCRequest
+	started, _ := sess.Values["oidc_started"].(int64)
+	if time.Since(time.Unix(started, 0)) < oidcRequestTTL {
+		s, _ := sess.Values["oidc_state"].(string)
+		n, _ := sess.Values["oidc_nonce"].(string)
+		v, _ := sess.Values["oidc_verifier"].(string)
+		if s != "" {
+			req = &OIDCRequest{State: s, Nonce: n, Verifier: v}
+		}
+	}
+	// 登录参数只能使用一次
+	for _, key := range []string{"oidc_state", "oidc_nonce", "oidc_verifier", "oidc_started"} {
+		delete(sess.Values, key)
+	}
 	if err := sess.Save(r, w); err != nil {
 		log.Printf("Error saving session: %v", err)
 		return "", errors.New("session error")
 	}
 
-	return role, nil
+	identity, err := a.oidc.Exchange(r.Context(), req, state, code)
+	if err != nil {
+		log.Printf("auth: oidc login failed: %v", err)
+		return "", err
+	}
+	return a.startSession(w, r, identity)
+}
+
+// authenticate 按认证链顺序认证用户，认证器不负责该用户时交给下一个
+func (a *AuthService) authenticate(username, password string) (*Identity, error) {
+	for _, authenticator := range a.authenticators {
+		identity, err := authenticator.Authenticate(username, password)
+		if err == ErrUnknownUser {
+			continue
+		}
+		if err != nil && err != ErrInvalidCredentials {
+			log.Printf("auth: %s authentication for %s failed: %v", authenticator.Name(), username, err)
+			return nil, ErrInvalidCredentials
+		}
+		return identity, err
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// provision 检查认证成功的用户能否登录并返回其 ID 和角色。外部目录用户首次登录时自动开通账户，
+// 之后每次登录按目录中的组同步角色；本地账户使用数据库中的角色。
+func (a *AuthService) provision(identity *Identity) (id int, role string, err error) {
+	// 外部目录的用户名不受本系统约束，开通前按本地账户的规则校验
+	if identity.Source != AuthSourceLocal {
+		if err := ValidateUsername(identity.Username); err != nil {
+			log.Printf("auth: rejected %s user %q: %v", identity.Source, identity.Username, err)
+			return 0, "", ErrInvalidCredentials
+		}
+	}
+	var source string
+	var disabled bool
+	err = a.db.QueryRow("SELECT id, role, disabled, auth_source FROM users WHERE username=?", identity.Username).
+		Scan(&id, &role, &disabled, &source)
+	if err == sql.ErrNoRows && identity.Source != AuthSourceLocal {
+		// 外部用户没有本地密码，写入无法通过 bcrypt 校验的占位值
+		result, err := a.db.Exec("INSERT INTO users(username, password, role, disabled, auth_source) VALUES (?, '!', ?, 0, ?)",
+			identity.Username, identity.Role, identity.Source)
+		if err != nil {
+			log.Printf("auth: failed to provision %s user %s: %v", identity.Source, identity.Username, err)
+			return 0, "", errors.New("provision failed")
+		}
+		id64, _ := result.LastInsertId()
+		log.Printf("auth: provisioned %s user %s as %s", identity.Source, identity.Username, identity.Role)
+		return int(id64), identity.Role, nil
+	} else if err != nil {
+		return 0, "", ErrInvalidCredentials
+	}
+
+	// 同名的本地账户不能通过外部目录登录
+	if source != identity.Source {
+		log.Printf("auth: %s user %s conflicts with existing %s account", identity.Source, identity.Username, source)
+		return 0, "", ErrInvalidCredentials
+	}
+	// 检查账户是否被禁用
+	if disabled {
+		return 0, "", errors.New("account is disabled")
+	}
+	if identity.Role != "" && identity.Role != role {
+		err := syncUserRole(a.db, id, identity.Role)
+		switch {
+		case err == ErrLastAdmin:
+			// 目录中的组变化不能让系统失去最后一个管理员，保留原角色
+			log.Printf("auth: kept admin role of %s: it is the last active admin", identity.Username)
+		case err != nil:
+			log.Printf("auth: failed to update role of %s: %v", identity.Username, err)
+			return 0, "", errors.New("provision failed")
+		default:
+			role = identity.Role
+		}
+	}
+	return id, role, nil
 }
 
-// Logout 清除当前会话，有效登出用户。
+// Logout 删除服务端会话并清除 cookie，有效登出用户。
 func (a *AuthService) Logout(w http.ResponseWriter, r *http.Request) {
 	sess, err := a.store.Get(r, "sess")
 	if err != nil {
@@ -78,9 +389,12 @@ func (a *AuthService) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Clear session values
-	delete(sess.Values, "user")
-	delete(sess.Values, "role")
+	if token, ok := sess.Values["sid"].(string); ok {
+		if err := deleteSession(a.db, token); err != nil {
+			log.Printf("auth: failed to delete session during logout: %v", err)
+		}
+	}
+	delete(sess.Values, "sid")
 
 	// Invalidate session
 	sess.Options.MaxAge = -1
@@ -92,23 +406,51 @@ func (a *AuthService) Logout(w http.ResponseWriter, r *http.Request) {
 // CurrentUser 从会话中检索用户名和角色。如果没有用户
 // 登录，两个返回值都将是空字符串。
 func (a *AuthService) CurrentUser(r *http.Request) (username, role string) {
+	u := a.Session(r)
+	if u == nil {
+		return "", ""
+	}
+	return u.Username, u.Role
+}
+
+// SessionUser 当前会话中的用户
+type SessionUser struct {
+	SessionID           int
+	UserID              int
+	Username            string
+	Role                string
+	MustChangePassword  bool // 管理员重置密码后，必须先修改密码才能继续使用
+	TwoFactorEnabled    bool
+	MustEnrollTwoFactor bool // 角色要求两步验证但尚未启用，必须先完成绑定才能继续使用
+}
+
+// Session 返回当前会话中的用户，未登录或会话已失效时返回 nil。
+// 每次请求都从数据库读取会话和账户，会话被撤销或账户被禁用、删除后立即失效，角色修改也立即生效。
+func (a *AuthService) Session(r *http.Request) *SessionUser {
 	sess, err := a.store.Get(r, "sess")
 	if err != nil {
 		log.Printf("Error getting session: %v", err)
-		return "", ""
+		return nil
 	}
 
-	u, ok := sess.Values["user"].(string)
+	token, ok := sess.Values["sid"].(string)
 	if !ok {
-		return "", ""
+		return nil
 	}
-
-	roleVal, ok := sess.Values["role"].(string)
-	if !ok {
-		return "", ""
+	u, err := lookupSession(a.db, token)
+	if err != nil {
+		if err != ErrSessionNotFound {
+			log.Printf("auth: failed to look up session: %v", err)
+		}
+		return nil
 	}
+	u.MustEnrollTwoFactor = !u.TwoFactorEnabled && a.TwoFactorRequired(u.Role)
+	return u
+}
 
-	return u, roleVal
+// RenewSession 修改密码并撤销用户的全部会话后，为当前浏览器创建新会话，使当前会话保持登录而其他会话失效
+func (a *AuthService) RenewSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	return a.issueSession(w, r, userID)
 }
 
 // HashPassword 生成给定纯文本密码的 bcrypt 哈希。使用的
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"com.duole/datax-web-go/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户来源，对应 users.auth_source
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	AuthSourceOIDC  = "oidc"
+)
+
+var (
+	// ErrUnknownUser 表示认证器不负责该用户，由认证链中的下一个认证器继续尝试
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials 表示用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity 认证成功的用户身份
+type Identity struct {
+	Username string
+	Role     string // 外部目录映射出的角色，本地账户为空表示使用数据库中的角色
+	Source   string
+}
+
+// Authenticator 校验用户名和密码。不负责该用户时返回 ErrUnknownUser，
+// 密码错误时返回 ErrInvalidCredentials 并终止认证链。
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*Identity, error)
+}
+
+// NewAuthenticators 按配置的 auth.chain 顺序创建认证链
+func NewAuthenticators(db *sql.DB, cfg *util.Config) ([]Authenticator, error) {
+	var chain []Authenticator
+	for _, name := range cfg.AuthChain {
+		switch name {
+		case AuthSourceLocal:
+			chain = append(chain, NewLocalAuthenticator(db))
+		case AuthSourceLDAP:
+			a, err := NewLDAPAuthenticator(cfg.LDAP)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, a)
+		default:
+			return nil, fmt.Errorf("未知的认证方式: %s", name)
+		}
+	}
+	return chain, nil
+}
+
+// LocalAuthenticator 使用 users 表中的 bcrypt 哈希认证本地账户
+type LocalAuthenticator struct {
+	db *sql.DB
+}
+
+// NewLocalAuthenticator 创建本地账户认证器
+func NewLocalAuthenticator(db *sql.DB) *LocalAuthenticator {
+	return &LocalAuthenticator{db: db}
+}
+
+// Name 返回认证方式名称
+func (a *LocalAuthenticator) Name() string { return AuthSourceLocal }
+
+// Authenticate 校验本地账户密码。外部目录开通的账户不由本认证器处理
+func (a *LocalAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	var hash, source string
+	err := a.db.QueryRow("SELECT password, auth_source FROM users WHERE username=?", username).Scan(&hash, &source)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownUser
+	} else if err != nil {
+		return nil, err
+	}
+	if source != AuthSourceLocal {
+		return nil, ErrUnknownUser
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Username: username, Source: AuthSourceLocal}, nil
+}
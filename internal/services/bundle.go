@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"com.duole/datax-web-go/internal/services/datax"
+	"com.duole/datax-web-go/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// BundleVersion 当前导出包的格式版本，格式不兼容变更时递增
+const BundleVersion = 1
+
+// 导出包中密钥字段的处理方式
+const (
+	BundleSecretsRedacted  = "redacted"  // 密钥字段置空，导入后需手动补充
+	BundleSecretsEncrypted = "encrypted" // 密钥字段使用口令加密
+)
+
+// Bundle 表示可在不同环境间迁移的任务流导出包。
+// 包内对象之间通过名称引用，导入时按名称映射到目标环境的对象。
+type Bundle struct {
+	Version     int                `json:"version" yaml:"version"`
+	ExportedAt  time.Time          `json:"exported_at" yaml:"exported_at"`
+	Secrets     string             `json:"secrets" yaml:"secrets"`
+	Salt        string             `json:"salt,omitempty" yaml:"salt,omitempty"` // 加密密钥时使用的盐（base64）
+	DataSources []BundleDataSource `json:"data_sources" yaml:"data_sources"`
+	Tasks       []BundleTask       `json:"tasks" yaml:"tasks"`
+	Flows       []BundleFlow       `json:"flows" yaml:"flows"`
+}
+
+// BundleDataSource 导出包中的数据源，db_password 和 hadoopconfig 视为密钥；外部密码来源只是引用，原样导出
+type BundleDataSource struct {
+	Name          string `json:"name" yaml:"name"`
+	Type          string `json:"type" yaml:"type"`
+	DBURL         string `json:"db_url,omitempty" yaml:"db_url,omitempty"`
+	DBUser        string `json:"db_user,omitempty" yaml:"db_user,omitempty"`
+	DBPassword    string `json:"db_password,omitempty" yaml:"db_password,omitempty"`
+	DBPasswordRef string `json:"db_password_ref,omitempty" yaml:"db_password_ref,omitempty"`
+	DBDatabase    string `json:"db_database,omitempty" yaml:"db_database,omitempty"`
+	DefaultFS     string `json:"defaultfs,omitempty" yaml:"defaultfs,omitempty"`
+	HadoopConfig  string `json:"hadoopconfig,omitempty" yaml:"hadoopconfig,omitempty"`
+}
+
+// BundleTask 导出包中的任务。json_config 中的连接信息在导出时移除，导入时按数据源重新填充。
+type BundleTask struct {
+	Name               string `json:"name" yaml:"name"`
+	Source             string `json:"source" yaml:"source"`
+	Target             string `json:"target" yaml:"target"`
+	IncrColumn         string `json:"incr_column,omitempty" yaml:"incr_column,omitempty"`
+	ReconcileEnabled   bool   `json:"reconcile_enabled,omitempty" yaml:"reconcile_enabled,omitempty"`
+	ReconcileTolerance int    `json:"reconcile_tolerance,omitempty" yaml:"reconcile_tolerance,omitempty"`
+	JsonConfig         string `json:"json_config" yaml:"json_config"`
+}
+
+// BundleFlow 导出包中的任务流及其步骤
+type BundleFlow struct {
+	Name        string       `json:"name" yaml:"name"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	CronExpr    string       `json:"cron_expr" yaml:"cron_expr"`
+	Enabled     bool         `json:"enabled" yaml:"enabled"`
+	Steps       []BundleStep `json:"steps" yaml:"steps"`
+}
+
+// BundleStep 导出包中的任务流步骤。datax 步骤通过 task 引用任务，
+// check/sql 步骤通过 data_source 引用数据源，其余配置保存在 config 中。
+type BundleStep struct {
+	Type           string         `json:"type" yaml:"type"`
+	Task           string         `json:"task,omitempty" yaml:"task,omitempty"`
+	Name           string         `json:"name,omitempty" yaml:"name,omitempty"`
+	DataSource     string         `json:"data_source,omitempty" yaml:"data_source,omitempty"`
+	TimeoutMinutes *int           `json:"timeout_minutes,omitempty" yaml:"timeout_minutes,omitempty"`
+	Config         map[string]any `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// ExportBundle 导出指定任务流及其引用的任务和数据源。
+// passphrase 为空时密钥字段置空，否则使用口令加密。secretProjects 为可以导出密钥的项目，
+// 其他项目中的数据源按未导出密码处理；nil 表示不限制
+func ExportBundle(db *sql.DB, flowIDs []int, passphrase string, secretProjects map[int]bool) (*Bundle, error) {
+	if len(flowIDs) == 0 {
+		return nil, errors.New("请选择要导出的任务流")
+	}
+
+	b := &Bundle{Version: BundleVersion, ExportedAt: time.Now(), Secrets: BundleSecretsRedacted}
+	var box *util.SecretBox
+	if passphrase != "" {
+		var err error
+		if box, err = util.NewSecretBox(passphrase, nil); err != nil {
+			return nil, err
+		}
+		b.Secrets = BundleSecretsEncrypted
+		b.Salt = base64.StdEncoding.EncodeToString(box.Salt())
+	}
+
+	ex := &bundleExporter{db: db, bundle: b, box: box, secretProjects: secretProjects, dsNames: map[int]string{}, taskNames: map[int]string{}}
+	flowNames := map[string]bool{}
+	for _, id := range flowIDs {
+		flow, err := ex.flow(id)
+		if err != nil {
+			return nil, err
+		}
+		if flowNames[flow.Name] {
+			return nil, fmt.Errorf("存在多个名为 %s 的任务流，导入时无法区分，请先重命名", flow.Name)
+		}
+		flowNames[flow.Name] = true
+		b.Flows = append(b.Flows, *flow)
+	}
+	return b, nil
+}
+
+// bundleExporter 在导出过程中记录已导出的数据源和任务，避免重复导出
+type bundleExporter struct {
+	db             *sql.DB
+	bundle         *Bundle
+	box            *util.SecretBox
+	secretProjects map[int]bool   // 可以导出密钥的项目，nil 表示不限制
+	dsNames        map[int]string // 数据源ID -> 名称
+	taskNames      map[int]string // 任务ID -> 名称
+}
+
+func (ex *bundleExporter) flow(id int) (*BundleFlow, error) {
+	var f BundleFlow
+	err := ex.db.QueryRow("SELECT name, COALESCE(description,''), cron_expr, enabled FROM task_flows WHERE id=?", id).
+		Scan(&f.Name, &f.Description, &f.CronExpr, &f.Enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("任务流 %d 不存在", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询任务流失败: %v", err)
+	}
+
+	rows, err := ex.db.Query(`
+		SELECT step_type, COALESCE(task_id,0), COALESCE(name,''), COALESCE(step_config,''), timeout_minutes
+		FROM task_flow_steps WHERE flow_id=? ORDER BY step_order`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务流步骤失败: %v", err)
+	}
+	type stepRow struct {
+		stepType, name, config string
+		taskID                 int
+		timeout                sql.NullInt64
+	}
+	var steps []stepRow
+	for rows.Next() {
+		var r stepRow
+		if err := rows.Scan(&r.stepType, &r.taskID, &r.name, &r.config, &r.timeout); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		steps = append(steps, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	f.Steps = []BundleStep{}
+	for _, r := range steps {
+		step := BundleStep{Type: r.stepType, Name: r.name}
+		if r.timeout.Valid {
+			t := int(r.timeout.Int64)
+			step.TimeoutMinutes = &t
+		}
+		if r.stepType == StepTypeDataX {
+			if step.Task, err = ex.task(r.taskID); err != nil {
+				return nil, err
+			}
+		} else if r.config != "" {
+			if err := json.Unmarshal([]byte(r.config), &step.Config); err != nil {
+				return nil, fmt.Errorf("任务流 %s 的步骤 %s 配置格式不正确: %v", f.Name, r.name, err)
+			}
+			// 数据源ID在不同环境不同，改为按名称引用
+			if dsID, ok := step.Config["data_source_id"].(float64); ok {
+				if step.DataSource, err = ex.dataSource(int(dsID)); err != nil {
+					return nil, err
+				}
+				delete(step.Config, "data_source_id")
+			}
+		}
+		f.Steps = append(f.Steps, step)
+	}
+	return &f, nil
+}
+
+// task 导出任务并返回其名称
+func (ex *bundleExporter) task(id int) (string, error) {
+	if name, ok := ex.taskNames[id]; ok {
+		return name, nil
+	}
+
+	var t BundleTask
+	var sourceID, targetID int
+	err := ex.db.QueryRow(`SELECT name, source_id, target_id, COALESCE(json_config,''), COALESCE(incr_column,''), reconcile_enabled, reconcile_tolerance
+		FROM tasks WHERE id=?`, id).
+		Scan(&t.Name, &sourceID, &targetID, &t.JsonConfig, &t.IncrColumn, &t.ReconcileEnabled, &t.ReconcileTolerance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("任务 %d 不存在", id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("查询任务失败: %v", err)
+	}
+	for _, name := range ex.taskNames {
+		if name == t.Name {
+			return "", fmt.Errorf("存在多个名为 %s 的任务，导入时无法区分，请先重命名", t.Name)
+		}
+	}
+
+	if t.Source, err = ex.dataSource(sourceID); err != nil {
+		return "", err
+	}
+	if t.Target, err = ex.dataSource(targetID); err != nil {
+		return "", err
+	}
+	if t.JsonConfig, err = stripTaskConnections(t.JsonConfig); err != nil {
+		return "", fmt.Errorf("任务 %s: %v", t.Name, err)
+	}
+
+	ex.taskNames[id] = t.Name
+	ex.bundle.Tasks = append(ex.bundle.Tasks, t)
+	return t.Name, nil
+}
+
+// dataSource 导出数据源并返回其名称，密钥字段按导出方式置空或加密
+func (ex *bundleExporter) dataSource(id int) (string, error) {
+	if name, ok := ex.dsNames[id]; ok {
+		return name, nil
+	}
+
+	var d BundleDataSource
+	var projectID int
+	err := ex.db.QueryRow(`SELECT name, project_id, type, COALESCE(db_url,''), COALESCE(db_user,''), COALESCE(db_password,''),
+		COALESCE(db_password_ref,''), COALESCE(db_database,''), COALESCE(defaultfs,''), COALESCE(hadoopconfig,'')
+		FROM data_sources WHERE id=?`, id).
+		Scan(&d.Name, &projectID, &d.Type, &d.DBURL, &d.DBUser, &d.DBPassword, &d.DBPasswordRef, &d.DBDatabase, &d.DefaultFS, &d.HadoopConfig)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("数据源 %d 不存在", id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("查询数据源失败: %v", err)
+	}
+	for _, name := range ex.dsNames {
+		if name == d.Name {
+			return "", fmt.Errorf("存在多个名为 %s 的数据源，导入时无法区分，请先重命名", d.Name)
+		}
+	}
+
+	// 不能导出密钥的项目中的数据源不解密，与未提供口令时一样置空
+	if ex.box == nil || (ex.secretProjects != nil && !ex.secretProjects[projectID]) {
+		d.DBPassword, d.HadoopConfig = "", ""
+	} else {
+		if d.DBPassword, err = datax.DecryptPassword(d.DBPassword); err != nil {
+			return "", fmt.Errorf("解密数据源 %s 的密码失败: %v", d.Name, err)
+		}
+		if d.DBPassword, err = ex.box.Seal(d.DBPassword); err != nil {
+			return "", err
+		}
+		if d.HadoopConfig, err = ex.box.Seal(d.HadoopConfig); err != nil {
+			return "", err
+		}
+	}
+
+	ex.dsNames[id] = d.Name
+	ex.bundle.DataSources = append(ex.bundle.DataSources, d)
+	return d.Name, nil
+}
+
+// MarshalBundle 将导出包序列化为 yaml 或 json
+func MarshalBundle(b *Bundle, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(b, "", "  ")
+	case "yaml", "":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(b); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// ParseBundle 解析 yaml 或 json 格式的导出包并校验格式版本
+func ParseBundle(data []byte) (*Bundle, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("导入内容为空")
+	}
+
+	var b Bundle
+	// JSON 是 YAML 的子集，但按 JSON 解析能给出更准确的错误位置
+	if data[0] == '{' {
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, fmt.Errorf("解析导入包失败: %v", err)
+		}
+	} else if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("解析导入包失败: %v", err)
+	}
+
+	if b.Version == 0 {
+		return nil, errors.New("导入包缺少版本号")
+	}
+	if b.Version > BundleVersion {
+		return nil, fmt.Errorf("导入包版本 %d 高于当前支持的版本 %d，请升级后再导入", b.Version, BundleVersion)
+	}
+	if b.Secrets != BundleSecretsRedacted && b.Secrets != BundleSecretsEncrypted {
+		return nil, fmt.Errorf("未知的密钥处理方式: %s", b.Secrets)
+	}
+	return &b, nil
+}
+
+// stripTaskConnections 移除 DataX 配置中与环境相关的连接信息和密钥，
+// 导入时由 bindTaskConnections 按目标环境的数据源重新填充
+func stripTaskConnections(config string) (string, error) {
+	if config == "" {
+		return config, nil
+	}
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range []string{"reader", "writer"} {
+		p, ok := jobContentPart(job, part)
+		if !ok {
+			continue
+		}
+		param, ok := p["parameter"].(map[string]any)
+		if !ok {
+			continue
+		}
+		delete(param, "username")
+		delete(param, "password")
+		delete(param, "hadoopConfig")
+		delete(param, "defaultFS")
+		if conns, ok := param["connection"].([]any); ok {
+			for _, c := range conns {
+				if conn, ok := c.(map[string]any); ok {
+					delete(conn, "jdbcUrl")
+				}
+			}
+		}
+	}
+	out, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
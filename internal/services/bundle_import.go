@@ -0,0 +1,974 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services/datax"
+	"com.duole/datax-web-go/internal/util"
+)
+
+// 导入计划中每个对象的处理方式
+const (
+	ImportCreate    = "create"    // 目标环境不存在，将新建
+	ImportUpdate    = "update"    // 目标环境存在且内容不同，将覆盖
+	ImportUnchanged = "unchanged" // 目标环境存在且内容相同
+	ImportReuse     = "reuse"     // 数据源按名称映射到目标环境已有的数据源
+	ImportConflict  = "conflict"  // 无法导入，需要先处理
+	ImportDelete    = "delete"    // 同一来源管理但已不在导入内容中，将删除
+)
+
+// 导入计划中的对象类型
+const (
+	ImportKindDataSource = "data_source"
+	ImportKindTask       = "task"
+	ImportKindFlow       = "flow"
+)
+
+// ImportOptions 控制导入行为
+type ImportOptions struct {
+	Passphrase string // 导入包密钥已加密时用于解密
+	Overwrite  bool   // 覆盖目标环境中内容不同的同名任务和任务流
+	DryRun     bool   // 只生成导入计划，不写入数据库
+	ManagedBy  string // 导入对象的管理来源，非空时写入 managed_by，界面不可修改
+	Prune      bool   // 删除由 ManagedBy 管理但不在导入内容中的任务和任务流
+	// 导入对象所属项目。非 0 时新建对象归属该项目，已有的同名任务和任务流必须属于该项目；
+	// 为 0 时不限制已有对象，新建对象归属默认项目
+	ProjectID int
+	// 可复用的已有数据源所在的项目，nil 表示不限制
+	DataSourceProjects map[int]bool
+	// 是否允许导入 Shell 步骤。Shell 步骤以服务进程的身份执行任意命令，只有管理员可以导入
+	AllowShell bool
+}
+
+// ImportItem 导入计划中的一项
+type ImportItem struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportResult 导入计划及执行结果
+type ImportResult struct {
+	Items   []ImportItem `json:"items"`
+	Applied bool         `json:"applied"`
+	FlowIDs []int        `json:"flow_ids,omitempty"` // 新建或更新的任务流，需重新加载调度
+	// 已删除的任务流，需从调度中移除
+	RemovedFlowIDs []int `json:"removed_flow_ids,omitempty"`
+}
+
+// Count 统计指定处理方式的对象数
+func (r *ImportResult) Count(action string) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// ImportBundle 按名称将导入包映射到目标环境并生成导入计划。
+// 存在冲突或 DryRun 时不写入任何数据，否则在一个事务中完成全部创建和更新。
+func ImportBundle(db *sql.DB, b *Bundle, opts ImportOptions, userID int) (*ImportResult, error) {
+	if err := decryptBundle(b, opts.Passphrase); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	im := &bundleImporter{
+		tx:          tx,
+		opts:        opts,
+		userID:      userID,
+		result:      &ImportResult{},
+		dataSources: map[string]*importDataSource{},
+		tasks:       map[string]*importTask{},
+	}
+	if err := im.plan(b); err != nil {
+		return nil, err
+	}
+	if opts.DryRun || im.result.Count(ImportConflict) > 0 {
+		return im.result, nil
+	}
+
+	if err := im.apply(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	im.result.Applied = true
+	return im.result, nil
+}
+
+// decryptBundle 使用口令解密导入包中的数据源密钥
+func decryptBundle(b *Bundle, passphrase string) error {
+	if b.Secrets != BundleSecretsEncrypted {
+		return nil
+	}
+	if passphrase == "" {
+		return errors.New("导入包中的密钥已加密，请提供导出时使用的口令")
+	}
+	salt, err := base64.StdEncoding.DecodeString(b.Salt)
+	if err != nil || len(salt) == 0 {
+		return errors.New("导入包缺少有效的加密盐")
+	}
+	box, err := util.NewSecretBox(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	for i := range b.DataSources {
+		d := &b.DataSources[i]
+		if d.DBPassword, err = box.Open(d.DBPassword); err != nil {
+			return fmt.Errorf("解密数据源 %s 失败: %v", d.Name, err)
+		}
+		if d.HadoopConfig, err = box.Open(d.HadoopConfig); err != nil {
+			return fmt.Errorf("解密数据源 %s 失败: %v", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// importDataSource 导入包中的数据源与目标环境的映射
+type importDataSource struct {
+	id     int              // 目标环境中的数据源ID，新建时在应用阶段回填
+	conn   BundleDataSource // 用于校验任务插件与数据源类型；复用时为目标环境中的数据源
+	create bool
+	ok     bool // 是否映射成功
+}
+
+// importTask 导入包中的任务与目标环境的映射
+type importTask struct {
+	id             int
+	action         string
+	task           BundleTask
+	config         string // 按目标环境数据源填充连接信息后的配置
+	source, target *importDataSource
+	configChanged  bool
+	incrChanged    bool
+}
+
+// importStep 解析后的任务流步骤
+type importStep struct {
+	stepType string
+	name     string
+	timeout  *int
+	task     *importTask       // datax 步骤引用的导入包中的任务
+	taskID   int               // datax 步骤引用的目标环境已有任务
+	ds       *importDataSource // check/sql 步骤引用的数据源
+	config   map[string]any
+}
+
+// importFlow 导入包中的任务流与目标环境的映射
+type importFlow struct {
+	id           int
+	action       string
+	flow         BundleFlow
+	steps        []importStep
+	stepsChanged bool
+}
+
+type bundleImporter struct {
+	tx          *sql.Tx
+	opts        ImportOptions
+	userID      int
+	result      *ImportResult
+	dataSources map[string]*importDataSource
+	dsOrder     []string
+	tasks       map[string]*importTask
+	taskOrder   []*importTask
+	flows       []*importFlow
+	prunedFlows []managedObject
+	prunedTasks []managedObject
+}
+
+// managedObject 由某一来源管理的已有任务或任务流
+type managedObject struct {
+	id   int
+	name string
+}
+
+func (im *bundleImporter) add(kind, name, action, message string) {
+	im.result.Items = append(im.result.Items, ImportItem{Kind: kind, Name: name, Action: action, Message: message})
+}
+
+// plan 解析导入包中的全部对象并确定处理方式，不写入数据
+func (im *bundleImporter) plan(b *Bundle) error {
+	for i := range b.DataSources {
+		d := b.DataSources[i]
+		if _, dup := im.dataSources[d.Name]; dup {
+			im.add(ImportKindDataSource, d.Name, ImportConflict, "导入包中存在重复的数据源名称")
+			continue
+		}
+		if err := im.planDataSource(d.Name, &d); err != nil {
+			return err
+		}
+	}
+	for _, t := range b.Tasks {
+		if _, dup := im.tasks[t.Name]; dup {
+			im.add(ImportKindTask, t.Name, ImportConflict, "导入包中存在重复的任务名称")
+			continue
+		}
+		if err := im.planTask(t); err != nil {
+			return err
+		}
+	}
+	names := map[string]bool{}
+	for _, f := range b.Flows {
+		if names[f.Name] {
+			im.add(ImportKindFlow, f.Name, ImportConflict, "导入包中存在重复的任务流名称")
+			continue
+		}
+		names[f.Name] = true
+		if err := im.planFlow(f); err != nil {
+			return err
+		}
+	}
+	if im.opts.Prune && im.opts.ManagedBy != "" {
+		return im.planPrune(b)
+	}
+	return nil
+}
+
+// dataSource 返回名称对应的数据源映射；导入包中未包含时尝试直接映射到目标环境的同名数据源
+func (im *bundleImporter) dataSource(name string) (*importDataSource, error) {
+	if ds, ok := im.dataSources[name]; ok {
+		return ds, nil
+	}
+	if err := im.planDataSource(name, nil); err != nil {
+		return nil, err
+	}
+	return im.dataSources[name], nil
+}
+
+func (im *bundleImporter) planDataSource(name string, d *BundleDataSource) error {
+	ds := &importDataSource{}
+	im.dataSources[name] = ds
+	im.dsOrder = append(im.dsOrder, name)
+
+	rows, err := im.tx.Query(`SELECT id, project_id, type, COALESCE(db_url,''), COALESCE(db_user,''), COALESCE(db_password,''),
+		COALESCE(db_database,''), COALESCE(defaultfs,''), COALESCE(hadoopconfig,'')
+		FROM data_sources WHERE name=?`, name)
+	if err != nil {
+		return fmt.Errorf("查询数据源失败: %v", err)
+	}
+	var existing []BundleDataSource
+	var ids []int
+	visible := true
+	for rows.Next() {
+		var e BundleDataSource
+		var id, projectID int
+		if err := rows.Scan(&id, &projectID, &e.Type, &e.DBURL, &e.DBUser, &e.DBPassword, &e.DBDatabase, &e.DefaultFS, &e.HadoopConfig); err != nil {
+			rows.Close()
+			return err
+		}
+		e.Name = name
+		existing = append(existing, e)
+		ids = append(ids, id)
+		if im.opts.DataSourceProjects != nil && !im.opts.DataSourceProjects[projectID] {
+			visible = false
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case len(existing) > 1:
+		im.add(ImportKindDataSource, name, ImportConflict, "目标环境中存在多个同名数据源，无法确定映射")
+	case len(existing) == 1 && !visible:
+		im.add(ImportKindDataSource, name, ImportConflict, "目标环境中的同名数据源属于无权访问的项目")
+	case len(existing) == 1 && d != nil && existing[0].Type != d.Type:
+		im.add(ImportKindDataSource, name, ImportConflict,
+			fmt.Sprintf("目标环境中的同名数据源类型为 %s，导入包中为 %s", existing[0].Type, d.Type))
+	case len(existing) == 1:
+		ds.id, ds.conn, ds.ok = ids[0], existing[0], true
+		im.add(ImportKindDataSource, name, ImportReuse, "使用目标环境中的同名数据源，连接信息不会被修改")
+	case d == nil:
+		im.add(ImportKindDataSource, name, ImportConflict, "导入包和目标环境中均不存在该数据源")
+	default:
+		ds.conn, ds.create, ds.ok = *d, true, true
+		msg := ""
+		if d.Type == string(datax.DataSourceMySQL) && d.DBPasswordRef != "" {
+			// 外部密码来源在目标环境未配置时仍然创建，执行前在数据源中修改即可
+			if err := datax.CheckPasswordRef(d.DBPasswordRef); err != nil {
+				msg = "外部密码来源不可用: " + err.Error()
+			}
+		} else if d.Type == string(datax.DataSourceMySQL) && d.DBPassword == "" {
+			msg = "导入包未包含密码，请在导入后补充"
+		}
+		im.add(ImportKindDataSource, name, ImportCreate, msg)
+	}
+	return nil
+}
+
+func (im *bundleImporter) planTask(t BundleTask) error {
+	it := &importTask{task: t}
+	im.tasks[t.Name] = it
+	im.taskOrder = append(im.taskOrder, it)
+
+	conflict := func(msg string) error {
+		it.action = ImportConflict
+		im.add(ImportKindTask, t.Name, ImportConflict, msg)
+		return nil
+	}
+
+	var err error
+	if it.source, err = im.dataSource(t.Source); err != nil {
+		return err
+	}
+	if it.target, err = im.dataSource(t.Target); err != nil {
+		return err
+	}
+	if !it.source.ok || !it.target.ok {
+		return conflict("引用的数据源无法映射")
+	}
+	if err := ValidateIncrColumn(t.IncrColumn); err != nil {
+		return conflict(err.Error())
+	}
+	if it.config, err = bindTaskConnections(t.JsonConfig, it.source, it.target); err != nil {
+		return conflict(err.Error())
+	}
+
+	rows, err := im.tx.Query(`SELECT id, project_id, source_id, target_id, COALESCE(json_config,''), COALESCE(incr_column,''), reconcile_enabled, reconcile_tolerance,
+		COALESCE(managed_by,'') FROM tasks WHERE name=?`, t.Name)
+	if err != nil {
+		return fmt.Errorf("查询任务失败: %v", err)
+	}
+	var matches int
+	var projectID, sourceID, targetID, tolerance int
+	var config, incr, managed string
+	var reconcile bool
+	for rows.Next() {
+		matches++
+		if err := rows.Scan(&it.id, &projectID, &sourceID, &targetID, &config, &incr, &reconcile, &tolerance, &managed); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch matches {
+	case 0:
+		projectID = im.projectID()
+	case 1:
+		if !im.inProject(projectID) {
+			return conflict("目标环境中的同名任务属于其他项目")
+		}
+	default:
+		return conflict("目标环境中存在多个同名任务，无法确定映射")
+	}
+	// 新建的数据源此时还没有 ID，其引用在写入时重新生成，只检查配置中另外引用的数据源
+	scope := datax.RefScope{ProjectID: projectID, SourceID: it.source.id, TargetID: it.target.id}
+	if err := datax.CheckDataSourceRefs(im.tx, it.config, scope); err != nil {
+		if errors.Is(err, datax.ErrRefOutOfScope) {
+			return conflict(err.Error())
+		}
+		return err
+	}
+	if matches == 0 {
+		it.action = ImportCreate
+		im.add(ImportKindTask, t.Name, ImportCreate, "")
+		return nil
+	}
+
+	change, err := im.managedChange(managed)
+	if err != nil {
+		return conflict(err.Error())
+	}
+	var changes []string
+	if change != "" {
+		changes = append(changes, change)
+	}
+	if it.source.create || it.target.create || sourceID != it.source.id || targetID != it.target.id {
+		changes = append(changes, "数据源")
+	}
+	if NormalizeJSON(config) != NormalizeJSON(it.config) {
+		it.configChanged = true
+		changes = append(changes, "配置")
+	}
+	if incr != t.IncrColumn {
+		it.incrChanged = true
+		changes = append(changes, "增量列")
+	}
+	if reconcile != t.ReconcileEnabled || tolerance != t.ReconcileTolerance {
+		changes = append(changes, "对账设置")
+	}
+	im.planUpdate(ImportKindTask, t.Name, &it.action, changes)
+	return nil
+}
+
+// managedChange 比较已有对象的管理来源与本次导入的来源。
+// 普通导入不能覆盖由同步管理的对象；同步时接管界面维护的同名对象。
+func (im *bundleImporter) managedChange(current string) (string, error) {
+	if current == im.opts.ManagedBy {
+		return "", nil
+	}
+	if im.opts.ManagedBy == "" {
+		return "", errors.New("目标环境中的同名对象由 Git 目录同步管理，请修改仓库中的定义")
+	}
+	return "纳入 Git 管理", nil
+}
+
+// planUpdate 根据差异项和覆盖选项确定已存在对象的处理方式
+func (im *bundleImporter) planUpdate(kind, name string, action *string, changes []string) {
+	diff := strings.Join(changes, "、")
+	switch {
+	case len(changes) == 0:
+		*action = ImportUnchanged
+		im.add(kind, name, ImportUnchanged, "")
+	case im.opts.Overwrite:
+		*action = ImportUpdate
+		im.add(kind, name, ImportUpdate, "将覆盖："+diff)
+	default:
+		*action = ImportConflict
+		im.add(kind, name, ImportConflict, "目标环境中已存在同名对象且内容不同（"+diff+"），选择覆盖后可更新")
+	}
+}
+
+func (im *bundleImporter) planFlow(f BundleFlow) error {
+	fl := &importFlow{flow: f}
+	conflict := func(msg string) error {
+		im.add(ImportKindFlow, f.Name, ImportConflict, msg)
+		return nil
+	}
+
+	if err := ValidateCronExpression(f.CronExpr); err != nil {
+		return conflict("调度表达式无效: " + err.Error())
+	}
+
+	for i, s := range f.Steps {
+		step := importStep{stepType: s.Type, name: s.Name, timeout: s.TimeoutMinutes, config: s.Config}
+		label := fmt.Sprintf("第 %d 步", i+1)
+		switch s.Type {
+		case StepTypeDataX:
+			if t, ok := im.tasks[s.Task]; ok {
+				if t.action == ImportConflict {
+					return conflict(label + "引用的任务 " + s.Task + " 无法导入")
+				}
+				step.task = t
+			} else {
+				id, err := im.existingTaskID(s.Task)
+				if err != nil {
+					return err
+				}
+				if id == 0 {
+					return conflict(label + "引用的任务 " + s.Task + " 在导入包和目标环境中均不存在或不唯一")
+				}
+				step.taskID = id
+			}
+		case StepTypeCheck, StepTypeSQL:
+			ds, err := im.dataSource(s.DataSource)
+			if err != nil {
+				return err
+			}
+			if !ds.ok {
+				return conflict(label + "引用的数据源 " + s.DataSource + " 无法映射")
+			}
+			if ds.conn.Type != string(datax.DataSourceMySQL) {
+				return conflict(label + "引用的数据源 " + s.DataSource + " 不是 MySQL 类型")
+			}
+			step.ds = ds
+		case StepTypeShell:
+			if !im.opts.AllowShell {
+				return conflict(label + "是 Shell 步骤，只有管理员可以导入")
+			}
+		default:
+			return conflict(label + "的步骤类型 " + s.Type + " 不受支持")
+		}
+		fl.steps = append(fl.steps, step)
+	}
+
+	var desc, cronExpr, managed string
+	var enabled bool
+	var projectID int
+	err := im.tx.QueryRow("SELECT id, project_id, COALESCE(description,''), cron_expr, enabled, COALESCE(managed_by,'') FROM task_flows WHERE name=?", f.Name).
+		Scan(&fl.id, &projectID, &desc, &cronExpr, &enabled, &managed)
+	if errors.Is(err, sql.ErrNoRows) {
+		fl.action = ImportCreate
+		im.flows = append(im.flows, fl)
+		im.add(ImportKindFlow, f.Name, ImportCreate, fmt.Sprintf("%d 个步骤", len(fl.steps)))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询任务流失败: %v", err)
+	}
+	// 同名任务流多于一个时 QueryRow 只返回第一条，这里单独检查
+	var count int
+	if err := im.tx.QueryRow("SELECT COUNT(*) FROM task_flows WHERE name=?", f.Name).Scan(&count); err != nil {
+		return err
+	}
+	if count > 1 {
+		return conflict("目标环境中存在多个同名任务流，无法确定映射")
+	}
+	if !im.inProject(projectID) {
+		return conflict("目标环境中的同名任务流属于其他项目")
+	}
+
+	change, err := im.managedChange(managed)
+	if err != nil {
+		return conflict(err.Error())
+	}
+	var changes []string
+	if change != "" {
+		changes = append(changes, change)
+	}
+	if desc != f.Description || cronExpr != f.CronExpr || enabled != f.Enabled {
+		changes = append(changes, "属性")
+	}
+	existing, err := im.existingStepSignatures(fl.id)
+	if err != nil {
+		return err
+	}
+	planned, err := fl.stepSignatures()
+	if err != nil {
+		return conflict(err.Error())
+	}
+	if strings.Join(existing, "\n") != strings.Join(planned, "\n") {
+		fl.stepsChanged = true
+		changes = append(changes, "步骤")
+	}
+	im.planUpdate(ImportKindFlow, f.Name, &fl.action, changes)
+	if fl.action != ImportConflict {
+		im.flows = append(im.flows, fl)
+	}
+	return nil
+}
+
+// planPrune 找出由同一来源管理、但已不在导入内容中的任务流和任务，计划删除。
+// 仍被其他任务流引用的任务不能删除。
+func (im *bundleImporter) planPrune(b *Bundle) error {
+	flowNames := map[string]bool{}
+	for _, f := range b.Flows {
+		flowNames[f.Name] = true
+	}
+	flows, err := im.managedObjects("task_flows")
+	if err != nil {
+		return err
+	}
+	pruned := map[int]bool{}
+	for _, o := range flows {
+		if !flowNames[o.name] {
+			pruned[o.id] = true
+			im.prunedFlows = append(im.prunedFlows, o)
+			im.add(ImportKindFlow, o.name, ImportDelete, "")
+		}
+	}
+
+	tasks, err := im.managedObjects("tasks")
+	if err != nil {
+		return err
+	}
+	for _, o := range tasks {
+		if _, ok := im.tasks[o.name]; ok {
+			continue
+		}
+		refs, err := im.taskReferences(o.id)
+		if err != nil {
+			return err
+		}
+		var blockers []string
+		for _, ref := range refs {
+			if !pruned[ref.id] && im.flowStillReferences(ref.id, o.id) {
+				blockers = append(blockers, ref.name)
+			}
+		}
+		if len(blockers) > 0 {
+			im.add(ImportKindTask, o.name, ImportConflict, "需要删除，但仍被任务流引用: "+strings.Join(blockers, "、"))
+			continue
+		}
+		im.prunedTasks = append(im.prunedTasks, o)
+		im.add(ImportKindTask, o.name, ImportDelete, "")
+	}
+	return nil
+}
+
+// managedObjects 列出 table 中由本次导入来源管理的对象，table 仅为 tasks 或 task_flows
+func (im *bundleImporter) managedObjects(table string) ([]managedObject, error) {
+	rows, err := im.tx.Query("SELECT id, name FROM "+table+" WHERE managed_by=? ORDER BY id", im.opts.ManagedBy)
+	if err != nil {
+		return nil, fmt.Errorf("查询受管对象失败: %v", err)
+	}
+	defer rows.Close()
+	var objs []managedObject
+	for rows.Next() {
+		var o managedObject
+		if err := rows.Scan(&o.id, &o.name); err != nil {
+			return nil, err
+		}
+		objs = append(objs, o)
+	}
+	return objs, rows.Err()
+}
+
+// taskReferences 列出引用任务的任务流
+func (im *bundleImporter) taskReferences(taskID int) ([]managedObject, error) {
+	rows, err := im.tx.Query(`
+		SELECT DISTINCT f.id, f.name FROM task_flow_steps s
+		JOIN task_flows f ON s.flow_id = f.id
+		WHERE s.task_id=?`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务流引用失败: %v", err)
+	}
+	defer rows.Close()
+	var refs []managedObject
+	for rows.Next() {
+		var r managedObject
+		if err := rows.Scan(&r.id, &r.name); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// flowStillReferences 判断导入后任务流是否仍引用该任务；不在导入内容中的任务流保持原样
+func (im *bundleImporter) flowStillReferences(flowID, taskID int) bool {
+	for _, fl := range im.flows {
+		if fl.id != flowID || fl.action == ImportCreate {
+			continue
+		}
+		for _, s := range fl.steps {
+			if s.taskID == taskID || (s.task != nil && s.task.id == taskID) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// inProject 判断已有对象是否属于导入的目标项目，未指定项目时不限制
+func (im *bundleImporter) inProject(projectID int) bool {
+	return im.opts.ProjectID == 0 || projectID == im.opts.ProjectID
+}
+
+// projectID 返回新建对象所属的项目
+func (im *bundleImporter) projectID() int {
+	if im.opts.ProjectID == 0 {
+		return DefaultProjectID
+	}
+	return im.opts.ProjectID
+}
+
+// existingTaskID 按名称查找目标环境（指定项目时为该项目）中唯一的任务，不存在或不唯一时返回 0
+func (im *bundleImporter) existingTaskID(name string) (int, error) {
+	rows, err := im.tx.Query("SELECT id FROM tasks WHERE name=? AND (? = 0 OR project_id = ?)", name, im.opts.ProjectID, im.opts.ProjectID)
+	if err != nil {
+		return 0, fmt.Errorf("查询任务失败: %v", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 {
+		return 0, rows.Err()
+	}
+	return ids[0], rows.Err()
+}
+
+// existingStepSignatures 返回目标环境任务流步骤的比较签名
+func (im *bundleImporter) existingStepSignatures(flowID int) ([]string, error) {
+	rows, err := im.tx.Query(`
+		SELECT step_type, COALESCE(task_id,0), COALESCE(name,''), COALESCE(step_config,''), timeout_minutes
+		FROM task_flow_steps WHERE flow_id=? ORDER BY step_order`, flowID)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务流步骤失败: %v", err)
+	}
+	defer rows.Close()
+	var sigs []string
+	for rows.Next() {
+		var stepType, name, config string
+		var taskID int
+		var timeout sql.NullInt64
+		if err := rows.Scan(&stepType, &taskID, &name, &config, &timeout); err != nil {
+			return nil, err
+		}
+		var t *int
+		if timeout.Valid {
+			v := int(timeout.Int64)
+			t = &v
+		}
+		sigs = append(sigs, stepSignature(stepType, fmt.Sprint(taskID), name, t, NormalizeJSON(config)))
+	}
+	return sigs, rows.Err()
+}
+
+// stepSignatures 返回导入后任务流步骤的比较签名；引用待新建对象的步骤必然不同
+func (fl *importFlow) stepSignatures() ([]string, error) {
+	var sigs []string
+	for _, s := range fl.steps {
+		task := "0"
+		if s.task != nil {
+			task = fmt.Sprint(s.task.id)
+			if s.task.action == ImportCreate {
+				task = "new"
+			}
+		} else if s.taskID > 0 {
+			task = fmt.Sprint(s.taskID)
+		}
+		config, err := s.stepConfig()
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, stepSignature(s.stepType, task, s.name, s.timeout, NormalizeJSON(config)))
+	}
+	return sigs, nil
+}
+
+func stepSignature(stepType, task, name string, timeout *int, config string) string {
+	t := "-"
+	if timeout != nil {
+		t = fmt.Sprint(*timeout)
+	}
+	return strings.Join([]string{stepType, task, name, t, config}, "|")
+}
+
+// stepConfig 生成步骤保存到 step_config 的 JSON，数据源引用替换为目标环境的ID
+func (s *importStep) stepConfig() (string, error) {
+	if s.stepType == StepTypeDataX {
+		return "", nil
+	}
+	cfg := map[string]any{}
+	for k, v := range s.config {
+		cfg[k] = v
+	}
+	if s.ds != nil {
+		cfg["data_source_id"] = s.ds.id
+	}
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("步骤 %s 配置格式不正确: %v", s.name, err)
+	}
+	return string(out), nil
+}
+
+// apply 按导入计划写入数据源、任务和任务流
+func (im *bundleImporter) apply() error {
+	for _, name := range im.dsOrder {
+		ds := im.dataSources[name]
+		if !ds.create {
+			continue
+		}
+		d := ds.conn
+		var res sql.Result
+		var err error
+		if d.Type == string(datax.DataSourceMySQL) {
+			password, encErr := datax.EncryptPassword(d.DBPassword)
+			if encErr != nil {
+				return fmt.Errorf("加密数据源 %s 的密码失败: %v", name, encErr)
+			}
+			res, err = im.tx.Exec(`INSERT INTO data_sources(name,project_id,type,db_url,db_user,db_password,db_password_ref,db_database,created_by,updated_by)
+				VALUES(?,?,?,?,?,?,NULLIF(?,''),?,?,?)`,
+				name, im.projectID(), d.Type, d.DBURL, d.DBUser, password, d.DBPasswordRef, d.DBDatabase, im.userID, im.userID)
+		} else {
+			res, err = im.tx.Exec(`INSERT INTO data_sources(name,project_id,type,defaultfs,hadoopconfig,created_by,updated_by) VALUES(?,?,?,?,?,?,?)`,
+				name, im.projectID(), d.Type, d.DefaultFS, d.HadoopConfig, im.userID, im.userID)
+		}
+		if err != nil {
+			return fmt.Errorf("创建数据源 %s 失败: %v", name, err)
+		}
+		id, _ := res.LastInsertId()
+		ds.id = int(id)
+	}
+
+	for _, t := range im.taskOrder {
+		if err := im.applyTask(t); err != nil {
+			return err
+		}
+	}
+
+	for _, fl := range im.flows {
+		if err := im.applyFlow(fl); err != nil {
+			return err
+		}
+	}
+
+	// 先删除任务流及其步骤，再删除不再被引用的任务
+	for _, o := range im.prunedFlows {
+		if _, err := im.tx.Exec("DELETE FROM task_flow_steps WHERE flow_id=?", o.id); err != nil {
+			return fmt.Errorf("删除任务流 %s 的步骤失败: %v", o.name, err)
+		}
+		if _, err := im.tx.Exec("DELETE FROM task_flows WHERE id=?", o.id); err != nil {
+			return fmt.Errorf("删除任务流 %s 失败: %v", o.name, err)
+		}
+		im.result.RemovedFlowIDs = append(im.result.RemovedFlowIDs, o.id)
+	}
+	for _, o := range im.prunedTasks {
+		if _, err := DeleteTask(im.tx, o.id); err != nil {
+			return fmt.Errorf("删除任务 %s 失败: %v", o.name, err)
+		}
+	}
+	return nil
+}
+
+func (im *bundleImporter) applyTask(t *importTask) error {
+	bt := t.task
+	if t.source.create || t.target.create {
+		config, err := bindTaskConnections(bt.JsonConfig, t.source, t.target)
+		if err != nil {
+			return fmt.Errorf("任务 %s 的配置无效: %v", bt.Name, err)
+		}
+		t.config = config
+	}
+	switch t.action {
+	case ImportCreate:
+		res, err := im.tx.Exec(`INSERT INTO tasks(name, project_id, source_id, target_id, json_config, incr_column, reconcile_enabled, reconcile_tolerance, managed_by, created_by, updated_by)
+			VALUES(?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?)`,
+			bt.Name, im.projectID(), t.source.id, t.target.id, t.config, bt.IncrColumn, bt.ReconcileEnabled, bt.ReconcileTolerance, im.opts.ManagedBy, im.userID, im.userID)
+		if err != nil {
+			return fmt.Errorf("创建任务 %s 失败: %v", bt.Name, err)
+		}
+		id, _ := res.LastInsertId()
+		t.id = int(id)
+		if _, err := SaveTaskConfig(im.tx, t.id, t.config, "导入", im.userID); err != nil {
+			return fmt.Errorf("创建任务 %s 失败: %v", bt.Name, err)
+		}
+	case ImportUpdate:
+		_, err := im.tx.Exec(`UPDATE tasks SET source_id=?, target_id=?, incr_column=NULLIF(?, ''), reconcile_enabled=?, reconcile_tolerance=?,
+			managed_by=NULLIF(?, ''), updated_by=? WHERE id=?`,
+			t.source.id, t.target.id, bt.IncrColumn, bt.ReconcileEnabled, bt.ReconcileTolerance, im.opts.ManagedBy, im.userID, t.id)
+		if err != nil {
+			return fmt.Errorf("更新任务 %s 失败: %v", bt.Name, err)
+		}
+		// 增量列变化后旧水位不再适用
+		if t.incrChanged {
+			if _, err := im.tx.Exec("DELETE FROM task_watermarks WHERE task_id=?", t.id); err != nil {
+				return fmt.Errorf("清除任务 %s 的增量水位失败: %v", bt.Name, err)
+			}
+		}
+		if t.configChanged {
+			if _, err := SaveTaskConfig(im.tx, t.id, t.config, "导入覆盖", im.userID); err != nil {
+				return fmt.Errorf("更新任务 %s 失败: %v", bt.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (im *bundleImporter) applyFlow(fl *importFlow) error {
+	f := fl.flow
+	switch fl.action {
+	case ImportCreate:
+		res, err := im.tx.Exec(`INSERT INTO task_flows(name, project_id, description, cron_expr, enabled, managed_by, created_by, updated_by)
+			VALUES(?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`, f.Name, im.projectID(), f.Description, f.CronExpr, f.Enabled, im.opts.ManagedBy, im.userID, im.userID)
+		if err != nil {
+			return fmt.Errorf("创建任务流 %s 失败: %v", f.Name, err)
+		}
+		id, _ := res.LastInsertId()
+		fl.id = int(id)
+	case ImportUpdate:
+		_, err := im.tx.Exec("UPDATE task_flows SET description=?, cron_expr=?, enabled=?, managed_by=NULLIF(?, ''), updated_by=? WHERE id=?",
+			f.Description, f.CronExpr, f.Enabled, im.opts.ManagedBy, im.userID, fl.id)
+		if err != nil {
+			return fmt.Errorf("更新任务流 %s 失败: %v", f.Name, err)
+		}
+		if !fl.stepsChanged {
+			im.result.FlowIDs = append(im.result.FlowIDs, fl.id)
+			return nil
+		}
+		if _, err := im.tx.Exec("DELETE FROM task_flow_steps WHERE flow_id=?", fl.id); err != nil {
+			return fmt.Errorf("更新任务流 %s 的步骤失败: %v", f.Name, err)
+		}
+	default:
+		return nil
+	}
+
+	for i, s := range fl.steps {
+		var taskID *int
+		var name, config *string
+		if s.stepType == StepTypeDataX {
+			id := s.taskID
+			if s.task != nil {
+				id = s.task.id
+			}
+			taskID = &id
+		} else {
+			cfg, err := s.stepConfig()
+			if err != nil {
+				return err
+			}
+			name, config = &s.name, &cfg
+		}
+		_, err := im.tx.Exec(`INSERT INTO task_flow_steps (flow_id, step_type, task_id, name, step_config, step_order, timeout_minutes, created_by, updated_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, fl.id, s.stepType, taskID, name, config, i+1, s.timeout, im.userID, im.userID)
+		if err != nil {
+			return fmt.Errorf("创建任务流 %s 的步骤失败: %v", f.Name, err)
+		}
+	}
+	im.result.FlowIDs = append(im.result.FlowIDs, fl.id)
+	return nil
+}
+
+// bindTaskConnections 将 DataX 配置中的连接信息填充为目标环境数据源的引用，并校验插件与数据源类型一致。
+// 新建的数据源在应用阶段取得ID后需要重新填充
+func bindTaskConnections(config string, source, target *importDataSource) (string, error) {
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return "", err
+	}
+	for part, ids := range map[string]*importDataSource{"reader": source, "writer": target} {
+		ds := ids.conn
+		p, ok := jobContentPart(job, part)
+		if !ok {
+			return "", fmt.Errorf("DataX 配置缺少 %s", part)
+		}
+		param, ok := p["parameter"].(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("DataX %s 缺少 parameter", part)
+		}
+		plugin, _ := p["name"].(string)
+
+		if strings.HasPrefix(plugin, "mysql") {
+			if ds.Type != string(datax.DataSourceMySQL) {
+				return "", fmt.Errorf("%s 需要 MySQL 数据源，%s 的类型为 %s", plugin, ds.Name, ds.Type)
+			}
+			param["username"] = datax.DataSourceRef(ids.id, datax.RefUsername)
+			param["password"] = datax.DataSourceRef(ids.id, datax.RefPassword)
+			jdbcURL := datax.DataSourceRef(ids.id, datax.RefJdbcURL)
+			conns, _ := param["connection"].([]any)
+			for _, c := range conns {
+				if m, ok := c.(map[string]any); ok {
+					// mysqlreader 的 jdbcUrl 为数组，mysqlwriter 为字符串
+					if part == "reader" {
+						m["jdbcUrl"] = []string{jdbcURL}
+					} else {
+						m["jdbcUrl"] = jdbcURL
+					}
+				}
+			}
+			continue
+		}
+
+		if ds.Type == string(datax.DataSourceMySQL) {
+			return "", fmt.Errorf("%s 需要文件系统数据源，%s 的类型为 mysql", plugin, ds.Name)
+		}
+		param["defaultFS"] = datax.DataSourceRef(ids.id, datax.RefDefaultFS)
+		param["hadoopConfig"] = datax.DataSourceRef(ids.id, datax.RefHadoopConfig)
+	}
+
+	out, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
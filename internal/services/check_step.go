@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+// CheckConfig 为数据质量检查步骤的配置，保存在 task_flow_steps.step_config 中
+type CheckConfig struct {
+	DataSourceID int         `json:"data_source_id"`
+	Assertions   []Assertion `json:"assertions"`
+}
+
+// Assertion 表示一条 SQL 断言：执行 SQL 取第一行第一列，与期望值按运算符比较
+type Assertion struct {
+	Name  string         `json:"name"`
+	SQL   string         `json:"sql"`
+	Op    string         `json:"op"`
+	Value AssertionValue `json:"value"`
+}
+
+// AssertionValue 为断言的期望值，JSON 中可写为数字或字符串
+type AssertionValue string
+
+// UnmarshalJSON 同时接受数字和字符串形式的期望值
+func (v *AssertionValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = AssertionValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("期望值必须为数字或字符串")
+	}
+	*v = AssertionValue(n.String())
+	return nil
+}
+
+// assertionOps 为支持的比较运算符
+var assertionOps = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+// NewCheckConfig 根据数据源和断言列表 JSON 生成检查步骤配置
+func NewCheckConfig(dataSourceID int, assertionsJSON string) (string, error) {
+	cfg := CheckConfig{DataSourceID: dataSourceID}
+	if err := json.Unmarshal([]byte(assertionsJSON), &cfg.Assertions); err != nil {
+		return "", fmt.Errorf("断言列表格式不正确: %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ParseCheckConfig 解析并校验检查步骤配置
+func ParseCheckConfig(config string) (*CheckConfig, error) {
+	var cfg CheckConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, fmt.Errorf("检查步骤配置格式不正确: %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// validate 校验数据源和每条断言
+func (c *CheckConfig) validate() error {
+	if c.DataSourceID <= 0 {
+		return errors.New("请选择检查使用的数据源")
+	}
+	if len(c.Assertions) == 0 {
+		return errors.New("至少需要一条断言")
+	}
+	for i, a := range c.Assertions {
+		if strings.TrimSpace(a.SQL) == "" {
+			return fmt.Errorf("第 %d 条断言缺少 SQL", i+1)
+		}
+		if !assertionOps[a.Op] {
+			return fmt.Errorf("第 %d 条断言的运算符无效: %s", i+1, a.Op)
+		}
+	}
+	return nil
+}
+
+// label 返回断言在日志中的显示名称
+func (a Assertion) label(index int) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return fmt.Sprintf("断言%d", index+1)
+}
+
+// evaluate 比较实际值与期望值；两者均为数值时按数值比较，否则只支持 == 和 !=
+func (a Assertion) evaluate(actual string) (bool, error) {
+	expected := string(a.Value)
+	av, errA := strconv.ParseFloat(actual, 64)
+	ev, errE := strconv.ParseFloat(expected, 64)
+	if errA == nil && errE == nil {
+		switch a.Op {
+		case "==":
+			return av == ev, nil
+		case "!=":
+			return av != ev, nil
+		case ">":
+			return av > ev, nil
+		case ">=":
+			return av >= ev, nil
+		case "<":
+			return av < ev, nil
+		case "<=":
+			return av <= ev, nil
+		}
+	}
+	switch a.Op {
+	case "==":
+		return actual == expected, nil
+	case "!=":
+		return actual != expected, nil
+	}
+	return false, fmt.Errorf("非数值结果无法使用运算符 %s 比较", a.Op)
+}
+
+// runCheckStep 执行数据质量检查步骤，任一断言不成立时步骤失败
+func (s *Scheduler) runCheckStep(ctx context.Context, step models.TaskFlowStep, execID int, executionType string) (string, error) {
+	start := time.Now()
+	fail := func(msg string, err error) (string, error) {
+		s.appendStepLog(step, execID, start, time.Now(), stepStatus(ctx, err), msg, executionType)
+		return msg, err
+	}
+
+	cfg, err := ParseCheckConfig(step.Config)
+	if err != nil {
+		return fail(err.Error(), err)
+	}
+	conn, err := datax.GetMySQLConnection(s.db, cfg.DataSourceID)
+	if err != nil {
+		return fail(fmt.Sprintf("获取检查数据源失败: %v", err), err)
+	}
+	db, err := datax.OpenMySQL(conn)
+	if err != nil {
+		return fail(fmt.Sprintf("连接检查数据源失败: %v", err), err)
+	}
+	defer db.Close()
+
+	var b strings.Builder
+	failed := 0
+	for i, a := range cfg.Assertions {
+		query := processPlaceholders(ctx, a.SQL)
+		fmt.Fprintf(&b, "SQL: %s\n", query)
+
+		var actual sql.NullString
+		err := db.QueryRowContext(ctx, query).Scan(&actual)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			if ctx.Err() != nil {
+				b.WriteString("检查被终止\n")
+				return fail(b.String(), ctx.Err())
+			}
+			failed++
+			fmt.Fprintf(&b, "[错误] %s: %v\n\n", a.label(i), err)
+			continue
+		}
+
+		value := "NULL"
+		if actual.Valid {
+			value = actual.String
+		}
+		ok, err := a.evaluate(value)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(&b, "[错误] %s: 实际值 %s，%v\n\n", a.label(i), value, err)
+		case ok:
+			fmt.Fprintf(&b, "[通过] %s: 实际值 %s，期望 %s %s\n\n", a.label(i), value, a.Op, a.Value)
+		default:
+			failed++
+			fmt.Fprintf(&b, "[失败] %s: 实际值 %s，期望 %s %s\n\n", a.label(i), value, a.Op, a.Value)
+		}
+	}
+	fmt.Fprintf(&b, "检查完成: 共 %d 项，通过 %d 项，未通过 %d 项", len(cfg.Assertions), len(cfg.Assertions)-failed, failed)
+
+	if failed > 0 {
+		err = fmt.Errorf("%d 项断言未通过", failed)
+	}
+	s.appendStepLog(step, execID, start, time.Now(), stepStatus(ctx, err), b.String(), executionType)
+	return b.String(), err
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// CSRFCookieName 供前端脚本读取 CSRF 令牌的 cookie，不设置 HttpOnly
+const CSRFCookieName = "csrf_token"
+
+// CSRFToken 返回当前浏览器会话的 CSRF 令牌，尚未生成时生成一个并保存到会话 cookie 中。
+// 令牌与会话绑定（同步令牌模式），修改数据的请求必须回传相同的令牌
+func (a *AuthService) CSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		// cookie 无法解码（如密钥更换）时 gorilla 仍返回新会话，保存后即覆盖旧 cookie
+		log.Printf("Error getting session: %v", err)
+	}
+	if token, ok := sess.Values["csrf"].(string); ok && token != "" {
+		return token, nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	sess.Values["csrf"] = token
+	if err := sess.Save(r, w); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ErrInvalidCSRFToken 表示请求未携带 CSRF 令牌或令牌与会话不一致
+var ErrInvalidCSRFToken = errors.New("CSRF 令牌无效，请刷新页面后重试")
+
+// CheckCSRFToken 校验请求回传的 CSRF 令牌是否与会话中保存的一致
+func (a *AuthService) CheckCSRFToken(r *http.Request, token string) error {
+	sess, err := a.store.Get(r, "sess")
+	if err != nil {
+		return ErrInvalidCSRFToken
+	}
+	expected, _ := sess.Values["csrf"].(string)
+	if expected == "" || token == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"strings"
 )
 
@@ -107,19 +106,20 @@ func (b *ConfigBuilder) buildMySQLReader(req ConfigRequest, columnNames []string
 		return nil, errors.New("缺少输入 MySQL 配置")
 	}
 
-	conn, err := GetMySQLConnection(b.db, req.Input.MySQL.SourceID)
-	if err != nil {
+	id := req.Input.MySQL.SourceID
+	if _, err := GetMySQLConnection(b.db, id); err != nil {
 		return nil, err
 	}
 
+	// 连接信息只保存数据源引用，执行时才替换为数据源当前的配置
 	param := map[string]any{
-		"username": conn.User,
-		"password": conn.Pass,
+		"username": DataSourceRef(id, RefUsername),
+		"password": DataSourceRef(id, RefPassword),
 		"column":   columnNames,
 		"connection": []map[string]any{{
 			"table": []string{req.Input.MySQL.Table},
 			"jdbcUrl": []string{
-				fmt.Sprintf("jdbc:mysql://%s/%s?useUnicode=true&characterEncoding=utf8", conn.Host, conn.DB),
+				DataSourceRef(id, RefJdbcURL),
 			},
 		}},
 	}
@@ -137,8 +137,8 @@ func (b *ConfigBuilder) buildFSReader(req ConfigRequest, columnNames []string) (
 		return nil, errors.New("缺少输入文件系统配置")
 	}
 
-	conn, err := GetFSConnection(b.db, req.Input.FS.FSID)
-	if err != nil {
+	id := req.Input.FS.FSID
+	if _, err := GetFSConnection(b.db, id); err != nil {
 		return nil, err
 	}
 
@@ -147,15 +147,12 @@ func (b *ConfigBuilder) buildFSReader(req ConfigRequest, columnNames []string) (
 		fileType = FileFormatORC
 	}
 
+	// hadoopConfig 为空时解析为空对象
 	param := map[string]any{
-		"defaultFS": conn.DefaultFS,
-		"path":      req.Input.FS.Path,
-		"fileType":  fileType,
-	}
-
-	// 只有当hadoopConfig不为空时才添加
-	if conn.HadoopConfig != nil && len(conn.HadoopConfig) > 0 {
-		param["hadoopConfig"] = conn.HadoopConfig
+		"defaultFS":    DataSourceRef(id, RefDefaultFS),
+		"hadoopConfig": DataSourceRef(id, RefHadoopConfig),
+		"path":         req.Input.FS.Path,
+		"fileType":     fileType,
 	}
 
 	// 添加filename字段（如果指定）
@@ -187,19 +184,19 @@ func (b *ConfigBuilder) buildMySQLWriter(req ConfigRequest, columnNames []string
 		return nil, errors.New("缺少输出 MySQL 配置")
 	}
 
-	conn, err := GetMySQLConnection(b.db, req.Output.MySQL.TargetID)
-	if err != nil {
+	id := req.Output.MySQL.TargetID
+	if _, err := GetMySQLConnection(b.db, id); err != nil {
 		return nil, err
 	}
 
 	param := map[string]any{
-		"username":  conn.User,
-		"password":  conn.Pass,
+		"username":  DataSourceRef(id, RefUsername),
+		"password":  DataSourceRef(id, RefPassword),
 		"column":    columnNames,
 		"writeMode": "insert",
 		"connection": []map[string]any{{
 			"table":   []string{req.Output.MySQL.Table},
-			"jdbcUrl": fmt.Sprintf("jdbc:mysql://%s/%s?useUnicode=true&characterEncoding=utf8", conn.Host, conn.DB),
+			"jdbcUrl": DataSourceRef(id, RefJdbcURL),
 		}},
 	}
 
@@ -212,8 +209,8 @@ func (b *ConfigBuilder) buildFSWriter(req ConfigRequest, columnNames []string) (
 		return nil, errors.New("缺少输出文件系统配置")
 	}
 
-	conn, err := GetFSConnection(b.db, req.Output.FS.FSID)
-	if err != nil {
+	id := req.Output.FS.FSID
+	if _, err := GetFSConnection(b.db, id); err != nil {
 		return nil, err
 	}
 
@@ -229,16 +226,12 @@ func (b *ConfigBuilder) buildFSWriter(req ConfigRequest, columnNames []string) (
 	}
 
 	param := map[string]any{
-		"defaultFS": conn.DefaultFS,
-		"path":      req.Output.FS.Path,
-		"fileType":  fileType,
-		"writeMode": string(writeMode),
-		"column":    b.buildOutputColumns(req.Columns),
-	}
-
-	// 只有当hadoopConfig不为空时才添加
-	if conn.HadoopConfig != nil && len(conn.HadoopConfig) > 0 {
-		param["hadoopConfig"] = conn.HadoopConfig
+		"defaultFS":    DataSourceRef(id, RefDefaultFS),
+		"hadoopConfig": DataSourceRef(id, RefHadoopConfig),
+		"path":         req.Output.FS.Path,
+		"fileType":     fileType,
+		"writeMode":    string(writeMode),
+		"column":       b.buildOutputColumns(req.Columns),
 	}
 
 	// 添加filename字段（如果指定）
@@ -316,8 +309,8 @@ func (b *ConfigBuilder) getFieldDelimiter(delimiter *string) (string, error) {
 	return "", errors.New("fieldDelimiter is required for file system")
 }
 
-// MarshalJSON 格式化 JSON
-func (b *ConfigBuilder) MarshalJSON(job map[string]any) (string, error) {
+// FormatJSON 格式化 JSON
+func (b *ConfigBuilder) FormatJSON(job map[string]any) (string, error) {
 	bs, err := json.MarshalIndent(job, "", "  ")
 	if err != nil {
 		return "", err
@@ -0,0 +1,139 @@
+package datax
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 批量模板中可用的占位符
+const (
+	bulkDBPlaceholder    = "${db}"
+	bulkTablePlaceholder = "${table}"
+)
+
+// renderBulkTemplate 替换批量模板中的库名和表名占位符，日期占位符保留到执行时处理
+func renderBulkTemplate(tpl, dbName, table string) string {
+	tpl = strings.ReplaceAll(tpl, bulkDBPlaceholder, dbName)
+	return strings.ReplaceAll(tpl, bulkTablePlaceholder, table)
+}
+
+// FilterTables 按正则、包含列表和排除列表筛选表名
+func FilterTables(tables []string, req BulkRequest) ([]string, error) {
+	var re *regexp.Regexp
+	if strings.TrimSpace(req.TableRegex) != "" {
+		var err error
+		re, err = regexp.Compile(strings.TrimSpace(req.TableRegex))
+		if err != nil {
+			return nil, fmt.Errorf("表名正则无效: %v", err)
+		}
+	}
+
+	include := make(map[string]bool, len(req.Include))
+	for _, t := range req.Include {
+		if t = strings.TrimSpace(t); t != "" {
+			include[t] = true
+		}
+	}
+	exclude := make(map[string]bool, len(req.Exclude))
+	for _, t := range req.Exclude {
+		if t = strings.TrimSpace(t); t != "" {
+			exclude[t] = true
+		}
+	}
+
+	var result []string
+	for _, t := range tables {
+		if re != nil && !re.MatchString(t) {
+			continue
+		}
+		if len(include) > 0 && !include[t] {
+			continue
+		}
+		if exclude[t] {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// BuildBulk 为源库中所有匹配的表生成任务计划
+// 每张表使用自省得到的列构建 ConfigRequest 并交给 BuildConfig，
+// 单表失败会记录在计划的 Error 字段中，不影响其他表
+func (b *ConfigBuilder) BuildBulk(req BulkRequest) ([]BulkTaskPlan, error) {
+	conn, err := GetMySQLConnection(b.db, req.SourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := ListMySQLTables(b.db, req.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	tables, err = FilterTables(tables, req)
+	if err != nil {
+		return nil, err
+	}
+
+	nameTpl := req.NameTemplate
+	if strings.TrimSpace(nameTpl) == "" {
+		nameTpl = "sync_${db}_${table}"
+	}
+	tableTpl := req.TableTemplate
+	if strings.TrimSpace(tableTpl) == "" {
+		tableTpl = bulkTablePlaceholder
+	}
+
+	plans := make([]BulkTaskPlan, 0, len(tables))
+	for _, table := range tables {
+		plan := BulkTaskPlan{
+			Table:    table,
+			Name:     renderBulkTemplate(nameTpl, conn.DB, table),
+			SourceID: req.SourceID,
+			TargetID: req.TargetID,
+		}
+
+		columns, err := ListMySQLColumns(b.db, req.SourceID, table)
+		if err != nil {
+			plan.Error = err.Error()
+			plans = append(plans, plan)
+			continue
+		}
+		plan.Columns = len(columns)
+
+		cfgReq := ConfigRequest{
+			InputType:    DataSourceMySQL,
+			OutputType:   req.OutputType,
+			MySQLBase:    "in",
+			MySQLWhere:   req.MySQLWhere,
+			Columns:      columns,
+			SpeedChannel: req.SpeedChannel,
+		}
+		cfgReq.Input.MySQL = &MySQLConfig{SourceID: req.SourceID, Table: table}
+		if req.OutputType == DataSourceMySQL {
+			cfgReq.Output.MySQL = &MySQLConfig{
+				TargetID: req.TargetID,
+				Table:    renderBulkTemplate(tableTpl, conn.DB, table),
+			}
+		} else {
+			cfgReq.Output.FS = &FSConfig{
+				FSID:           req.TargetID,
+				FileType:       req.FileType,
+				Path:           renderBulkTemplate(req.PathTemplate, conn.DB, table),
+				WriteMode:      req.WriteMode,
+				FieldDelimiter: req.Delimiter,
+			}
+		}
+
+		job, err := b.BuildConfig(cfgReq)
+		if err != nil {
+			plan.Error = err.Error()
+		} else {
+			plan.Job = job
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
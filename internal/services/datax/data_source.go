@@ -8,13 +8,13 @@ import (
 	"strings"
 )
 
-// GetMySQLConnection 根据 ID 获取 MySQL 数据源连接配置
+// GetMySQLConnection 根据 ID 获取 MySQL 数据源连接配置，密码已解密或已从外部密码来源读取
 func GetMySQLConnection(db *sql.DB, id int) (*MySQLConnection, error) {
-	var url, user, pass, database string
+	var url, user, pass, passRef, database string
 	var typ string
 
-	err := db.QueryRow("SELECT type, db_url, db_user, db_password, db_database FROM data_sources WHERE id = ?",
-		id).Scan(&typ, &url, &user, &pass, &database)
+	err := db.QueryRow("SELECT type, db_url, db_user, COALESCE(db_password,''), COALESCE(db_password_ref,''), db_database FROM data_sources WHERE id = ?",
+		id).Scan(&typ, &url, &user, &pass, &passRef, &database)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -26,6 +26,9 @@ func GetMySQLConnection(db *sql.DB, id int) (*MySQLConnection, error) {
 	if typ != "mysql" {
 		return nil, errors.New("数据源类型不是MySQL")
 	}
+	if pass, err = ResolvePassword(pass, passRef); err != nil {
+		return nil, fmt.Errorf("获取数据源密码失败: %v", err)
+	}
 
 	return &MySQLConnection{
 		Host: url,
@@ -56,28 +59,113 @@ func GetFSConnection(db *sql.DB, id int) (*FSConnection, error) {
 		return nil, errors.New("数据源类型不是文件系统类型")
 	}
 
-	// 解析hadoopconfig字符串为map
+	return &FSConnection{
+		DefaultFS:    defaultfs,
+		HadoopConfig: ParseHadoopConfig(hadoopcfg),
+	}, nil
+}
+
+// ParseHadoopConfig 解析数据源的 hadoopconfig 字段，支持 JSON 和 key1=value1,key2=value2 两种格式
+func ParseHadoopConfig(hadoopcfg string) map[string]string {
 	hadoopConfig := make(map[string]string)
+	if hadoopcfg == "" {
+		return hadoopConfig
+	}
 
-	// 如果hadoopcfg不为空，解析为map
-	if hadoopcfg != "" {
-		// 尝试解析为JSON格式
-		err := json.Unmarshal([]byte(hadoopcfg), &hadoopConfig)
-		if err != nil {
-			// 如果不是JSON格式，尝试解析为简单的键值对格式
-			// 例如：key1=value1,key2=value2
-			pairs := strings.Split(hadoopcfg, ",")
-			for _, pair := range pairs {
-				kv := strings.SplitN(pair, "=", 2)
-				if len(kv) == 2 {
-					hadoopConfig[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
-				}
+	// 尝试解析为JSON格式
+	if err := json.Unmarshal([]byte(hadoopcfg), &hadoopConfig); err != nil {
+		// 如果不是JSON格式，尝试解析为简单的键值对格式
+		pairs := strings.Split(hadoopcfg, ",")
+		for _, pair := range pairs {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) == 2 {
+				hadoopConfig[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 			}
 		}
 	}
+	return hadoopConfig
+}
 
-	return &FSConnection{
-		DefaultFS:    defaultfs,
-		HadoopConfig: hadoopConfig,
-	}, nil
+// OpenMySQL 使用连接配置打开到业务 MySQL 的连接，调用方负责关闭
+func OpenMySQL(conn *MySQLConnection) (*sql.DB, error) {
+	return openMySQL(conn, "")
+}
+
+// OpenMySQLMultiStatements 打开允许一次执行多条语句的连接，用于 SQL 脚本步骤
+func OpenMySQLMultiStatements(conn *MySQLConnection) (*sql.DB, error) {
+	return openMySQL(conn, "&multiStatements=true")
+}
+
+func openMySQL(conn *MySQLConnection, params string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=true&timeout=10s%s", conn.User, conn.Pass, conn.Host, conn.DB, params)
+	dbc, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("连接源库失败: %v", err)
+	}
+	dbc.SetMaxOpenConns(2)
+	dbc.SetMaxIdleConns(1)
+	return dbc, nil
+}
+
+// ListMySQLTables 列出 MySQL 数据源所在库中的所有基础表
+func ListMySQLTables(db *sql.DB, id int) ([]string, error) {
+	conn, err := GetMySQLConnection(db, id)
+	if err != nil {
+		return nil, err
+	}
+	dbc, err := OpenMySQL(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer dbc.Close()
+
+	rows, err := dbc.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema=? AND table_type='BASE TABLE'
+		ORDER BY table_name`, conn.DB)
+	if err != nil {
+		return nil, fmt.Errorf("查询表失败: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			tables = append(tables, name)
+		}
+	}
+	return tables, rows.Err()
+}
+
+// ListMySQLColumns 按字段顺序查询 MySQL 表的列定义
+func ListMySQLColumns(db *sql.DB, id int, table string) ([]Column, error) {
+	conn, err := GetMySQLConnection(db, id)
+	if err != nil {
+		return nil, err
+	}
+	dbc, err := OpenMySQL(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer dbc.Close()
+
+	rows, err := dbc.Query(`
+		SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema=? AND table_name=?
+		ORDER BY ordinal_position`, conn.DB, table)
+	if err != nil {
+		return nil, fmt.Errorf("查询字段失败: %v", err)
+	}
+	defer rows.Close()
+
+	var cols []Column
+	for rows.Next() {
+		var col Column
+		if err := rows.Scan(&col.Name, &col.DataType); err == nil {
+			cols = append(cols, col)
+		}
+	}
+	return cols, rows.Err()
 }
@@ -0,0 +1,182 @@
+package datax
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// 任务配置中可以引用的数据源字段
+const (
+	RefUsername     = "username"
+	RefPassword     = "password"
+	RefJdbcURL      = "jdbcUrl"
+	RefDefaultFS    = "defaultFS"
+	RefHadoopConfig = "hadoopConfig"
+)
+
+var (
+	// stringRefPattern 匹配字符串字段的引用，如 ${ds:12.password}，可以出现在 JSON 字符串中的任意位置
+	stringRefPattern = regexp.MustCompile(`\$\{ds:(\d+)\.(username|password|jdbcUrl|defaultFS)\}`)
+	// objectRefPattern 匹配 hadoopConfig 的引用，须作为完整的 JSON 字符串值出现，解析时连同引号替换为对象
+	objectRefPattern = regexp.MustCompile(`"\$\{ds:(\d+)\.hadoopConfig\}"`)
+	// anyRefPattern 匹配所有字段的引用，用于提取引用的数据源
+	anyRefPattern = regexp.MustCompile(`\$\{ds:(\d+)\.(?:username|password|jdbcUrl|defaultFS|hadoopConfig)\}`)
+)
+
+// ErrRefOutOfScope 表示任务配置引用了任务无权使用的数据源
+var ErrRefOutOfScope = errors.New("任务只能引用自身的源、目标数据源或同一项目中的数据源")
+
+// RefScope 任务配置可以引用的数据源：任务的源和目标数据源，以及与任务属于同一项目的数据源
+type RefScope struct {
+	ProjectID int
+	SourceID  int
+	TargetID  int
+}
+
+// rowQuerier 可查询单行的数据库句柄或事务
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// DataSourceRef 返回数据源字段在任务配置中的引用。保存的任务配置只包含引用，
+// 执行时由 ResolveDataSourceRefs 替换为数据源当前的连接信息，修改数据源后所有引用它的任务随之生效
+func DataSourceRef(id int, field string) string {
+	return fmt.Sprintf("${ds:%d.%s}", id, field)
+}
+
+// DataSourceRefIDs 返回配置中引用的数据源 ID，按首次出现的顺序去重
+func DataSourceRefIDs(config string) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, m := range anyRefPattern.FindAllStringSubmatch(config, -1) {
+		id, err := strconv.Atoi(m[1])
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// CheckDataSourceRefs 检查配置引用的数据源都在 scope 内。引用其他项目或不存在的数据源时返回包装了
+// ErrRefOutOfScope 的错误，否则任何能编辑任务的用户都可以借引用读取其他项目数据源的密码
+func CheckDataSourceRefs(q rowQuerier, config string, scope RefScope) error {
+	for _, id := range DataSourceRefIDs(config) {
+		if id == scope.SourceID || id == scope.TargetID {
+			continue
+		}
+		var projectID int
+		err := q.QueryRow("SELECT project_id FROM data_sources WHERE id=?", id).Scan(&projectID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("引用的数据源 %d 不存在，%w", id, ErrRefOutOfScope)
+		}
+		if err != nil {
+			return fmt.Errorf("查询数据源 %d 失败: %v", id, err)
+		}
+		if projectID != scope.ProjectID {
+			return fmt.Errorf("引用的数据源 %d 属于其他项目，%w", id, ErrRefOutOfScope)
+		}
+	}
+	return nil
+}
+
+// ResolveDataSourceRefs 将 DataX 配置中的数据源引用替换为数据源当前的连接信息，密码在此时解密。
+// 字符串字段按 JSON 字符串转义，引用须位于 JSON 字符串内。scope 非空时先按 CheckDataSourceRefs
+// 检查引用的数据源，为空时不限制，仅用于有服务器权限的运维人员离线调试
+func ResolveDataSourceRefs(db *sql.DB, config string, scope *RefScope) (string, error) {
+	if scope != nil && db != nil {
+		if err := CheckDataSourceRefs(db, config, *scope); err != nil {
+			return "", err
+		}
+	}
+	r := &refResolver{db: db, mysql: make(map[int]*MySQLConnection), fs: make(map[int]*FSConnection)}
+	config = objectRefPattern.ReplaceAllStringFunc(config, func(ref string) string {
+		m := objectRefPattern.FindStringSubmatch(ref)
+		conn := r.fsConnection(m[1])
+		if conn == nil {
+			return ref
+		}
+		out, _ := json.Marshal(conn.HadoopConfig)
+		return string(out)
+	})
+	config = stringRefPattern.ReplaceAllStringFunc(config, func(ref string) string {
+		m := stringRefPattern.FindStringSubmatch(ref)
+		var value string
+		switch m[2] {
+		case RefDefaultFS:
+			conn := r.fsConnection(m[1])
+			if conn == nil {
+				return ref
+			}
+			value = conn.DefaultFS
+		default:
+			conn := r.mysqlConnection(m[1])
+			if conn == nil {
+				return ref
+			}
+			switch m[2] {
+			case RefUsername:
+				value = conn.User
+			case RefPassword:
+				value = conn.Pass
+			case RefJdbcURL:
+				value = conn.JdbcURL()
+			}
+		}
+		quoted, _ := json.Marshal(value)
+		return string(quoted[1 : len(quoted)-1])
+	})
+	if r.err != nil {
+		return "", r.err
+	}
+	return config, nil
+}
+
+// refResolver 缓存一次解析中用到的数据源，并记录遇到的第一个错误
+type refResolver struct {
+	db    *sql.DB
+	mysql map[int]*MySQLConnection
+	fs    map[int]*FSConnection
+	err   error
+}
+
+func (r *refResolver) mysqlConnection(rawID string) *MySQLConnection {
+	id, _ := strconv.Atoi(rawID)
+	if conn, ok := r.mysql[id]; ok || r.fail(id) {
+		return conn
+	}
+	conn, err := GetMySQLConnection(r.db, id)
+	if err != nil {
+		r.err = fmt.Errorf("解析数据源 %d 的引用失败: %v", id, err)
+		return nil
+	}
+	r.mysql[id] = conn
+	return conn
+}
+
+func (r *refResolver) fsConnection(rawID string) *FSConnection {
+	id, _ := strconv.Atoi(rawID)
+	if conn, ok := r.fs[id]; ok || r.fail(id) {
+		return conn
+	}
+	conn, err := GetFSConnection(r.db, id)
+	if err != nil {
+		r.err = fmt.Errorf("解析数据源 %d 的引用失败: %v", id, err)
+		return nil
+	}
+	r.fs[id] = conn
+	return conn
+}
+
+// fail 已出错或没有数据库连接时不再查询
+func (r *refResolver) fail(id int) bool {
+	if r.err == nil && r.db == nil {
+		r.err = fmt.Errorf("配置引用了数据源 %d，需要连接数据库", id)
+	}
+	return r.err != nil
+}
@@ -0,0 +1,59 @@
+package datax
+
+import (
+	"context"
+	"errors"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// keyring 加解密数据源密码的主密钥环，为 nil 时密码以明文保存
+var keyring *util.Keyring
+
+// secretProviders 数据源外部密码来源，为 nil 时只能使用数据库中保存的密码
+var secretProviders *SecretProviders
+
+// SetKeyring 设置加解密数据源密码使用的主密钥环，须在启动时、处理请求和调度任务之前调用
+func SetKeyring(k *util.Keyring) {
+	keyring = k
+}
+
+// SetSecretProviders 设置数据源外部密码来源，须在启动时、处理请求和调度任务之前调用
+func SetSecretProviders(p *SecretProviders) {
+	secretProviders = p
+}
+
+// EncryptPassword 加密要保存到 data_sources.db_password 的密码，未配置主密钥时原样返回
+func EncryptPassword(plain string) (string, error) {
+	if keyring == nil {
+		return plain, nil
+	}
+	return keyring.Encrypt(plain)
+}
+
+// DecryptPassword 解密 data_sources.db_password 中保存的密码，未加密的旧数据原样返回
+func DecryptPassword(value string) (string, error) {
+	if !util.IsEnveloped(value) {
+		return value, nil
+	}
+	if keyring == nil {
+		return "", errors.New("数据源密码已加密，但未配置主密钥")
+	}
+	return keyring.Decrypt(value)
+}
+
+// CheckPasswordRef 校验要保存的外部密码来源，空串表示使用数据库中保存的密码
+func CheckPasswordRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	return secretProviders.Check(ref)
+}
+
+// ResolvePassword 返回数据源的实际密码：配置了外部密码来源 ref 时从来源读取，否则解密 stored
+func ResolvePassword(stored, ref string) (string, error) {
+	if ref == "" {
+		return DecryptPassword(stored)
+	}
+	return secretProviders.Resolve(context.Background(), ref)
+}
@@ -0,0 +1,178 @@
+package datax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// 数据源的外部密码来源
+const (
+	SecretEnv   = "env"   // env:变量名
+	SecretFile  = "file"  // file:文件名，相对于配置的目录
+	SecretVault = "vault" // vault:路径#字段，字段缺省为 password
+)
+
+// SecretProvider 外部密钥来源，按来源内的名称读取密钥
+type SecretProvider interface {
+	Fetch(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviders 按密码来源的前缀选择外部密钥来源，读取到的值按 TTL 缓存，
+// 密钥在外部轮换后最迟在 TTL 到期时生效
+type SecretProviders struct {
+	providers map[string]SecretProvider
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+// cachedSecret 缓存的密钥及其过期时间
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// NewSecretProviders 创建空的密钥来源集合，ttl 不大于 0 时不缓存
+func NewSecretProviders(ttl time.Duration) *SecretProviders {
+	return &SecretProviders{
+		providers: make(map[string]SecretProvider),
+		ttl:       ttl,
+		now:       time.Now,
+		cache:     make(map[string]cachedSecret),
+	}
+}
+
+// SecretProvidersFromConfig 按配置创建密钥来源：环境变量来源始终启用，文件和 Vault 来源只在配置后启用
+func SecretProvidersFromConfig(cfg util.SecretProvidersConfig) (*SecretProviders, error) {
+	s := NewSecretProviders(time.Duration(cfg.CacheTTLSeconds) * time.Second)
+	s.Register(SecretEnv, &EnvSecretProvider{Prefix: cfg.EnvPrefix})
+	if cfg.FileDir != "" {
+		info, err := os.Stat(cfg.FileDir)
+		if err != nil {
+			return nil, fmt.Errorf("密钥目录不可用: %v", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("密钥目录 %s 不是目录", cfg.FileDir)
+		}
+		s.Register(SecretFile, &FileSecretProvider{Dir: cfg.FileDir})
+	}
+	if cfg.Vault.Address != "" {
+		vault, err := NewVaultSecretProvider(cfg.Vault)
+		if err != nil {
+			return nil, err
+		}
+		s.Register(SecretVault, vault)
+	}
+	return s, nil
+}
+
+// Register 注册密码来源前缀对应的密钥来源
+func (s *SecretProviders) Register(scheme string, p SecretProvider) {
+	s.providers[scheme] = p
+}
+
+// Check 校验密码来源的格式，并确认对应的密钥来源已启用，不读取密钥
+func (s *SecretProviders) Check(ref string) error {
+	scheme, _, err := ParseSecretRef(ref)
+	if err != nil {
+		return err
+	}
+	if s == nil || s.providers[scheme] == nil {
+		return fmt.Errorf("密钥来源 %s 未配置", scheme)
+	}
+	return nil
+}
+
+// Resolve 读取密码来源对应的密钥，缓存未过期时直接返回缓存的值
+func (s *SecretProviders) Resolve(ctx context.Context, ref string) (string, error) {
+	if err := s.Check(ref); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	cached, ok := s.cache[ref]
+	s.mu.Unlock()
+	if ok && s.now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	scheme, name, _ := ParseSecretRef(ref)
+	value, err := s.providers[scheme].Fetch(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("读取 %s 失败: %v", ref, err)
+	}
+	if s.ttl > 0 {
+		s.mu.Lock()
+		s.cache[ref] = cachedSecret{value: value, expires: s.now().Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return value, nil
+}
+
+// ParseSecretRef 将密码来源拆分为来源前缀和来源内的名称
+func ParseSecretRef(ref string) (string, string, error) {
+	scheme, name, ok := strings.Cut(strings.TrimSpace(ref), ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("密码来源 %q 格式应为 env:变量名、file:文件名 或 vault:路径#字段", ref)
+	}
+	switch scheme {
+	case SecretEnv, SecretFile, SecretVault:
+		return scheme, name, nil
+	}
+	return "", "", fmt.Errorf("不支持的密码来源 %s", scheme)
+}
+
+// EnvSecretProvider 从服务进程的环境变量读取密钥，只允许读取指定前缀的变量
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+// Fetch 读取环境变量，变量未设置时返回错误
+func (p *EnvSecretProvider) Fetch(_ context.Context, name string) (string, error) {
+	if !strings.HasPrefix(name, p.Prefix) {
+		return "", fmt.Errorf("只能读取以 %s 开头的环境变量", p.Prefix)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("环境变量 %s 未设置", name)
+	}
+	return value, nil
+}
+
+// FileSecretProvider 从目录中的文件读取密钥，如挂载为卷的 Kubernetes Secret，每个键对应一个文件
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Fetch 读取目录下的文件，去掉末尾换行；文件名不能跳出目录，解析符号链接后的文件也必须位于目录内
+func (p *FileSecretProvider) Fetch(_ context.Context, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", errors.New("文件名必须是密钥目录内的相对路径")
+	}
+	dir, err := filepath.EvalSymlinks(p.Dir)
+	if err != nil {
+		return "", err
+	}
+	// Kubernetes Secret 卷中的文件是指向目录内 ..data 的符号链接，允许目录内的链接，拒绝链接到目录外
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(dir, target); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("密钥文件 %s 指向密钥目录之外", name)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
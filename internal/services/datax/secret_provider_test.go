@@ -0,0 +1,166 @@
+package datax
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretProvidersCacheTTL(t *testing.T) {
+	f, srv := newFakeVault(t, "")
+	s := NewSecretProviders(time.Minute)
+	s.Register(SecretVault, newTestVault(t, srv, testVaultToken, ""))
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	ref := "vault:secret/data/mysql/prod"
+
+	resolve := func(want string, wantRequests int) {
+		t.Helper()
+		got, err := s.Resolve(ctx, ref)
+		if err != nil || got != want {
+			t.Fatalf("Resolve = %q, %v; want %q", got, err, want)
+		}
+		if n := f.requestCount(); n != wantRequests {
+			t.Fatalf("vault requests = %d, want %d", n, wantRequests)
+		}
+	}
+	resolve("v2-pass", 1)
+	// 轮换后的密钥在 TTL 内仍返回缓存的值
+	f.set("secret/data/mysql/prod", map[string]any{"data": map[string]any{"password": "rotated"}, "metadata": map[string]any{}})
+	now = now.Add(59 * time.Second)
+	resolve("v2-pass", 1)
+	now = now.Add(time.Second)
+	resolve("rotated", 2)
+}
+
+func TestSecretProvidersErrorsAreNotCached(t *testing.T) {
+	f, srv := newFakeVault(t, "")
+	s := NewSecretProviders(time.Minute)
+	s.Register(SecretVault, newTestVault(t, srv, testVaultToken, ""))
+	ctx := context.Background()
+
+	if _, err := s.Resolve(ctx, "vault:secret/data/mysql/new"); err == nil {
+		t.Fatal("Resolve succeeded for a missing path")
+	}
+	f.set("secret/data/mysql/new", map[string]any{"data": map[string]any{"password": "created"}, "metadata": map[string]any{}})
+	if got, err := s.Resolve(ctx, "vault:secret/data/mysql/new"); err != nil || got != "created" {
+		t.Fatalf("Resolve after the secret was created = %q, %v", got, err)
+	}
+}
+
+func TestSecretProvidersCheck(t *testing.T) {
+	s := NewSecretProviders(0)
+	s.Register(SecretEnv, &EnvSecretProvider{Prefix: "DATAX_"})
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{ref: "env:DATAX_PASS"},
+		{ref: " env:DATAX_PASS "},
+		{ref: "file:mysql", wantErr: true},
+		{ref: "ftp:mysql", wantErr: true},
+		{ref: "env:", wantErr: true},
+		{ref: "DATAX_PASS", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := s.Check(tt.ref); (err != nil) != tt.wantErr {
+			t.Errorf("Check(%q) err = %v, wantErr %v", tt.ref, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEnvSecretProviderPrefix(t *testing.T) {
+	t.Setenv("DATAX_ORDERS_PASSWORD", "env-pass")
+	t.Setenv("OTHER_PASSWORD", "secret")
+	p := &EnvSecretProvider{Prefix: "DATAX_"}
+	if got, err := p.Fetch(context.Background(), "DATAX_ORDERS_PASSWORD"); err != nil || got != "env-pass" {
+		t.Fatalf("Fetch = %q, %v", got, err)
+	}
+	if _, err := p.Fetch(context.Background(), "OTHER_PASSWORD"); err == nil {
+		t.Fatal("Fetch read a variable outside the prefix")
+	}
+	if _, err := p.Fetch(context.Background(), "DATAX_UNSET"); err == nil {
+		t.Fatal("Fetch succeeded for an unset variable")
+	}
+}
+
+func TestFileSecretProviderFetch(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "secrets")
+	writeFile(t, filepath.Join(dir, "orders-mysql"), "file-pass\r\n")
+	writeFile(t, filepath.Join(dir, "team", "warehouse"), "nested-pass\n")
+	writeFile(t, filepath.Join(root, "outside"), "leaked")
+	// Kubernetes Secret 卷的布局：键文件链接到 ..data，..data 链接到带时间戳的目录
+	writeFile(t, filepath.Join(dir, "..2026_01_01", "k8s-mysql"), "k8s-pass")
+	symlink(t, "..2026_01_01", filepath.Join(dir, "..data"))
+	symlink(t, filepath.Join("..data", "k8s-mysql"), filepath.Join(dir, "k8s-mysql"))
+	// 链接到目录外的文件和目录
+	symlink(t, filepath.Join(root, "outside"), filepath.Join(dir, "escape-abs"))
+	symlink(t, filepath.Join("..", "outside"), filepath.Join(dir, "escape-rel"))
+	symlink(t, root, filepath.Join(dir, "parent"))
+
+	p := &FileSecretProvider{Dir: dir}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "orders-mysql", want: "file-pass"},
+		{name: "team/warehouse", want: "nested-pass"},
+		{name: "k8s-mysql", want: "k8s-pass"},
+		{name: "missing", wantErr: true},
+		{name: "../outside", wantErr: true},
+		{name: filepath.Join(root, "outside"), wantErr: true},
+		{name: "escape-abs", wantErr: true},
+		{name: "escape-rel", wantErr: true},
+		{name: "parent/outside", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Fetch(context.Background(), tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("Fetch(%q) = %q, %v; want %q, wantErr %v", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileSecretProviderSymlinkedDir(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "real", "orders-mysql"), "file-pass")
+	symlink(t, filepath.Join(root, "real"), filepath.Join(root, "secrets"))
+
+	// 配置的目录本身是符号链接时，目录内的文件仍可读取
+	p := &FileSecretProvider{Dir: filepath.Join(root, "secrets")}
+	got, err := p.Fetch(context.Background(), "orders-mysql")
+	if err != nil || got != "file-pass" {
+		t.Fatalf("Fetch = %q, %v", got, err)
+	}
+	if _, err := (&FileSecretProvider{Dir: filepath.Join(root, "missing")}).Fetch(context.Background(), "orders-mysql"); err == nil {
+		t.Fatal("Fetch succeeded with a missing directory")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		if strings.Contains(err.Error(), "not supported") || strings.Contains(err.Error(), "privilege") {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+		t.Fatal(err)
+	}
+}
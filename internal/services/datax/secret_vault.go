@@ -0,0 +1,97 @@
+package datax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// VaultSecretProvider 通过 HashiCorp Vault 兼容的 HTTP 接口读取密钥，支持 KV v1 和 v2 引擎。
+// 名称为 路径#字段，路径即 /v1/ 之后的部分，如 secret/data/mysql/prod#password
+type VaultSecretProvider struct {
+	address   string
+	token     string
+	namespace string
+	// HTTPClient 访问 Vault 使用的客户端，测试时可指向本地模拟服务
+	HTTPClient *http.Client
+}
+
+// NewVaultSecretProvider 按配置创建 Vault 密钥来源
+func NewVaultSecretProvider(cfg util.VaultConfig) (*VaultSecretProvider, error) {
+	address := strings.TrimRight(cfg.Address, "/")
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		return nil, fmt.Errorf("Vault 地址 %q 应以 http:// 或 https:// 开头", cfg.Address)
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("Vault 密钥来源需要配置令牌")
+	}
+	return &VaultSecretProvider{
+		address:    address,
+		token:      cfg.Token,
+		namespace:  cfg.Namespace,
+		HTTPClient: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+	}, nil
+}
+
+// vaultResponse Vault 读取接口的响应，KV v2 的数据位于 data.data
+type vaultResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []string       `json:"errors"`
+}
+
+// Fetch 读取路径下的密钥字段，字段缺省为 password
+func (p *VaultSecretProvider) Fetch(ctx context.Context, name string) (string, error) {
+	path, field, _ := strings.Cut(name, "#")
+	path = strings.Trim(path, "/")
+	if field == "" {
+		field = "password"
+	}
+	if path == "" || strings.Contains(path, "..") {
+		return "", fmt.Errorf("Vault 路径 %q 无效", path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.address+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求 Vault 失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body vaultResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("解析 Vault 响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(body.Errors) > 0 {
+			return "", fmt.Errorf("Vault 返回 %d: %s", resp.StatusCode, strings.Join(body.Errors, "; "))
+		}
+		return "", fmt.Errorf("Vault 返回 %d", resp.StatusCode)
+	}
+
+	data := body.Data
+	// KV v2 在 data.data 中返回密钥，同时带有 data.metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, v2 := data["metadata"]; v2 {
+			data = nested
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault 路径 %s 中没有字符串字段 %s", path, field)
+	}
+	return value, nil
+}
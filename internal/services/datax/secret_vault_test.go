@@ -0,0 +1,165 @@
+package datax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+const testVaultToken = "s.test-token"
+
+// fakeVault 本地 Vault 服务，按路径返回预置的响应，并校验令牌和命名空间请求头
+type fakeVault struct {
+	namespace string
+	secrets   map[string]map[string]any
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != testVaultToken {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	if r.Header.Get("X-Vault-Namespace") != f.namespace {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"wrong namespace"}})
+		return
+	}
+	f.mu.Lock()
+	data, ok := f.secrets[strings.TrimPrefix(r.URL.Path, "/v1/")]
+	f.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+// set 写入路径下的响应数据
+func (f *fakeVault) set(path string, data map[string]any) {
+	f.mu.Lock()
+	f.secrets[path] = data
+	f.mu.Unlock()
+}
+
+func (f *fakeVault) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func newFakeVault(t *testing.T, namespace string) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	f := &fakeVault{
+		namespace: namespace,
+		secrets: map[string]map[string]any{
+			// KV v2
+			"secret/data/mysql/prod": {
+				"data":     map[string]any{"password": "v2-pass", "user": "datax", "port": 3306},
+				"metadata": map[string]any{"version": 3},
+			},
+			// KV v1，data 字段本身就是密钥
+			"kv/mysql/legacy": {"password": "v1-pass", "data": map[string]any{"password": "nested"}},
+		},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func newTestVault(t *testing.T, srv *httptest.Server, token, namespace string) *VaultSecretProvider {
+	t.Helper()
+	p, err := NewVaultSecretProvider(util.VaultConfig{Address: srv.URL + "/", Token: token, Namespace: namespace, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatalf("NewVaultSecretProvider: %v", err)
+	}
+	p.HTTPClient = srv.Client()
+	return p
+}
+
+func TestVaultFetch(t *testing.T) {
+	_, srv := newFakeVault(t, "")
+	p := newTestVault(t, srv, testVaultToken, "")
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{name: "kv v2 default field", ref: "secret/data/mysql/prod", want: "v2-pass"},
+		{name: "kv v2 named field", ref: "/secret/data/mysql/prod/#user", want: "datax"},
+		{name: "kv v1 keeps top level data", ref: "kv/mysql/legacy", want: "v1-pass"},
+		{name: "missing field", ref: "secret/data/mysql/prod#token", wantErr: "没有字符串字段 token"},
+		{name: "non-string field", ref: "secret/data/mysql/prod#port", wantErr: "没有字符串字段 port"},
+		{name: "missing path", ref: "secret/data/mysql/dev", wantErr: "Vault 返回 404"},
+		{name: "empty path", ref: "#password", wantErr: "无效"},
+		{name: "path traversal", ref: "secret/../sys/raw#password", wantErr: "无效"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Fetch(context.Background(), tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fetch(%q) = %q, %v; want error containing %q", tt.ref, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Fetch(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultTokenErrors(t *testing.T) {
+	_, srv := newFakeVault(t, "team-a")
+
+	_, err := newTestVault(t, srv, "s.revoked", "team-a").Fetch(context.Background(), "secret/data/mysql/prod")
+	if err == nil || !strings.Contains(err.Error(), "Vault 返回 403: permission denied") {
+		t.Fatalf("revoked token: err = %v", err)
+	}
+	_, err = newTestVault(t, srv, testVaultToken, "").Fetch(context.Background(), "secret/data/mysql/prod")
+	if err == nil || !strings.Contains(err.Error(), "wrong namespace") {
+		t.Fatalf("missing namespace: err = %v", err)
+	}
+	got, err := newTestVault(t, srv, testVaultToken, "team-a").Fetch(context.Background(), "secret/data/mysql/prod")
+	if err != nil || got != "v2-pass" {
+		t.Fatalf("namespaced read = %q, %v", got, err)
+	}
+}
+
+func TestNewVaultSecretProviderConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  util.VaultConfig
+	}{
+		{name: "missing scheme", cfg: util.VaultConfig{Address: "vault.example.com:8200", Token: testVaultToken}},
+		{name: "missing token", cfg: util.VaultConfig{Address: "https://vault.example.com:8200"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVaultSecretProvider(tt.cfg); err == nil {
+				t.Fatal("NewVaultSecretProvider accepted an invalid config")
+			}
+		})
+	}
+}
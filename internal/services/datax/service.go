@@ -54,3 +54,28 @@ func (s *Service) GenerateConfig(req ConfigRequest) ConfigResponse {
 		Message: "配置生成成功",
 	}
 }
+
+// GenerateBulk 验证批量请求并为每张匹配的表生成任务计划
+func (s *Service) GenerateBulk(req BulkRequest) ([]BulkTaskPlan, error) {
+	if err := s.validator.ValidateBulkRequest(req); err != nil {
+		return nil, err
+	}
+	return s.builder.BuildBulk(req)
+}
+
+// FormatJSON 将 DataX Job 格式化为保存用的 JSON 文本
+func (s *Service) FormatJSON(job map[string]any) (string, error) {
+	return s.builder.FormatJSON(job)
+}
+
+// BuildJSON 验证请求并生成保存用的 DataX JSON 文本
+func (s *Service) BuildJSON(req ConfigRequest) (string, error) {
+	if err := s.validator.ValidateConfigRequest(req); err != nil {
+		return "", err
+	}
+	job, err := s.builder.BuildConfig(req)
+	if err != nil {
+		return "", err
+	}
+	return s.builder.FormatJSON(job)
+}
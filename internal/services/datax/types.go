@@ -1,5 +1,7 @@
 package datax
 
+import "fmt"
+
 // DataX 支持的数据源类型
 type DataSourceType string
 
@@ -45,6 +47,24 @@ type ConfigRequest struct {
 	} `json:"out"`
 }
 
+// DataSourceIDs 返回请求引用的全部数据源ID
+func (r *ConfigRequest) DataSourceIDs() []int {
+	var ids []int
+	if r.Input.MySQL != nil {
+		ids = append(ids, r.Input.MySQL.SourceID)
+	}
+	if r.Input.FS != nil {
+		ids = append(ids, r.Input.FS.FSID)
+	}
+	if r.Output.MySQL != nil {
+		ids = append(ids, r.Output.MySQL.TargetID)
+	}
+	if r.Output.FS != nil {
+		ids = append(ids, r.Output.FS.FSID)
+	}
+	return ids
+}
+
 // MySQL 配置
 type MySQLConfig struct {
 	SourceID int    `json:"source_id"`
@@ -86,6 +106,11 @@ type MySQLConnection struct {
 	DB   string
 }
 
+// JdbcURL 返回 DataX mysqlreader/mysqlwriter 使用的 JDBC 连接串
+func (c *MySQLConnection) JdbcURL() string {
+	return fmt.Sprintf("jdbc:mysql://%s/%s?useUnicode=true&characterEncoding=utf8", c.Host, c.DB)
+}
+
 // 文件系统连接配置
 type FSConnection struct {
 	DefaultFS    string
@@ -108,3 +133,41 @@ type ConfigResponse struct {
 	Error   string                 `json:"error,omitempty"`
 	Message string                 `json:"message,omitempty"`
 }
+
+// 批量生成任务请求
+type BulkRequest struct {
+	ProjectID     int            `json:"project_id"`     // 任务和任务流所属项目ID
+	SourceID      int            `json:"source_id"`      // 源 MySQL 数据源ID
+	TableRegex    string         `json:"table_regex"`    // 表名正则（可选）
+	Include       []string       `json:"include"`        // 包含的表名列表（可选）
+	Exclude       []string       `json:"exclude"`        // 排除的表名列表（可选）
+	OutputType    DataSourceType `json:"outType"`        // 输出数据源类型
+	TargetID      int            `json:"target_id"`      // 目标数据源ID
+	PathTemplate  string         `json:"path_template"`  // 文件系统输出路径模板，支持 ${db}/${table} 与日期占位符
+	TableTemplate string         `json:"table_template"` // MySQL 输出表名模板，默认 ${table}
+	NameTemplate  string         `json:"name_template"`  // 任务名称模板，默认 sync_${db}_${table}
+	MySQLWhere    string         `json:"mysqlWhere"`     // 应用于每张表的 WHERE 条件
+	SpeedChannel  int            `json:"speedChannel"`   // 并发通道数
+	FileType      FileFormat     `json:"fileType"`
+	WriteMode     WriteMode      `json:"writeMode,omitempty"`
+	Delimiter     *string        `json:"fieldDelimiter,omitempty"`
+	Flow          *BulkFlow      `json:"flow,omitempty"` // 不为空时将所有任务放入新建的任务流
+}
+
+// 批量生成时新建的任务流
+type BulkFlow struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Cron        string `json:"cron"`
+}
+
+// 批量生成的单个任务计划
+type BulkTaskPlan struct {
+	Table    string         `json:"table"`
+	Name     string         `json:"name"`
+	SourceID int            `json:"source_id"`
+	TargetID int            `json:"target_id"`
+	Columns  int            `json:"columns"`
+	Job      map[string]any `json:"json,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
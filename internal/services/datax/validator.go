@@ -124,3 +124,50 @@ func IsValidationError(err error) (ValidationError, bool) {
 	}
 	return ValidationError{}, false
 }
+
+// ValidateBulkRequest 验证批量生成请求
+func (v *Validator) ValidateBulkRequest(req BulkRequest) error {
+	if req.SourceID == 0 {
+		return ValidationError{
+			Message:    "缺少源 MySQL 数据源",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if req.TargetID == 0 {
+		return ValidationError{
+			Message:    "缺少目标数据源",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	switch req.OutputType {
+	case DataSourceMySQL:
+	case DataSourceOFS, DataSourceHDFS, DataSourceCOSN:
+		if req.PathTemplate == "" {
+			return ValidationError{
+				Message:    "文件系统输出时路径模板不能为空",
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		if req.Delimiter == nil || *req.Delimiter == "" {
+			return ValidationError{
+				Message:    "文件系统输出时文本分隔符为必填项",
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+	default:
+		return ValidationError{
+			Message:    "未知输出类型",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	if req.Flow != nil && (req.Flow.Name == "" || req.Flow.Cron == "") {
+		return ValidationError{
+			Message:    "新建任务流时名称和 Cron 表达式不能为空",
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	return nil
+}
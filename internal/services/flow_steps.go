@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// 任务流步骤类型
+const (
+	StepTypeDataX = "datax"
+	StepTypeCheck = "check"
+	StepTypeSQL   = "sql"
+	StepTypeShell = "shell"
+)
+
+// runStep 按步骤类型分派执行，datax 步骤复用 RunTaskWithContext
+func (s *Scheduler) runStep(ctx context.Context, step models.TaskFlowStep, execID int, executionType string) (string, error) {
+	switch step.StepType {
+	case "", StepTypeDataX:
+		return s.RunTaskWithContext(ctx, step.TaskID, &execID, &step.ID, &step.StepOrder, executionType)
+	case StepTypeCheck:
+		return s.runCheckStep(ctx, step, execID, executionType)
+	case StepTypeSQL:
+		return s.runSQLStep(ctx, step, execID, executionType)
+	case StepTypeShell:
+		return s.runShellStep(ctx, step, execID, executionType)
+	default:
+		errorMsg := fmt.Sprintf("不支持的步骤类型: %s", step.StepType)
+		s.appendStepLog(step, execID, time.Now(), time.Now(), "failed", errorMsg, executionType)
+		return errorMsg, fmt.Errorf("unsupported step type %q", step.StepType)
+	}
+}
+
+// appendStepLog 为非 DataX 步骤写入任务日志，task_id 记为 NULL
+func (s *Scheduler) appendStepLog(step models.TaskFlowStep, execID int, start, end time.Time, status, text, executionType string) int64 {
+	return s.appendTaskLog(0, nil, start, end, status, text, &execID, &step.ID, &step.StepOrder, executionType)
+}
+
+// stepStatus 根据执行错误和上下文确定步骤的日志状态
+func stepStatus(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case ctx.Err() == context.Canceled:
+		return "killed"
+	default:
+		return "failed"
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services/datax"
+	"gopkg.in/yaml.v3"
+)
+
+// ManagedByGitOps 标记由 Git 目录同步管理的任务和任务流，这些对象在界面中只读
+const ManagedByGitOps = "gitops"
+
+// GitOpsDocument 为 Git 目录中的一个 YAML 文档，目录下所有文档合并后同步到数据库
+type GitOpsDocument struct {
+	// 数据源别名 -> 数据库中的数据源名称。数据源本身（含密钥）不在 Git 中维护，只能引用
+	DataSources map[string]string `yaml:"data_sources"`
+	Tasks       []GitOpsTask      `yaml:"tasks"`
+	Flows       []GitOpsFlow      `yaml:"flows"`
+}
+
+// GitOpsTask 任务定义。config 使用与界面生成配置相同的 ConfigRequest 字段，
+// json 为原始 DataX JSON，两者二选一；连接信息和密钥均按 source/target 数据源填充。
+type GitOpsTask struct {
+	Name               string         `yaml:"name"`
+	Source             string         `yaml:"source"`
+	Target             string         `yaml:"target"`
+	IncrColumn         string         `yaml:"incr_column"`
+	ReconcileEnabled   bool           `yaml:"reconcile_enabled"`
+	ReconcileTolerance int            `yaml:"reconcile_tolerance"`
+	Config             map[string]any `yaml:"config"`
+	JSON               string         `yaml:"json"`
+}
+
+// GitOpsFlow 任务流定义，enabled 缺省为启用
+type GitOpsFlow struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Cron        string       `yaml:"cron"`
+	Enabled     *bool        `yaml:"enabled"`
+	Steps       []GitOpsStep `yaml:"steps"`
+}
+
+// GitOpsStep 任务流步骤定义，type 缺省为 datax
+type GitOpsStep struct {
+	Type           string           `yaml:"type"`
+	Task           string           `yaml:"task"`
+	Name           string           `yaml:"name"`
+	DataSource     string           `yaml:"data_source"`
+	TimeoutMinutes *int             `yaml:"timeout_minutes"`
+	SQL            string           `yaml:"sql"`
+	Script         string           `yaml:"script"`
+	Assertions     []map[string]any `yaml:"assertions"`
+}
+
+// SyncGitOps 将 Git 目录中的定义同步到数据库：新建和更新受管对象，删除目录中已移除的受管对象。
+// dryRun 为 true 时只返回同步计划。allowShell 为 false 时含 Shell 步骤的任务流视为冲突，
+// 能向 Git 仓库提交的人不一定是管理员，需在配置中显式允许
+func SyncGitOps(db *sql.DB, dir string, dryRun, allowShell bool, userID int) (*ImportResult, error) {
+	doc, err := LoadGitOpsDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := doc.toBundle(db)
+	if err != nil {
+		return nil, err
+	}
+	return ImportBundle(db, bundle, ImportOptions{
+		Overwrite:  true,
+		DryRun:     dryRun,
+		ManagedBy:  ManagedByGitOps,
+		Prune:      true,
+		AllowShell: allowShell,
+	}, userID)
+}
+
+// SyncGitOpsOnStartup 在启动时同步 Git 目录，失败只记录日志，不影响服务启动
+func SyncGitOpsOnStartup(db *sql.DB, dir string, allowShell bool) {
+	result, err := SyncGitOps(db, dir, false, allowShell, 0)
+	if err != nil {
+		log.Printf("gitops: startup sync of %s failed: %v", dir, err)
+		return
+	}
+	if !result.Applied {
+		for _, item := range result.Items {
+			if item.Action == ImportConflict {
+				log.Printf("gitops: conflict on %s %s: %s", item.Kind, item.Name, item.Message)
+			}
+		}
+		log.Printf("gitops: startup sync of %s skipped because of conflicts", dir)
+		return
+	}
+	log.Printf("gitops: synced %s (create %d, update %d, delete %d, unchanged %d)", dir,
+		result.Count(ImportCreate), result.Count(ImportUpdate), result.Count(ImportDelete), result.Count(ImportUnchanged))
+}
+
+// LoadGitOpsDir 递归读取目录下的 .yaml/.yml 文件（忽略以 . 开头的目录和文件），
+// 每个文件可包含多个以 --- 分隔的文档
+func LoadGitOpsDir(dir string) (*GitOpsDocument, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取同步目录失败: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", dir)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取同步目录失败: %v", err)
+	}
+	// 目录为空时同步会删除全部受管对象，通常是配置错误
+	if len(files) == 0 {
+		return nil, fmt.Errorf("同步目录 %s 中没有 YAML 定义文件", dir)
+	}
+	sort.Strings(files)
+
+	merged := &GitOpsDocument{DataSources: map[string]string{}}
+	for _, path := range files {
+		if err := loadGitOpsFile(path, merged); err != nil {
+			rel, _ := filepath.Rel(dir, path)
+			return nil, fmt.Errorf("%s: %v", rel, err)
+		}
+	}
+	return merged, nil
+}
+
+func loadGitOpsFile(path string, merged *GitOpsDocument) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	for {
+		var doc GitOpsDocument
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for alias, name := range doc.DataSources {
+			if existing, ok := merged.DataSources[alias]; ok && existing != name {
+				return fmt.Errorf("数据源别名 %s 重复定义为 %s 和 %s", alias, existing, name)
+			}
+			merged.DataSources[alias] = name
+		}
+		merged.Tasks = append(merged.Tasks, doc.Tasks...)
+		merged.Flows = append(merged.Flows, doc.Flows...)
+	}
+}
+
+// dataSourceName 将别名解析为数据库中的数据源名称，未定义别名时按名称直接引用
+func (d *GitOpsDocument) dataSourceName(ref string) string {
+	if name, ok := d.DataSources[ref]; ok {
+		return name
+	}
+	return ref
+}
+
+// toBundle 将 Git 目录中的定义转换为导入包，复用导入的映射、冲突检测和写入逻辑
+func (d *GitOpsDocument) toBundle(db *sql.DB) (*Bundle, error) {
+	b := &Bundle{Version: BundleVersion, Secrets: BundleSecretsRedacted}
+	for _, t := range d.Tasks {
+		task, err := d.toBundleTask(db, t)
+		if err != nil {
+			return nil, fmt.Errorf("任务 %s: %v", t.Name, err)
+		}
+		b.Tasks = append(b.Tasks, *task)
+	}
+	for _, f := range d.Flows {
+		flow, err := d.toBundleFlow(f)
+		if err != nil {
+			return nil, fmt.Errorf("任务流 %s: %v", f.Name, err)
+		}
+		b.Flows = append(b.Flows, *flow)
+	}
+	return b, nil
+}
+
+func (d *GitOpsDocument) toBundleTask(db *sql.DB, t GitOpsTask) (*BundleTask, error) {
+	if strings.TrimSpace(t.Name) == "" {
+		return nil, errors.New("缺少 name")
+	}
+	if t.Source == "" || t.Target == "" {
+		return nil, errors.New("缺少 source 或 target 数据源")
+	}
+	task := &BundleTask{
+		Name:               t.Name,
+		Source:             d.dataSourceName(t.Source),
+		Target:             d.dataSourceName(t.Target),
+		IncrColumn:         t.IncrColumn,
+		ReconcileEnabled:   t.ReconcileEnabled,
+		ReconcileTolerance: t.ReconcileTolerance,
+	}
+
+	switch {
+	case t.JSON != "" && t.Config != nil:
+		return nil, errors.New("config 和 json 只能指定一个")
+	case t.JSON != "":
+		if _, err := decodeJobConfig(t.JSON); err != nil {
+			return nil, err
+		}
+		task.JsonConfig = t.JSON
+	case t.Config != nil:
+		config, err := buildGitOpsConfig(db, t.Config, task.Source, task.Target)
+		if err != nil {
+			return nil, err
+		}
+		task.JsonConfig = config
+	default:
+		return nil, errors.New("缺少 config 或 json")
+	}
+	return task, nil
+}
+
+// buildGitOpsConfig 按 ConfigRequest 字段生成 DataX JSON，数据源ID由 source/target 名称填充
+func buildGitOpsConfig(db *sql.DB, fields map[string]any, source, target string) (string, error) {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("config 格式不正确: %v", err)
+	}
+	var req datax.ConfigRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return "", fmt.Errorf("config 格式不正确: %v", err)
+	}
+
+	sourceID, sourceType, err := lookupDataSource(db, source)
+	if err != nil {
+		return "", err
+	}
+	targetID, targetType, err := lookupDataSource(db, target)
+	if err != nil {
+		return "", err
+	}
+	if req.InputType == "" {
+		req.InputType = datax.DataSourceType(sourceType)
+	}
+	if req.OutputType == "" {
+		req.OutputType = datax.DataSourceType(targetType)
+	}
+	if req.Input.MySQL != nil {
+		req.Input.MySQL.SourceID = sourceID
+	}
+	if req.Input.FS != nil {
+		req.Input.FS.FSID = sourceID
+	}
+	if req.Output.MySQL != nil {
+		req.Output.MySQL.TargetID = targetID
+	}
+	if req.Output.FS != nil {
+		req.Output.FS.FSID = targetID
+	}
+
+	return datax.NewService(db).BuildJSON(req)
+}
+
+// lookupDataSource 按名称查找唯一的数据源
+func lookupDataSource(db *sql.DB, name string) (int, string, error) {
+	rows, err := db.Query("SELECT id, type FROM data_sources WHERE name=?", name)
+	if err != nil {
+		return 0, "", fmt.Errorf("查询数据源失败: %v", err)
+	}
+	defer rows.Close()
+	var id, n int
+	var typ string
+	for rows.Next() {
+		n++
+		if err := rows.Scan(&id, &typ); err != nil {
+			return 0, "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+	switch n {
+	case 0:
+		return 0, "", fmt.Errorf("数据源 %s 不存在", name)
+	case 1:
+		return id, typ, nil
+	default:
+		return 0, "", fmt.Errorf("存在多个名为 %s 的数据源", name)
+	}
+}
+
+func (d *GitOpsDocument) toBundleFlow(f GitOpsFlow) (*BundleFlow, error) {
+	if strings.TrimSpace(f.Name) == "" {
+		return nil, errors.New("缺少 name")
+	}
+	flow := &BundleFlow{
+		Name:        f.Name,
+		Description: f.Description,
+		CronExpr:    f.Cron,
+		Enabled:     f.Enabled == nil || *f.Enabled,
+		Steps:       []BundleStep{},
+	}
+
+	for i, s := range f.Steps {
+		step, err := d.toBundleStep(s)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 步: %v", i+1, err)
+		}
+		flow.Steps = append(flow.Steps, *step)
+	}
+	return flow, nil
+}
+
+// toBundleStep 校验步骤定义并转换为导入包步骤，校验规则与界面添加步骤一致
+func (d *GitOpsDocument) toBundleStep(s GitOpsStep) (*BundleStep, error) {
+	if s.Type == "" {
+		s.Type = StepTypeDataX
+	}
+	step := &BundleStep{Type: s.Type, TimeoutMinutes: s.TimeoutMinutes}
+	if s.Type == StepTypeDataX {
+		if s.Task == "" {
+			return nil, errors.New("datax 步骤缺少 task")
+		}
+		step.Task = s.Task
+		return step, nil
+	}
+
+	if strings.TrimSpace(s.Name) == "" {
+		return nil, errors.New("步骤名称不能为空")
+	}
+	step.Name = strings.TrimSpace(s.Name)
+
+	// 数据源在导入时按名称映射，这里用占位ID完成格式校验
+	const placeholderID = 1
+	var config string
+	var err error
+	switch s.Type {
+	case StepTypeCheck:
+		var assertions []byte
+		if assertions, err = json.Marshal(s.Assertions); err != nil {
+			return nil, fmt.Errorf("断言列表格式不正确: %v", err)
+		}
+		config, err = NewCheckConfig(placeholderID, string(assertions))
+	case StepTypeSQL:
+		config, err = NewSQLStepConfig(placeholderID, s.SQL)
+	case StepTypeShell:
+		config, err = NewShellStepConfig(s.Script)
+	default:
+		return nil, fmt.Errorf("不支持的步骤类型 %s", s.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(config), &step.Config); err != nil {
+		return nil, err
+	}
+	if s.Type != StepTypeShell {
+		if s.DataSource == "" {
+			return nil, errors.New("缺少 data_source")
+		}
+		step.DataSource = d.dataSourceName(s.DataSource)
+		delete(step.Config, "data_source_id")
+	}
+	return step, nil
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+// identifierPattern 限制增量列只能是普通标识符，避免拼接 SQL 时注入
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// numericTypes 为按数值比较（不加引号）的 MySQL 列类型
+var numericTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true, "integer": true, "bigint": true,
+	"decimal": true, "numeric": true, "float": true, "double": true,
+}
+
+// temporalTypes 为按日期时间比较的 MySQL 列类型，手动设置水位时须符合 temporalLayouts 之一
+var temporalTypes = map[string]bool{
+	"date": true, "datetime": true, "timestamp": true, "time": true, "year": true,
+}
+
+// temporalLayouts 手动设置日期时间水位时接受的格式
+var temporalLayouts = []string{
+	"2006-01-02 15:04:05.999999", "2006-01-02 15:04:05", "2006-01-02", "15:04:05", "2006",
+}
+
+// incrementalWindow 表示一次增量执行的同步区间 (last, current]
+type incrementalWindow struct {
+	column  string
+	last    *string
+	current *string
+	numeric bool
+}
+
+// condition 返回注入到 reader where 中的区间条件
+func (w *incrementalWindow) condition() string {
+	col := "`" + w.column + "`"
+	if w.current == nil {
+		// 源表没有数据，本次不同步任何行
+		return "1=0"
+	}
+	upper := fmt.Sprintf("%s <= %s", col, w.literal(*w.current))
+	if w.last == nil {
+		return upper
+	}
+	return fmt.Sprintf("%s > %s AND %s", col, w.literal(*w.last), upper)
+}
+
+// literal 按列类型格式化比较值。只有能解析为数字的值才不加引号，其余一律作为字符串转义
+func (w *incrementalWindow) literal(v string) string {
+	if w.numeric && isNumber(v) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(v) + "'"
+}
+
+// isNumber 判断值是否为整数或浮点数
+func isNumber(v string) bool {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+// checkWatermarkValue 按增量列的类型校验手动设置的水位
+func checkWatermarkValue(dataType, value string) error {
+	dataType = strings.ToLower(dataType)
+	switch {
+	case numericTypes[dataType]:
+		if !isNumber(value) {
+			return fmt.Errorf("增量列类型为 %s，水位必须是数字", dataType)
+		}
+	case temporalTypes[dataType]:
+		for _, layout := range temporalLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("增量列类型为 %s，水位格式应为 YYYY-MM-DD 或 YYYY-MM-DD HH:MM:SS", dataType)
+	}
+	return nil
+}
+
+// splitTable 将 mysqlreader 的表名拆分为库名和表名，未指定库名时使用 defaultSchema
+func splitTable(table, defaultSchema string) (string, string) {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return strings.Trim(schema, "`"), strings.Trim(name, "`")
+	}
+	return defaultSchema, strings.Trim(table, "`")
+}
+
+// quoteTable 按库名、表名分别加反引号，名称中的反引号转义为两个
+func quoteTable(table string) string {
+	var parts []string
+	for _, part := range strings.Split(table, ".") {
+		part = strings.Trim(part, "`")
+		parts = append(parts, "`"+strings.ReplaceAll(part, "`", "``")+"`")
+	}
+	return strings.Join(parts, ".")
+}
+
+// columnDataType 查询列在源库中的数据类型
+func columnDataType(src *sql.DB, defaultSchema, table, column string) (string, error) {
+	schema, name := splitTable(table, defaultSchema)
+	var dataType string
+	err := src.QueryRow(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema=? AND table_name=? AND column_name=?`, schema, name, column).Scan(&dataType)
+	if err != nil {
+		return "", fmt.Errorf("增量列 %s 在表 %s 中不存在: %v", column, table, err)
+	}
+	return dataType, nil
+}
+
+// ValidateIncrColumn 校验增量列名
+func ValidateIncrColumn(column string) error {
+	if column != "" && !identifierPattern.MatchString(column) {
+		return fmt.Errorf("增量列名无效: %s", column)
+	}
+	return nil
+}
+
+// applyIncremental 为配置了增量列的任务计算同步区间并注入 mysqlreader 的 where。
+// 未配置增量列时原样返回配置和 nil 区间。
+func (s *Scheduler) applyIncremental(taskID, sourceID int, config string) (string, *incrementalWindow, error) {
+	var column string
+	if err := s.db.QueryRow("SELECT COALESCE(incr_column,'') FROM tasks WHERE id=?", taskID).Scan(&column); err != nil {
+		return config, nil, fmt.Errorf("查询增量配置失败: %v", err)
+	}
+	if column == "" {
+		return config, nil, nil
+	}
+	if err := ValidateIncrColumn(column); err != nil {
+		return config, nil, err
+	}
+
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return config, nil, err
+	}
+	param, err := mysqlReaderParameter(job)
+	if err != nil {
+		return config, nil, err
+	}
+	table, err := readerTable(param)
+	if err != nil {
+		return config, nil, err
+	}
+	baseWhere, _ := param["where"].(string)
+
+	conn, err := datax.GetMySQLConnection(s.db, sourceID)
+	if err != nil {
+		return config, nil, err
+	}
+	src, err := datax.OpenMySQL(conn)
+	if err != nil {
+		return config, nil, err
+	}
+	defer src.Close()
+
+	window := &incrementalWindow{column: column}
+
+	dataType, err := columnDataType(src, conn.DB, table, column)
+	if err != nil {
+		return config, nil, err
+	}
+	window.numeric = numericTypes[strings.ToLower(dataType)]
+
+	maxQuery := fmt.Sprintf("SELECT CAST(MAX(`%s`) AS CHAR) FROM %s", column, quoteTable(table))
+	if strings.TrimSpace(baseWhere) != "" {
+		maxQuery += " WHERE " + baseWhere
+	}
+	var current sql.NullString
+	if err := src.QueryRow(maxQuery).Scan(&current); err != nil {
+		return config, nil, fmt.Errorf("查询增量列最大值失败: %v", err)
+	}
+	if current.Valid {
+		window.current = &current.String
+	}
+
+	var last string
+	var lastColumn string
+	err = s.db.QueryRow("SELECT incr_column, watermark FROM task_watermarks WHERE task_id=?", taskID).Scan(&lastColumn, &last)
+	switch {
+	case err == nil && lastColumn == column:
+		window.last = &last
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return config, nil, fmt.Errorf("查询增量水位失败: %v", err)
+	}
+
+	cond := window.condition()
+	if strings.TrimSpace(baseWhere) != "" {
+		param["where"] = fmt.Sprintf("(%s) AND %s", baseWhere, cond)
+	} else {
+		param["where"] = cond
+	}
+
+	out, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return config, nil, fmt.Errorf("序列化配置失败: %v", err)
+	}
+	return string(out), window, nil
+}
+
+// advanceWatermark 在任务成功后把水位推进到本次同步区间的上界
+func (s *Scheduler) advanceWatermark(taskID int, window *incrementalWindow) {
+	if window == nil || window.current == nil {
+		return
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO task_watermarks (task_id, incr_column, watermark, updated_by)
+		VALUES (?, ?, ?, NULL)
+		ON DUPLICATE KEY UPDATE incr_column=VALUES(incr_column), watermark=VALUES(watermark), updated_by=NULL
+	`, taskID, window.column, *window.current)
+	if err != nil {
+		log.Printf("scheduler: failed to advance watermark for task %d: %v", taskID, err)
+	}
+}
+
+// GetTaskWatermark 查询任务当前的增量水位，没有水位时返回 nil
+func GetTaskWatermark(db *sql.DB, taskID int) (*models.TaskWatermark, error) {
+	var w models.TaskWatermark
+	err := db.QueryRow(`
+		SELECT w.task_id, w.incr_column, w.watermark, u.username, w.updated_at
+		FROM task_watermarks w
+		LEFT JOIN users u ON w.updated_by = u.id
+		WHERE w.task_id=?`, taskID).
+		Scan(&w.TaskID, &w.IncrColumn, &w.Watermark, &w.UpdatedByName, &w.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// ResetTaskWatermark 手动设置任务水位；value 为空时删除水位，下次执行将从头全量同步。
+// 水位须符合增量列在源表中的类型（数字或日期时间）
+func ResetTaskWatermark(db *sql.DB, taskID int, value string, userID int) error {
+	if value == "" {
+		_, err := db.Exec("DELETE FROM task_watermarks WHERE task_id=?", taskID)
+		return err
+	}
+
+	var column, config string
+	var sourceID int
+	err := db.QueryRow("SELECT COALESCE(incr_column,''), source_id, COALESCE(json_config,'') FROM tasks WHERE id=?", taskID).
+		Scan(&column, &sourceID, &config)
+	if err != nil {
+		return err
+	}
+	if column == "" {
+		return errors.New("任务未配置增量列")
+	}
+	if err := ValidateIncrColumn(column); err != nil {
+		return err
+	}
+	dataType, err := sourceColumnType(db, sourceID, config, column)
+	if err != nil {
+		return err
+	}
+	if err := checkWatermarkValue(dataType, value); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO task_watermarks (task_id, incr_column, watermark, updated_by)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE incr_column=VALUES(incr_column), watermark=VALUES(watermark), updated_by=VALUES(updated_by)
+	`, taskID, column, value, userID)
+	return err
+}
+
+// sourceColumnType 按任务配置中 mysqlreader 的第一张表查询增量列在源库中的数据类型
+func sourceColumnType(db *sql.DB, sourceID int, config, column string) (string, error) {
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return "", err
+	}
+	param, err := mysqlReaderParameter(job)
+	if err != nil {
+		return "", err
+	}
+	table, err := readerTable(param)
+	if err != nil {
+		return "", err
+	}
+	conn, err := datax.GetMySQLConnection(db, sourceID)
+	if err != nil {
+		return "", err
+	}
+	src, err := datax.OpenMySQL(conn)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return columnDataType(src, conn.DB, table, column)
+}
+
+// decodeJobConfig 解析 DataX JSON，保留数字原样以便重新序列化
+func decodeJobConfig(config string) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(config)))
+	dec.UseNumber()
+	var job map[string]any
+	if err := dec.Decode(&job); err != nil {
+		return nil, fmt.Errorf("解析JSON配置失败: %v", err)
+	}
+	return job, nil
+}
+
+// jobContentPart 返回 job.content 第一项中的 reader 或 writer
+func jobContentPart(job map[string]any, part string) (map[string]any, bool) {
+	j, ok := job["job"].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	content, ok := j["content"].([]any)
+	if !ok || len(content) == 0 {
+		return nil, false
+	}
+	item, ok := content[0].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	p, ok := item[part].(map[string]any)
+	return p, ok
+}
+
+// mysqlReaderParameter 返回 mysqlreader 的 parameter 节点
+func mysqlReaderParameter(job map[string]any) (map[string]any, error) {
+	reader, ok := jobContentPart(job, "reader")
+	if !ok || reader["name"] != "mysqlreader" {
+		return nil, errors.New("增量同步仅支持 mysqlreader")
+	}
+	param, ok := reader["parameter"].(map[string]any)
+	if !ok {
+		return nil, errors.New("mysqlreader 缺少 parameter")
+	}
+	return param, nil
+}
+
+// readerTable 返回 mysqlreader 的第一张表
+func readerTable(param map[string]any) (string, error) {
+	conns, ok := param["connection"].([]any)
+	if !ok || len(conns) == 0 {
+		return "", errors.New("mysqlreader 缺少 connection")
+	}
+	conn, ok := conns[0].(map[string]any)
+	if !ok {
+		return "", errors.New("mysqlreader connection 格式不正确")
+	}
+	tables, ok := conn["table"].([]any)
+	if !ok || len(tables) == 0 {
+		return "", errors.New("mysqlreader 缺少 table")
+	}
+	table, ok := tables[0].(string)
+	if !ok || table == "" {
+		return "", errors.New("mysqlreader table 格式不正确")
+	}
+	return table, nil
+}
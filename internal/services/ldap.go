@@ -0,0 +1,180 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// LDAPConn 是认证所需的 LDAP 连接操作，*ldap.Conn 实现了该接口。
+// 测试时可通过 LDAPAuthenticator.Dial 替换为进程内的模拟目录。
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator 通过 LDAP / Active Directory 认证用户：先用服务账号查找用户条目，
+// 再以用户 DN 和密码绑定校验密码，并按所属组映射角色
+type LDAPAuthenticator struct {
+	cfg  util.LDAPConfig
+	Dial func() (LDAPConn, error)
+}
+
+// NewLDAPAuthenticator 创建 LDAP 认证器，检查必填配置和角色映射
+func NewLDAPAuthenticator(cfg util.LDAPConfig) (*LDAPAuthenticator, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("LDAP 认证需要配置 url 和 base_dn")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("LDAP user_filter 必须包含 %%s: %s", cfg.UserFilter)
+	}
+	if cfg.GroupBaseDN != "" && !strings.Contains(cfg.GroupFilter, "%s") {
+		return nil, fmt.Errorf("配置了 group_base_dn 时 LDAP group_filter 必须包含 %%s: %s", cfg.GroupFilter)
+	}
+	for group, role := range cfg.GroupRoles {
+		if role != "admin" && role != "user" {
+			return nil, fmt.Errorf("LDAP 组 %s 映射的角色无效: %s", group, role)
+		}
+	}
+	if cfg.DefaultRole != "admin" && cfg.DefaultRole != "user" && cfg.DefaultRole != "none" {
+		return nil, fmt.Errorf("LDAP default_role 无效: %s", cfg.DefaultRole)
+	}
+	a := &LDAPAuthenticator{cfg: cfg}
+	a.Dial = a.dial
+	return a, nil
+}
+
+// dial 连接 LDAP 服务器，按配置启用 StartTLS
+func (a *LDAPAuthenticator) dial() (LDAPConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Name 返回认证方式名称
+func (a *LDAPAuthenticator) Name() string { return AuthSourceLDAP }
+
+// Authenticate 在目录中查找用户并校验密码。目录中不存在的用户返回 ErrUnknownUser
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	// 空密码在多数目录中会被当作匿名绑定而成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := a.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 失败: %w", err)
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+		}
+	}
+
+	// 1.1 表示不返回任何属性，只需要条目的 DN
+	attrs := []string{"1.1"}
+	if a.cfg.GroupAttribute != "" {
+		attrs = []string{a.cfg.GroupAttribute}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout/time.Second), false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)), attrs, nil))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 查找用户失败: %w", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		return nil, fmt.Errorf("LDAP 中存在多个匹配用户 %s 的条目", username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP 用户绑定失败: %w", err)
+	}
+
+	groups := entry.GetAttributeValues(a.cfg.GroupAttribute)
+	if a.cfg.GroupBaseDN != "" {
+		// 用户绑定后重新以服务账号查找组，避免用户本身没有读取组的权限
+		if a.cfg.BindDN != "" {
+			if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+			}
+		}
+		found, err := conn.Search(ldap.NewSearchRequest(a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(ldapTimeout/time.Second), false,
+			fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)), []string{"1.1"}, nil))
+		if err != nil {
+			return nil, fmt.Errorf("LDAP 查找用户组失败: %w", err)
+		}
+		for _, g := range found.Entries {
+			groups = append(groups, g.DN)
+		}
+	}
+
+	role := a.groupRole(groups)
+	if role == "none" {
+		log.Printf("auth: ldap user %s is not in any mapped group", username)
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Username: username, Role: role, Source: AuthSourceLDAP}, nil
+}
+
+// groupRole 按组映射计算角色，同时属于多个组时取 admin，未匹配任何组时使用默认角色。
+// 组 DN 比较忽略大小写和空格差异
+func (a *LDAPAuthenticator) groupRole(groups []string) string {
+	role := ""
+	for mapped, r := range a.cfg.GroupRoles {
+		for _, g := range groups {
+			if !sameDN(mapped, g) {
+				continue
+			}
+			if r == "admin" {
+				return r
+			}
+			role = r
+		}
+	}
+	if role == "" {
+		return a.cfg.DefaultRole
+	}
+	return role
+}
+
+// sameDN 判断两个 DN 是否相同
+func sameDN(a, b string) bool {
+	dnA, errA := ldap.ParseDN(a)
+	dnB, errB := ldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return dnA.EqualFold(dnB)
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"com.duole/datax-web-go/internal/util"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBindDN       = "cn=datax-web,ou=services,dc=example,dc=com"
+	testBindPassword = "service-secret"
+	testAdminGroup   = "cn=datax-admins,ou=groups,dc=example,dc=com"
+	testUserGroup    = "cn=data-eng,ou=groups,dc=example,dc=com"
+)
+
+// fakeLDAPEntry 模拟目录中的条目
+type fakeLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeDirectory 进程内的 LDAP 目录，只支持简单绑定和单个相等条件的过滤器，记录收到的请求
+type fakeDirectory struct {
+	entries  []fakeLDAPEntry
+	boundDN  string
+	filters  []string
+	dialErr  error
+	searches int
+}
+
+func (d *fakeDirectory) Dial() (LDAPConn, error) {
+	if d.dialErr != nil {
+		return nil, d.dialErr
+	}
+	d.boundDN = ""
+	return d, nil
+}
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if dn == testBindDN && password == testBindPassword {
+		d.boundDN = dn
+		return nil
+	}
+	for _, e := range d.entries {
+		if e.dn == dn && e.password != "" && e.password == password {
+			d.boundDN = dn
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches++
+	d.filters = append(d.filters, req.Filter)
+	if d.boundDN != testBindDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("search requires the service account"))
+	}
+	// 按真实客户端的方式解析过滤器，未转义的特殊字符会改变过滤器结构或解析失败
+	packet, err := ldap.CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if packet.Tag != ldap.FilterEqualityMatch {
+		return nil, fmt.Errorf("unsupported filter %s", req.Filter)
+	}
+	attr, value := packet.Children[0].Data.String(), packet.Children[1].Data.String()
+
+	result := &ldap.SearchResult{}
+	for _, e := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), strings.ToLower(req.BaseDN)) {
+			continue
+		}
+		for _, v := range e.attrs[attr] {
+			if strings.EqualFold(v, value) {
+				result.Entries = append(result.Entries, ldap.NewEntry(e.dn, e.attrs))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error { return nil }
+
+// testLDAPConfig 返回与 LoadConfigFromYaml 默认值一致的配置
+func testLDAPConfig() util.LDAPConfig {
+	return util.LDAPConfig{
+		URL:            "ldap://ldap.example.com",
+		BindDN:         testBindDN,
+		BindPassword:   testBindPassword,
+		BaseDN:         "ou=people,dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		GroupFilter:    "(member=%s)",
+		GroupRoles: map[string]string{
+			testAdminGroup: "admin",
+			testUserGroup:  "user",
+		},
+		DefaultRole: "user",
+	}
+}
+
+// testDirectory 返回包含几个用户和组的目录
+func testDirectory() *fakeDirectory {
+	person := func(uid, password string, groups ...string) fakeLDAPEntry {
+		return fakeLDAPEntry{
+			dn:       "uid=" + uid + ",ou=people,dc=example,dc=com",
+			password: password,
+			attrs:    map[string][]string{"uid": {uid}, "memberOf": groups},
+		}
+	}
+	group := func(dn string, members ...string) fakeLDAPEntry {
+		return fakeLDAPEntry{dn: dn, attrs: map[string][]string{"member": members}}
+	}
+	return &fakeDirectory{entries: []fakeLDAPEntry{
+		person("alice", "alice-pw", testAdminGroup),
+		person("bob", "bob-pw", testUserGroup),
+		// 组 DN 的大小写和空格与映射配置不同
+		person("carol", "carol-pw", "CN=Data-Eng, OU=Groups, DC=example, DC=com", testAdminGroup),
+		person("dave", "dave-pw"),
+		person("a*)(uid=*", "star-pw"),
+		group(testAdminGroup, "uid=erin,ou=people,dc=example,dc=com"),
+		person("erin", "erin-pw"),
+	}}
+}
+
+func newTestLDAP(t *testing.T, cfg util.LDAPConfig, dir *fakeDirectory) *LDAPAuthenticator {
+	t.Helper()
+	a, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator: %v", err)
+	}
+	a.Dial = dir.Dial
+	return a
+}
+
+func TestLDAPAuthenticateBind(t *testing.T) {
+	tests := []struct {
+		name, username, password string
+		wantRole                 string
+		wantErr                  error
+	}{
+		{name: "success", username: "bob", password: "bob-pw", wantRole: "user"},
+		{name: "wrong password", username: "bob", password: "alice-pw", wantErr: ErrInvalidCredentials},
+		{name: "empty password", username: "bob", password: "", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "mallory", password: "x", wantErr: ErrUnknownUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestLDAP(t, testLDAPConfig(), testDirectory())
+			identity, err := a.Authenticate(tt.username, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if identity.Username != tt.username || identity.Role != tt.wantRole || identity.Source != AuthSourceLDAP {
+				t.Fatalf("identity = %+v, want %s/%s/%s", identity, tt.username, tt.wantRole, AuthSourceLDAP)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticateEmptyPasswordDoesNotBind(t *testing.T) {
+	dir := testDirectory()
+	a := newTestLDAP(t, testLDAPConfig(), dir)
+	if _, err := a.Authenticate("bob", ""); err != ErrInvalidCredentials {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if dir.searches != 0 {
+		t.Fatalf("empty password must be rejected before contacting the directory, got %d searches", dir.searches)
+	}
+}
+
+func TestLDAPAuthenticateServiceBindFailure(t *testing.T) {
+	cfg := testLDAPConfig()
+	cfg.BindPassword = "wrong"
+	a := newTestLDAP(t, cfg, testDirectory())
+	_, err := a.Authenticate("bob", "bob-pw")
+	if err == nil || err == ErrInvalidCredentials || err == ErrUnknownUser {
+		t.Fatalf("err = %v, want a service bind error", err)
+	}
+}
+
+func TestLDAPFilterEscaping(t *testing.T) {
+	dir := testDirectory()
+	a := newTestLDAP(t, testLDAPConfig(), dir)
+
+	// 用户名中的过滤器特殊字符必须转义，否则 *)(uid=* 会匹配所有用户
+	identity, err := a.Authenticate("a*)(uid=*", "star-pw")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if identity.Username != "a*)(uid=*" {
+		t.Fatalf("username = %q", identity.Username)
+	}
+	want := `(uid=a\2a\29\28uid=\2a)`
+	if len(dir.filters) == 0 || dir.filters[0] != want {
+		t.Fatalf("filters = %q, want first %q", dir.filters, want)
+	}
+
+	if _, err := a.Authenticate("*", "alice-pw"); err != ErrUnknownUser {
+		t.Fatalf("wildcard username: err = %v, want %v", err, ErrUnknownUser)
+	}
+}
+
+func TestLDAPGroupRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		cfg      func(*util.LDAPConfig)
+		wantRole string
+		wantErr  error
+	}{
+		{name: "admin group", username: "alice", password: "alice-pw", wantRole: "admin"},
+		{name: "user group", username: "bob", password: "bob-pw", wantRole: "user"},
+		{name: "admin wins and DN compare ignores case and spaces", username: "carol", password: "carol-pw", wantRole: "admin"},
+		{name: "no group uses default role", username: "dave", password: "dave-pw", wantRole: "user"},
+		{
+			name: "no group with default none is rejected", username: "dave", password: "dave-pw",
+			cfg:     func(c *util.LDAPConfig) { c.DefaultRole = "none" },
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "group search under group_base_dn", username: "erin", password: "erin-pw",
+			cfg: func(c *util.LDAPConfig) {
+				c.GroupBaseDN = "ou=groups,dc=example,dc=com"
+				c.DefaultRole = "none"
+			},
+			wantRole: "admin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testLDAPConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			a := newTestLDAP(t, cfg, testDirectory())
+			identity, err := a.Authenticate(tt.username, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && identity.Role != tt.wantRole {
+				t.Fatalf("role = %s, want %s", identity.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestNewLDAPAuthenticatorConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(*util.LDAPConfig)
+		wantErr bool
+	}{
+		{name: "valid", cfg: func(*util.LDAPConfig) {}},
+		{name: "missing url", cfg: func(c *util.LDAPConfig) { c.URL = "" }, wantErr: true},
+		{name: "user filter without placeholder", cfg: func(c *util.LDAPConfig) { c.UserFilter = "(uid=admin)" }, wantErr: true},
+		{name: "group filter without placeholder", cfg: func(c *util.LDAPConfig) {
+			c.GroupBaseDN = "ou=groups,dc=example,dc=com"
+			c.GroupFilter = "(objectClass=groupOfNames)"
+		}, wantErr: true},
+		{name: "group filter unused without group_base_dn", cfg: func(c *util.LDAPConfig) { c.GroupFilter = "(objectClass=groupOfNames)" }},
+		{name: "invalid group role", cfg: func(c *util.LDAPConfig) { c.GroupRoles = map[string]string{testAdminGroup: "root"} }, wantErr: true},
+		{name: "invalid default role", cfg: func(c *util.LDAPConfig) { c.DefaultRole = "guest" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testLDAPConfig()
+			tt.cfg(&cfg)
+			_, err := NewLDAPAuthenticator(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// stubAuthenticator 模拟认证链中的本地账户认证器
+type stubAuthenticator struct {
+	users map[string]string
+	calls int
+}
+
+func (s *stubAuthenticator) Name() string { return AuthSourceLocal }
+
+func (s *stubAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	s.calls++
+	stored, ok := s.users[username]
+	if !ok {
+		return nil, ErrUnknownUser
+	}
+	if stored != password {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Username: username, Source: AuthSourceLocal}, nil
+}
+
+func TestAuthChainFallsBackToLocal(t *testing.T) {
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		dialErr    error
+		wantSource string
+		wantErr    error
+		wantLocal  bool // 是否交给了本地认证器
+	}{
+		{name: "ldap user", username: "bob", password: "bob-pw", wantSource: AuthSourceLDAP},
+		{name: "unknown in ldap falls back to local", username: "root", password: "root-pw", wantSource: AuthSourceLocal, wantLocal: true},
+		{name: "local wrong password", username: "root", password: "nope", wantErr: ErrInvalidCredentials, wantLocal: true},
+		{name: "ldap wrong password stops the chain", username: "bob", password: "nope", wantErr: ErrInvalidCredentials},
+		{name: "ldap unavailable stops the chain", username: "root", password: "root-pw", dialErr: errors.New("connection refused"), wantErr: ErrInvalidCredentials},
+		{name: "unknown everywhere", username: "mallory", password: "x", wantErr: ErrInvalidCredentials, wantLocal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDirectory()
+			dir.dialErr = tt.dialErr
+			local := &stubAuthenticator{users: map[string]string{"root": "root-pw"}}
+			a := &AuthService{authenticators: []Authenticator{newTestLDAP(t, testLDAPConfig(), dir), local}}
+
+			identity, err := a.authenticate(tt.username, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && identity.Source != tt.wantSource {
+				t.Fatalf("source = %s, want %s", identity.Source, tt.wantSource)
+			}
+			if (local.calls > 0) != tt.wantLocal {
+				t.Fatalf("local authenticator calls = %d, want called %v", local.calls, tt.wantLocal)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// 登录失败计数的维度
+const (
+	throttleScopeUser = "user"
+	throttleScopeIP   = "ip"
+)
+
+// LoginLockedError 表示账户或来源 IP 因登录失败次数过多被临时锁定
+type LoginLockedError struct {
+	Remaining time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	minutes := int((e.Remaining + time.Minute - 1) / time.Minute)
+	return fmt.Sprintf("登录失败次数过多，请 %d 分钟后再试", minutes)
+}
+
+// LoginThrottle 按账户和来源 IP 统计登录失败次数，窗口期内失败达到上限后临时锁定。
+// 计数保存在数据库中，多实例部署和重启后仍然有效
+type LoginThrottle struct {
+	db  *sql.DB
+	cfg util.LoginLockoutConfig
+}
+
+// NewLoginThrottle 创建登录限流器
+func NewLoginThrottle(db *sql.DB, cfg util.LoginLockoutConfig) *LoginThrottle {
+	return &LoginThrottle{db: db, cfg: cfg}
+}
+
+// throttleKey 账户维度按不区分大小写的用户名计数，与用户名的唯一性规则一致
+func throttleKey(username string) string {
+	return truncate(strings.ToLower(strings.TrimSpace(username)), 255)
+}
+
+// Check 检查账户或来源 IP 是否处于锁定期，锁定时返回 *LoginLockedError。
+// 查询失败时放行，避免数据库异常导致所有人无法登录。t 为 nil 表示不限流
+func (t *LoginThrottle) Check(username, ip string) error {
+	if t == nil {
+		return nil
+	}
+	var remaining sql.NullInt64
+	err := t.db.QueryRow(`SELECT MAX(TIMESTAMPDIFF(SECOND, NOW(), locked_until)) FROM login_failures
+		WHERE ((scope=? AND login_key=?) OR (scope=? AND login_key=?)) AND locked_until > NOW()`,
+		throttleScopeUser, throttleKey(username), throttleScopeIP, truncate(ip, 255)).Scan(&remaining)
+	if err != nil {
+		log.Printf("auth: failed to check login lockout: %v", err)
+		return nil
+	}
+	if remaining.Valid && remaining.Int64 > 0 {
+		return &LoginLockedError{Remaining: time.Duration(remaining.Int64) * time.Second}
+	}
+	return nil
+}
+
+// Fail 记录一次登录失败，窗口期内失败次数达到上限时锁定账户或来源 IP
+func (t *LoginThrottle) Fail(username, ip string) {
+	if t == nil {
+		return
+	}
+	window := t.cfg.WindowMinutes * 60
+	lockout := t.cfg.LockoutMinutes * 60
+	for _, f := range []struct {
+		scope, key string
+		max        int
+	}{
+		{throttleScopeUser, throttleKey(username), t.cfg.MaxFailures},
+		{throttleScopeIP, truncate(ip, 255), t.cfg.IPMaxFailures},
+	} {
+		if f.key == "" {
+			continue
+		}
+		// 超过窗口期的计数从 1 重新开始；ON DUPLICATE KEY UPDATE 按顺序赋值，后面的表达式使用更新后的 failures
+		_, err := t.db.Exec(`INSERT INTO login_failures (scope, login_key, failures, window_start, locked_until)
+			VALUES (?, ?, 1, NOW(), IF(1 >= ?, NOW() + INTERVAL ? SECOND, NULL))
+			ON DUPLICATE KEY UPDATE
+				failures = IF(window_start < NOW() - INTERVAL ? SECOND, 1, failures + 1),
+				window_start = IF(failures = 1, NOW(), window_start),
+				locked_until = IF(failures >= ?, NOW() + INTERVAL ? SECOND, locked_until)`,
+			f.scope, f.key, f.max, lockout, window, f.max, lockout)
+		if err != nil {
+			log.Printf("auth: failed to record login failure for %s %s: %v", f.scope, f.key, err)
+		}
+	}
+	// 清理已过期的计数，避免随机用户名使表无限增长
+	if _, err := t.db.Exec(`DELETE FROM login_failures
+		WHERE window_start < NOW() - INTERVAL ? SECOND AND (locked_until IS NULL OR locked_until < NOW())`, window); err != nil {
+		log.Printf("auth: failed to purge login failures: %v", err)
+	}
+}
+
+// Succeed 登录成功后清除账户的失败计数。来源 IP 的计数保留，避免用一个有效账户重置对其他账户的猜测
+func (t *LoginThrottle) Succeed(username string) {
+	if t == nil {
+		return
+	}
+	if _, err := t.db.Exec("DELETE FROM login_failures WHERE scope=? AND login_key=?", throttleScopeUser, throttleKey(username)); err != nil {
+		log.Printf("auth: failed to reset login failures for %s: %v", username, err)
+	}
+}
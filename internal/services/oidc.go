@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"com.duole/datax-web-go/internal/util"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider 通过 OpenID Connect 授权码流程（PKCE）登录，并将 ID 令牌中的声明映射为用户名和角色
+type OIDCProvider struct {
+	cfg util.OIDCConfig
+	// HTTPClient 访问身份提供方使用的客户端，为空时使用默认客户端；测试时可指向本地模拟签发方
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// OIDCRequest 一次登录的校验参数，跳转前保存在会话中，回调时取回核对
+type OIDCRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewOIDCProvider 创建 OIDC 登录，检查必填配置和角色映射。身份提供方的发现文档在首次登录时读取
+func NewOIDCProvider(cfg util.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC 登录需要配置 issuer、client_id 和 redirect_url")
+	}
+	for value, role := range cfg.ClaimRoles {
+		if role != "admin" && role != "user" {
+			return nil, fmt.Errorf("OIDC 声明值 %s 映射的角色无效: %s", value, role)
+		}
+	}
+	if cfg.DefaultRole != "admin" && cfg.DefaultRole != "user" && cfg.DefaultRole != "none" {
+		return nil, fmt.Errorf("OIDC default_role 无效: %s", cfg.DefaultRole)
+	}
+	return &OIDCProvider{cfg: cfg}, nil
+}
+
+// context 返回携带自定义 HTTP 客户端的上下文
+func (p *OIDCProvider) context(ctx context.Context) context.Context {
+	if p.HTTPClient != nil {
+		return oidc.ClientContext(ctx, p.HTTPClient)
+	}
+	return ctx
+}
+
+// discover 读取身份提供方的发现文档，成功后缓存；失败时下次登录重试，避免身份提供方暂时不可用时影响启动
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(p.context(ctx), p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取 OIDC 发现文档失败: %w", err)
+		}
+		p.provider = provider
+	}
+	conf := &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     p.provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+	return p.provider, conf, nil
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址，返回的 OIDCRequest 需保存到回调时使用
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context) (string, *OIDCRequest, error) {
+	_, conf, err := p.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	state, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	req := &OIDCRequest{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	url := conf.AuthCodeURL(req.State, oidc.Nonce(req.Nonce), oauth2.S256ChallengeOption(req.Verifier))
+	return url, req, nil
+}
+
+// Exchange 核对回调参数，用授权码换取 ID 令牌并校验签名、签发方、受众、有效期和 nonce，返回映射后的身份
+func (p *OIDCProvider) Exchange(ctx context.Context, req *OIDCRequest, state, code string) (*Identity, error) {
+	if req == nil || subtle.ConstantTimeCompare([]byte(req.State), []byte(state)) != 1 {
+		return nil, errors.New("登录请求已失效，请重新登录")
+	}
+	if code == "" {
+		return nil, errors.New("回调缺少授权码")
+	}
+	provider, conf, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = p.context(ctx)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("换取令牌失败: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("令牌响应中缺少 id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID 令牌校验失败: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(req.Nonce)) != 1 {
+		return nil, errors.New("ID 令牌的 nonce 不匹配")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析 ID 令牌声明失败: %w", err)
+	}
+	username, _ := claims[p.cfg.UsernameClaim].(string)
+	if username == "" || len([]rune(username)) > 64 {
+		return nil, fmt.Errorf("ID 令牌的 %s 声明不是有效的用户名", p.cfg.UsernameClaim)
+	}
+	role := p.claimRole(claims[p.cfg.RoleClaim])
+	if role == "none" {
+		return nil, fmt.Errorf("用户 %s 未被授权访问", username)
+	}
+	return &Identity{Username: username, Role: role, Source: AuthSourceOIDC}, nil
+}
+
+// claimRole 按声明值映射角色，声明可以是字符串或字符串数组；同时匹配多个值时取 admin，
+// 未匹配任何值时使用默认角色
+func (p *OIDCProvider) claimRole(claim any) string {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = []string{v}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	role := ""
+	for _, value := range values {
+		switch p.cfg.ClaimRoles[value] {
+		case "admin":
+			return "admin"
+		case "user":
+			role = "user"
+		}
+	}
+	if role == "" {
+		return p.cfg.DefaultRole
+	}
+	return role
+}
+
+// randomToken 生成用于 state 和 nonce 的随机字符串
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+const testClientID = "datax-web"
+
+// fakeIssuer 本地 OIDC 签发方：提供发现文档、JWKS 和令牌端点，令牌端点按 PKCE 校验 code_verifier
+type fakeIssuer struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	codes         map[string]issuedCode
+	discoveryDown bool
+	tokenRequests int
+}
+
+// issuedCode 授权码对应的 PKCE challenge 和 ID 令牌声明
+type issuedCode struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	f := &fakeIssuer{key: key, codes: map[string]issuedCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("/jwks", f.jwks)
+	mux.HandleFunc("/token", f.token)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// setDiscoveryDown 切换发现文档是否可用
+func (f *fakeIssuer) setDiscoveryDown(down bool) {
+	f.mu.Lock()
+	f.discoveryDown = down
+	f.mu.Unlock()
+}
+
+// requests 返回令牌端点收到的请求数
+func (f *fakeIssuer) requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokenRequests
+}
+
+func (f *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	down := f.discoveryDown
+	f.mu.Unlock()
+	if down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                f.srv.URL,
+		"authorization_endpoint":                f.srv.URL + "/authorize",
+		"token_endpoint":                        f.srv.URL + "/token",
+		"jwks_uri":                              f.srv.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (f *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test-key",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+	}}})
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	f.mu.Lock()
+	f.tokenRequests++
+	issued, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     f.sign(issued.claims),
+	})
+}
+
+// sign 使用 RS256 签发 JWT
+func (f *fakeIssuer) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize 模拟用户在身份提供方完成登录：检查授权地址中的参数，登记授权码并返回。
+// mutate 用于修改默认的 ID 令牌声明
+func (f *fakeIssuer) authorize(t *testing.T, authURL string, req *OIDCRequest, mutate func(map[string]any)) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	q := u.Query()
+	if got := u.Scheme + "://" + u.Host + u.Path; got != f.srv.URL+"/authorize" {
+		t.Fatalf("authorization endpoint = %s, want %s/authorize", got, f.srv.URL)
+	}
+	for key, want := range map[string]string{
+		"client_id":             testClientID,
+		"response_type":         "code",
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(key) != want {
+			t.Fatalf("auth url %s = %q, want %q", key, q.Get(key), want)
+		}
+	}
+	if q.Get("code_challenge") == "" || strings.Contains(authURL, req.Verifier) {
+		t.Fatalf("auth url must carry the PKCE challenge but not the verifier: %s", authURL)
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":                f.srv.URL,
+		"aud":                testClientID,
+		"sub":                "user-1",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              q.Get("nonce"),
+		"preferred_username": "oidc-user",
+		"groups":             []any{"data-eng"},
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+	code := fmt.Sprintf("code-%d", now.UnixNano())
+	f.mu.Lock()
+	f.codes[code] = issuedCode{challenge: q.Get("code_challenge"), claims: claims}
+	f.mu.Unlock()
+	return code
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestOIDC(t *testing.T, f *fakeIssuer) *OIDCProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(util.OIDCConfig{
+		Issuer:        f.srv.URL,
+		ClientID:      testClientID,
+		ClientSecret:  "client-secret",
+		RedirectURL:   "https://datax.example.com/login/oidc/callback",
+		Scopes:        []string{"openid", "profile"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		ClaimRoles:    map[string]string{"datax-admins": "admin", "data-eng": "user"},
+		DefaultRole:   "none",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	p.HTTPClient = f.srv.Client()
+	return p
+}
+
+// oidcLogin 完成一次登录：生成授权地址、在签发方登录并回调 Exchange
+func oidcLogin(t *testing.T, f *fakeIssuer, p *OIDCProvider, mutate func(map[string]any)) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, req, err := p.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := f.authorize(t, authURL, req, mutate)
+	return p.Exchange(ctx, req, req.State, code)
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+
+	f.setDiscoveryDown(true)
+	if _, _, err := p.AuthCodeURL(context.Background()); err == nil {
+		t.Fatal("AuthCodeURL succeeded while discovery is unavailable")
+	}
+	// 发现失败不缓存，签发方恢复后可以继续登录
+	f.setDiscoveryDown(false)
+	identity, err := oidcLogin(t, f, p, nil)
+	if err != nil {
+		t.Fatalf("login after discovery recovered: %v", err)
+	}
+	if identity.Username != "oidc-user" || identity.Role != "user" || identity.Source != AuthSourceOIDC {
+		t.Fatalf("identity = %+v", identity)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+	p.cfg.Issuer = f.srv.URL + "/other"
+	if _, _, err := p.AuthCodeURL(context.Background()); err == nil {
+		t.Fatal("AuthCodeURL accepted a discovery document for another issuer")
+	}
+}
+
+func TestOIDCExchangeState(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+	ctx := context.Background()
+
+	authURL, req, err := p.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := f.authorize(t, authURL, req, nil)
+	if _, err := p.Exchange(ctx, req, "forged-state", code); err == nil {
+		t.Fatal("Exchange accepted a mismatched state")
+	}
+	if _, err := p.Exchange(ctx, nil, req.State, code); err == nil {
+		t.Fatal("Exchange accepted a callback without a pending login")
+	}
+	if _, err := p.Exchange(ctx, req, req.State, ""); err == nil {
+		t.Fatal("Exchange accepted an empty code")
+	}
+	if n := f.requests(); n != 0 {
+		t.Fatalf("rejected callbacks must not reach the token endpoint, got %d requests", n)
+	}
+}
+
+func TestOIDCExchangePKCE(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+	ctx := context.Background()
+
+	authURL, req, err := p.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := f.authorize(t, authURL, req, nil)
+	// 授权码被截获后，没有对应 verifier 的一方不能换取令牌
+	stolen := *req
+	stolen.Verifier = strings.Repeat("x", 43)
+	if _, err := p.Exchange(ctx, &stolen, req.State, code); err == nil {
+		t.Fatal("Exchange succeeded with a wrong PKCE verifier")
+	}
+
+	authURL, req, err = p.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code = f.authorize(t, authURL, req, nil)
+	if _, err := p.Exchange(ctx, req, req.State, code); err != nil {
+		t.Fatalf("Exchange with the matching verifier: %v", err)
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(map[string]any)
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "nonce mismatch", mutate: func(c map[string]any) { c["nonce"] = "replayed" }, wantErr: true},
+		{name: "missing nonce", mutate: func(c map[string]any) { delete(c, "nonce") }, wantErr: true},
+		{name: "expired", mutate: func(c map[string]any) {
+			c["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		}, wantErr: true},
+		{name: "wrong audience", mutate: func(c map[string]any) { c["aud"] = "another-client" }, wantErr: true},
+		{name: "wrong issuer", mutate: func(c map[string]any) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "missing username", mutate: func(c map[string]any) { delete(c, "preferred_username") }, wantErr: true},
+		{name: "unmapped groups with default none", mutate: func(c map[string]any) { c["groups"] = []any{"finance"} }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			p := newTestOIDC(t, f)
+			_, err := oidcLogin(t, f, p, tt.mutate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCClaimRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups any
+		want   string
+	}{
+		{name: "string claim", groups: "data-eng", want: "user"},
+		{name: "admin wins", groups: []any{"data-eng", "datax-admins"}, want: "admin"},
+		{name: "ignores non-string values", groups: []any{42, "data-eng"}, want: "user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			p := newTestOIDC(t, f)
+			identity, err := oidcLogin(t, f, p, func(c map[string]any) { c["groups"] = tt.groups })
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if identity.Role != tt.want {
+				t.Fatalf("role = %s, want %s", identity.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCFirstLoginProvisioning(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+	users := &fakeUsers{}
+	a := &AuthService{db: openFakeUsers(t, users), oidc: p}
+
+	identity, err := oidcLogin(t, f, p, nil)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	id, role, err := a.provision(identity)
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	if len(users.rows) != 1 {
+		t.Fatalf("users = %+v, want one provisioned user", users.rows)
+	}
+	u := users.rows[0]
+	if u.id != id || u.username != "oidc-user" || u.role != "user" || role != "user" || u.source != AuthSourceOIDC {
+		t.Fatalf("provisioned %+v (id %d, role %s)", u, id, role)
+	}
+
+	// 之后的登录按声明同步角色，不重复开通
+	identity, err = oidcLogin(t, f, p, func(c map[string]any) { c["groups"] = []any{"datax-admins"} })
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	again, role, err := a.provision(identity)
+	if err != nil {
+		t.Fatalf("provision on second login: %v", err)
+	}
+	if again != id || role != "admin" || len(users.rows) != 1 || users.rows[0].role != "admin" {
+		t.Fatalf("second login: id %d role %s users %+v", again, role, users.rows)
+	}
+
+	// 声明变化不能降级最后一个启用的管理员
+	identity, err = oidcLogin(t, f, p, nil)
+	if err != nil {
+		t.Fatalf("third login: %v", err)
+	}
+	if _, role, err = a.provision(identity); err != nil || role != "admin" || users.rows[0].role != "admin" {
+		t.Fatalf("last admin demoted: role %s err %v users %+v", role, err, users.rows)
+	}
+}
+
+func TestOIDCProvisionConflicts(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDC(t, f)
+	users := &fakeUsers{rows: []fakeUser{{id: 1, username: "oidc-user", role: "user", source: AuthSourceLocal}}}
+	a := &AuthService{db: openFakeUsers(t, users), oidc: p}
+
+	identity, err := oidcLogin(t, f, p, nil)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if _, _, err := a.provision(identity); err != ErrInvalidCredentials {
+		t.Fatalf("OIDC login over a local account: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	identity, err = oidcLogin(t, f, p, func(c map[string]any) { c["preferred_username"] = "bad name!" })
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if _, _, err := a.provision(identity); err != ErrInvalidCredentials {
+		t.Fatalf("invalid username: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if len(users.rows) != 1 {
+		t.Fatalf("users = %+v, no account should be provisioned", users.rows)
+	}
+}
+
+// fakeUser users 表中开通账户用到的列
+type fakeUser struct {
+	id       int
+	username string
+	role     string
+	disabled bool
+	source   string
+}
+
+// fakeUsers 内存中的 users 表，通过 database/sql 驱动只响应开通和同步角色使用的语句。
+// 驱动按语句操作的表和条件识别语句，不依赖语句的具体写法
+type fakeUsers struct {
+	mu   sync.Mutex
+	rows []fakeUser
+}
+
+var (
+	fakeUsersOnce     sync.Once
+	fakeUsersMu       sync.Mutex
+	fakeUsersRegistry = map[string]*fakeUsers{}
+)
+
+// openFakeUsers 返回读写 users 的数据库句柄
+func openFakeUsers(t *testing.T, users *fakeUsers) *sql.DB {
+	t.Helper()
+	fakeUsersOnce.Do(func() { sql.Register("fakeusers", fakeUsersDriver{}) })
+	fakeUsersMu.Lock()
+	fakeUsersRegistry[t.Name()] = users
+	fakeUsersMu.Unlock()
+	db, err := sql.Open("fakeusers", t.Name())
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeUsersDriver struct{}
+
+func (fakeUsersDriver) Open(name string) (driver.Conn, error) {
+	fakeUsersMu.Lock()
+	defer fakeUsersMu.Unlock()
+	users, ok := fakeUsersRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %s", name)
+	}
+	return &fakeUsersConn{users: users}, nil
+}
+
+type fakeUsersConn struct{ users *fakeUsers }
+
+func (c *fakeUsersConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeUsersStmt{users: c.users, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *fakeUsersConn) Close() error              { return nil }
+func (c *fakeUsersConn) Begin() (driver.Tx, error) { return fakeUsersTx{}, nil }
+
+type fakeUsersTx struct{}
+
+func (fakeUsersTx) Commit() error   { return nil }
+func (fakeUsersTx) Rollback() error { return nil }
+
+type fakeUsersStmt struct {
+	users *fakeUsers
+	query string
+}
+
+func (s *fakeUsersStmt) Close() error  { return nil }
+func (s *fakeUsersStmt) NumInput() int { return -1 }
+
+func (s *fakeUsersStmt) Exec(args []driver.Value) (driver.Result, error) {
+	u := s.users
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO users"):
+		row := fakeUser{id: len(u.rows) + 1, username: args[0].(string), role: args[1].(string), source: args[2].(string)}
+		u.rows = append(u.rows, row)
+		return fakeUsersResult{id: int64(row.id)}, nil
+	case strings.HasPrefix(s.query, "UPDATE users SET role"):
+		for i := range u.rows {
+			if int64(u.rows[i].id) == args[1].(int64) {
+				u.rows[i].role = args[0].(string)
+				return fakeUsersResult{affected: 1}, nil
+			}
+		}
+		return fakeUsersResult{}, nil
+	}
+	return nil, fmt.Errorf("fake db: unsupported exec %q", s.query)
+}
+
+func (s *fakeUsersStmt) Query(args []driver.Value) (driver.Rows, error) {
+	u := s.users
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !strings.Contains(s.query, "FROM users") {
+		return nil, fmt.Errorf("fake db: unsupported query %q", s.query)
+	}
+	rows := &fakeUsersRows{}
+	switch {
+	case strings.Contains(s.query, "WHERE username"):
+		rows.columns = []string{"id", "role", "disabled", "auth_source"}
+		for _, r := range u.rows {
+			if r.username == args[0].(string) {
+				rows.values = append(rows.values, []driver.Value{int64(r.id), r.role, r.disabled, r.source})
+			}
+		}
+	case strings.Contains(s.query, "WHERE id"):
+		rows.columns = []string{"role", "disabled"}
+		for _, r := range u.rows {
+			if int64(r.id) == args[0].(int64) {
+				rows.values = append(rows.values, []driver.Value{r.role, r.disabled})
+			}
+		}
+	case strings.Contains(s.query, "role='admin'"):
+		rows.columns = []string{"id"}
+		for _, r := range u.rows {
+			if r.role == "admin" && !r.disabled && int64(r.id) != args[0].(int64) {
+				rows.values = append(rows.values, []driver.Value{int64(r.id)})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("fake db: unsupported query %q", s.query)
+	}
+	return rows, nil
+}
+
+type fakeUsersResult struct{ id, affected int64 }
+
+func (r fakeUsersResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r fakeUsersResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeUsersRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeUsersRows) Columns() []string { return r.columns }
+func (r *fakeUsersRows) Close() error      { return nil }
+func (r *fakeUsersRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
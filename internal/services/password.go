@@ -0,0 +1,139 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"com.duole/datax-web-go/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt 只使用密码的前 72 个字节
+const maxPasswordBytes = util.MaxPasswordBytes
+
+// ErrNotLocalAccount 表示账户由 LDAP 或单点登录管理，没有本地密码
+var ErrNotLocalAccount = errors.New("该账户由外部身份源管理，不能在此修改密码")
+
+// CheckPasswordPolicy 按密码策略检查新密码，不符合时返回说明原因的错误
+func CheckPasswordPolicy(policy util.PasswordPolicy, username, password string) error {
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("密码长度不能少于 %d 个字符", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("密码长度不能超过 %d 个字节", maxPasswordBytes)
+	}
+	if strings.EqualFold(password, username) {
+		return errors.New("密码不能与用户名相同")
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "大写字母")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "小写字母")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "数字")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "符号")
+	}
+	if len(missing) > 0 {
+		return errors.New("密码必须包含" + strings.Join(missing, "、"))
+	}
+	return nil
+}
+
+// VerifyPassword 校验本地账户的当前密码
+func VerifyPassword(db *sql.DB, userID int, password string) error {
+	var hash, source string
+	if err := db.QueryRow("SELECT password, auth_source FROM users WHERE id=?", userID).Scan(&hash, &source); err != nil {
+		return err
+	}
+	if source != AuthSourceLocal {
+		return ErrNotLocalAccount
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// SetPassword 设置本地账户的密码并撤销该用户的全部会话。
+// mustChange 为 true 表示管理员重置，用户下次登录后必须先修改密码，同时撤销用户的全部 API 令牌，
+// 重置通常意味着账户可能已泄露
+func SetPassword(db *sql.DB, userID int, password string, mustChange bool, updatedBy int) error {
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`UPDATE users SET password=?, must_change_password=?, password_changed_at=NOW(),
+		updated_by=? WHERE id=? AND auth_source=?`,
+		hashed, mustChange, updatedBy, userID, AuthSourceLocal)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var source string
+		if err := db.QueryRow("SELECT auth_source FROM users WHERE id=?", userID).Scan(&source); err != nil {
+			return err
+		}
+		return ErrNotLocalAccount
+	}
+	if mustChange {
+		if err := RevokeUserAPITokens(db, userID); err != nil {
+			return err
+		}
+	}
+	return RevokeUserSessions(db, userID)
+}
+
+// generatedPasswordChars 自动生成密码使用的字符，去掉了容易混淆的 0/O、1/l/I
+const generatedPasswordChars = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!@#$%^&*-_"
+
+// GeneratePassword 生成符合密码策略的随机密码，长度至少为 16 个字符，最多为 maxPasswordBytes 个字符
+func GeneratePassword(policy util.PasswordPolicy) (string, error) {
+	if err := policy.Validate(); err != nil {
+		return "", err
+	}
+	length := 16
+	if policy.MinLength > length {
+		length = policy.MinLength
+	}
+	if length > maxPasswordBytes {
+		length = maxPasswordBytes
+	}
+	buf := make([]byte, length)
+	limit := big.NewInt(int64(len(generatedPasswordChars)))
+	for {
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, limit)
+			if err != nil {
+				return "", err
+			}
+			buf[i] = generatedPasswordChars[n.Int64()]
+		}
+		// 随机结果偶尔缺少某类字符，重新生成直到满足策略
+		if CheckPasswordPolicy(policy, "", string(buf)) == nil {
+			return string(buf), nil
+		}
+	}
+}
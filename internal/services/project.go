@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// 项目角色，权限依次递增：viewer 只读，operator 还可执行和终止，editor 还可编辑和删除
+const (
+	ProjectViewer   = "viewer"
+	ProjectOperator = "operator"
+	ProjectEditor   = "editor"
+)
+
+// DefaultProjectID 默认项目，未指定项目的对象（包括 Git 同步创建的对象）归属该项目
+const DefaultProjectID = 1
+
+// projectRoleRank 角色的权限等级，未知角色为 0
+var projectRoleRank = map[string]int{
+	ProjectViewer:   1,
+	ProjectOperator: 2,
+	ProjectEditor:   3,
+}
+
+// ValidProjectRole 判断是否为有效的项目角色
+func ValidProjectRole(role string) bool {
+	return projectRoleRank[role] > 0
+}
+
+// ProjectRoleAtLeast 判断 role 是否具有 required 角色的全部权限
+func ProjectRoleAtLeast(role, required string) bool {
+	return projectRoleRank[role] > 0 && projectRoleRank[role] >= projectRoleRank[required]
+}
+
+// ProjectRoleName 返回项目角色的中文名称
+func ProjectRoleName(role string) string {
+	switch role {
+	case ProjectViewer:
+		return "查看者"
+	case ProjectOperator:
+		return "操作员"
+	case ProjectEditor:
+		return "编辑者"
+	}
+	return role
+}
+
+// ProjectRole 返回用户在项目中的角色，不是项目成员时返回空字符串
+func ProjectRole(db *sql.DB, userID, projectID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM project_members WHERE project_id=? AND user_id=?", projectID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// ListProjects 返回全部项目及成员数
+func ListProjects(db *sql.DB) ([]models.Project, error) {
+	rows, err := db.Query(`SELECT p.id, p.name, p.description, p.created_at,
+		(SELECT COUNT(*) FROM project_members pm WHERE pm.project_id = p.id)
+		FROM projects p ORDER BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Members); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// UserProjects 返回用户是成员的项目及其角色
+func UserProjects(db *sql.DB, userID int) ([]models.Project, error) {
+	rows, err := db.Query(`SELECT p.id, p.name, p.description, p.created_at, pm.role
+		FROM projects p JOIN project_members pm ON pm.project_id = p.id
+		WHERE pm.user_id = ? ORDER BY p.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Role); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// CreateProject 创建项目并返回项目ID
+func CreateProject(db *sql.DB, name, description string, userID int) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("项目名称不能为空")
+	}
+	if len([]rune(name)) > 100 {
+		return 0, errors.New("项目名称不能超过100个字符")
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE name=?)", name).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, fmt.Errorf("项目 %s 已存在", name)
+	}
+
+	result, err := db.Exec("INSERT INTO projects (name, description, created_by) VALUES (?, ?, ?)",
+		name, strings.TrimSpace(description), userID)
+	if err != nil {
+		return 0, fmt.Errorf("创建项目失败: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id), nil
+}
+
+// DeleteProject 删除没有任何数据源、任务和任务流的项目，默认项目不能删除
+func DeleteProject(db *sql.DB, projectID int) error {
+	if projectID == DefaultProjectID {
+		return errors.New("默认项目不能删除")
+	}
+	var objects int
+	err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM data_sources WHERE project_id=?)
+		+ (SELECT COUNT(*) FROM tasks WHERE project_id=?)
+		+ (SELECT COUNT(*) FROM task_flows WHERE project_id=?)`, projectID, projectID, projectID).Scan(&objects)
+	if err != nil {
+		return err
+	}
+	if objects > 0 {
+		return errors.New("项目中仍有数据源、任务或任务流，不能删除")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM project_members WHERE project_id=?", projectID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM projects WHERE id=?", projectID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListProjectMembers 返回项目的成员及角色
+func ListProjectMembers(db *sql.DB, projectID int) ([]models.ProjectMember, error) {
+	rows, err := db.Query(`SELECT pm.user_id, u.username, pm.role, pm.created_at
+		FROM project_members pm JOIN users u ON pm.user_id = u.id
+		WHERE pm.project_id = ? ORDER BY u.username`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.ProjectMember
+	for rows.Next() {
+		var m models.ProjectMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetProjectMember 授予用户项目角色，用户已是成员时更新其角色
+func SetProjectMember(db *sql.DB, projectID, userID int, role string, grantedBy int) error {
+	if !ValidProjectRole(role) {
+		return fmt.Errorf("无效的项目角色: %s", role)
+	}
+	_, err := db.Exec(`INSERT INTO project_members (project_id, user_id, role, created_by) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`, projectID, userID, role, grantedBy)
+	return err
+}
+
+// RemoveProjectMember 取消用户在项目中的授权
+func RemoveProjectMember(db *sql.DB, projectID, userID int) error {
+	_, err := db.Exec("DELETE FROM project_members WHERE project_id=? AND user_id=?", projectID, userID)
+	return err
+}
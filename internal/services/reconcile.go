@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+// 对账状态
+const (
+	ReconcileNone       = "none"
+	ReconcileMatched    = "matched"
+	ReconcileMismatched = "mismatched"
+	ReconcileError      = "error"
+)
+
+// DataX 执行结束时输出的统计信息
+var (
+	dataxReadTotalPattern   = regexp.MustCompile(`读出记录总数\s*:\s*(\d+)`)
+	dataxFailedTotalPattern = regexp.MustCompile(`读写失败总数\s*:\s*(\d+)`)
+)
+
+// reconcileResult 表示一次执行后的对账结果
+type reconcileResult struct {
+	status     string
+	sourceRows *int64
+	targetRows *int64
+	message    string
+}
+
+// reconcile 在任务成功后比较源端行数与 DataX 实际写入行数。
+// 未开启对账的任务返回 nil。源端为 MySQL 时使用与 reader 相同的 where 计数，
+// 否则以 DataX 读出记录数作为源端行数；目标端行数为读出数减去读写失败数。
+func (s *Scheduler) reconcile(taskID, sourceID int, config, output string) *reconcileResult {
+	var enabled bool
+	var tolerance int64
+	err := s.db.QueryRow("SELECT reconcile_enabled, reconcile_tolerance FROM tasks WHERE id=?", taskID).
+		Scan(&enabled, &tolerance)
+	if err != nil {
+		return &reconcileResult{status: ReconcileError, message: fmt.Sprintf("查询对账配置失败: %v", err)}
+	}
+	if !enabled {
+		return nil
+	}
+
+	read, okRead := parseDataXCounter(dataxReadTotalPattern, output)
+	failed, okFailed := parseDataXCounter(dataxFailedTotalPattern, output)
+	if !okRead || !okFailed {
+		return &reconcileResult{status: ReconcileError, message: "未能从 DataX 输出中解析读写统计"}
+	}
+	written := read - failed
+
+	sourceRows := read
+	if job, err := decodeJobConfig(config); err == nil {
+		if param, err := mysqlReaderParameter(job); err == nil {
+			count, err := s.countMySQLSource(sourceID, param)
+			if err != nil {
+				return &reconcileResult{status: ReconcileError, targetRows: &written, message: err.Error()}
+			}
+			sourceRows = count
+		}
+	}
+
+	result := &reconcileResult{sourceRows: &sourceRows, targetRows: &written}
+	diff := sourceRows - written
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > tolerance {
+		result.status = ReconcileMismatched
+		result.message = fmt.Sprintf("对账不一致: 源端 %d 行，写入 %d 行，差异 %d 超出容忍度 %d", sourceRows, written, diff, tolerance)
+	} else {
+		result.status = ReconcileMatched
+		result.message = fmt.Sprintf("对账一致: 源端 %d 行，写入 %d 行", sourceRows, written)
+	}
+	return result
+}
+
+// countMySQLSource 使用 reader 的表和 where 在源库计数
+func (s *Scheduler) countMySQLSource(sourceID int, param map[string]any) (int64, error) {
+	table, err := readerTable(param)
+	if err != nil {
+		return 0, err
+	}
+	where, _ := param["where"].(string)
+
+	conn, err := datax.GetMySQLConnection(s.db, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	src, err := datax.OpenMySQL(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	query := "SELECT COUNT(*) FROM " + quoteTable(table)
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+	var count int64
+	if err := src.QueryRow(query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("源端计数失败: %v", err)
+	}
+	return count, nil
+}
+
+// parseDataXCounter 从 DataX 输出中取最后一次出现的统计值
+func parseDataXCounter(pattern *regexp.Regexp, output string) (int64, bool) {
+	matches := pattern.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(matches[len(matches)-1][1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// updateTaskLogReconcile 将对账结果写回任务日志
+func (s *Scheduler) updateTaskLogReconcile(logID int64, result *reconcileResult) {
+	if logID == 0 || result == nil {
+		return
+	}
+	_, err := s.db.Exec(`UPDATE task_logs SET reconcile_status=?, source_rows=?, target_rows=? WHERE id=?`,
+		result.status, result.sourceRows, result.targetRows, logID)
+	if err != nil {
+		log.Printf("scheduler: failed to update reconcile status for task log %d: %v", logID, err)
+	}
+}
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/robfig/cron/v3"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -13,6 +16,7 @@ import (
 	"time"
 
 	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
 	"com.duole/datax-web-go/internal/util"
 )
 
@@ -36,6 +40,8 @@ type Scheduler struct {
 	cron      *cron.Cron
 	dataxHome string
 	tempDir   string
+	// Shell 步骤的运行方式，未设置时拒绝执行 Shell 步骤
+	shell *ShellRunner
 
 	// 锁
 	tasksMu sync.RWMutex // 保护 running tasks
@@ -66,6 +72,11 @@ func NewScheduler(db *sql.DB, c *cron.Cron, dataxHome, tempDir string) *Schedule
 	return s
 }
 
+// SetShellRunner 设置 Shell 步骤的运行方式
+func (s *Scheduler) SetShellRunner(r *ShellRunner) {
+	s.shell = r
+}
+
 // initTempDir 初始化临时目录，检查是否存在或创建
 func (s *Scheduler) initTempDir() {
 	// 先检查目录是否已存在
@@ -206,12 +217,28 @@ func (s *Scheduler) RemoveTaskFlowFromCron(flowID int) error {
 // 日志被捕获并存储在 task_logs 中。完成后，状态更新为 'success' 或 'failed'。
 // 当通过 KillTask 取消上下文时，底层命令将被终止，状态标记为 'killed'。
 func (s *Scheduler) RunTask(ctx context.Context, taskID int) (string, error) {
-	return s.runTask(ctx, taskID, time.Time{}, nil, nil, nil, "manual")
+	return s.runTask(ctx, taskID, ExecutionDateFrom(ctx), nil, nil, nil, "manual")
 }
 
 // RunTaskWithContext 执行任务并支持任务流上下文信息
 func (s *Scheduler) RunTaskWithContext(ctx context.Context, taskID int, flowExecutionID, stepID, stepOrder *int, executionType string) (string, error) {
-	return s.runTask(ctx, taskID, time.Time{}, flowExecutionID, stepID, stepOrder, executionType)
+	return s.runTask(ctx, taskID, ExecutionDateFrom(ctx), flowExecutionID, stepID, stepOrder, executionType)
+}
+
+// RenderTaskConfig 返回任务实际执行时使用的 DataX 配置：日期占位符按上下文中的业务日期替换，
+// 增量任务注入当前水位对应的同步区间。不会执行任务，也不会推进水位。
+func (s *Scheduler) RenderTaskConfig(ctx context.Context, taskID int) (string, error) {
+	var jsonCfg string
+	var srcID int
+	err := s.db.QueryRow(`SELECT COALESCE(json_config,''), source_id FROM tasks WHERE id=?`, taskID).Scan(&jsonCfg, &srcID)
+	if err != nil {
+		return "", err
+	}
+	if jsonCfg == "" {
+		return "", fmt.Errorf("task %d has empty configuration", taskID)
+	}
+	config, _, err := s.applyIncremental(taskID, srcID, processPlaceholders(ctx, jsonCfg))
+	return config, err
 }
 
 // runTask 内部任务执行方法
@@ -240,9 +267,10 @@ func (s *Scheduler) runTask(ctx context.Context, taskID int, executionDate time.
 
 	// 获取详细信息：JSON 配置、源、目标
 	var jsonCfg, name string
-	var srcID, tgtID int
-	err := s.db.QueryRow(`SELECT name, COALESCE(json_config,''), source_id, target_id FROM tasks WHERE id=?`, taskID).
-		Scan(&name, &jsonCfg, &srcID, &tgtID)
+	var srcID, tgtID, projectID int
+	var version *int
+	err := s.db.QueryRow(`SELECT name, COALESCE(json_config,''), source_id, target_id, project_id, NULLIF(current_version, 0) FROM tasks WHERE id=?`, taskID).
+		Scan(&name, &jsonCfg, &srcID, &tgtID, &projectID, &version)
 	if err != nil {
 		cleanup()
 		errorMsg := fmt.Sprintf("查询任务失败: %v", err)
@@ -253,7 +281,7 @@ func (s *Scheduler) runTask(ctx context.Context, taskID int, executionDate time.
 	if jsonCfg == "" {
 		cleanup()
 		errorMsg := "任务配置为空，无法执行"
-		s.appendTaskLog(taskID, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
+		s.appendTaskLog(taskID, version, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
 		return errorMsg, fmt.Errorf("task %d has empty configuration", taskID)
 	}
 
@@ -265,35 +293,41 @@ func (s *Scheduler) runTask(ctx context.Context, taskID int, executionDate time.
 		processedConfig = util.ProcessDatePlaceholders(jsonCfg, executionDate)
 	}
 
+	// 增量任务：根据水位计算同步区间并注入 reader 的 where
+	processedConfig, window, err := s.applyIncremental(taskID, srcID, processedConfig)
+	if err != nil {
+		cleanup()
+		errorMsg := fmt.Sprintf("增量区间计算失败: %v", err)
+		s.appendTaskLog(taskID, version, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
+		return errorMsg, err
+	}
+
 	// 验证并创建路径
 	pathValidator := util.NewPathValidator()
 	if err := pathValidator.ValidateDataXConfigPaths(processedConfig); err != nil {
 		cleanup()
 		errorMsg := fmt.Sprintf("路径验证失败: %v", err)
-		s.appendTaskLog(taskID, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
+		s.appendTaskLog(taskID, version, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
 		return errorMsg, err
 	}
 
 	// 准备命令
-	tmp := filepath.Join(s.tempDir, fmt.Sprintf("job_%d_%d.json", taskID, time.Now().UnixNano()))
-	if err := os.WriteFile(tmp, []byte(processedConfig), 0644); err != nil {
+	scope := &datax.RefScope{ProjectID: projectID, SourceID: srcID, TargetID: tgtID}
+	cmd, tmp, err := s.dataxCommand(jobCtx, fmt.Sprintf("job_%d", taskID), processedConfig, scope)
+	if err != nil {
 		cleanup()
-		os.Remove(tmp) // 清理临时文件
 		errorMsg := fmt.Sprintf("写入配置文件失败: %v", err)
-		s.appendTaskLog(taskID, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
+		s.appendTaskLog(taskID, version, time.Now(), time.Now(), "failed", errorMsg, flowExecutionID, stepID, stepOrder, executionType)
 		return errorMsg, err
 	}
 
-	// 创建命令
-	cmd := exec.CommandContext(jobCtx, "python", filepath.Join(s.dataxHome, "bin", "datax.py"), tmp)
-
 	// 更新运行状态中的命令
 	s.tasksMu.Lock()
 	s.tasks[taskID].cmd = cmd
 	s.tasksMu.Unlock()
 
 	start := time.Now()
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd, nil)
 	end := time.Now()
 
 	// 移除运行状态
@@ -312,12 +346,78 @@ func (s *Scheduler) runTask(ctx context.Context, taskID int, executionDate time.
 		}
 	}
 
+	// 成功后按需对账，差异超出容忍度时返回错误使任务流失败
+	var recon *reconcileResult
+	if status == "success" {
+		recon = s.reconcile(taskID, srcID, processedConfig, string(output))
+		if recon != nil && recon.status == ReconcileMismatched {
+			err = errors.New(recon.message)
+		}
+	}
+
+	// 增量任务在日志开头记录本次同步区间，并仅在成功后推进水位
+	logText := string(output)
+	if window != nil {
+		logText = fmt.Sprintf("增量同步区间: %s\n\n%s", window.condition(), logText)
+		if status == "success" && err == nil {
+			s.advanceWatermark(taskID, window)
+		}
+	}
+	if recon != nil {
+		logText = fmt.Sprintf("%s\n\n%s", logText, recon.message)
+	}
+	if !executionDate.IsZero() {
+		logText = fmt.Sprintf("业务日期: %s\n\n%s", executionDate.Format("2006-01-02"), logText)
+	}
+
 	// 保存日志
-	s.appendTaskLog(taskID, start, end, status, string(output), flowExecutionID, stepID, stepOrder, executionType)
+	logID := s.appendTaskLog(taskID, version, start, end, status, logText, flowExecutionID, stepID, stepOrder, executionType)
+	s.updateTaskLogReconcile(logID, recon)
 
 	// 清理临时文件
 	os.Remove(tmp)
-	return string(output), err
+	return logText, err
+}
+
+// dataxCommand 将配置写入临时目录并创建执行 datax.py 的命令，返回命令和临时文件路径，
+// 调用方负责在执行结束后删除临时文件。配置中的数据源引用只在写入临时文件时解析为当前的连接信息，
+// 临时文件仅当前用户可读。scope 限制可以引用的数据源，为空时不限制
+func (s *Scheduler) dataxCommand(ctx context.Context, name, config string, scope *datax.RefScope) (*exec.Cmd, string, error) {
+	config, err := datax.ResolveDataSourceRefs(s.db, config, scope)
+	if err != nil {
+		return nil, "", err
+	}
+	tmp := filepath.Join(s.tempDir, fmt.Sprintf("%s_%d.json", name, time.Now().UnixNano()))
+	if err := os.WriteFile(tmp, []byte(config), 0600); err != nil {
+		os.Remove(tmp)
+		return nil, "", err
+	}
+	return exec.CommandContext(ctx, "python", filepath.Join(s.dataxHome, "bin", "datax.py"), tmp), tmp, nil
+}
+
+// runCommand 执行命令并返回合并后的标准输出和标准错误，stream 非空时同时实时写入 stream
+func runCommand(cmd *exec.Cmd, stream io.Writer) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if stream != nil {
+		w = io.MultiWriter(&buf, stream)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	return buf.Bytes(), err
+}
+
+// ExecuteDataX 使用与调度执行相同的方式执行 DataX 配置，输出实时写入 out。
+// 不登记运行状态、不写任务日志、不推进水位，用于离线调试；配置不属于任务，引用的数据源不受项目限制。
+func (s *Scheduler) ExecuteDataX(ctx context.Context, name, config string, out io.Writer) error {
+	cmd, tmp, err := s.dataxCommand(ctx, name, config, nil)
+	if err != nil {
+		return fmt.Errorf("写入配置文件失败: %v", err)
+	}
+	defer os.Remove(tmp)
+	_, err = runCommand(cmd, out)
+	return err
 }
 
 // KillTask 通过任务 ID 取消正在运行的任务。如果任务未运行，
@@ -437,10 +537,11 @@ func (s *Scheduler) KillTaskFlow(flowID int) error {
 func (s *Scheduler) executeFlowSteps(ctx context.Context, flowID, execID int, executionType string) error {
 	// 按 step_order 获取任务流步骤
 	rows, err := s.db.Query(`
-		SELECT s.id, s.task_id, s.timeout_minutes, s.step_order, t.name
+		SELECT s.id, s.step_type, COALESCE(s.task_id, 0), s.timeout_minutes, s.step_order,
+		       COALESCE(t.name, s.name, ''), COALESCE(s.step_config, '')
 		FROM task_flow_steps s
-		JOIN tasks t ON s.task_id = t.id
-		WHERE s.flow_id = ?
+		LEFT JOIN tasks t ON s.task_id = t.id
+		WHERE s.flow_id = ? AND (s.step_type <> 'datax' OR t.id IS NOT NULL)
 		ORDER BY s.step_order
 	`, flowID)
 	if err != nil {
@@ -453,7 +554,7 @@ func (s *Scheduler) executeFlowSteps(ctx context.Context, flowID, execID int, ex
 	for rows.Next() {
 		var step models.TaskFlowStep
 		var stepOrder int
-		rows.Scan(&step.ID, &step.TaskID, &step.TimeoutMinutes, &stepOrder, &step.TaskName)
+		rows.Scan(&step.ID, &step.StepType, &step.TaskID, &step.TimeoutMinutes, &stepOrder, &step.TaskName, &step.Config)
 		step.StepOrder = stepOrder
 		steps = append(steps, step)
 	}
@@ -483,8 +584,8 @@ func (s *Scheduler) executeStep(ctx context.Context, step models.TaskFlowStep, f
 		defer cancel()
 	}
 
-	// 直接复用 RunTaskWithContext 方法执行任务
-	_, err := s.RunTaskWithContext(stepCtx, step.TaskID, &execID, &step.ID, &step.StepOrder, executionType)
+	// 按步骤类型执行，DataX 步骤复用 RunTaskWithContext
+	_, err := s.runStep(stepCtx, step, execID, executionType)
 
 	// 确定成功状态
 	success := err == nil
@@ -503,6 +604,14 @@ func (s *Scheduler) executeStep(ctx context.Context, step models.TaskFlowStep, f
 
 // ========== 状态查询方法 ==========
 
+// IsTaskRunning 检查任务是否正在运行
+func (s *Scheduler) IsTaskRunning(taskID int) bool {
+	s.tasksMu.RLock()
+	defer s.tasksMu.RUnlock()
+	_, exists := s.tasks[taskID]
+	return exists
+}
+
 // IsTaskFlowRunning 检查任务流是否正在运行
 func (s *Scheduler) IsTaskFlowRunning(flowID int) bool {
 	s.flowsMu.RLock()
@@ -513,6 +622,34 @@ func (s *Scheduler) IsTaskFlowRunning(flowID int) bool {
 
 // ========== 辅助方法 ==========
 
+// ctxKey 是本包存入 context 的值的键类型，未导出的类型不会与其他包的键冲突
+type ctxKey int
+
+const (
+	executionDateKey ctxKey = iota
+	clientIPKey
+)
+
+// WithExecutionDate 返回携带业务日期的上下文，任务和任务流步骤中的日期占位符按该日期替换，
+// 用于补数和按指定日期重跑
+func WithExecutionDate(ctx context.Context, date time.Time) context.Context {
+	return context.WithValue(ctx, executionDateKey, date)
+}
+
+// ExecutionDateFrom 返回上下文中的业务日期，未设置时为零值
+func ExecutionDateFrom(ctx context.Context) time.Time {
+	date, _ := ctx.Value(executionDateKey).(time.Time)
+	return date
+}
+
+// processPlaceholders 按上下文中的业务日期替换日期占位符，未设置时使用默认日期（前一天）
+func processPlaceholders(ctx context.Context, text string) string {
+	if date := ExecutionDateFrom(ctx); !date.IsZero() {
+		return util.ProcessDatePlaceholders(text, date)
+	}
+	return util.ProcessDatePlaceholders(text)
+}
+
 // ValidateCronExpression 验证cron表达式格式
 func ValidateCronExpression(expr string) error {
 	if expr == "" {
@@ -528,15 +665,23 @@ func ValidateCronExpression(expr string) error {
 	return nil
 }
 
-// appendTaskLog 为任务插入日志条目
-func (s *Scheduler) appendTaskLog(taskID int, start, end time.Time, status, text string, flowExecutionID, stepID, stepOrder *int, executionType string) {
-	_, err := s.db.Exec(`
+// appendTaskLog 为任务插入日志条目并记录执行时的配置版本，返回日志ID（失败时为0）。
+// taskID 为 0 表示非 DataX 步骤，task_id 记为 NULL。
+func (s *Scheduler) appendTaskLog(taskID int, configVersion *int, start, end time.Time, status, text string, flowExecutionID, stepID, stepOrder *int, executionType string) int64 {
+	var logTaskID any
+	if taskID != 0 {
+		logTaskID = taskID
+	}
+	result, err := s.db.Exec(`
 		INSERT INTO task_logs(
-			task_id, flow_execution_id, step_id, step_order, 
+			task_id, config_version, flow_execution_id, step_id, step_order, 
 			execution_type, start_time, end_time, status, log
-		) VALUES(?,?,?,?,?,?,?,?,?)
-	`, taskID, flowExecutionID, stepID, stepOrder, executionType, start, end, status, text)
+		) VALUES(?,?,?,?,?,?,?,?,?,?)
+	`, logTaskID, configVersion, flowExecutionID, stepID, stepOrder, executionType, start, end, status, text)
 	if err != nil {
 		log.Printf("scheduler: failed to append task log for task %d: %v", taskID, err)
+		return 0
 	}
+	id, _ := result.LastInsertId()
+	return id
 }
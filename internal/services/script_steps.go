@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+const (
+	// defaultShellTimeout 为未设置步骤超时时间的 Shell 步骤的默认超时
+	defaultShellTimeout = 30 * time.Minute
+	// maxShellOutput 为 Shell 步骤写入日志的最大输出字节数
+	maxShellOutput = 1 << 20
+)
+
+// shellEnvPath 为 Shell 步骤可见的 PATH，其余环境变量均不继承
+const shellEnvPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// SQLStepConfig 为 SQL 步骤的配置，可包含多条以分号分隔的语句
+type SQLStepConfig struct {
+	DataSourceID int    `json:"data_source_id"`
+	SQL          string `json:"sql"`
+}
+
+// ShellStepConfig 为 Shell 步骤的配置
+type ShellStepConfig struct {
+	Script string `json:"script"`
+}
+
+// NewSQLStepConfig 生成 SQL 步骤配置
+func NewSQLStepConfig(dataSourceID int, script string) (string, error) {
+	cfg := SQLStepConfig{DataSourceID: dataSourceID, SQL: strings.TrimSpace(script)}
+	if err := cfg.validate(); err != nil {
+		return "", err
+	}
+	return marshalStepConfig(cfg)
+}
+
+// NewShellStepConfig 生成 Shell 步骤配置
+func NewShellStepConfig(script string) (string, error) {
+	cfg := ShellStepConfig{Script: strings.TrimSpace(script)}
+	if err := cfg.validate(); err != nil {
+		return "", err
+	}
+	return marshalStepConfig(cfg)
+}
+
+func (c *SQLStepConfig) validate() error {
+	if c.DataSourceID <= 0 {
+		return errors.New("请选择执行 SQL 的数据源")
+	}
+	if c.SQL == "" {
+		return errors.New("SQL 不能为空")
+	}
+	return nil
+}
+
+func (c *ShellStepConfig) validate() error {
+	if c.Script == "" {
+		return errors.New("脚本不能为空")
+	}
+	return nil
+}
+
+func marshalStepConfig(cfg any) (string, error) {
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// runSQLStep 在指定 MySQL 数据源上执行 SQL 步骤
+func (s *Scheduler) runSQLStep(ctx context.Context, step models.TaskFlowStep, execID int, executionType string) (string, error) {
+	start := time.Now()
+	fail := func(msg string, err error) (string, error) {
+		s.appendStepLog(step, execID, start, time.Now(), stepStatus(ctx, err), msg, executionType)
+		return msg, err
+	}
+
+	var cfg SQLStepConfig
+	if err := json.Unmarshal([]byte(step.Config), &cfg); err != nil {
+		return fail(fmt.Sprintf("SQL 步骤配置格式不正确: %v", err), err)
+	}
+	if err := cfg.validate(); err != nil {
+		return fail(err.Error(), err)
+	}
+
+	conn, err := datax.GetMySQLConnection(s.db, cfg.DataSourceID)
+	if err != nil {
+		return fail(fmt.Sprintf("获取数据源失败: %v", err), err)
+	}
+	db, err := datax.OpenMySQLMultiStatements(conn)
+	if err != nil {
+		return fail(fmt.Sprintf("连接数据源失败: %v", err), err)
+	}
+	defer db.Close()
+
+	query := processPlaceholders(ctx, cfg.SQL)
+	logText := fmt.Sprintf("数据源: %s/%s\nSQL:\n%s\n\n", conn.Host, conn.DB, query)
+
+	result, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return fail(logText+fmt.Sprintf("执行失败: %v", err), err)
+	}
+	affected, _ := result.RowsAffected()
+	logText += fmt.Sprintf("执行成功，影响行数: %d", affected)
+
+	s.appendStepLog(step, execID, start, time.Now(), "success", logText, executionType)
+	return logText, nil
+}
+
+// runShellStep 在临时工作目录中执行 Shell 脚本。脚本按 ShellRunner 的配置以低权限用户或通过隔离命令运行，
+// 未配置隔离方式时拒绝执行。脚本不继承服务进程的环境变量，未设置步骤超时时使用默认超时，
+// 超时或取消时结束脚本所在的整个进程组。
+func (s *Scheduler) runShellStep(ctx context.Context, step models.TaskFlowStep, execID int, executionType string) (string, error) {
+	start := time.Now()
+	fail := func(msg string, err error) (string, error) {
+		s.appendStepLog(step, execID, start, time.Now(), stepStatus(ctx, err), msg, executionType)
+		return msg, err
+	}
+
+	var cfg ShellStepConfig
+	if err := json.Unmarshal([]byte(step.Config), &cfg); err != nil {
+		return fail(fmt.Sprintf("Shell 步骤配置格式不正确: %v", err), err)
+	}
+	if err := cfg.validate(); err != nil {
+		return fail(err.Error(), err)
+	}
+
+	workDir, err := os.MkdirTemp(s.tempDir, fmt.Sprintf("shell_%d_", step.ID))
+	if err != nil {
+		return fail(fmt.Sprintf("创建工作目录失败: %v", err), err)
+	}
+	defer os.RemoveAll(workDir)
+
+	runCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, defaultShellTimeout)
+		defer cancel()
+	}
+
+	script := processPlaceholders(ctx, cfg.Script)
+	output := &limitedBuffer{limit: maxShellOutput}
+	cmd, err := s.shell.command(runCtx, workDir, script)
+	if err != nil {
+		return fail(fmt.Sprintf("$ %s\n\n执行失败: %v", script, err), err)
+	}
+	cmd.Env = []string{
+		"PATH=" + shellEnvPath,
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"LANG=C.UTF-8",
+		fmt.Sprintf("FLOW_EXECUTION_ID=%d", execID),
+		fmt.Sprintf("STEP_ID=%d", step.ID),
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// 脚本派生的子进程持有输出管道时，超时后最多再等待 10 秒
+	cmd.WaitDelay = 10 * time.Second
+
+	err = cmd.Run()
+	// 脚本结束后仍在后台运行的子进程一并结束
+	killProcessGroup(cmd)
+	logText := fmt.Sprintf("$ %s\n\n%s", script, output.String())
+	if output.truncated {
+		logText += fmt.Sprintf("\n...（输出超过 %d 字节，已截断）", maxShellOutput)
+	}
+	if err != nil {
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			err = errors.New("脚本执行超时")
+		}
+		return fail(logText+fmt.Sprintf("\n执行失败: %v", err), err)
+	}
+
+	s.appendStepLog(step, execID, start, time.Now(), "success", logText, executionType)
+	return logText, nil
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，超出部分丢弃
+type limitedBuffer struct {
+	buf       strings.Builder
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remain := b.limit - b.buf.Len()
+	if remain <= 0 {
+		b.truncated = true
+		return len(p), nil
+	}
+	if len(p) > remain {
+		b.buf.Write(p[:remain])
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// SecretRotationResult 主密钥轮换的统计
+type SecretRotationResult struct {
+	DataSources int // 用当前主密钥重新加密的数据源密码
+	Tasks       int // 内联连接信息替换为引用并生成新版本的任务
+	Versions    int // 清除了内联密码的历史版本
+}
+
+// RotateDataSourceSecrets 用当前主密钥重新加密全部数据源密码，未加密的旧数据一并加密；
+// 同时将任务当前配置中内联的连接信息替换为数据源引用并生成新版本，并清除历史版本中的内联密码。
+// 旧主密钥须在轮换完成后才能从配置中移除。dryRun 为 true 时只统计不写入
+func RotateDataSourceSecrets(db *sql.DB, k *util.Keyring, dryRun bool) (*SecretRotationResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	type dsRow struct {
+		id       int
+		password string
+	}
+	rows, err := tx.Query("SELECT id, COALESCE(db_password,'') FROM data_sources WHERE type='mysql' FOR UPDATE")
+	if err != nil {
+		return nil, fmt.Errorf("查询数据源失败: %v", err)
+	}
+	var sources []dsRow
+	for rows.Next() {
+		var d dsRow
+		if err := rows.Scan(&d.id, &d.password); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sources = append(sources, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &SecretRotationResult{}
+	for _, d := range sources {
+		rewrapped, changed, err := k.Rewrap(d.password)
+		if err != nil {
+			return nil, fmt.Errorf("重新加密数据源 %d 的密码失败: %v", d.id, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE data_sources SET db_password=? WHERE id=?", rewrapped, d.id); err != nil {
+			return nil, fmt.Errorf("更新数据源 %d 失败: %v", d.id, err)
+		}
+		result.DataSources++
+	}
+
+	// 数据源已在本事务中重新加密，比对任务配置时用同一密钥环解密
+	bound, err := bindTaskConfigs(tx, k.Decrypt)
+	if err != nil {
+		return nil, err
+	}
+	result.Tasks = bound.Tasks
+	result.Versions = bound.Versions
+
+	if dryRun {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
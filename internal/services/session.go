@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"com.duole/datax-web-go/internal/models"
+)
+
+// sessionTTL 登录会话的有效期
+const sessionTTL = 7 * 24 * time.Hour
+
+// sessionTouchInterval 最近活动时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// ErrSessionNotFound 表示会话不存在或已失效
+var ErrSessionNotFound = errors.New("会话不存在或已失效")
+
+// execer 可执行 SQL 的数据库句柄或事务
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// hashSessionToken 返回会话令牌的 SHA-256 十六进制哈希。Cookie 中只保存令牌明文，
+// 数据库中只保存哈希，数据库泄露时无法据此冒用会话
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithClientIP 返回携带客户端 IP 的上下文，登录时记录在会话中
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// clientIP 返回请求的客户端 IP，上下文中未设置时使用连接的对端地址
+func clientIP(r *http.Request) string {
+	if ip, _ := r.Context().Value(clientIPKey).(string); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// createSession 为用户创建服务端会话并返回令牌明文，同时清理已过期的会话
+func createSession(db *sql.DB, userID int, ip, userAgent string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	// 过期时间由数据库计算，与查询时比较的 NOW() 使用同一时钟和时区
+	if _, err := db.Exec(`INSERT INTO user_sessions (user_id, token_hash, ip, user_agent, expires_at)
+		VALUES (?, ?, ?, ?, NOW() + INTERVAL ? SECOND)`, userID, hashSessionToken(token), truncate(ip, 45), truncate(userAgent, 255),
+		int(sessionTTL.Seconds())); err != nil {
+		return "", err
+	}
+	if _, err := db.Exec("DELETE FROM user_sessions WHERE expires_at < NOW()"); err != nil {
+		log.Printf("auth: failed to purge expired sessions: %v", err)
+	}
+	return token, nil
+}
+
+// lookupSession 按令牌查找有效的会话。会话已撤销、已过期或用户已禁用、删除时返回 ErrSessionNotFound
+func lookupSession(db *sql.DB, token string) (*SessionUser, error) {
+	var u SessionUser
+	var stale bool
+	err := db.QueryRow(`SELECT s.id, s.last_seen_at < NOW() - INTERVAL ? SECOND,
+		u.id, u.username, u.role, u.must_change_password, u.totp_enabled
+		FROM user_sessions s JOIN users u ON s.user_id = u.id
+		WHERE s.token_hash=? AND s.expires_at > NOW() AND u.disabled=0 AND u.deleted_at IS NULL`,
+		int(sessionTouchInterval.Seconds()), hashSessionToken(token)).
+		Scan(&u.SessionID, &stale, &u.UserID, &u.Username, &u.Role, &u.MustChangePassword, &u.TwoFactorEnabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if stale {
+		if _, err := db.Exec("UPDATE user_sessions SET last_seen_at=NOW() WHERE id=?", u.SessionID); err != nil {
+			log.Printf("auth: failed to touch session %d: %v", u.SessionID, err)
+		}
+	}
+	return &u, nil
+}
+
+// deleteSession 按令牌删除会话，用于登出
+func deleteSession(db *sql.DB, token string) error {
+	_, err := db.Exec("DELETE FROM user_sessions WHERE token_hash=?", hashSessionToken(token))
+	return err
+}
+
+// ListActiveSessions 返回全部未过期的会话，最近活动的在前
+func ListActiveSessions(db *sql.DB) ([]models.UserSession, error) {
+	rows, err := db.Query(`SELECT s.id, s.user_id, u.username, s.ip, s.user_agent, s.created_at, s.last_seen_at, s.expires_at
+		FROM user_sessions s JOIN users u ON s.user_id = u.id
+		WHERE s.expires_at > NOW() AND u.disabled=0 AND u.deleted_at IS NULL
+		ORDER BY s.last_seen_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.UserSession
+	for rows.Next() {
+		var s models.UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Username, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession 撤销指定会话，该会话的下一个请求即需要重新登录。返回会话所属的用户 ID
+func RevokeSession(db *sql.DB, id int) (int, error) {
+	var userID int
+	if err := db.QueryRow("SELECT user_id FROM user_sessions WHERE id=?", id).Scan(&userID); err == sql.ErrNoRows {
+		return 0, ErrSessionNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec("DELETE FROM user_sessions WHERE id=?", id); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// RevokeUserSessions 撤销用户的全部会话，用于禁用、删除用户和修改密码
+func RevokeUserSessions(db execer, userID int) error {
+	_, err := db.Exec("DELETE FROM user_sessions WHERE user_id=?", userID)
+	return err
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+// ErrShellNotSandboxed 未配置 Shell 步骤的隔离方式时拒绝执行脚本
+var ErrShellNotSandboxed = errors.New("未配置 Shell 步骤的隔离方式（shell_steps.run_as_user 或 shell_steps.runner），拒绝执行脚本")
+
+// ShellRunner 决定 Shell 步骤脚本的运行方式：以低权限用户运行、通过隔离命令运行，或两者结合。
+// 脚本在独立的进程组中运行，超时或取消时整个进程组一起结束
+type ShellRunner struct {
+	// 运行脚本的用户，asUser 为 false 时使用服务进程的用户
+	asUser   bool
+	uid, gid uint32
+	// 隔离命令前缀
+	runner []string
+	// 是否允许执行脚本
+	enabled bool
+}
+
+// NewShellRunner 按配置创建 Shell 步骤的运行方式。运行用户必须存在且不能是 root 或服务进程自身的用户，
+// 否则起不到隔离作用
+func NewShellRunner(cfg util.ShellStepsConfig) (*ShellRunner, error) {
+	r := &ShellRunner{runner: cfg.Runner}
+	if cfg.RunAsUser != "" {
+		u, err := user.Lookup(cfg.RunAsUser)
+		if err != nil {
+			return nil, fmt.Errorf("Shell 步骤的运行用户 %s 不存在: %v", cfg.RunAsUser, err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Shell 步骤的运行用户 %s 的 uid 无效: %s", cfg.RunAsUser, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Shell 步骤的运行用户 %s 的 gid 无效: %s", cfg.RunAsUser, u.Gid)
+		}
+		if uid == 0 || int(uid) == os.Geteuid() {
+			return nil, fmt.Errorf("Shell 步骤的运行用户 %s 不能是 root 或服务进程自身的用户", cfg.RunAsUser)
+		}
+		r.asUser, r.uid, r.gid = true, uint32(uid), uint32(gid)
+	}
+	if len(cfg.Runner) > 0 && strings.TrimSpace(cfg.Runner[0]) == "" {
+		return nil, errors.New("Shell 步骤的隔离命令不能为空")
+	}
+	r.enabled = r.asUser || len(r.runner) > 0 || cfg.AllowUnsandboxed
+	return r, nil
+}
+
+// Sandboxed 返回脚本是否以隔离方式运行
+func (r *ShellRunner) Sandboxed() bool {
+	return r != nil && (r.asUser || len(r.runner) > 0)
+}
+
+// command 创建在 workDir 中执行脚本的命令，未配置隔离方式时返回 ErrShellNotSandboxed
+func (r *ShellRunner) command(ctx context.Context, workDir, script string) (*exec.Cmd, error) {
+	if r == nil || !r.enabled {
+		return nil, ErrShellNotSandboxed
+	}
+	args := make([]string, 0, len(r.runner)+3)
+	for _, arg := range r.runner {
+		args = append(args, strings.ReplaceAll(arg, "{workdir}", workDir))
+	}
+	args = append(args, "sh", "-c", script)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = workDir
+	if err := r.prepare(cmd, workDir); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
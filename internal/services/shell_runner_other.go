@@ -0,0 +1,18 @@
+//go:build !unix
+
+package services
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// prepare 当前平台无法隔离脚本和结束进程组，不支持 Shell 步骤
+func (r *ShellRunner) prepare(cmd *exec.Cmd, workDir string) error {
+	return errors.New("当前平台不支持 Shell 步骤")
+}
+
+// killProcessGroup 当前平台不支持进程组
+func killProcessGroup(cmd *exec.Cmd) error {
+	return nil
+}
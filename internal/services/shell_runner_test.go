@@ -0,0 +1,175 @@
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"com.duole/datax-web-go/internal/util"
+)
+
+func TestNewShellRunnerConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       util.ShellStepsConfig
+		wantErr   bool
+		enabled   bool
+		sandboxed bool
+	}{
+		{name: "not configured"},
+		{name: "unsandboxed", cfg: util.ShellStepsConfig{AllowUnsandboxed: true}, enabled: true},
+		{name: "runner", cfg: util.ShellStepsConfig{Runner: []string{"bwrap", "--chdir", "{workdir}"}}, enabled: true, sandboxed: true},
+		{name: "empty runner", cfg: util.ShellStepsConfig{Runner: []string{" "}}, wantErr: true},
+		{name: "unknown user", cfg: util.ShellStepsConfig{RunAsUser: "no-such-user-datax"}, wantErr: true},
+		{name: "root", cfg: util.ShellStepsConfig{RunAsUser: "root"}, wantErr: true},
+	}
+	if u, err := user.LookupId(strconv.Itoa(os.Geteuid())); err == nil && u.Uid != "0" {
+		tests = append(tests, struct {
+			name      string
+			cfg       util.ShellStepsConfig
+			wantErr   bool
+			enabled   bool
+			sandboxed bool
+		}{name: "service user", cfg: util.ShellStepsConfig{RunAsUser: u.Username}, wantErr: true})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewShellRunner(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.enabled != tt.enabled || r.Sandboxed() != tt.sandboxed {
+				t.Fatalf("enabled = %v, sandboxed = %v; want %v, %v", r.enabled, r.Sandboxed(), tt.enabled, tt.sandboxed)
+			}
+		})
+	}
+}
+
+func TestShellRunnerRefusesWithoutSandbox(t *testing.T) {
+	r, err := NewShellRunner(util.ShellStepsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, runner := range []*ShellRunner{nil, r} {
+		if _, err := runner.command(context.Background(), t.TempDir(), "true"); err != ErrShellNotSandboxed {
+			t.Fatalf("command err = %v, want %v", err, ErrShellNotSandboxed)
+		}
+	}
+}
+
+func TestShellRunnerPrefix(t *testing.T) {
+	r, err := NewShellRunner(util.ShellStepsConfig{Runner: []string{"env", "SANDBOX_ROOT={workdir}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	cmd, err := r.command(context.Background(), workDir, `echo "$SANDBOX_ROOT" && pwd`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := workDir + "\n" + workDir + "\n"; string(out) != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestShellRunnerKillsProcessGroup(t *testing.T) {
+	r, err := NewShellRunner(util.ShellStepsConfig{AllowUnsandboxed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	// 后台子进程继承输出管道，只结束 sh 时 Wait 会一直等到 WaitDelay
+	cmd, err := r.command(ctx, workDir, `sleep 60 & echo $! > child.pid; wait`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stdout = &limitedBuffer{limit: 1024}
+	cmd.WaitDelay = 10 * time.Second
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("script finished before the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Run returned after %v, the background child kept the pipe open", elapsed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workDir, "child.pid"))
+	if err != nil {
+		t.Fatalf("read child pid: %v", err)
+	}
+	pid := strings.TrimSpace(string(data))
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("child process %s survived the timeout", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestShellRunnerRunAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("user nobody does not exist")
+	}
+	r, err := NewShellRunner(util.ShellStepsConfig{RunAsUser: "nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与调度器的临时目录一样，工作目录的上级目录需要允许运行用户进入
+	parent, err := os.MkdirTemp("", "datax-shell-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(parent) })
+	if err := os.Chmod(parent, 0755); err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := os.MkdirTemp(parent, "shell_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := r.command(context.Background(), workDir, `id -u && touch out`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != nobody.Uid {
+		t.Fatalf("script ran as uid %s, want %s", got, nobody.Uid)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "out")); err != nil {
+		t.Fatalf("script could not write its work directory: %v", err)
+	}
+}
+
+// processAlive 判断进程是否仍在运行，僵尸进程视为已结束
+func processAlive(pid string) bool {
+	stat, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
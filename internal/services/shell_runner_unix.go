@@ -0,0 +1,39 @@
+//go:build unix
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// prepare 让脚本在独立的进程组中运行，超时或取消时结束整个进程组，避免脚本派生的子进程残留；
+// 配置了运行用户时切换用户并将工作目录交给该用户
+func (r *ShellRunner) prepare(cmd *exec.Cmd, workDir string) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if r.asUser {
+		if err := os.Chown(workDir, int(r.uid), int(r.gid)); err != nil {
+			return fmt.Errorf("设置工作目录的属主失败: %v", err)
+		}
+		// 同时清空附加组，脚本不继承服务进程所属的组
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: r.uid, Gid: r.gid, Groups: []uint32{}}
+	}
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	return nil
+}
+
+// killProcessGroup 结束命令所在的整个进程组
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return err
+}
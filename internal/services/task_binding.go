@@ -0,0 +1,375 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+// TaskBindingResult 将任务配置中内联的连接信息替换为数据源引用的统计
+type TaskBindingResult struct {
+	Tasks    int // 有字段被替换为引用、并因此生成新版本的任务
+	Versions int // 清除了内联密码的历史版本
+}
+
+// RedactedPassword 代替历史版本和页面中内联密码明文的标记
+const RedactedPassword = "******"
+
+// passwordRefPattern 匹配完整的密码引用，引用本身不是密钥，不需要隐藏
+var passwordRefPattern = regexp.MustCompile(`^\$\{ds:\d+\.password\}$`)
+
+// configRow 待处理的任务或任务版本配置
+type configRow struct {
+	id, sourceID, targetID int
+	config                 string
+}
+
+// boundDataSource 数据源当前的连接信息，用于识别任务配置中内联的值
+type boundDataSource struct {
+	mysql *datax.MySQLConnection
+	fs    *datax.FSConnection
+}
+
+// BindTaskDataSourceRefs 将任务当前配置中与源、目标数据源当前配置一致的内联连接信息
+// （用户名、密码、jdbcUrl、defaultFS、hadoopConfig）替换为数据源引用，之后修改数据源即对这些任务生效。
+// 替换后的配置保存为任务的新版本。历史版本同样替换为引用，其余内联密码以 RedactedPassword 代替，
+// 避免能查看版本历史的用户读到旧的明文密码；当前版本与任务配置保持一致，只替换为引用。
+// 加密的数据源密码需要先设置主密钥才能比对。dryRun 为 true 时只统计不写入
+func BindTaskDataSourceRefs(db *sql.DB, dryRun bool) (*TaskBindingResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := bindTaskConfigs(tx, datax.DecryptPassword)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
+
+// bindTaskConfigs 在事务中替换任务配置中的内联连接信息并生成新版本，decrypt 用于解密数据源密码
+func bindTaskConfigs(tx *sql.Tx, decrypt func(string) (string, error)) (*TaskBindingResult, error) {
+	sources, err := loadBoundDataSources(tx, decrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TaskBindingResult{}
+	tasks, err := queryConfigRows(tx, "SELECT id, source_id, target_id, COALESCE(json_config,'') FROM tasks")
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %v", err)
+	}
+	for _, t := range tasks {
+		if config, ok := inlineDataSourceRefs(t.config, sources, t.sourceID, t.targetID); ok {
+			if _, err := SaveTaskConfig(tx, t.id, config, bindVersionComment, 0); err != nil {
+				return nil, fmt.Errorf("更新任务 %d 失败: %v", t.id, err)
+			}
+			result.Tasks++
+		}
+	}
+
+	versions, err := queryConfigRows(tx, `SELECT v.id, t.source_id, t.target_id, COALESCE(v.json_config,'')
+		FROM task_versions v JOIN tasks t ON v.task_id = t.id WHERE v.version <> t.current_version`)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务版本失败: %v", err)
+	}
+	for _, v := range versions {
+		config, bound := inlineDataSourceRefs(v.config, sources, v.sourceID, v.targetID)
+		config, redacted := redactJobPasswords(config)
+		if !bound && !redacted {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE task_versions SET json_config=? WHERE id=?", config, v.id); err != nil {
+			return nil, fmt.Errorf("更新任务版本 %d 失败: %v", v.id, err)
+		}
+		result.Versions++
+	}
+	return result, nil
+}
+
+// bindVersionComment 将内联连接信息替换为引用时生成的版本的变更说明
+const bindVersionComment = "将内联连接信息替换为数据源引用"
+
+// errRedactedPassword 回滚的版本中仍有无法恢复的已隐藏密码
+var errRedactedPassword = errors.New("该版本中的密码已隐藏且无法替换为数据源引用，请回滚后手动填写")
+
+// bindRestoredConfig 将回滚恢复的旧版本配置中的内联连接信息替换为引用，避免把旧版本中的密码明文写回任务；
+// 历史版本中已隐藏的 reader/writer 密码替换为源、目标数据源的密码引用。无法比对时（如缺少主密钥）
+// 只替换已隐藏的密码
+func bindRestoredConfig(tx *sql.Tx, taskID int, config string) (string, error) {
+	var sourceID, targetID int
+	if err := tx.QueryRow("SELECT source_id, target_id FROM tasks WHERE id=?", taskID).Scan(&sourceID, &targetID); err != nil {
+		return "", fmt.Errorf("查询任务失败: %v", err)
+	}
+	if sources, err := loadBoundDataSources(tx, datax.DecryptPassword); err == nil {
+		config, _ = inlineDataSourceRefs(config, sources, sourceID, targetID)
+	}
+	config = restoreRedactedPasswords(config, sourceID, targetID)
+	if strings.Contains(config, `"`+RedactedPassword+`"`) {
+		return "", errRedactedPassword
+	}
+	return config, nil
+}
+
+// RedactConfigPasswords 返回隐藏了内联密码的配置，用于展示版本和审计记录；密码引用保持不变
+func RedactConfigPasswords(config string) string {
+	redacted, _ := redactJobPasswords(config)
+	return redacted
+}
+
+// redactJobPasswords 将配置中任意位置的 password 字段的明文值替换为 RedactedPassword，
+// 返回新配置以及是否有替换。无法解析的配置原样返回
+func redactJobPasswords(config string) (string, bool) {
+	if config == "" {
+		return config, false
+	}
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return config, false
+	}
+	if !redactPasswordValues(job) {
+		return config, false
+	}
+	return encodeJobConfig(job, config)
+}
+
+// redactPasswordValues 递归替换 password 字段的明文值
+func redactPasswordValues(v any) bool {
+	changed := false
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			if strings.EqualFold(k, "password") {
+				if s, ok := val.(string); ok && s != "" && s != RedactedPassword && !passwordRefPattern.MatchString(s) {
+					x[k] = RedactedPassword
+					changed = true
+				}
+				continue
+			}
+			if redactPasswordValues(val) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, item := range x {
+			if redactPasswordValues(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// restoreRedactedPasswords 将 reader/writer 中已隐藏的密码替换为源、目标数据源的密码引用
+func restoreRedactedPasswords(config string, sourceID, targetID int) string {
+	if !strings.Contains(config, RedactedPassword) {
+		return config
+	}
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return config
+	}
+	changed := false
+	for part, id := range map[string]int{"reader": sourceID, "writer": targetID} {
+		p, ok := jobContentPart(job, part)
+		if !ok {
+			continue
+		}
+		param, ok := p["parameter"].(map[string]any)
+		if ok && param["password"] == RedactedPassword && id > 0 {
+			param["password"] = datax.DataSourceRef(id, datax.RefPassword)
+			changed = true
+		}
+	}
+	if !changed {
+		return config
+	}
+	restored, _ := encodeJobConfig(job, config)
+	return restored
+}
+
+// loadBoundDataSources 读取全部数据源当前的连接信息。使用外部密码来源的数据源不批量读取密钥，其内联密码保持不变
+func loadBoundDataSources(tx *sql.Tx, decrypt func(string) (string, error)) (map[int]boundDataSource, error) {
+	rows, err := tx.Query(`SELECT id, type, COALESCE(db_url,''), COALESCE(db_user,''), COALESCE(db_password,''),
+		COALESCE(db_password_ref,''), COALESCE(db_database,''), COALESCE(defaultfs,''), COALESCE(hadoopconfig,'') FROM data_sources`)
+	if err != nil {
+		return nil, fmt.Errorf("查询数据源失败: %v", err)
+	}
+	defer rows.Close()
+
+	sources := make(map[int]boundDataSource)
+	for rows.Next() {
+		var id int
+		var typ, url, user, pass, passRef, database, defaultFS, hadoopConfig string
+		if err := rows.Scan(&id, &typ, &url, &user, &pass, &passRef, &database, &defaultFS, &hadoopConfig); err != nil {
+			return nil, err
+		}
+		if typ != string(datax.DataSourceMySQL) {
+			sources[id] = boundDataSource{fs: &datax.FSConnection{DefaultFS: defaultFS, HadoopConfig: datax.ParseHadoopConfig(hadoopConfig)}}
+			continue
+		}
+		if passRef != "" {
+			pass = ""
+		} else if pass, err = decrypt(pass); err != nil {
+			return nil, fmt.Errorf("解密数据源 %d 的密码失败: %v", id, err)
+		}
+		sources[id] = boundDataSource{mysql: &datax.MySQLConnection{Host: url, User: user, Pass: pass, DB: database}}
+	}
+	return sources, rows.Err()
+}
+
+// queryConfigRows 读取全部结果后再返回，之后才能在同一事务中执行更新
+func queryConfigRows(tx *sql.Tx, query string) ([]configRow, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []configRow
+	for rows.Next() {
+		var r configRow
+		if err := rows.Scan(&r.id, &r.sourceID, &r.targetID, &r.config); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// inlineDataSourceRefs 将 reader/writer 中与源、目标数据源当前配置一致的内联连接信息替换为引用，
+// 返回新配置以及是否有替换。与数据源不一致的值是任务特意填写的，保持不变；无法解析的配置也保持不变
+func inlineDataSourceRefs(config string, sources map[int]boundDataSource, sourceID, targetID int) (string, bool) {
+	if config == "" {
+		return config, false
+	}
+	job, err := decodeJobConfig(config)
+	if err != nil {
+		return config, false
+	}
+	changed := false
+	for part, id := range map[string]int{"reader": sourceID, "writer": targetID} {
+		p, ok := jobContentPart(job, part)
+		if !ok {
+			continue
+		}
+		param, ok := p["parameter"].(map[string]any)
+		if !ok {
+			continue
+		}
+		ds, known := sources[id]
+		if !known {
+			continue
+		}
+		name, _ := p["name"].(string)
+		switch {
+		case strings.HasPrefix(name, "mysql") && ds.mysql != nil:
+			if bindMySQLParam(param, ds.mysql, id) {
+				changed = true
+			}
+		case !strings.HasPrefix(name, "mysql") && ds.fs != nil:
+			if bindFSParam(param, ds.fs, id) {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return config, false
+	}
+	return encodeJobConfig(job, config)
+}
+
+// encodeJobConfig 格式化修改后的配置，失败时返回原配置和 false
+func encodeJobConfig(job map[string]any, original string) (string, bool) {
+	// 不转义 HTML 字符，避免 where 条件中的 < > & 变成 \u003c 等形式
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(job); err != nil {
+		return original, false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// bindMySQLParam 替换 mysqlreader/mysqlwriter 参数中的用户名、密码和 jdbcUrl
+func bindMySQLParam(param map[string]any, conn *datax.MySQLConnection, id int) bool {
+	changed := bindStringParam(param, "username", conn.User, datax.DataSourceRef(id, datax.RefUsername))
+	if bindStringParam(param, "password", conn.Pass, datax.DataSourceRef(id, datax.RefPassword)) {
+		changed = true
+	}
+	jdbcURL, ref := conn.JdbcURL(), datax.DataSourceRef(id, datax.RefJdbcURL)
+	conns, _ := param["connection"].([]any)
+	for _, c := range conns {
+		m, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		// mysqlreader 的 jdbcUrl 为数组，mysqlwriter 为字符串
+		if urls, ok := m["jdbcUrl"].([]any); ok {
+			for i, u := range urls {
+				if u == jdbcURL {
+					urls[i] = ref
+					changed = true
+				}
+			}
+		} else if bindStringParam(m, "jdbcUrl", jdbcURL, ref) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// bindFSParam 替换文件系统 reader/writer 参数中的 defaultFS 和 hadoopConfig
+func bindFSParam(param map[string]any, conn *datax.FSConnection, id int) bool {
+	changed := bindStringParam(param, "defaultFS", conn.DefaultFS, datax.DataSourceRef(id, datax.RefDefaultFS))
+	ref := datax.DataSourceRef(id, datax.RefHadoopConfig)
+	switch inline := param["hadoopConfig"].(type) {
+	case nil:
+		// 数据源没有 hadoopConfig 时旧配置不包含该字段，引用解析为空对象；defaultFS 是特意填写的则不补充
+		if len(conn.HadoopConfig) == 0 && param["defaultFS"] == datax.DataSourceRef(id, datax.RefDefaultFS) {
+			param["hadoopConfig"] = ref
+			changed = true
+		}
+	case map[string]any:
+		if sameHadoopConfig(inline, conn.HadoopConfig) {
+			param["hadoopConfig"] = ref
+			changed = true
+		}
+	}
+	return changed
+}
+
+// bindStringParam 值与数据源当前配置一致且非空时替换为引用
+func bindStringParam(param map[string]any, key, current, ref string) bool {
+	inline, _ := param[key].(string)
+	if inline == "" || inline != current {
+		return false
+	}
+	param[key] = ref
+	return true
+}
+
+// sameHadoopConfig 比较任务中内联的 hadoopConfig 与数据源的配置
+func sameHadoopConfig(inline map[string]any, current map[string]string) bool {
+	if len(inline) != len(current) {
+		return false
+	}
+	for k, v := range inline {
+		s, ok := v.(string)
+		if !ok || current[k] != s {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactConfigPasswords(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string // 脱敏后应包含的片段
+		secret string   // 脱敏后不应出现的明文
+	}{
+		{
+			name:   "reader and writer",
+			config: `{"job":{"content":[{"reader":{"name":"mysqlreader","parameter":{"username":"u","password":"s3cret-r"}},"writer":{"name":"mysqlwriter","parameter":{"password":"s3cret-w"}}}]}}`,
+			want:   []string{`"password": "******"`},
+			secret: "s3cret",
+		},
+		{
+			name:   "nested and later content",
+			config: `{"job":{"content":[{},{"writer":{"parameter":{"connection":[{"Password":"s3cret"}]}}}]}}`,
+			want:   []string{`"Password": "******"`},
+			secret: "s3cret",
+		},
+		{
+			name:   "refs kept",
+			config: `{"job":{"content":[{"reader":{"parameter":{"password":"${ds:3.password}"}}}]}}`,
+			want:   []string{`"password":"${ds:3.password}"`},
+		},
+		{
+			name:   "not json",
+			config: `password=s3cret`,
+			want:   []string{`password=s3cret`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RedactConfigPasswords(tt.config)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Fatalf("RedactConfigPasswords() = %s, want it to contain %s", got, w)
+				}
+			}
+			if tt.secret != "" && strings.Contains(got, tt.secret) {
+				t.Fatalf("RedactConfigPasswords() = %s, plaintext password left", got)
+			}
+		})
+	}
+}
+
+func TestRestoreRedactedPasswords(t *testing.T) {
+	redacted := RedactConfigPasswords(`{"job":{"content":[{"reader":{"name":"mysqlreader","parameter":{"password":"a"}},"writer":{"name":"mysqlwriter","parameter":{"password":"b"}}}]}}`)
+	got := restoreRedactedPasswords(redacted, 3, 4)
+	for _, want := range []string{`"password": "${ds:3.password}"`, `"password": "${ds:4.password}"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("restoreRedactedPasswords() = %s, want it to contain %s", got, want)
+		}
+	}
+	if strings.Contains(got, RedactedPassword) {
+		t.Fatalf("restoreRedactedPasswords() = %s, marker left", got)
+	}
+}
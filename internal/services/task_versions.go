@@ -0,0 +1,147 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"com.duole/datax-web-go/internal/models"
+	"com.duole/datax-web-go/internal/services/datax"
+)
+
+// SaveTaskConfig 更新任务配置并生成一个新的不可变版本，返回新版本号。userID 为 0 表示系统操作。
+// 必须在事务中调用，以保证同一任务的版本号连续且唯一。配置中的数据源引用须符合 datax.CheckDataSourceRefs。
+func SaveTaskConfig(tx *sql.Tx, taskID int, config, comment string, userID int) (int, error) {
+	var current int
+	var scope datax.RefScope
+	err := tx.QueryRow("SELECT current_version, project_id, source_id, target_id FROM tasks WHERE id=? FOR UPDATE", taskID).
+		Scan(&current, &scope.ProjectID, &scope.SourceID, &scope.TargetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.New("任务不存在")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询任务版本失败: %v", err)
+	}
+	if err := datax.CheckDataSourceRefs(tx, config, scope); err != nil {
+		return 0, err
+	}
+
+	var latest int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM task_versions WHERE task_id=?", taskID).Scan(&latest); err != nil {
+		return 0, fmt.Errorf("查询任务版本失败: %v", err)
+	}
+	version := latest + 1
+
+	_, err = tx.Exec(`INSERT INTO task_versions (task_id, version, json_config, comment, created_by)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0))`, taskID, version, config, comment, userID)
+	if err != nil {
+		return 0, fmt.Errorf("保存任务版本失败: %v", err)
+	}
+	_, err = tx.Exec("UPDATE tasks SET json_config=?, current_version=?, updated_by=NULLIF(?, 0) WHERE id=?", config, version, userID, taskID)
+	if err != nil {
+		return 0, fmt.Errorf("更新任务配置失败: %v", err)
+	}
+	return version, nil
+}
+
+// DeleteTask 在事务中删除任务及其配置版本和增量水位，任务不存在时返回 false
+func DeleteTask(tx *sql.Tx, taskID int) (bool, error) {
+	result, err := tx.Exec("DELETE FROM tasks WHERE id=?", taskID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM task_versions WHERE task_id=?", taskID); err != nil {
+		return false, fmt.Errorf("删除任务版本失败: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM task_watermarks WHERE task_id=?", taskID); err != nil {
+		return false, fmt.Errorf("删除增量水位失败: %v", err)
+	}
+	return true, nil
+}
+
+// RollbackTaskConfig 将任务配置回滚到指定版本。回滚不会修改历史，而是以该版本内容生成新版本；
+// 旧版本中内联的连接信息与数据源一致时在新版本中替换为引用，已隐藏的密码替换为数据源的密码引用。
+func RollbackTaskConfig(db *sql.DB, taskID, version, userID int) (int, error) {
+	target, err := GetTaskVersion(db, taskID, version)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	config, err := bindRestoredConfig(tx, taskID, target.JsonConfig)
+	if err != nil {
+		return 0, err
+	}
+	newVersion, err := SaveTaskConfig(tx, taskID, config, fmt.Sprintf("回滚到版本 %d", version), userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+// ListTaskVersions 按版本号倒序列出任务的全部配置版本
+func ListTaskVersions(db *sql.DB, taskID int) ([]models.TaskVersion, error) {
+	rows, err := db.Query(`
+		SELECT v.id, v.task_id, v.version, v.json_config, v.comment, v.created_by, u.username, v.created_at
+		FROM task_versions v
+		LEFT JOIN users u ON v.created_by = u.id
+		WHERE v.task_id=?
+		ORDER BY v.version DESC`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.TaskVersion
+	for rows.Next() {
+		var v models.TaskVersion
+		if err := rows.Scan(&v.ID, &v.TaskID, &v.Version, &v.JsonConfig, &v.Comment, &v.CreatedBy, &v.CreatedByName, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetTaskVersion 查询任务的指定配置版本
+func GetTaskVersion(db *sql.DB, taskID, version int) (*models.TaskVersion, error) {
+	var v models.TaskVersion
+	err := db.QueryRow(`
+		SELECT v.id, v.task_id, v.version, v.json_config, v.comment, v.created_by, u.username, v.created_at
+		FROM task_versions v
+		LEFT JOIN users u ON v.created_by = u.id
+		WHERE v.task_id=? AND v.version=?`, taskID, version).
+		Scan(&v.ID, &v.TaskID, &v.Version, &v.JsonConfig, &v.Comment, &v.CreatedBy, &v.CreatedByName, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("版本 %d 不存在", version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// NormalizeJSON 以固定缩进和键顺序格式化 JSON，便于逐行对比；无法解析时原样返回
+func NormalizeJSON(config string) string {
+	var v any
+	if err := json.Unmarshal([]byte(config), &v); err != nil {
+		return config
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return config
+	}
+	return string(out)
+}
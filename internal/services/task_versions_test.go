@@ -0,0 +1,301 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 数据源 3、4 当前的密码，以及 3 轮换前的旧密码
+const (
+	testSourcePass    = "r-s3cret"
+	testTargetPass    = "w-s3cret"
+	testOldSourcePass = "old-s3cret"
+)
+
+func testTaskConfig(readerPass, writerPass string) string {
+	return fmt.Sprintf(`{"job":{"content":[{"reader":{"name":"mysqlreader","parameter":{"username":"reader","password":%q,`+
+		`"connection":[{"jdbcUrl":["jdbc:mysql://src:3306/app"],"table":["t"]}]}},`+
+		`"writer":{"name":"mysqlwriter","parameter":{"username":"writer","password":%q,`+
+		`"connection":[{"jdbcUrl":"jdbc:mysql://dst:3306/dw","table":["t"]}]}}}]}}`, readerPass, writerPass)
+}
+
+func TestRollbackToPreBindingVersion(t *testing.T) {
+	store := &fakeTaskStore{
+		task: fakeTask{id: 1, projectID: 1, sourceID: 3, targetID: 4, current: 2},
+		sources: []fakeTaskSource{
+			{id: 3, url: "src:3306", user: "reader", pass: testSourcePass, database: "app"},
+			{id: 4, url: "dst:3306", user: "writer", pass: testTargetPass, database: "dw"},
+		},
+		versions: []fakeTaskVersion{
+			// 版本 1 使用数据源 3 轮换前的密码，与数据源不一致，绑定时无法替换为引用
+			{id: 1, version: 1, config: testTaskConfig(testOldSourcePass, testTargetPass)},
+			{id: 2, version: 2, config: testTaskConfig(testSourcePass, testTargetPass)},
+		},
+	}
+	store.task.config = store.versions[1].config
+	db := openFakeTaskStore(t, store)
+
+	result, err := BindTaskDataSourceRefs(db, false)
+	if err != nil {
+		t.Fatalf("BindTaskDataSourceRefs: %v", err)
+	}
+	if result.Tasks != 1 || result.Versions != 2 {
+		t.Fatalf("bind result = %+v, want 1 task and 2 versions", result)
+	}
+	store.assertNoPlaintext(t)
+
+	before := AuditSnapshot(db, AuditTask, 1)
+	version, err := RollbackTaskConfig(db, 1, 1, 0)
+	if err != nil {
+		t.Fatalf("RollbackTaskConfig: %v", err)
+	}
+	if version != 4 || store.task.current != 4 {
+		t.Fatalf("rollback created version %d, task at %d; want 4", version, store.task.current)
+	}
+	store.assertNoPlaintext(t)
+	for _, ref := range []string{"${ds:3.password}", "${ds:4.password}"} {
+		if !strings.Contains(store.task.config, ref) {
+			t.Fatalf("task config after rollback lacks %s:\n%s", ref, store.task.config)
+		}
+	}
+
+	after := AuditSnapshot(db, AuditTask, 1)
+	if after == nil {
+		t.Fatal("AuditSnapshot returned nil")
+	}
+	audit := fmt.Sprint(after, AuditDiff(before, after))
+	for _, secret := range []string{testSourcePass, testTargetPass, testOldSourcePass} {
+		if strings.Contains(audit, secret) {
+			t.Fatalf("audit record contains plaintext password %s:\n%s", secret, audit)
+		}
+	}
+}
+
+func TestRollbackRejectsUnrecoverablePassword(t *testing.T) {
+	// 密码位于 reader/writer 之外时无法替换为引用，回滚应失败而不是写入掩码
+	config := `{"job":{"content":[{},{"reader":{"parameter":{"password":"******"}}}]}}`
+	store := &fakeTaskStore{
+		task:     fakeTask{id: 1, projectID: 1, sourceID: 3, targetID: 4, current: 2, config: testTaskConfig("", "")},
+		versions: []fakeTaskVersion{{id: 1, version: 1, config: config}, {id: 2, version: 2, config: testTaskConfig("", "")}},
+	}
+	db := openFakeTaskStore(t, store)
+	if _, err := RollbackTaskConfig(db, 1, 1, 0); err != errRedactedPassword {
+		t.Fatalf("RollbackTaskConfig err = %v, want %v", err, errRedactedPassword)
+	}
+	if store.task.current != 2 || len(store.versions) != 2 {
+		t.Fatalf("rejected rollback changed the task: current %d, %d versions", store.task.current, len(store.versions))
+	}
+}
+
+func TestDeleteTaskRemovesHistory(t *testing.T) {
+	store := &fakeTaskStore{
+		task:      fakeTask{id: 1, current: 1, config: testTaskConfig("", "")},
+		versions:  []fakeTaskVersion{{id: 1, version: 1, config: testTaskConfig(testOldSourcePass, "")}},
+		watermark: "2024-01-01 00:00:00",
+	}
+	db := openFakeTaskStore(t, store)
+	for i, want := range []bool{true, false} {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted, err := DeleteTask(tx, 1)
+		if err != nil {
+			t.Fatalf("DeleteTask: %v", err)
+		}
+		tx.Commit()
+		if deleted != want {
+			t.Fatalf("delete #%d = %v, want %v", i+1, deleted, want)
+		}
+	}
+	if store.task.id != 0 || len(store.versions) != 0 || store.watermark != "" {
+		t.Fatalf("task %d, %d versions and watermark %q left after delete", store.task.id, len(store.versions), store.watermark)
+	}
+}
+
+// fakeTaskStore 内存中的单个任务及其版本和数据源，通过 database/sql 驱动响应版本管理和审计快照使用的语句。
+// 驱动按语句操作的表识别语句，事务不隔离也不回滚
+type fakeTaskStore struct {
+	mu        sync.Mutex
+	task      fakeTask // id 为 0 表示任务已删除
+	sources   []fakeTaskSource
+	versions  []fakeTaskVersion
+	watermark string
+}
+
+type fakeTask struct {
+	id, projectID, sourceID, targetID, current int
+	config                                     string
+}
+
+type fakeTaskSource struct {
+	id                        int
+	url, user, pass, database string
+}
+
+type fakeTaskVersion struct {
+	id, version int
+	config      string
+}
+
+// assertNoPlaintext 检查任务配置和所有版本中都没有密码明文
+func (s *fakeTaskStore) assertNoPlaintext(t *testing.T) {
+	t.Helper()
+	configs := []string{s.task.config}
+	for _, v := range s.versions {
+		configs = append(configs, v.config)
+	}
+	for _, config := range configs {
+		for _, secret := range []string{testSourcePass, testTargetPass, testOldSourcePass} {
+			if strings.Contains(config, secret) {
+				t.Fatalf("plaintext password %s left in:\n%s", secret, config)
+			}
+		}
+	}
+}
+
+var (
+	fakeTaskStoreOnce     sync.Once
+	fakeTaskStoreMu       sync.Mutex
+	fakeTaskStoreRegistry = map[string]*fakeTaskStore{}
+)
+
+// openFakeTaskStore 返回读写 store 的数据库句柄
+func openFakeTaskStore(t *testing.T, store *fakeTaskStore) *sql.DB {
+	t.Helper()
+	fakeTaskStoreOnce.Do(func() { sql.Register("faketasks", fakeTaskStoreDriver{}) })
+	fakeTaskStoreMu.Lock()
+	fakeTaskStoreRegistry[t.Name()] = store
+	fakeTaskStoreMu.Unlock()
+	db, err := sql.Open("faketasks", t.Name())
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeTaskStoreDriver struct{}
+
+func (fakeTaskStoreDriver) Open(name string) (driver.Conn, error) {
+	fakeTaskStoreMu.Lock()
+	defer fakeTaskStoreMu.Unlock()
+	store, ok := fakeTaskStoreRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %s", name)
+	}
+	return &fakeTaskStoreConn{store: store}, nil
+}
+
+type fakeTaskStoreConn struct{ store *fakeTaskStore }
+
+func (c *fakeTaskStoreConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeTaskStoreStmt{store: c.store, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *fakeTaskStoreConn) Close() error              { return nil }
+func (c *fakeTaskStoreConn) Begin() (driver.Tx, error) { return fakeUsersTx{}, nil }
+
+type fakeTaskStoreStmt struct {
+	store *fakeTaskStore
+	query string
+}
+
+func (s *fakeTaskStoreStmt) Close() error  { return nil }
+func (s *fakeTaskStoreStmt) NumInput() int { return -1 }
+
+func (s *fakeTaskStoreStmt) Exec(args []driver.Value) (driver.Result, error) {
+	st := s.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO task_versions"):
+		v := fakeTaskVersion{id: len(st.versions) + 1, version: int(args[1].(int64)), config: args[2].(string)}
+		st.versions = append(st.versions, v)
+		return fakeUsersResult{id: int64(v.id), affected: 1}, nil
+	case strings.HasPrefix(s.query, "UPDATE task_versions SET json_config"):
+		for i := range st.versions {
+			if int64(st.versions[i].id) == args[1].(int64) {
+				st.versions[i].config = args[0].(string)
+				return fakeUsersResult{affected: 1}, nil
+			}
+		}
+		return fakeUsersResult{}, nil
+	case strings.HasPrefix(s.query, "DELETE FROM tasks"):
+		if st.task.id == 0 || int64(st.task.id) != args[0].(int64) {
+			return fakeUsersResult{}, nil
+		}
+		st.task = fakeTask{}
+		return fakeUsersResult{affected: 1}, nil
+	case strings.HasPrefix(s.query, "DELETE FROM task_versions"):
+		n := len(st.versions)
+		st.versions = nil
+		return fakeUsersResult{affected: int64(n)}, nil
+	case strings.HasPrefix(s.query, "DELETE FROM task_watermarks"):
+		st.watermark = ""
+		return fakeUsersResult{affected: 1}, nil
+	case strings.HasPrefix(s.query, "UPDATE tasks SET json_config"):
+		st.task.config, st.task.current = args[0].(string), int(args[1].(int64))
+		return fakeUsersResult{affected: 1}, nil
+	}
+	return nil, fmt.Errorf("fake db: unsupported exec %q", s.query)
+}
+
+func (s *fakeTaskStoreStmt) Query(args []driver.Value) (driver.Rows, error) {
+	st := s.store
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	task := st.task
+	rows := &fakeUsersRows{}
+	switch {
+	case strings.Contains(s.query, "FROM data_sources"):
+		rows.columns = []string{"id", "type", "db_url", "db_user", "db_password", "db_password_ref", "db_database", "defaultfs", "hadoopconfig"}
+		for _, ds := range st.sources {
+			rows.values = append(rows.values, []driver.Value{int64(ds.id), "mysql", ds.url, ds.user, ds.pass, "", ds.database, "", ""})
+		}
+	case strings.Contains(s.query, "FROM task_versions v JOIN tasks"):
+		rows.columns = []string{"id", "source_id", "target_id", "json_config"}
+		for _, v := range st.versions {
+			if v.version != task.current {
+				rows.values = append(rows.values, []driver.Value{int64(v.id), int64(task.sourceID), int64(task.targetID), v.config})
+			}
+		}
+	case strings.Contains(s.query, "MAX(version)"):
+		latest := 0
+		for _, v := range st.versions {
+			if v.version > latest {
+				latest = v.version
+			}
+		}
+		rows.columns = []string{"latest"}
+		rows.values = [][]driver.Value{{int64(latest)}}
+	case strings.Contains(s.query, "FROM task_versions"):
+		rows.columns = []string{"id", "task_id", "version", "json_config", "comment", "created_by", "username", "created_at"}
+		for _, v := range st.versions {
+			if int64(v.version) == args[1].(int64) {
+				rows.values = append(rows.values, []driver.Value{int64(v.id), int64(task.id), int64(v.version), v.config, "", nil, nil, time.Now()})
+			}
+		}
+	case strings.Contains(s.query, "FROM task_watermarks"):
+		rows.columns = []string{"watermark"}
+	case strings.HasPrefix(s.query, "SELECT * FROM tasks"):
+		rows.columns = []string{"id", "name", "project_id", "source_id", "target_id", "json_config", "current_version"}
+		rows.values = [][]driver.Value{{int64(task.id), "orders", int64(task.projectID), int64(task.sourceID), int64(task.targetID), task.config, int64(task.current)}}
+	case strings.HasPrefix(s.query, "SELECT current_version, project_id, source_id, target_id FROM tasks"):
+		rows.columns = []string{"current_version", "project_id", "source_id", "target_id"}
+		rows.values = [][]driver.Value{{int64(task.current), int64(task.projectID), int64(task.sourceID), int64(task.targetID)}}
+	case strings.HasPrefix(s.query, "SELECT source_id, target_id FROM tasks"):
+		rows.columns = []string{"source_id", "target_id"}
+		rows.values = [][]driver.Value{{int64(task.sourceID), int64(task.targetID)}}
+	case strings.HasPrefix(s.query, "SELECT id, source_id, target_id") && strings.Contains(s.query, "FROM tasks"):
+		rows.columns = []string{"id", "source_id", "target_id", "json_config"}
+		rows.values = [][]driver.Value{{int64(task.id), int64(task.sourceID), int64(task.targetID), task.config}}
+	default:
+		return nil, fmt.Errorf("fake db: unsupported query %q", s.query)
+	}
+	return rows, nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpPeriod 动态验证码的有效周期
+const totpPeriod = 30 * time.Second
+
+// totpSkew 允许的时钟偏差（前后各一个周期）
+const totpSkew = 1
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var (
+	// ErrTwoFactorRequired 表示密码校验通过，还需要输入两步验证码才能完成登录
+	ErrTwoFactorRequired = errors.New("需要两步验证")
+	// ErrInvalidTwoFactorCode 表示两步验证码或恢复码错误、已使用或已过期
+	ErrInvalidTwoFactorCode = errors.New("验证码错误")
+)
+
+// totpOpts 与常见身份验证器应用兼容的参数：SHA1、6 位数字、30 秒周期
+var totpOpts = totp.ValidateOpts{
+	Period:    uint(totpPeriod / time.Second),
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TwoFactorEnrollment 启用两步验证页面展示的信息
+type TwoFactorEnrollment struct {
+	Secret string // Base32 密钥，供无法扫码时手动输入
+	URL    string // otpauth:// 地址
+	QRCode string // 二维码 PNG 的 data URI
+}
+
+// TwoFactorStatus 返回用户是否已启用两步验证以及剩余的恢复码数量
+func TwoFactorStatus(db *sql.DB, userID int) (enabled bool, remaining int, err error) {
+	if err = db.QueryRow("SELECT totp_enabled FROM users WHERE id=?", userID).Scan(&enabled); err != nil {
+		return false, 0, err
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM user_recovery_codes WHERE user_id=? AND used_at IS NULL", userID).Scan(&remaining)
+	return enabled, remaining, err
+}
+
+// BeginTwoFactorEnrollment 为尚未启用两步验证的用户生成密钥（已生成但未确认的密钥沿用），
+// 返回用于扫码的二维码。密钥在 ConfirmTwoFactor 校验验证码后才生效
+func BeginTwoFactorEnrollment(db *sql.DB, userID int, issuer string) (*TwoFactorEnrollment, error) {
+	var username, secret string
+	var enabled bool
+	if err := db.QueryRow("SELECT username, totp_secret, totp_enabled FROM users WHERE id=?", userID).
+		Scan(&username, &secret, &enabled); err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	if secret == "" {
+		buf := make([]byte, 20)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+		if _, err := db.Exec("UPDATE users SET totp_secret=? WHERE id=? AND totp_enabled=0", secret, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + issuer + ":" + username,
+		RawQuery: url.Values{
+			"secret": {secret},
+			"issuer": {issuer},
+		}.Encode(),
+	}
+	key, err := otp.NewKeyFromURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URL:    key.String(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// ConfirmTwoFactor 用验证器应用生成的验证码确认密钥并启用两步验证，返回恢复码明文（只显示一次）
+func ConfirmTwoFactor(db *sql.DB, userID int, code string) ([]string, error) {
+	var secret string
+	var enabled bool
+	if err := db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id=?", userID).Scan(&secret, &enabled); err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	if secret == "" {
+		return nil, errors.New("请先生成密钥")
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE users SET totp_enabled=1, totp_last_step=? WHERE id=?", step, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RegenerateRecoveryCodes 作废原有恢复码并生成新的一组，返回明文（只显示一次）
+func RegenerateRecoveryCodes(db *sql.DB, userID int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// DisableTwoFactor 关闭两步验证，清除密钥和恢复码。用于用户自行关闭和管理员为丢失设备的用户重置
+func DisableTwoFactor(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE users SET totp_enabled=0, totp_secret='', totp_last_step=0 WHERE id=?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id=?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyTwoFactor 校验用户的动态验证码或恢复码。动态验证码每个周期只能使用一次，恢复码只能使用一次
+func VerifyTwoFactor(db *sql.DB, userID int, code string) error {
+	code = strings.TrimSpace(code)
+	var secret string
+	var enabled bool
+	if err := db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id=?", userID).Scan(&secret, &enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrInvalidTwoFactorCode
+	}
+
+	if step, ok := matchTOTP(secret, code, time.Now()); ok {
+		// 只接受比上次使用的周期更新的验证码，防止验证码被截获后重放
+		result, err := db.Exec("UPDATE users SET totp_last_step=? WHERE id=? AND totp_last_step < ?", step, userID, step)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	result, err := db.Exec("UPDATE user_recovery_codes SET used_at=NOW() WHERE user_id=? AND code_hash=? AND used_at IS NULL",
+		userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// matchTOTP 在允许的时钟偏差内查找与 code 匹配的周期序号
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	if len(code) != totpOpts.Digits.Length() {
+		return 0, false
+	}
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i) * totpPeriod)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / int64(totpPeriod/time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// replaceRecoveryCodes 删除用户原有的恢复码并生成新的一组，数据库中只保存哈希
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id=?", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		// 10 位十六进制，分两段便于抄写，如 3f9a2-c71d0
+		raw := hex.EncodeToString(buf)
+		code := raw[:5] + "-" + raw[5:]
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashRecoveryCode(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 返回恢复码的 SHA-256 十六进制哈希，输入时忽略大小写和分隔符
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
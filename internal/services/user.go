@@ -0,0 +1,230 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+)
+
+var (
+	// ErrLastAdmin 表示操作会导致系统中没有启用的管理员
+	ErrLastAdmin = errors.New("不能禁用、降级或删除最后一个启用的管理员")
+	// ErrUserNotFound 表示用户不存在或已删除
+	ErrUserNotFound = errors.New("用户不存在")
+)
+
+// usernamePattern 用户名只允许字母、数字和 . _ @ -，需以字母或数字开头
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+// ValidateUsername 检查用户名格式
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("用户名只能包含字母、数字和 . _ @ -，以字母或数字开头，最长 64 个字符")
+	}
+	return nil
+}
+
+// CheckUsernameAvailable 检查用户名是否可用。已删除用户的用户名保留，以便审计记录和历史对象仍能对应到原用户
+func CheckUsernameAvailable(db *sql.DB, username string) error {
+	var deleted sql.NullTime
+	err := db.QueryRow("SELECT deleted_at FROM users WHERE username=?", username).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if deleted.Valid {
+		return fmt.Errorf("用户名 %s 已被已删除的用户使用", username)
+	}
+	return fmt.Errorf("用户名 %s 已存在", username)
+}
+
+// UserInput 新建或修改用户时可编辑的字段
+type UserInput struct {
+	Role        string
+	DisplayName string
+	Email       string
+	Disabled    bool
+}
+
+// Validate 检查角色、显示名称和邮箱
+func (in *UserInput) Validate() error {
+	if in.Role != "admin" && in.Role != "user" {
+		return fmt.Errorf("无效的角色: %s", in.Role)
+	}
+	if len([]rune(in.DisplayName)) > 100 {
+		return errors.New("显示名称不能超过 100 个字符")
+	}
+	if in.Email != "" {
+		addr, err := mail.ParseAddress(in.Email)
+		if err != nil || addr.Address != in.Email || len(in.Email) > 255 {
+			return fmt.Errorf("无效的邮箱地址: %s", in.Email)
+		}
+	}
+	return nil
+}
+
+// activeAdmin 判断角色和状态是否为启用的管理员
+func activeAdmin(role string, disabled bool) bool {
+	return role == "admin" && !disabled
+}
+
+// lockUser 在事务中锁定未删除的用户并返回其角色和状态
+func lockUser(tx *sql.Tx, id int) (role string, disabled bool, err error) {
+	err = tx.QueryRow("SELECT role, disabled FROM users WHERE id=? AND deleted_at IS NULL FOR UPDATE", id).Scan(&role, &disabled)
+	if err == sql.ErrNoRows {
+		return "", false, ErrUserNotFound
+	}
+	return role, disabled, err
+}
+
+// ensureOtherAdmin 确认除指定用户外还有启用的管理员，查询时锁定这些管理员，避免并发操作同时移除
+func ensureOtherAdmin(tx *sql.Tx, id int) error {
+	rows, err := tx.Query("SELECT id FROM users WHERE role='admin' AND disabled=0 AND deleted_at IS NULL AND id<>? FOR UPDATE", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return ErrLastAdmin
+	}
+	return rows.Err()
+}
+
+// UpdateUser 修改用户的角色、状态、显示名称和邮箱，不允许移除最后一个启用的管理员。
+// 禁用用户时立即撤销其全部会话
+func UpdateUser(db *sql.DB, id int, in UserInput, updatedBy int) error {
+	if err := in.Validate(); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	role, disabled, err := lockUser(tx, id)
+	if err != nil {
+		return err
+	}
+	if activeAdmin(role, disabled) && !activeAdmin(in.Role, in.Disabled) {
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET role=?, disabled=?, display_name=?, email=?, updated_by=? WHERE id=?",
+		in.Role, in.Disabled, in.DisplayName, in.Email, updatedBy, id); err != nil {
+		return err
+	}
+	if in.Disabled {
+		if err := RevokeUserSessions(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// syncUserRole 将外部目录映射的角色同步到用户，与 UpdateUser 一样不允许降级最后一个启用的管理员
+func syncUserRole(db *sql.DB, id int, role string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, disabled, err := lockUser(tx, id)
+	if err != nil {
+		return err
+	}
+	if activeAdmin(current, disabled) && !activeAdmin(role, disabled) {
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET role=? WHERE id=?", role, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ToggleUser 切换用户的启用状态，不允许禁用最后一个启用的管理员。禁用时立即撤销其全部会话
+func ToggleUser(db *sql.DB, id int, updatedBy int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	role, disabled, err := lockUser(tx, id)
+	if err != nil {
+		return err
+	}
+	if activeAdmin(role, disabled) {
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET disabled=1-disabled, updated_by=? WHERE id=?", updatedBy, id); err != nil {
+		return err
+	}
+	if !disabled {
+		if err := RevokeUserSessions(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteUser 软删除用户：其创建的任务和任务流转交给 transferTo，移除项目授权、API 令牌和会话。用户记录保留，以便审计记录和历史对象仍能对应到原用户
+func DeleteUser(db *sql.DB, id, transferTo, deletedBy int) error {
+	if id == transferTo {
+		return errors.New("不能将对象转交给被删除的用户")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	role, disabled, err := lockUser(tx, id)
+	if err != nil {
+		return err
+	}
+	if activeAdmin(role, disabled) {
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+	}
+	var transferDisabled bool
+	if err := tx.QueryRow("SELECT disabled FROM users WHERE id=? AND deleted_at IS NULL", transferTo).Scan(&transferDisabled); err != nil {
+		return errors.New("接收对象的用户不存在")
+	}
+	if transferDisabled {
+		return errors.New("不能将对象转交给已禁用的用户")
+	}
+
+	for _, stmt := range []string{
+		"UPDATE tasks SET created_by=? WHERE created_by=?",
+		"UPDATE task_flows SET created_by=? WHERE created_by=?",
+	} {
+		if _, err := tx.Exec(stmt, transferTo, id); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		"DELETE FROM project_members WHERE user_id=?",
+		"DELETE FROM api_tokens WHERE user_id=?",
+		"DELETE FROM user_sessions WHERE user_id=?",
+		"DELETE FROM user_recovery_codes WHERE user_id=?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET deleted_at=NOW(), disabled=1, updated_by=? WHERE id=?", deletedBy, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
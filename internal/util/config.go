@@ -1,8 +1,11 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -23,6 +26,202 @@ type Config struct {
 	Port       string `yaml:"port"`
 	DataxHome  string `yaml:"datax_home"`
 	TempDir    string `yaml:"temp_dir"`
+	// 信任其 X-Forwarded-For 的反向代理地址或网段，为空时不信任任何代理，客户端 IP 取连接的对端地址
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Git 同步目录，为空表示不启用
+	GitOpsDir           string `yaml:"gitops.dir"`
+	GitOpsSyncOnStartup bool   `yaml:"gitops.sync_on_startup"`
+	// 是否允许同步 Shell 步骤，默认不允许
+	GitOpsAllowShell bool `yaml:"gitops.allow_shell_steps"`
+	// 登录认证方式，按顺序尝试，默认只使用本地账户
+	AuthChain []string   `yaml:"auth.chain"`
+	LDAP      LDAPConfig `yaml:"auth.ldap"`
+	OIDC      OIDCConfig `yaml:"auth.oidc"`
+	// 本地账户的密码策略
+	PasswordPolicy PasswordPolicy `yaml:"auth.password_policy"`
+	// 两步验证
+	TwoFactor TwoFactorConfig `yaml:"auth.two_factor"`
+	// 登录失败锁定
+	Lockout LoginLockoutConfig `yaml:"auth.lockout"`
+	// 数据源密码加密
+	Secrets SecretsConfig `yaml:"secrets"`
+	// Shell 步骤的隔离方式
+	ShellSteps ShellStepsConfig `yaml:"shell_steps"`
+}
+
+// ShellStepsConfig Shell 步骤的隔离配置。未配置 run_as_user 或 runner 时拒绝执行 Shell 步骤，
+// 除非显式开启 allow_unsandboxed
+type ShellStepsConfig struct {
+	// 以该系统用户运行脚本，服务需要以 root 运行或具有 CAP_SETUID 和 CAP_SETGID；
+	// 该用户不应能读取服务的配置文件和数据目录
+	RunAsUser string `yaml:"run_as_user"`
+	// 隔离命令，脚本以 sh -c 的形式追加在其后执行，参数中的 {workdir} 替换为步骤的临时工作目录，
+	// 如 bwrap、nsjail 或 firejail 的命令行
+	Runner []string `yaml:"runner"`
+	// 不做隔离，直接以服务进程的用户运行脚本，仅用于开发环境
+	AllowUnsandboxed bool `yaml:"allow_unsandboxed"`
+}
+
+// SecretsConfig 数据源密码的信封加密配置。主密钥也可以通过环境变量 DATAX_MASTER_KEYS
+// （格式为 ID:密钥,ID:密钥）和 DATAX_ACTIVE_KEY 指定，环境变量优先
+type SecretsConfig struct {
+	// 加密新密码使用的主密钥ID，只有一个主密钥时可以省略
+	ActiveKey string `yaml:"active_key"`
+	// 主密钥ID 到 base64 编码的 32 字节密钥，轮换期间同时保留新旧主密钥
+	MasterKeys map[string]string `yaml:"master_keys"`
+	// 外部密钥来源，数据源可以从中读取密码而不在数据库中保存
+	Providers SecretProvidersConfig `yaml:"providers"`
+}
+
+// SecretProvidersConfig 外部密钥来源配置。数据源的密码来源写作 env:变量名、file:文件名 或 vault:路径#字段，
+// 未配置的来源不可用（环境变量来源始终可用，但只能读取指定前缀的变量）
+type SecretProvidersConfig struct {
+	// 读取到的密码的缓存时间（秒），默认 300
+	CacheTTLSeconds int `yaml:"cache_ttl_seconds"`
+	// 环境变量来源只能读取以此为前缀的变量，避免引用服务自身的配置，默认 DATAX_SECRET_
+	EnvPrefix string `yaml:"env_prefix"`
+	// 文件来源的目录，如挂载的 Kubernetes Secret 卷，每个文件保存一个密码
+	FileDir string `yaml:"file_dir"`
+	// HashiCorp Vault 兼容的 HTTP 接口
+	Vault VaultConfig `yaml:"vault"`
+}
+
+// VaultConfig Vault 密钥来源配置，地址、令牌和命名空间也可以通过 VAULT_ADDR、VAULT_TOKEN、VAULT_NAMESPACE 指定，环境变量优先
+type VaultConfig struct {
+	Address        string `yaml:"address"` // 如 https://vault.example.com:8200
+	Token          string `yaml:"token"`
+	Namespace      string `yaml:"namespace"`       // 企业版命名空间，可选
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // 请求超时，默认 10
+}
+
+// ProviderConfig 返回填充默认值并应用环境变量后的外部密钥来源配置
+func (s SecretsConfig) ProviderConfig() SecretProvidersConfig {
+	p := s.Providers
+	if p.CacheTTLSeconds <= 0 {
+		p.CacheTTLSeconds = 300
+	}
+	if p.EnvPrefix == "" {
+		p.EnvPrefix = "DATAX_SECRET_"
+	}
+	for env, dst := range map[string]*string{"VAULT_ADDR": &p.Vault.Address, "VAULT_TOKEN": &p.Vault.Token, "VAULT_NAMESPACE": &p.Vault.Namespace} {
+		if v := strings.TrimSpace(os.Getenv(env)); v != "" {
+			*dst = v
+		}
+	}
+	if p.Vault.TimeoutSeconds <= 0 {
+		p.Vault.TimeoutSeconds = 10
+	}
+	return p
+}
+
+// Keyring 按配置和环境变量创建主密钥环，未配置主密钥时返回 nil
+func (s SecretsConfig) Keyring() (*Keyring, error) {
+	if err := applySecretsEnv(&s); err != nil {
+		return nil, err
+	}
+	if len(s.MasterKeys) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(s.ActiveKey, s.MasterKeys)
+}
+
+// applySecretsEnv 使用环境变量覆盖主密钥配置
+func applySecretsEnv(s *SecretsConfig) error {
+	if v := strings.TrimSpace(os.Getenv("DATAX_MASTER_KEYS")); v != "" {
+		s.MasterKeys = make(map[string]string)
+		for _, item := range strings.Split(v, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(item), ":")
+			if !ok {
+				return errors.New("DATAX_MASTER_KEYS 格式应为 ID:密钥,ID:密钥")
+			}
+			s.MasterKeys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("DATAX_ACTIVE_KEY")); v != "" {
+		s.ActiveKey = v
+	}
+	return nil
+}
+
+// LoginLockoutConfig 登录失败锁定配置：窗口期内失败次数达到上限后，账户或来源 IP 被临时锁定
+type LoginLockoutConfig struct {
+	MaxFailures    int `yaml:"max_failures"`    // 同一账户的失败次数上限
+	IPMaxFailures  int `yaml:"ip_max_failures"` // 同一来源 IP 的失败次数上限
+	WindowMinutes  int `yaml:"window_minutes"`  // 统计失败次数的窗口期
+	LockoutMinutes int `yaml:"lockout_minutes"` // 锁定时长
+}
+
+// TwoFactorConfig 两步验证（TOTP）配置，任何用户都可以自行启用
+type TwoFactorConfig struct {
+	// 验证器应用中显示的服务名称
+	Issuer string `yaml:"issuer"`
+	// 必须启用两步验证的角色，这些角色的用户登录后须先完成绑定才能继续使用
+	RequiredRoles []string `yaml:"required_roles"`
+}
+
+// PasswordPolicy 设置或修改本地账户密码时的要求
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+}
+
+// MaxPasswordBytes bcrypt 只使用密码的前 72 个字节，更长的密码会被拒绝
+const MaxPasswordBytes = 72
+
+// Validate 校验密码策略。最小长度超过 MaxPasswordBytes 时没有密码能满足策略
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength > MaxPasswordBytes {
+		return fmt.Errorf("password_policy.min_length 不能超过 %d", MaxPasswordBytes)
+	}
+	return nil
+}
+
+// LDAPConfig LDAP / Active Directory 登录配置
+type LDAPConfig struct {
+	URL                string `yaml:"url"` // 如 ldaps://ldap.example.com:636
+	StartTLS           bool   `yaml:"start_tls"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// 用于查找用户的服务账号，为空时匿名查找
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// 查找用户的过滤条件，%s 替换为转义后的用户名
+	UserFilter string `yaml:"user_filter"`
+	// 用户条目中记录所属组的属性，如 memberOf
+	GroupAttribute string `yaml:"group_attribute"`
+	// 目录不支持 memberOf 时按组查找：在 GroupBaseDN 下用 GroupFilter 搜索，%s 替换为用户 DN
+	GroupBaseDN string `yaml:"group_base_dn"`
+	GroupFilter string `yaml:"group_filter"`
+	// 组 DN 到角色（admin 或 user）的映射，同时属于多个组时取权限最高的角色
+	GroupRoles map[string]string `yaml:"group_roles"`
+	// 不属于任何映射组的用户的角色，none 表示拒绝登录
+	DefaultRole string `yaml:"default_role"`
+}
+
+// OIDCConfig OpenID Connect 单点登录配置，Issuer 为空表示不启用
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // 如 https://datax.example.com/login/oidc/callback
+	Scopes       []string `yaml:"scopes"`
+	// 作为用户名的声明，默认 preferred_username
+	UsernameClaim string `yaml:"username_claim"`
+	// 用于映射角色的声明（字符串或字符串数组），默认 groups
+	RoleClaim string `yaml:"role_claim"`
+	// 声明值到角色（admin 或 user）的映射，同时匹配多个值时取权限最高的角色
+	ClaimRoles map[string]string `yaml:"claim_roles"`
+	// 未匹配任何声明值的用户的角色，none 表示拒绝登录
+	DefaultRole string `yaml:"default_role"`
+}
+
+// DSN 返回连接 MySQL 的数据源名称
+func (c *Config) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4&loc=Asia%%2FShanghai",
+		c.DBUser, c.DBPass, c.DBHost, c.DBPort, c.DBName)
 }
 
 // LoadConfigFromYaml 从 YAML 文件读取配置值。
@@ -60,6 +259,23 @@ func loadFromYamlFile(configPath string) (*Config, error) {
 		Port       string `yaml:"port"`
 		DataxHome  string `yaml:"datax_home"`
 		TempDir    string `yaml:"temp_dir"`
+		// 信任的反向代理
+		TrustedProxies []string `yaml:"trusted_proxies"`
+		GitOps         struct {
+			Dir           string `yaml:"dir"`
+			SyncOnStartup *bool  `yaml:"sync_on_startup"`
+			AllowShell    bool   `yaml:"allow_shell_steps"`
+		} `yaml:"gitops"`
+		Auth struct {
+			Chain          []string           `yaml:"chain"`
+			LDAP           LDAPConfig         `yaml:"ldap"`
+			OIDC           OIDCConfig         `yaml:"oidc"`
+			PasswordPolicy PasswordPolicy     `yaml:"password_policy"`
+			TwoFactor      TwoFactorConfig    `yaml:"two_factor"`
+			Lockout        LoginLockoutConfig `yaml:"lockout"`
+		} `yaml:"auth"`
+		Secrets    SecretsConfig    `yaml:"secrets"`
+		ShellSteps ShellStepsConfig `yaml:"shell_steps"`
 	}
 
 	if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
@@ -67,15 +283,25 @@ func loadFromYamlFile(configPath string) (*Config, error) {
 	}
 
 	cfg := &Config{
-		DBHost:     yamlConfig.DB.Host,
-		DBPort:     yamlConfig.DB.Port,
-		DBUser:     yamlConfig.DB.User,
-		DBPass:     yamlConfig.DB.Pass,
-		DBName:     yamlConfig.DB.Name,
-		SessionKey: yamlConfig.SessionKey,
-		Port:       yamlConfig.Port,
-		DataxHome:  yamlConfig.DataxHome,
-		TempDir:    yamlConfig.TempDir,
+		DBHost:         yamlConfig.DB.Host,
+		DBPort:         yamlConfig.DB.Port,
+		DBUser:         yamlConfig.DB.User,
+		DBPass:         yamlConfig.DB.Pass,
+		DBName:         yamlConfig.DB.Name,
+		SessionKey:     yamlConfig.SessionKey,
+		Port:           yamlConfig.Port,
+		DataxHome:      yamlConfig.DataxHome,
+		TempDir:        yamlConfig.TempDir,
+		TrustedProxies: yamlConfig.TrustedProxies,
+		GitOpsDir:      yamlConfig.GitOps.Dir,
+		AuthChain:      yamlConfig.Auth.Chain,
+		LDAP:           yamlConfig.Auth.LDAP,
+		OIDC:           yamlConfig.Auth.OIDC,
+		PasswordPolicy: yamlConfig.Auth.PasswordPolicy,
+		TwoFactor:      yamlConfig.Auth.TwoFactor,
+		Lockout:        yamlConfig.Auth.Lockout,
+		Secrets:        yamlConfig.Secrets,
+		ShellSteps:     yamlConfig.ShellSteps,
 	}
 
 	// 使用默认值填充空字段
@@ -103,6 +329,55 @@ func loadFromYamlFile(configPath string) (*Config, error) {
 	if cfg.TempDir == "" {
 		cfg.TempDir = "/tmp/datax-web"
 	}
+	if len(cfg.AuthChain) == 0 {
+		cfg.AuthChain = []string{"local"}
+	}
+	if cfg.LDAP.UserFilter == "" {
+		cfg.LDAP.UserFilter = "(uid=%s)"
+	}
+	if cfg.LDAP.GroupAttribute == "" {
+		cfg.LDAP.GroupAttribute = "memberOf"
+	}
+	if cfg.LDAP.GroupFilter == "" {
+		cfg.LDAP.GroupFilter = "(member=%s)"
+	}
+	if cfg.LDAP.DefaultRole == "" {
+		cfg.LDAP.DefaultRole = "user"
+	}
+	if cfg.PasswordPolicy.MinLength <= 0 {
+		cfg.PasswordPolicy.MinLength = 8
+	}
+	if cfg.TwoFactor.Issuer == "" {
+		cfg.TwoFactor.Issuer = "DataX-Web"
+	}
+	if cfg.Lockout.MaxFailures <= 0 {
+		cfg.Lockout.MaxFailures = 5
+	}
+	if cfg.Lockout.IPMaxFailures <= 0 {
+		cfg.Lockout.IPMaxFailures = 20
+	}
+	if cfg.Lockout.WindowMinutes <= 0 {
+		cfg.Lockout.WindowMinutes = 15
+	}
+	if cfg.Lockout.LockoutMinutes <= 0 {
+		cfg.Lockout.LockoutMinutes = 15
+	}
+	if len(cfg.OIDC.Scopes) == 0 {
+		cfg.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.OIDC.UsernameClaim == "" {
+		cfg.OIDC.UsernameClaim = "preferred_username"
+	}
+	if cfg.OIDC.RoleClaim == "" {
+		cfg.OIDC.RoleClaim = "groups"
+	}
+	if cfg.OIDC.DefaultRole == "" {
+		cfg.OIDC.DefaultRole = "user"
+	}
+	// 配置了同步目录时默认在启动时同步
+	cfg.GitOpsSyncOnStartup = cfg.GitOpsDir != "" &&
+		(yamlConfig.GitOps.SyncOnStartup == nil || *yamlConfig.GitOps.SyncOnStartup)
+	cfg.GitOpsAllowShell = yamlConfig.GitOps.AllowShell
 
 	return cfg, nil
 }
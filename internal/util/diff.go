@@ -0,0 +1,105 @@
+package util
+
+import "strings"
+
+// 并排对比中每一行的类型
+const (
+	DiffEqual  = "equal"
+	DiffChange = "change"
+	DiffDelete = "delete"
+	DiffInsert = "insert"
+)
+
+// DiffRow 表示并排对比中的一行，行号为 0 表示该侧没有对应内容
+type DiffRow struct {
+	Kind    string
+	LeftNo  int
+	Left    string
+	RightNo int
+	Right   string
+}
+
+// SideBySideDiff 对两段文本按行做最长公共子序列对比，返回并排展示的行。
+// 相邻的删除和新增行会配对为修改行。
+func SideBySideDiff(a, b string) []DiffRow {
+	left := strings.Split(a, "\n")
+	right := strings.Split(b, "\n")
+
+	// 先去掉公共前后缀，缩小 LCS 计算规模
+	prefix := 0
+	for prefix < len(left) && prefix < len(right) && left[prefix] == right[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(left)-prefix && suffix < len(right)-prefix &&
+		left[len(left)-1-suffix] == right[len(right)-1-suffix] {
+		suffix++
+	}
+
+	var rows []DiffRow
+	for i := 0; i < prefix; i++ {
+		rows = append(rows, DiffRow{Kind: DiffEqual, LeftNo: i + 1, Left: left[i], RightNo: i + 1, Right: right[i]})
+	}
+	rows = append(rows, diffMiddle(left[prefix:len(left)-suffix], right[prefix:len(right)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		li := len(left) - suffix + i
+		ri := len(right) - suffix + i
+		rows = append(rows, DiffRow{Kind: DiffEqual, LeftNo: li + 1, Left: left[li], RightNo: ri + 1, Right: right[ri]})
+	}
+	return rows
+}
+
+// diffMiddle 对去掉公共前后缀后的部分计算 LCS，offset 为两侧起始行号偏移
+func diffMiddle(left, right []string, leftOffset, rightOffset int) []DiffRow {
+	n, m := len(left), len(right)
+	// lcs[i][j] 为 left[i:] 与 right[j:] 的最长公共子序列长度
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var rows []DiffRow
+	var deleted, inserted []DiffRow
+	flush := func() {
+		// 将连续的删除和新增配对成修改行
+		k := 0
+		for ; k < len(deleted) && k < len(inserted); k++ {
+			rows = append(rows, DiffRow{Kind: DiffChange,
+				LeftNo: deleted[k].LeftNo, Left: deleted[k].Left,
+				RightNo: inserted[k].RightNo, Right: inserted[k].Right})
+		}
+		rows = append(rows, deleted[k:]...)
+		rows = append(rows, inserted[k:]...)
+		deleted, inserted = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && left[i] == right[j]:
+			flush()
+			rows = append(rows, DiffRow{Kind: DiffEqual, LeftNo: leftOffset + i + 1, Left: left[i], RightNo: rightOffset + j + 1, Right: right[j]})
+			i++
+			j++
+		case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			deleted = append(deleted, DiffRow{Kind: DiffDelete, LeftNo: leftOffset + i + 1, Left: left[i]})
+			i++
+		default:
+			inserted = append(inserted, DiffRow{Kind: DiffInsert, RightNo: rightOffset + j + 1, Right: right[j]})
+			j++
+		}
+	}
+	flush()
+	return rows
+}
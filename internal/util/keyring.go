@@ -0,0 +1,210 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// envelopePrefix 标识经主密钥信封加密的字段值，格式为
+// env:v1:<主密钥ID>:<被主密钥加密的数据密钥>:<被数据密钥加密的明文>
+const envelopePrefix = "env:v1:"
+
+// Keyring 持有一组主密钥，对敏感字段做信封加密：每个值使用随机生成的数据密钥 AES-256-GCM 加密，
+// 数据密钥再由当前主密钥加密后与密文一起保存。轮换主密钥时只需用新主密钥重新加密数据密钥
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring 由主密钥ID到 base64 编码的 32 字节密钥的映射创建密钥环，active 为加密新值使用的主密钥。
+// 只有一个主密钥时 active 可以为空
+func NewKeyring(active string, keys map[string]string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("未配置主密钥")
+	}
+	k := &Keyring{active: active, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("主密钥ID %q 无效，不能为空或包含冒号", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("主密钥 %s 应为 base64 编码的 32 字节密钥", id)
+		}
+		aead, err := newGCM(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if k.active == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("配置了多个主密钥时必须指定当前使用的主密钥")
+		}
+		for id := range keys {
+			k.active = id
+		}
+	}
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("当前主密钥 %s 不在主密钥列表中", k.active)
+	}
+	return k, nil
+}
+
+// ActiveKey 返回加密新值使用的主密钥ID
+func (k *Keyring) ActiveKey() string {
+	return k.active
+}
+
+// KeyIDs 返回全部主密钥ID
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Encrypt 使用新的数据密钥加密明文，数据密钥由当前主密钥加密；空串原样返回
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("生成数据密钥失败: %v", err)
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(data, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+	return k.wrap(k.active, dek, sealed)
+}
+
+// Decrypt 解密 Encrypt 生成的值；不带信封前缀的值视为未加密的旧数据原样返回
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEnveloped(value) {
+		return value, nil
+	}
+	_, dek, sealed, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(data, sealed, nil)
+	if err != nil {
+		return "", errors.New("密文已损坏")
+	}
+	return string(plain), nil
+}
+
+// Rewrap 用当前主密钥重新加密值的数据密钥，密文本身不变；未加密的旧数据直接加密。
+// 返回新值以及是否发生了变化，已使用当前主密钥的值保持不变
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsEnveloped(value) {
+		sealed, err := k.Encrypt(value)
+		return sealed, err == nil, err
+	}
+	keyID, dek, sealed, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.active {
+		return value, false, nil
+	}
+	rewrapped, err := k.wrap(k.active, dek, sealed)
+	return rewrapped, err == nil, err
+}
+
+// wrap 用主密钥加密数据密钥并拼接为信封格式，主密钥ID作为附加数据防止被替换
+func (k *Keyring) wrap(keyID string, dek, sealed []byte) (string, error) {
+	wrapped, err := seal(k.keys[keyID], dek, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + keyID + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrap 解析信封格式并解密数据密钥，返回主密钥ID、数据密钥和被数据密钥加密的密文
+func (k *Keyring) unwrap(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("密文格式不正确")
+	}
+	keyID := parts[0]
+	master, ok := k.keys[keyID]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("缺少主密钥 %s", keyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, errors.New("密文格式不正确")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, errors.New("密文格式不正确")
+	}
+	dek, err := open(master, wrapped, []byte(keyID))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("主密钥 %s 错误或密文已损坏", keyID)
+	}
+	return keyID, dek, sealed, nil
+}
+
+// IsEnveloped 判断值是否为 Keyring 加密后的密文
+func IsEnveloped(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// EnvelopeKeyID 返回加密值使用的主密钥ID，未加密时返回空串
+func EnvelopeKeyID(value string) string {
+	if !IsEnveloped(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, envelopePrefix), ":")
+	return id
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密并在密文前附加随机 nonce
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+// open 解密 seal 生成的数据
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	n := aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("密文格式不正确")
+	}
+	return aead.Open(nil, sealed[:n], sealed[n:], additional)
+}
@@ -11,6 +11,15 @@ import (
 // PathValidator 路径校验器
 type PathValidator struct {
 	hadoopCmd string // hadoop命令路径，默认为"hadoop"
+	dryRun    bool   // 预演模式：只检查路径，不创建
+	checks    []PathCheck
+}
+
+// PathCheck 预演模式下单个路径的检查结果
+type PathCheck struct {
+	Path   string
+	Exists bool
+	Err    error // 检查失败（如 hadoop 命令不可用）时非空
 }
 
 // NewPathValidator 创建路径校验器
@@ -25,10 +34,25 @@ func (pv *PathValidator) SetHadoopCmd(cmd string) {
 	pv.hadoopCmd = cmd
 }
 
+// SetDryRun 设置预演模式。预演模式下只检查路径是否存在，不创建目录，
+// 检查失败也不返回错误，结果通过 Checks 获取
+func (pv *PathValidator) SetDryRun(dryRun bool) {
+	pv.dryRun = dryRun
+}
+
+// Checks 返回预演模式下的路径检查结果
+func (pv *PathValidator) Checks() []PathCheck {
+	return pv.checks
+}
+
 // ValidateAndCreatePath 验证路径是否存在，不存在则创建
 func (pv *PathValidator) ValidateAndCreatePath(fsType, path string) error {
 	// 检查路径是否存在
 	exists, err := pv.checkPathExists(path)
+	if pv.dryRun {
+		pv.checks = append(pv.checks, PathCheck{Path: path, Exists: exists, Err: err})
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("检查路径失败: %v", err)
 	}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedPrefix 标识经 SecretBox 加密的字段值
+const sealedPrefix = "enc:"
+
+// SecretBox 使用口令派生的密钥对敏感字段做 AES-256-GCM 加解密
+type SecretBox struct {
+	aead cipher.AEAD
+	salt []byte
+}
+
+// NewSecretBox 由口令和盐派生密钥；salt 为空时生成新的随机盐
+func NewSecretBox(passphrase string, salt []byte) (*SecretBox, error) {
+	if passphrase == "" {
+		return nil, errors.New("口令不能为空")
+	}
+	if len(salt) == 0 {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("生成随机盐失败: %v", err)
+		}
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead, salt: salt}, nil
+}
+
+// Salt 返回派生密钥使用的盐，解密时需原样提供
+func (b *SecretBox) Salt() []byte {
+	return b.salt
+}
+
+// Seal 加密明文，返回带 enc: 前缀的 base64 字符串；空串原样返回
+func (b *SecretBox) Seal(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密 Seal 生成的字符串；不带 enc: 前缀的值视为明文原样返回
+func (b *SecretBox) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", errors.New("密文格式不正确")
+	}
+	n := b.aead.NonceSize()
+	if len(raw) < n {
+		return "", errors.New("密文格式不正确")
+	}
+	plain, err := b.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return "", errors.New("口令错误或密文已损坏")
+	}
+	return string(plain), nil
+}
+
+// IsSealed 判断值是否为 SecretBox 加密后的密文
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
@@ -1,6 +1,65 @@
 // common.js - 通用前端工具函数
 // 用于减少各页面间的重复代码
 
+/**
+ * CSRF 防护：服务端通过 csrf_token cookie 下发令牌，
+ * 修改数据的请求须在 X-CSRF-Token 请求头或 csrf_token 表单字段中回传
+ */
+function getCSRFToken() {
+  const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+  return match ? decodeURIComponent(match[1]) : '';
+}
+
+function isSafeMethod(method) {
+  return /^(GET|HEAD|OPTIONS)$/i.test(method || 'GET');
+}
+
+(function installCSRFProtection() {
+  // fetch：同源的非 GET 请求自动附加请求头
+  const originalFetch = window.fetch;
+  window.fetch = function (input, init = {}) {
+    const request = input instanceof Request ? input : null;
+    const url = new URL(request ? request.url : input, window.location.href);
+    const method = init.method || (request && request.method) || 'GET';
+    if (url.origin === window.location.origin && !isSafeMethod(method)) {
+      const headers = new Headers(init.headers || (request && request.headers) || {});
+      if (!headers.has('X-CSRF-Token')) {
+        headers.set('X-CSRF-Token', getCSRFToken());
+      }
+      init = { ...init, headers };
+    }
+    return originalFetch.call(this, input, init);
+  };
+
+  // 表单：POST 提交前补充隐藏的 csrf_token 字段
+  function addTokenField(form) {
+    if (isSafeMethod(form.method)) {
+      return;
+    }
+    let field = form.querySelector('input[name="csrf_token"]');
+    if (!field) {
+      field = document.createElement('input');
+      field.type = 'hidden';
+      field.name = 'csrf_token';
+      form.appendChild(field);
+    }
+    field.value = getCSRFToken();
+  }
+
+  document.addEventListener('submit', function (e) {
+    if (e.target instanceof HTMLFormElement) {
+      addTokenField(e.target);
+    }
+  }, true);
+
+  // form.submit() 不会触发 submit 事件，需要单独处理
+  const originalSubmit = HTMLFormElement.prototype.submit;
+  HTMLFormElement.prototype.submit = function () {
+    addTokenField(this);
+    return originalSubmit.call(this);
+  };
+})();
+
 /**
  * 创建表格搜索筛选功能
  * @param {string} tableId - 表格ID
@@ -72,10 +131,12 @@ function createTableFilter(tableId, searchId, filterId, options = {}) {
         });
       }
 
-      // 筛选匹配
+      // 筛选匹配（设置 filterSeparator 时字段可包含多个值）
       if (filter && filterValue) {
         const fieldValue = (row.dataset[config.filterField] || '').toLowerCase();
-        matchesFilter = fieldValue === filterValue;
+        matchesFilter = config.filterSeparator
+          ? fieldValue.split(config.filterSeparator).includes(filterValue)
+          : fieldValue === filterValue;
       }
 
       row.style.display = (matchesSearch && matchesFilter) ? '' : 'none';
@@ -342,8 +403,7 @@ const ValidationRules = {
   // 任务字段规则
   datax_json: { required: true, minLength: 1, label: 'DataX配置' },
   source_id: { required: true, label: '源数据源' },
-  target_id: { required: true, label: '目标数据源' },
-  flow_id: { required: true, label: '任务流' }
+  target_id: { required: true, label: '目标数据源' }
 };
 
 /**
@@ -357,9 +417,12 @@ function validateDataSourceForm(form) {
     Object.assign(rules, {
       db_url: ValidationRules.db_url,
       db_user: ValidationRules.db_user,
-      db_password: ValidationRules.db_password,
       db_database: ValidationRules.db_database
     });
+    // 使用外部密码来源时密码可以留空
+    if (!form.querySelector('[name="db_password_ref"]')?.value.trim()) {
+      rules.db_password = ValidationRules.db_password;
+    }
   } else if (['ofs', 'hdfs', 'cosn'].includes(type)) {
     rules.defaultfs = ValidationRules.defaultfs;
   }
@@ -408,8 +471,7 @@ function validateFormByType(form, type) {
         name: ValidationRules.name,
         datax_json: ValidationRules.datax_json,
         source_id: ValidationRules.source_id,
-        target_id: ValidationRules.target_id,
-        flow_id: ValidationRules.flow_id
+        target_id: ValidationRules.target_id
       });
       break;
     case 'user':
@@ -449,10 +511,12 @@ function normalizeDataSourceFields(ds) {
     id: ds.id || ds.ID,
     name: ds.name || ds.Name,
     type: ds.type || ds.Type,
+    project_id: ds.project_id || ds.ProjectID,
     db_url: ds.db_url || ds.DBURL,
     db_user: ds.db_user || ds.DBUser,
     db_database: ds.db_database || ds.DBDatabase,
     db_password: ds.db_password || ds.DBPassword,
+    db_password_ref: ds.db_password_ref || ds.DBPasswordRef,
     defaultfs: ds.defaultfs || ds.DefaultFS,
     hadoopconfig: ds.hadoopconfig || ds.HadoopConfig
   };
@@ -596,6 +660,32 @@ function confirmDelete(itemName = '该项目') {
   });
 }
 
+/**
+ * 获取对账状态徽章
+ * @param {Object} log - 任务日志（含 reconcile_status/source_rows/target_rows）
+ */
+function getReconcileBadge(log) {
+  const status = log.reconcile_status || 'none';
+  if (status === 'none') return '<span class="text-muted">-</span>';
+  const counts = (log.source_rows != null && log.target_rows != null)
+    ? ` ${log.source_rows}/${log.target_rows}` : '';
+  const badges = {
+    'matched': `<span class="badge badge-success" title="源端/写入行数">一致${counts}</span>`,
+    'mismatched': `<span class="badge badge-danger" title="源端/写入行数">不一致${counts}</span>`,
+    'error': '<span class="badge badge-warning">对账失败</span>'
+  };
+  return badges[status] || '<span class="badge badge-secondary">未知</span>';
+}
+
+/**
+ * 获取执行时使用的任务配置版本链接
+ * @param {Object} log - 任务日志（含 task_id/config_version）
+ */
+function getConfigVersionLink(log) {
+  if (!log.task_id || !log.config_version) return '';
+  return `<a class="badge badge-light" href="/tasks/${log.task_id}/versions" title="执行时使用的配置版本">v${log.config_version}</a>`;
+}
+
 // 全局函数，供模板调用
 window.createTableFilter = createTableFilter;
 window.ModalManager = ModalManager;
@@ -610,6 +700,8 @@ window.showErrors = showErrors;
 window.confirmDelete = confirmDelete;
 window.normalizeDataSourceFields = normalizeDataSourceFields;
 window.showFormErrors = showFormErrors;
+window.getReconcileBadge = getReconcileBadge;
+window.getConfigVersionLink = getConfigVersionLink;
 
 // ========== 公共初始化函数 ==========
 